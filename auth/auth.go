@@ -8,10 +8,14 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+// sessionCookie is the cookie the user's token is stored in
+const sessionCookie = "app_user"
+
 type authRoutes struct {
 	passwordService interfaces.IPasswordService
 	jwtService      interfaces.IJWTService
 	userService     interfaces.IUsersService
+	sessionService  interfaces.ISessionService
 }
 
 type LoginRequest struct {
@@ -23,7 +27,7 @@ func (a *authRoutes) LoginHandler(c *fiber.Ctx) error {
 	user := c.FormValue("username")
 	pass := c.FormValue("password")
 	slog.Info("Login attempt for user", "user", user)
-	dbUser, err := a.userService.GetUserByUsername(user)
+	dbUser, err := a.userService.GetUserByUsername(c.UserContext(), user)
 	if err != nil {
 		slog.Info("Failed login attempt for user", "user", user)
 		c.Redirect("/login?loginError=true")
@@ -42,9 +46,10 @@ func (a *authRoutes) LoginHandler(c *fiber.Ctx) error {
 		c.Redirect("/login?loginError=true")
 		return nil
 	}
+	recordSession(c, a.sessionService, dbUser, interfaces.SessionMethodPassword)
 	// stick the token in the cookie
 	c.Cookie(&fiber.Cookie{
-		Name:     "app_user",
+		Name:     sessionCookie,
 		Value:    token,
 		SameSite: "Strict",
 		HTTPOnly: true,
@@ -57,9 +62,9 @@ func (a *authRoutes) LogoutHandler(c *fiber.Ctx) error {
 	return nil
 }
 
-func RegisterPublicRoutes(router fiber.Router, passwordService interfaces.IPasswordService, userService interfaces.IUsersService, jwtService interfaces.IJWTService) {
+func RegisterPublicRoutes(router fiber.Router, passwordService interfaces.IPasswordService, userService interfaces.IUsersService, jwtService interfaces.IJWTService, sessionService interfaces.ISessionService) {
 	slog.Info("Adding public auth routes", "router", router)
-	authRoutes := authRoutes{passwordService: passwordService, userService: userService, jwtService: jwtService}
+	authRoutes := authRoutes{passwordService: passwordService, userService: userService, jwtService: jwtService, sessionService: sessionService}
 
 	router.Post("/login", authRoutes.LoginHandler)
 
@@ -73,18 +78,120 @@ func RegisterPrivateRoutes(router fiber.Router, passwordService interfaces.IPass
 
 }
 
-func AddJWTAuth(app *fiber.App, settingsService interfaces.ISettingsService) {
-	signingKey, err := settingsService.GetString("jwt_signing_key")
-	if err != nil {
-		slog.Error("Error getting JWT signing key", "error", err)
-		panic(err.Error())
-	}
+// AddJWTAuth requires a valid session token on every following route,
+// the key is looked up per request so a rotated signing key applies without a restart
+// - app: *fiber.App fiber app
+// - jwtService: provides the current signing key
+func AddJWTAuth(app *fiber.App, jwtService interfaces.IJWTService) {
 	app.Use(jwtware.New(jwtware.Config{
-		SigningKey: jwtware.SigningKey{Key: []byte(signingKey)},
+		KeyFunc: jwtService.KeyFunc,
+		Claims:  &interfaces.UserClaims{},
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			slog.Error("JWT Error", "error", err)
 			return c.Redirect("/login")
 		},
-		TokenLookup: "cookie:app_user",
+		TokenLookup: "cookie:" + sessionCookie,
 	}))
 }
+
+// AddClientCertAuth signs in users that present a verified client certificate and have no valid session,
+// the certificate common name is matched against usernames and its email addresses against user emails
+// - app: *fiber.App fiber app
+// - jwtService: used to check the current session and issue a new one
+// - userService: used to find the user a certificate belongs to
+// - sessionService: records the sign in
+func AddClientCertAuth(app *fiber.App, jwtService interfaces.IJWTService, userService interfaces.IUsersService, sessionService interfaces.ISessionService) {
+	app.Use(func(c *fiber.Ctx) error {
+		state := c.Context().TLSConnectionState()
+		if state == nil || len(state.VerifiedChains) == 0 {
+			return c.Next()
+		}
+		if _, err := jwtService.Validate(c.Cookies(sessionCookie)); err == nil {
+			return c.Next()
+		}
+		subject := state.VerifiedChains[0][0]
+		user, err := userService.GetUserByUsername(c.UserContext(), subject.Subject.CommonName)
+		for _, email := range subject.EmailAddresses {
+			if err == nil {
+				break
+			}
+			user, err = userService.GetUserByEmail(c.UserContext(), email)
+		}
+		if err != nil {
+			slog.Warn("Client certificate does not belong to a user", "subject", subject.Subject.String())
+			return c.Next()
+		}
+		token, err := jwtService.Generate(user)
+		if err != nil {
+			slog.Error("Failed to generate token", "error", err)
+			return c.Next()
+		}
+		slog.Info("Signed in with client certificate", "user", user.Username, "subject", subject.Subject.String())
+		recordSession(c, sessionService, user, interfaces.SessionMethodClientCertificate)
+		// the session also authenticates this request so the certificate is only mapped once per session
+		c.Request().Header.SetCookie(sessionCookie, token)
+		c.Cookie(&fiber.Cookie{
+			Name:     sessionCookie,
+			Value:    token,
+			SameSite: "Strict",
+			HTTPOnly: true,
+		})
+		return c.Next()
+	})
+}
+
+// recordSession records a sign in, a failure is logged rather than refusing the sign in
+func recordSession(c *fiber.Ctx, sessionService interfaces.ISessionService, user *interfaces.User, method string) {
+	if err := sessionService.Record(c.UserContext(), user.ID, method, c.IP(), c.Get(fiber.HeaderUserAgent)); err != nil {
+		slog.Error("Failed to record session", "user", user.Username, "error", err)
+	}
+}
+
+// RequireRole returns a handler that only allows users with the given role to continue,
+// it must be added after AddCurrentUser so the stored role is checked rather than the one in the token
+// - role: the role the user must have
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := CurrentUser(c)
+		if user == nil || user.Role != role {
+			return c.Redirect("/403")
+		}
+		return c.Next()
+	}
+}
+
+const currentUserLocal = "User"
+
+// AddCurrentUser loads the logged in user from the users service on every request and exposes it to handlers
+// and views as the User local, so role changes and deletions apply without waiting for the token to expire
+// - jwtService: used to read the user ID from the token claims
+// - userService: used to load the stored user
+func AddCurrentUser(app *fiber.App, jwtService interfaces.IJWTService, userService interfaces.IUsersService) {
+	app.Use(func(c *fiber.Ctx) error {
+		claimsUser, err := jwtService.UserFromClaims(c)
+		if err != nil || claimsUser == nil {
+			slog.Warn("Authenticated request has unusable claims", "error", err)
+			return expireSession(c)
+		}
+		user, err := userService.GetUserByID(c.UserContext(), claimsUser.ID)
+		if err != nil {
+			slog.Warn("Authenticated user could not be loaded", "id", claimsUser.ID, "error", err)
+			return expireSession(c)
+		}
+		c.Locals(currentUserLocal, user)
+		return c.Next()
+	})
+}
+
+// expireSession clears the session cookie and sends the user back to the login page
+func expireSession(c *fiber.Ctx) error {
+	c.ClearCookie(sessionCookie)
+	return c.Redirect("/login")
+}
+
+// CurrentUser returns the user loaded by AddCurrentUser
+// Returns nil when the request is not authenticated
+func CurrentUser(c *fiber.Ctx) *interfaces.User {
+	user, _ := c.Locals(currentUserLocal).(*interfaces.User)
+	return user
+}
@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// RunBackup runs the backup command, the backup is written to the backup path unless an output file is given
+// - args: arguments after "backup"
+// - backupService: takes the backup
+// - defaults: whether backups are compressed and encrypted unless the flags say otherwise
+// - stdout: where the backup is written with -o -, otherwise where its path is printed
+func RunBackup(ctx context.Context, args []string, backupService interfaces.IBackupService, defaults interfaces.BackupOptions, stdout io.Writer) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("o", "", "file the backup is written to, - for stdout")
+	compress := flags.Bool("compress", defaults.Compress, "gzip compress the backup")
+	encrypt := flags.Bool("encrypt", defaults.Encrypt, "encrypt the backup with the key encryption key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: backup [-o file] [-compress=true|false] [-encrypt=true|false]")
+	}
+	options := interfaces.BackupOptions{Compress: *compress, Encrypt: *encrypt}
+	switch *output {
+	case "":
+		path, err := backupService.BackupToPath(ctx, options)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, path)
+		return nil
+	case "-":
+		return backupService.Backup(ctx, stdout, options)
+	default:
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		if err := backupService.Backup(ctx, file, options); err != nil {
+			file.Close()
+			os.Remove(*output)
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, *output)
+		return nil
+	}
+}
+
+// RunRestore runs the restore command, it fails with ErrDatabaseInUse unless the server is stopped
+// - args: arguments after "restore"
+// - backupService: replaces the database
+// - stdin: where the backup is read from with -
+// - stdout: where the result is printed
+func RunRestore(ctx context.Context, args []string, backupService interfaces.IBackupService, stdin io.Reader, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: restore <file>, - reads the backup from stdin, the server must be stopped first")
+	}
+	input := stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	err := backupService.Restore(ctx, input)
+	if errors.Is(err, interfaces.ErrDatabaseInUse) {
+		return fmt.Errorf("%w, stop the server before restoring", err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "restored %s\n", args[0])
+	return nil
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"gopkg.in/yaml.v3"
+)
+
+// RunConfig runs the config subcommands
+// - args: arguments after "config"
+// - config: the loaded configuration
+// - stdout: where the configuration is printed
+func RunConfig(args []string, config interfaces.IConfig, stdout io.Writer) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New("usage: config print")
+	}
+	return printConfig(config, stdout)
+}
+
+// printConfig writes the effective configuration as YAML nested the same way as config.yaml
+func printConfig(config interfaces.IConfig, stdout io.Writer) error {
+	document := map[string]interface{}{}
+	for key, value := range config.GetRedactedSettings() {
+		if duration, ok := value.(time.Duration); ok {
+			value = duration.String()
+		}
+		parts := strings.Split(key, ".")
+		section := document
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := section[part].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				section[part] = child
+			}
+			section = child
+		}
+		section[parts[len(parts)-1]] = value
+	}
+	encoder := yaml.NewEncoder(stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return fmt.Errorf("failed to print config: %w", err)
+	}
+	return encoder.Close()
+}
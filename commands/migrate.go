@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+const migrateUsage = "usage: migrate status|up [version]|down [version]|redo|create [-dir dir] <name> [-dry-run]"
+
+// RunMigrate runs the migrate subcommands
+// - args: arguments after "migrate"
+// - migrator: applies and rolls back the migrations
+// - stdout: where the status and the migrations run are written
+func RunMigrate(ctx context.Context, args []string, migrator interfaces.IMigrator, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "show what would run without running it")
+	dir := flags.String("dir", "database/migrations", "directory new migrations are created in")
+	positional, err := parseInterspersed(flags, args[1:])
+	if err != nil {
+		return err
+	}
+
+	var steps []interfaces.MigrationStep
+	switch {
+	case args[0] == "status" && len(positional) == 0:
+		return writeStatus(ctx, migrator, stdout)
+	case args[0] == "create" && len(positional) == 1:
+		path, err := migrator.Create(*dir, positional[0], *dryRun)
+		if err != nil {
+			return err
+		}
+		if *dryRun {
+			fmt.Fprintf(stdout, "would create %s\n", path)
+		} else {
+			fmt.Fprintf(stdout, "created %s\n", path)
+		}
+		return nil
+	case args[0] == "up" && len(positional) == 0:
+		steps, err = migrator.Up(ctx, *dryRun)
+	case args[0] == "down" && len(positional) == 0:
+		steps, err = migrator.Down(ctx, *dryRun)
+	case args[0] == "redo" && len(positional) == 0:
+		steps, err = migrator.Redo(ctx, *dryRun)
+	case (args[0] == "up" || args[0] == "down") && len(positional) == 1:
+		version, parseErr := strconv.ParseInt(positional[0], 10, 64)
+		if parseErr != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", positional[0])
+		}
+		if args[0] == "up" {
+			steps, err = migrator.UpTo(ctx, version, *dryRun)
+		} else {
+			steps, err = migrator.DownTo(ctx, version, *dryRun)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	writeSteps(stdout, steps, *dryRun)
+	return err
+}
+
+// parseInterspersed parses flags that come before, between or after the positional arguments
+// Returns the positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// writeStatus prints every known migration and when it was applied
+func writeStatus(ctx context.Context, migrator interfaces.IMigrator, stdout io.Writer) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "VERSION\tMIGRATION\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.Applied {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(table, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	return table.Flush()
+}
+
+// writeSteps prints the migrations that were applied or rolled back, or that would be in a dry run
+func writeSteps(w io.Writer, steps []interfaces.MigrationStep, dryRun bool) {
+	if len(steps) == 0 {
+		fmt.Fprintln(w, "nothing to migrate")
+		return
+	}
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, step := range steps {
+		if dryRun {
+			fmt.Fprintf(table, "would %s\t%d\t%s\n", step.Direction, step.Version, step.Name)
+		} else {
+			fmt.Fprintf(table, "%s\t%d\t%s\t%s\n", step.Direction, step.Version, step.Name, step.Duration.Round(time.Millisecond))
+		}
+	}
+	table.Flush()
+}
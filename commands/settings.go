@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// cliActor is recorded in the setting history for changes made from the command line
+var cliActor = interfaces.SettingActor{Username: "cli"}
+
+// RunSettings runs the settings export and import subcommands
+// - args: arguments after "settings"
+// - bulkService: service used to export and import settings
+// - stdout: where exports and import diffs are written
+func RunSettings(ctx context.Context, args []string, bulkService interfaces.ISettingsBulkService, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: settings export|import [flags]")
+	}
+	switch args[0] {
+	case "export":
+		return exportSettings(ctx, args[1:], bulkService, stdout)
+	case "import":
+		return importSettings(ctx, args[1:], bulkService, stdout)
+	default:
+		return fmt.Errorf("unknown settings command %q", args[0])
+	}
+}
+
+func exportSettings(ctx context.Context, args []string, bulkService interfaces.ISettingsBulkService, stdout io.Writer) error {
+	flags := flag.NewFlagSet("settings export", flag.ContinueOnError)
+	format := flags.String("format", interfaces.ImportFormatYAML, "export format, yaml or json")
+	out := flags.String("out", "", "file to write, defaults to stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return bulkService.ExportSettings(ctx, *format, stdout)
+	}
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := bulkService.ExportSettings(ctx, *format, file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func importSettings(ctx context.Context, args []string, bulkService interfaces.ISettingsBulkService, stdout io.Writer) error {
+	flags := flag.NewFlagSet("settings import", flag.ContinueOnError)
+	format := flags.String("format", "", "import format, yaml or json, detected from the file extension by default")
+	apply := flags.Bool("apply", false, "apply the changes instead of only showing the diff")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: settings import [-format yaml|json] [-apply] <file>")
+	}
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = interfaces.ImportFormatYAML
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			*format = interfaces.ImportFormatJSON
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var rows []interfaces.SettingImportRow
+	if *apply {
+		// the diff is printed by the same run that applies it, there is no earlier preview to hold it to
+		rows, err = bulkService.ApplyImport(ctx, *format, data, nil, cliActor)
+	} else {
+		rows, err = bulkService.PreviewImport(ctx, *format, data)
+	}
+	if rows != nil {
+		writeDiff(stdout, rows)
+	}
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if row.Error != "" {
+			return interfaces.ErrImportInvalid
+		}
+	}
+	if !*apply {
+		fmt.Fprintln(stdout, "dry run, pass -apply to save the changes")
+	}
+	return nil
+}
+
+// writeDiff prints one line per imported setting, marking changed settings with ~ and invalid ones with !
+func writeDiff(w io.Writer, rows []interfaces.SettingImportRow) {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		switch {
+		case row.Error != "":
+			fmt.Fprintf(table, "!\t%s\t%s\n", row.Key, row.Error)
+		case row.Changed:
+			fmt.Fprintf(table, "~\t%s\t%q -> %q\n", row.Key, row.Current, row.New)
+		default:
+			fmt.Fprintf(table, " \t%s\tunchanged\n", row.Key)
+		}
+	}
+	table.Flush()
+}
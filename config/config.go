@@ -5,72 +5,297 @@ import (
 	"log/slog"
 	"os"
 	"path"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 const (
-	databasePathkey      = "database.path"
-	serverPortKey        = "server.port"
-	serverAddressKey     = "server.address"
-	serverTLSEnabledKey  = "server.tls.enabled"
-	serverTLSCertKey     = "server.tls.cert"
-	serverTLSCertPathKey = "server.tls.cert_path"
-	serverTLSKeyKey      = "server.tls.key"
-	serverTLSKeyPathKey  = "server.tls.key_path"
-	serverTLSCaKey       = "server.tls.ca"
-	serverTLSCaPathKey   = "server.tls.ca_path"
+	databasePathkey         = "database.path"
+	databaseDriverKey       = "database.driver"
+	databaseDSNKey          = "database.dsn"
+	databaseMaxOpenKey      = "database.max_open_conns"
+	databaseMaxIdleKey      = "database.max_idle_conns"
+	databaseLifetimeKey     = "database.conn_max_lifetime"
+	databaseIdleTimeKey     = "database.conn_max_idle_time"
+	databaseAutoMigrate     = "database.auto_migrate"
+	databaseQueryTimeoutKey = "database.query_timeout"
+	sqliteJournalModeKey    = "database.sqlite.journal_mode"
+	sqliteSynchronousKey    = "database.sqlite.synchronous"
+	sqliteBusyTimeoutKey    = "database.sqlite.busy_timeout"
+	sqliteForeignKeysKey    = "database.sqlite.foreign_keys"
+	sqliteReadConnsKey      = "database.sqlite.read_conns"
+	serverPortKey           = "server.port"
+	serverAddressKey        = "server.address"
+	serverTLSEnabledKey     = "server.tls.enabled"
+	serverTLSCertKey        = interfaces.ConfigKeyServerTLSCert
+	serverTLSCertPathKey    = interfaces.ConfigKeyServerTLSCertPath
+	serverTLSKeyKey         = interfaces.ConfigKeyServerTLSKey
+	serverTLSKeyPathKey     = interfaces.ConfigKeyServerTLSKeyPath
+	serverTLSCaKey          = interfaces.ConfigKeyServerTLSCA
+	serverTLSCaPathKey      = interfaces.ConfigKeyServerTLSCAPath
+	serverTLSClientAuth     = interfaces.ConfigKeyServerTLSClientAuth
+	storagePathKey          = "storage.path"
+	deletionGraceKey        = "privacy.deletion_grace_period"
+	deletionIntervalKey     = "privacy.deletion_interval"
+	secretsKeyKey           = "secrets.key"
+	secretsKeyPathKey       = "secrets.key_path"
+	secretsPreviousKey      = "secrets.previous_keys"
+	settingsPollKey         = "settings.poll_interval"
+	backupPathKey           = "backup.path"
+	backupIntervalKey       = "backup.interval"
+	backupRetentionKey      = "backup.retention"
+	backupCompressKey       = "backup.compress"
+	backupEncryptKey        = "backup.encrypt"
+	logFormatKey            = "log.format"
+	viewsPathKey            = "views.path"
+	jwtLifetimeKey          = "auth.jwt_lifetime"
+	csrfExpirationKey       = "server.csrf.expiration"
+	cacheExpirationKey      = "server.cache.expiration"
+	cacheControlKey         = "server.cache.control"
+	argon2TimeKey           = "password.argon2.time"
+	argon2MemoryKey         = "password.argon2.memory"
+	argon2ThreadsKey        = "password.argon2.threads"
+	argon2KeyLengthKey      = "password.argon2.key_length"
+	argon2SaltLengthKey     = "password.argon2.salt_length"
+	mailFromKey             = "mail.from"
+	mailLogKey              = "mail.log"
+	smtpHostKey             = "mail.smtp.host"
+	smtpPortKey             = "mail.smtp.port"
+	smtpUsernameKey         = "mail.smtp.username"
+	smtpPasswordKey         = "mail.smtp.password"
+	smtpTLSKey              = "mail.smtp.tls"
 )
 
+// secretKeys are redacted when the configuration is printed, APP_SECRETS_KEY supplies the key encryption key
+// without writing it to disk and APP_SECRETS_PREVIOUS_KEYS holds whitespace separated retired keys during a rotation
+var secretKeys = map[string]bool{
+	// a data source name can hold the database password
+	databaseDSNKey:     true,
+	secretsKeyKey:      true,
+	secretsPreviousKey: true,
+	serverTLSKeyKey:    true,
+	smtpPasswordKey:    true,
+}
+
 type viperConfig struct {
-	viper *viper.Viper
+	// current is replaced as a whole when the config file changes so readers never see a partial update
+	current atomic.Pointer[viper.Viper]
+	// defaults holds the default of every known key, its type is the type the key is validated against
+	defaults map[string]interface{}
+	// flags are parsed once and applied again whenever the configuration is rebuilt
+	flags *pflag.FlagSet
 }
 
-// NewViperConfig creates a new viperConfig instance
-func NewViperConfig() interfaces.IConfig {
-	config := viperConfig{viper: viper.New()}
+// NewViperConfig loads the configuration, each source overrides the ones before it:
+//   - the defaults
+//   - the file given by --config, or the first config.yaml found in ., ./config,
+//     $HOME/.config/gofiber-pug-starter and /etc/gofiber-pug-starter
+//   - environment variables named after the key with an APP_ prefix, like APP_SERVER_PORT for server.port
+//   - command line flags named after the key, like --server.port=8443
+//
+// - args: the command line arguments without the program name, flags end at the first argument that is not a flag
+// Returns the config and the arguments after the flags, or an error if a source cannot be read or a value is invalid
+func NewViperConfig(args []string) (interfaces.IConfig, []string, error) {
+	config := &viperConfig{defaults: map[string]interface{}{}}
 	config.setDefaults()
-	config.initialize()
-	return &config
+	config.flags = config.buildFlags()
+	if err := config.flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	v, err := config.build()
+	if err != nil {
+		return nil, nil, err
+	}
+	config.current.Store(v)
+	return config, config.flags.Args(), nil
 }
 
-func (c *viperConfig) setDefaults() {
-	c.viper.SetDefault(databasePathkey, path.Join("data", "db.sqlite"))
-	c.viper.SetDefault(serverPortKey, 8080)
-	c.viper.SetDefault(serverAddressKey, "localhost")
-	c.viper.SetDefault(serverTLSEnabledKey, false)
-	c.viper.SetDefault(serverTLSCertKey, "")
-	c.viper.SetDefault(serverTLSCertPathKey, "")
-	c.viper.SetDefault(serverTLSKeyKey, "")
-	c.viper.SetDefault(serverTLSKeyPathKey, "")
-	c.viper.SetDefault(serverTLSCaKey, "")
-	c.viper.SetDefault(serverTLSCaPathKey, "")
+// v returns the current configuration
+func (c *viperConfig) v() *viper.Viper {
+	return c.current.Load()
 }
 
-func (c *viperConfig) initialize() {
-	c.viper.SetConfigName("config")
-	c.viper.SetConfigType("yaml")
-	c.viper.AddConfigPath(".")
-	c.viper.AutomaticEnv()
+func (c *viperConfig) setDefault(key string, value interface{}) {
+	c.defaults[key] = value
+}
+
+func (c *viperConfig) setDefaults() {
+	c.setDefault(databasePathkey, path.Join("data", "db.sqlite"))
+	c.setDefault(databaseDriverKey, interfaces.DatabaseDriverSQLite)
+	c.setDefault(databaseDSNKey, "")
+	c.setDefault(databaseMaxOpenKey, 0)
+	// matches database/sql, which keeps 2 idle connections unless told otherwise
+	c.setDefault(databaseMaxIdleKey, 2)
+	c.setDefault(databaseLifetimeKey, time.Duration(0))
+	c.setDefault(databaseIdleTimeKey, time.Duration(0))
+	c.setDefault(databaseAutoMigrate, true)
+	c.setDefault(databaseQueryTimeoutKey, 10*time.Second)
+	c.setDefault(sqliteJournalModeKey, "WAL")
+	c.setDefault(sqliteSynchronousKey, "NORMAL")
+	c.setDefault(sqliteBusyTimeoutKey, 5*time.Second)
+	c.setDefault(sqliteForeignKeysKey, true)
+	c.setDefault(sqliteReadConnsKey, 4)
+	c.setDefault(serverPortKey, 8080)
+	c.setDefault(serverAddressKey, "localhost")
+	c.setDefault(serverTLSEnabledKey, false)
+	c.setDefault(serverTLSCertKey, "")
+	c.setDefault(serverTLSCertPathKey, "")
+	c.setDefault(serverTLSKeyKey, "")
+	c.setDefault(serverTLSKeyPathKey, "")
+	c.setDefault(serverTLSCaKey, "")
+	c.setDefault(serverTLSCaPathKey, "")
+	c.setDefault(serverTLSClientAuth, "none")
+	c.setDefault(storagePathKey, path.Join("data", "blobs"))
+	c.setDefault(deletionGraceKey, 30*24*time.Hour)
+	c.setDefault(deletionIntervalKey, time.Hour)
+	c.setDefault(secretsKeyKey, "")
+	// no default, a key file next to the database would be copied along with it
+	c.setDefault(secretsKeyPathKey, "")
+	c.setDefault(secretsPreviousKey, []string{})
+	c.setDefault(settingsPollKey, 30*time.Second)
+	c.setDefault(backupPathKey, path.Join("data", "backups"))
+	c.setDefault(backupIntervalKey, time.Duration(0))
+	c.setDefault(backupRetentionKey, 7)
+	c.setDefault(backupCompressKey, true)
+	c.setDefault(backupEncryptKey, true)
+	c.setDefault(interfaces.ConfigKeyLogLevel, "debug")
+	c.setDefault(interfaces.ConfigKeyCORSAllowOrigins, []string{"*"})
+	c.setDefault(interfaces.ConfigKeyRateLimitMax, 300)
+	c.setDefault(interfaces.ConfigKeyRateLimitWindow, time.Minute)
+	c.setDefault(interfaces.ConfigKeyCORSAllowMethods, []string{"GET", "POST", "HEAD", "PUT", "DELETE", "PATCH"})
+	c.setDefault(interfaces.ConfigKeyCORSAllowHeaders, []string{})
+	c.setDefault(interfaces.ConfigKeyCORSAllowCredentials, false)
+	c.setDefault(interfaces.ConfigKeyCORSMaxAge, time.Duration(0))
+	c.setDefault(logFormatKey, "json")
+	c.setDefault(viewsPathKey, "views")
+	c.setDefault(jwtLifetimeKey, 72*time.Hour)
+	c.setDefault(csrfExpirationKey, time.Hour)
+	c.setDefault(cacheExpirationKey, time.Minute)
+	c.setDefault(cacheControlKey, false)
+	// the parameters passwords were hashed with before they were stored in the hash
+	c.setDefault(argon2TimeKey, 1)
+	c.setDefault(argon2MemoryKey, 64*1024)
+	c.setDefault(argon2ThreadsKey, 4)
+	c.setDefault(argon2KeyLengthKey, 32)
+	c.setDefault(argon2SaltLengthKey, 16)
+	c.setDefault(mailFromKey, "")
+	c.setDefault(mailLogKey, false)
+	c.setDefault(smtpHostKey, "")
+	c.setDefault(smtpPortKey, 587)
+	c.setDefault(smtpUsernameKey, "")
+	c.setDefault(smtpPasswordKey, "")
+	c.setDefault(smtpTLSKey, interfaces.SMTPTLSStartTLS)
 }
 
 // GetDatabasePath returns the database path
 func (c *viperConfig) GetDatabasePath() string {
-	return c.viper.GetString(databasePathkey)
+	return c.v().GetString(databasePathkey)
+}
+
+// GetDatabaseDriver returns sqlite, postgres or mysql
+func (c *viperConfig) GetDatabaseDriver() string {
+	return c.v().GetString(databaseDriverKey)
+}
+
+// GetDatabaseDSN returns the data source name of the database, SQLite uses the database path when it is empty
+func (c *viperConfig) GetDatabaseDSN() string {
+	return c.v().GetString(databaseDSNKey)
+}
+
+// GetDatabaseMaxOpenConns returns the maximum number of open connections, 0 is unlimited
+func (c *viperConfig) GetDatabaseMaxOpenConns() int {
+	return c.v().GetInt(databaseMaxOpenKey)
+}
+
+// GetDatabaseMaxIdleConns returns the maximum number of idle connections kept in the pool
+func (c *viperConfig) GetDatabaseMaxIdleConns() int {
+	return c.v().GetInt(databaseMaxIdleKey)
+}
+
+// GetDatabaseConnMaxLifetime returns how long a connection is reused before it is closed, 0 reuses it forever
+func (c *viperConfig) GetDatabaseConnMaxLifetime() time.Duration {
+	return c.v().GetDuration(databaseLifetimeKey)
+}
+
+// GetDatabaseConnMaxIdleTime returns how long a connection can be idle before it is closed, 0 keeps it open
+func (c *viperConfig) GetDatabaseConnMaxIdleTime() time.Duration {
+	return c.v().GetDuration(databaseIdleTimeKey)
+}
+
+// GetDatabaseAutoMigrate returns whether pending migrations are applied at startup
+func (c *viperConfig) GetDatabaseAutoMigrate() bool {
+	return c.v().GetBool(databaseAutoMigrate)
+}
+
+// GetDatabaseQueryTimeout returns how long a single query may run before it is cancelled, 0 never cancels it
+func (c *viperConfig) GetDatabaseQueryTimeout() time.Duration {
+	return c.v().GetDuration(databaseQueryTimeoutKey)
+}
+
+// GetSQLiteJournalMode returns the journal_mode pragma SQLite databases are opened with
+func (c *viperConfig) GetSQLiteJournalMode() string {
+	return strings.ToUpper(c.v().GetString(sqliteJournalModeKey))
+}
+
+// GetSQLiteSynchronous returns the synchronous pragma SQLite databases are opened with
+func (c *viperConfig) GetSQLiteSynchronous() string {
+	return strings.ToUpper(c.v().GetString(sqliteSynchronousKey))
+}
+
+// GetSQLiteBusyTimeout returns how long SQLite waits for a lock held by another process
+func (c *viperConfig) GetSQLiteBusyTimeout() time.Duration {
+	return c.v().GetDuration(sqliteBusyTimeoutKey)
+}
+
+// GetSQLiteForeignKeys returns whether SQLite enforces foreign keys
+func (c *viperConfig) GetSQLiteForeignKeys() bool {
+	return c.v().GetBool(sqliteForeignKeysKey)
+}
+
+// GetSQLiteReadConns returns the number of read only SQLite connections, 0 reads on the writer connection
+func (c *viperConfig) GetSQLiteReadConns() int {
+	return c.v().GetInt(sqliteReadConnsKey)
+}
+
+// GetLogLevel returns the minimum level logged
+func (c *viperConfig) GetLogLevel() slog.Level {
+	var level slog.Level
+	// the level was validated when the configuration was loaded
+	level.UnmarshalText([]byte(c.v().GetString(interfaces.ConfigKeyLogLevel)))
+	return level
+}
+
+// GetCORSAllowOrigins returns the origins allowed to make cross origin requests
+func (c *viperConfig) GetCORSAllowOrigins() []string {
+	return c.v().GetStringSlice(interfaces.ConfigKeyCORSAllowOrigins)
+}
+
+// GetRateLimitMax returns the number of requests a client can make per window, 0 disables rate limiting
+func (c *viperConfig) GetRateLimitMax() int {
+	return c.v().GetInt(interfaces.ConfigKeyRateLimitMax)
+}
+
+// GetRateLimitWindow returns the window requests are counted in
+func (c *viperConfig) GetRateLimitWindow() time.Duration {
+	return c.v().GetDuration(interfaces.ConfigKeyRateLimitWindow)
 }
 
 func (c *viperConfig) GetServerPort() uint16 {
-	return uint16(c.viper.GetInt(serverPortKey))
+	return uint16(c.v().GetInt(serverPortKey))
 }
 
 func (c *viperConfig) GetServerAddress() string {
-	return c.viper.GetString(serverAddressKey)
+	return c.v().GetString(serverAddressKey)
 }
 
 func (c *viperConfig) ifNilTryPath(primaryKey string, pathKey string) string {
-	if c.viper.GetString(primaryKey) == "" {
-		path := c.viper.GetString(pathKey)
+	if c.v().GetString(primaryKey) == "" {
+		path := c.v().GetString(pathKey)
 		if path != "" {
 			// Open the file
 			file, err := os.Open(path)
@@ -90,7 +315,7 @@ func (c *viperConfig) ifNilTryPath(primaryKey string, pathKey string) string {
 		}
 		return ""
 	}
-	return c.viper.GetString(primaryKey)
+	return c.v().GetString(primaryKey)
 }
 
 func (c *viperConfig) GetServerCert() string {
@@ -105,6 +330,165 @@ func (c *viperConfig) GetServerCA() string {
 	return c.ifNilTryPath(serverTLSCaKey, serverTLSCaPathKey)
 }
 
+// GetServerCertPath returns the file the server certificate is read from when it is not set directly
+func (c *viperConfig) GetServerCertPath() string {
+	return c.v().GetString(serverTLSCertPathKey)
+}
+
+// GetServerKeyPath returns the file the server key is read from when it is not set directly
+func (c *viperConfig) GetServerKeyPath() string {
+	return c.v().GetString(serverTLSKeyPathKey)
+}
+
+// GetServerCAPath returns the file the client CA is read from when it is not set directly
+func (c *viperConfig) GetServerCAPath() string {
+	return c.v().GetString(serverTLSCaPathKey)
+}
+
+// GetServerClientAuth returns whether client certificates are not requested, optional or required
+func (c *viperConfig) GetServerClientAuth() string {
+	return c.v().GetString(serverTLSClientAuth)
+}
+
 func (c *viperConfig) IsTLSEnabled() bool {
-	return c.viper.GetBool(serverTLSEnabledKey)
+	return c.v().GetBool(serverTLSEnabledKey)
+}
+
+// GetStoragePath returns the directory blobs such as avatars are stored in
+func (c *viperConfig) GetStoragePath() string {
+	return c.v().GetString(storagePathKey)
+}
+
+// GetAccountDeletionGracePeriod returns how long a deleted account can be restored before it is purged
+func (c *viperConfig) GetAccountDeletionGracePeriod() time.Duration {
+	return c.v().GetDuration(deletionGraceKey)
+}
+
+// GetAccountDeletionInterval returns how often accounts past their grace period are purged
+func (c *viperConfig) GetAccountDeletionInterval() time.Duration {
+	return c.v().GetDuration(deletionIntervalKey)
+}
+
+// GetSecretsKey returns the base64 encoded key encryption key if it is set directly or through the environment
+func (c *viperConfig) GetSecretsKey() string {
+	return c.v().GetString(secretsKeyKey)
+}
+
+// GetSecretsKeyPath returns the file the key encryption key is read from, and created in, when it is not set directly,
+// it must be outside the data directories
+func (c *viperConfig) GetSecretsKeyPath() string {
+	return c.v().GetString(secretsKeyPathKey)
+}
+
+// GetPreviousSecretsKeys returns retired base64 encoded key encryption keys, secrets wrapped with them are re-wrapped on startup
+func (c *viperConfig) GetPreviousSecretsKeys() []string {
+	return c.v().GetStringSlice(secretsPreviousKey)
+}
+
+// GetSettingsPollInterval returns how often settings are reloaded to pick up changes made by other instances
+func (c *viperConfig) GetSettingsPollInterval() time.Duration {
+	return c.v().GetDuration(settingsPollKey)
+}
+
+// GetBackupPath returns the directory scheduled backups are written to
+func (c *viperConfig) GetBackupPath() string {
+	return c.v().GetString(backupPathKey)
+}
+
+// GetBackupInterval returns how often a backup is written to the backup path, 0 disables scheduled backups
+func (c *viperConfig) GetBackupInterval() time.Duration {
+	return c.v().GetDuration(backupIntervalKey)
+}
+
+// GetBackupRetention returns how many backups are kept in the backup path, older ones are removed
+func (c *viperConfig) GetBackupRetention() int {
+	return c.v().GetInt(backupRetentionKey)
+}
+
+// GetBackupCompress returns whether backups are gzip compressed unless asked otherwise
+func (c *viperConfig) GetBackupCompress() bool {
+	return c.v().GetBool(backupCompressKey)
+}
+
+// GetBackupEncrypt returns whether backups are encrypted with the key encryption key unless asked otherwise
+func (c *viperConfig) GetBackupEncrypt() bool {
+	return c.v().GetBool(backupEncryptKey)
+}
+
+// GetLogFormat returns json or text
+func (c *viperConfig) GetLogFormat() string {
+	return c.v().GetString(logFormatKey)
+}
+
+// GetViewsPath returns the directory the page templates are loaded from
+func (c *viperConfig) GetViewsPath() string {
+	return c.v().GetString(viewsPathKey)
+}
+
+// GetJWTLifetime returns how long a session token is valid after sign in
+func (c *viperConfig) GetJWTLifetime() time.Duration {
+	return c.v().GetDuration(jwtLifetimeKey)
+}
+
+// GetCSRFExpiration returns how long a CSRF token is valid
+func (c *viperConfig) GetCSRFExpiration() time.Duration {
+	return c.v().GetDuration(csrfExpirationKey)
+}
+
+// GetCORSAllowMethods returns the methods allowed in cross origin requests
+func (c *viperConfig) GetCORSAllowMethods() []string {
+	return c.v().GetStringSlice(interfaces.ConfigKeyCORSAllowMethods)
+}
+
+// GetCORSAllowHeaders returns the headers allowed in cross origin requests, empty allows the requested headers
+func (c *viperConfig) GetCORSAllowHeaders() []string {
+	return c.v().GetStringSlice(interfaces.ConfigKeyCORSAllowHeaders)
+}
+
+// GetCORSAllowCredentials returns whether cross origin requests can send cookies
+func (c *viperConfig) GetCORSAllowCredentials() bool {
+	return c.v().GetBool(interfaces.ConfigKeyCORSAllowCredentials)
+}
+
+// GetCORSMaxAge returns how long browsers may cache a preflight response, 0 leaves it to the browser
+func (c *viperConfig) GetCORSMaxAge() time.Duration {
+	return c.v().GetDuration(interfaces.ConfigKeyCORSMaxAge)
+}
+
+// GetCacheExpiration returns how long static assets are cached by the server
+func (c *viperConfig) GetCacheExpiration() time.Duration {
+	return c.v().GetDuration(cacheExpirationKey)
+}
+
+// GetCacheControl returns whether cached static assets are sent with a Cache-Control header
+func (c *viperConfig) GetCacheControl() bool {
+	return c.v().GetBool(cacheControlKey)
+}
+
+// GetArgon2Params returns the parameters new password hashes are made with
+func (c *viperConfig) GetArgon2Params() interfaces.Argon2Params {
+	return interfaces.Argon2Params{
+		Time:       c.v().GetUint32(argon2TimeKey),
+		Memory:     c.v().GetUint32(argon2MemoryKey),
+		Threads:    uint8(c.v().GetUint(argon2ThreadsKey)),
+		KeyLength:  c.v().GetUint32(argon2KeyLengthKey),
+		SaltLength: c.v().GetUint32(argon2SaltLengthKey),
+	}
+}
+
+// GetSMTPConfig returns the mail server emails are sent through
+func (c *viperConfig) GetSMTPConfig() interfaces.SMTPConfig {
+	return interfaces.SMTPConfig{
+		Host:     c.v().GetString(smtpHostKey),
+		Port:     uint16(c.v().GetInt(smtpPortKey)),
+		Username: c.v().GetString(smtpUsernameKey),
+		Password: c.v().GetString(smtpPasswordKey),
+		TLS:      c.v().GetString(smtpTLSKey),
+		From:     c.v().GetString(mailFromKey),
+	}
+}
+
+// GetMailLog returns whether emails are written to the log, links included, when no mail server is configured
+func (c *viperConfig) GetMailLog() bool {
+	return c.v().GetBool(mailLogKey)
 }
@@ -1,28 +1,145 @@
 package config
 
 import (
+	"log/slog"
+	"os"
 	"path"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewViperConfig(t *testing.T) {
 	// Create a new Viper config
-	config := NewViperConfig()
+	config, args, err := NewViperConfig(nil)
 
 	// Assert that the config is not nil
+	assert.NoError(t, err)
 	assert.NotNil(t, config)
+	assert.Empty(t, args)
 }
 
 func TestViperConfig_GetDatabasePath(t *testing.T) {
 	// Create a new Viper config
-	config := NewViperConfig()
+	config, _, err := NewViperConfig(nil)
+	assert.NoError(t, err)
 
 	// Get the database path
 	dbPath := config.GetDatabasePath()
 
 	// Assert that the database path is the default value
-	expectedPath := path.Join("data", "db")
+	expectedPath := path.Join("data", "db.sqlite")
 	assert.Equal(t, expectedPath, dbPath)
 }
+
+// writeConfigFile writes a config file to a temporary directory and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func TestSourcePrecedence(t *testing.T) {
+	file := writeConfigFile(t, "server:\n  port: 8081\n  address: 0.0.0.0\ndatabase:\n  path: file.sqlite\n")
+	t.Setenv("APP_SERVER_PORT", "8082")
+	t.Setenv("APP_DATABASE_PATH", "env.sqlite")
+
+	config, args, err := NewViperConfig([]string{"--config", file, "--server.port=8083", "settings", "export", "--format", "json"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(8083), config.GetServerPort(), "flags override the environment")
+	assert.Equal(t, "env.sqlite", config.GetDatabasePath(), "the environment overrides the file")
+	assert.Equal(t, "0.0.0.0", config.GetServerAddress(), "the file overrides the defaults")
+	assert.Equal(t, []string{"settings", "export", "--format", "json"}, args)
+}
+
+func TestRejectsInvalidConfig(t *testing.T) {
+	_, _, err := NewViperConfig([]string{"--config", writeConfigFile(t, "server:\n  prot: 8081\n")})
+	assert.ErrorContains(t, err, `unknown config key "server.prot"`)
+
+	_, _, err = NewViperConfig([]string{"--server.port=70000"})
+	assert.ErrorContains(t, err, "server.port")
+
+	t.Setenv("APP_SETTINGS_POLL_INTERVAL", "often")
+	_, _, err = NewViperConfig(nil)
+	assert.ErrorContains(t, err, "settings.poll_interval")
+
+	_, _, err = NewViperConfig([]string{"--config", filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.Error(t, err)
+
+	_, _, err = NewViperConfig([]string{"--password.argon2.threads=8", "--password.argon2.memory=32"})
+	assert.ErrorContains(t, err, "password.argon2.memory")
+
+	_, _, err = NewViperConfig([]string{"--server.cors.allow_credentials"})
+	assert.ErrorContains(t, err, "server.cors.allow_credentials")
+
+	_, _, err = NewViperConfig([]string{"--log.format=xml"})
+	assert.ErrorContains(t, err, "log.format")
+
+	_, _, err = NewViperConfig([]string{"--mail.smtp.tls=ssl"})
+	assert.ErrorContains(t, err, "mail.smtp.tls")
+
+	_, _, err = NewViperConfig([]string{"--mail.smtp.host=smtp.example.com"})
+	assert.ErrorContains(t, err, "mail.from")
+}
+
+func TestGetRedactedSettings(t *testing.T) {
+	t.Setenv("APP_SECRETS_KEY", "c2VjcmV0")
+
+	config, _, err := NewViperConfig(nil)
+
+	assert.NoError(t, err)
+	settings := config.GetRedactedSettings()
+	assert.Equal(t, "REDACTED", settings["secrets.key"])
+	assert.Equal(t, []string{}, settings["secrets.previous_keys"])
+	assert.Equal(t, "", settings["server.tls.key"])
+	assert.Equal(t, 8080, settings["server.port"])
+}
+
+// levelReloadable records the log level it was reloaded with
+type levelReloadable struct {
+	reloads atomic.Int32
+	level   atomic.Value
+}
+
+func (r *levelReloadable) ReloadKeys() []string {
+	return []string{interfaces.ConfigKeyLogLevel}
+}
+
+func (r *levelReloadable) Reload(config interfaces.IConfig) error {
+	r.level.Store(config.GetLogLevel())
+	r.reloads.Add(1)
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	file := writeConfigFile(t, "log:\n  level: info\nserver:\n  port: 8081\n")
+	config, _, err := NewViperConfig([]string{"--config", file})
+	assert.NoError(t, err)
+	component := &levelReloadable{}
+	assert.NoError(t, config.Watch(component))
+
+	assert.NoError(t, os.WriteFile(file, []byte("log:\n  level: warn\nserver:\n  port: 8082\n"), 0600))
+	assert.Eventually(t, func() bool {
+		return component.reloads.Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, slog.LevelWarn, component.level.Load())
+	assert.Equal(t, slog.LevelWarn, config.GetLogLevel())
+	assert.Equal(t, uint16(8082), config.GetServerPort(), "keys that need a restart are still updated")
+
+	reloads := component.reloads.Load()
+	assert.NoError(t, os.WriteFile(file, []byte("log:\n  level: loud\n"), 0600))
+	time.Sleep(time.Second)
+	assert.Equal(t, reloads, component.reloads.Load(), "invalid changes are ignored")
+	assert.Equal(t, slog.LevelWarn, config.GetLogLevel())
+}
+
+func TestWatchWithoutConfigFile(t *testing.T) {
+	config, _, err := NewViperConfig(nil)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, config.Watch(), ErrNoConfigFile)
+}
@@ -0,0 +1,357 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	// envPrefix is prepended to environment variables, server.port is read from APP_SERVER_PORT
+	envPrefix = "APP"
+	// configFlag is the flag that points at a config file instead of searching for one
+	configFlag = "config"
+	// appName names the per user and system wide config directories
+	appName = "gofiber-pug-starter"
+	// redacted replaces secrets when the configuration is printed
+	redacted = "REDACTED"
+	// reloadDelay is how long the config file must stay unchanged before it is read again
+	reloadDelay = 250 * time.Millisecond
+)
+
+// ErrNoConfigFile is returned by Watch when the configuration was loaded without a file
+var ErrNoConfigFile = errors.New("no config file was loaded")
+
+// positiveDurations are intervals that must be greater than zero
+var positiveDurations = []string{
+	deletionIntervalKey, settingsPollKey, interfaces.ConfigKeyRateLimitWindow,
+	jwtLifetimeKey, csrfExpirationKey, cacheExpirationKey,
+}
+
+// sqliteJournalModes are the journal_mode pragma values
+var sqliteJournalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+
+// sqliteSynchronousModes are the synchronous pragma values
+var sqliteSynchronousModes = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+
+// minimums are integers that must be at least the given value
+var minimums = map[string]int{
+	databaseMaxOpenKey:               0,
+	databaseMaxIdleKey:               0,
+	interfaces.ConfigKeyRateLimitMax: 0,
+	argon2TimeKey:                    1,
+	argon2ThreadsKey:                 1,
+	argon2KeyLengthKey:               16,
+	argon2SaltLengthKey:              8,
+	backupRetentionKey:               1,
+	sqliteReadConnsKey:               0,
+}
+
+// configSearchPath returns the directories searched for config.yaml in order
+func configSearchPath() []string {
+	paths := []string{".", "config"}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", appName))
+	}
+	return append(paths, filepath.Join("/etc", appName))
+}
+
+// keys returns the known keys sorted
+func (c *viperConfig) keys() []string {
+	keys := make([]string, 0, len(c.defaults))
+	for key := range c.defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// buildFlags builds a flag for every known key, typed after its default
+func (c *viperConfig) buildFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet(appName, pflag.ContinueOnError)
+	// the flags end where a command starts
+	flags.SetInterspersed(false)
+	flags.String(configFlag, "", "config file to read instead of searching for config.yaml")
+	for _, key := range c.keys() {
+		switch value := c.defaults[key].(type) {
+		case bool:
+			flags.Bool(key, value, "")
+		case int:
+			flags.Int(key, value, "")
+		case time.Duration:
+			flags.Duration(key, value, "")
+		case []string:
+			flags.StringSlice(key, value, "")
+		default:
+			flags.String(key, cast.ToString(value), "")
+		}
+	}
+	return flags
+}
+
+// build loads the configuration from every source and validates it
+func (c *viperConfig) build() (*viper.Viper, error) {
+	v := viper.New()
+	for key, value := range c.defaults {
+		v.SetDefault(key, value)
+	}
+	v.SetConfigName("config")
+	v.SetConfigType("yaml")
+	for _, path := range configSearchPath() {
+		v.AddConfigPath(path)
+	}
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for _, key := range c.keys() {
+		if err := v.BindPFlag(key, c.flags.Lookup(key)); err != nil {
+			return nil, err
+		}
+	}
+
+	if path, _ := c.flags.GetString(configFlag); path != "" {
+		v.SetConfigFile(path)
+	}
+	if err := v.ReadInConfig(); err != nil {
+		if !errors.As(err, &viper.ConfigFileNotFoundError{}) {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		slog.Info("No config file found, using the defaults, environment and flags", "searched", configSearchPath())
+	} else {
+		slog.Info("Loaded config file", "path", v.ConfigFileUsed())
+	}
+	if err := c.validate(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// typed returns the effective value of a key converted to the type of its default
+func (c *viperConfig) typed(v *viper.Viper, key string) (interface{}, error) {
+	value := v.Get(key)
+	switch c.defaults[key].(type) {
+	case bool:
+		return cast.ToBoolE(value)
+	case int:
+		return cast.ToIntE(value)
+	case time.Duration:
+		return cast.ToDurationE(value)
+	case []string:
+		return cast.ToStringSliceE(value)
+	default:
+		return cast.ToStringE(value)
+	}
+}
+
+// validate rejects keys that are not known and values that do not match the type of their default
+func (c *viperConfig) validate(v *viper.Viper) error {
+	var errs []error
+	for _, key := range v.AllKeys() {
+		if _, ok := c.defaults[key]; !ok {
+			errs = append(errs, fmt.Errorf("unknown config key %q", key))
+		}
+	}
+	for _, key := range c.keys() {
+		if _, err := c.typed(v, key); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for %s: %w", key, err))
+		}
+	}
+	if port, err := cast.ToIntE(v.Get(serverPortKey)); err == nil && (port < 1 || port > 65535) {
+		errs = append(errs, fmt.Errorf("invalid value for %s: %d is not between 1 and 65535", serverPortKey, port))
+	}
+	for _, key := range positiveDurations {
+		if interval, err := cast.ToDurationE(v.Get(key)); err == nil && interval <= 0 {
+			errs = append(errs, fmt.Errorf("invalid value for %s: must be greater than zero", key))
+		}
+	}
+	for _, key := range c.keys() {
+		minimum, ok := minimums[key]
+		if !ok {
+			continue
+		}
+		if value, err := cast.ToIntE(v.Get(key)); err == nil && value < minimum {
+			errs = append(errs, fmt.Errorf("invalid value for %s: must be at least %d", key, minimum))
+		}
+	}
+	for _, key := range []string{interfaces.ConfigKeyCORSMaxAge, databaseLifetimeKey, databaseIdleTimeKey, backupIntervalKey, sqliteBusyTimeoutKey, databaseQueryTimeoutKey} {
+		if duration, err := cast.ToDurationE(v.Get(key)); err == nil && duration < 0 {
+			errs = append(errs, fmt.Errorf("invalid value for %s: must not be negative", key))
+		}
+	}
+	switch driver := v.GetString(databaseDriverKey); driver {
+	case interfaces.DatabaseDriverSQLite:
+	case interfaces.DatabaseDriverPostgres, interfaces.DatabaseDriverMySQL:
+		if v.GetString(databaseDSNKey) == "" {
+			errs = append(errs, fmt.Errorf("invalid value for %s: %s needs a data source name", databaseDSNKey, driver))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid value for %s: use sqlite, postgres or mysql", databaseDriverKey))
+	}
+	threads, threadsErr := cast.ToIntE(v.Get(argon2ThreadsKey))
+	if threadsErr == nil && threads > 255 {
+		errs = append(errs, fmt.Errorf("invalid value for %s: must be at most 255", argon2ThreadsKey))
+	}
+	// argon2 needs at least 8 KiB per thread
+	if memory, err := cast.ToIntE(v.Get(argon2MemoryKey)); err == nil && threadsErr == nil && memory < 8*threads {
+		errs = append(errs, fmt.Errorf("invalid value for %s: must be at least 8 KiB per thread", argon2MemoryKey))
+	}
+	if mode := strings.ToUpper(v.GetString(sqliteJournalModeKey)); !slices.Contains(sqliteJournalModes, mode) {
+		errs = append(errs, fmt.Errorf("invalid value for %s: use %s", sqliteJournalModeKey, strings.Join(sqliteJournalModes, ", ")))
+	}
+	if synchronous := strings.ToUpper(v.GetString(sqliteSynchronousKey)); !slices.Contains(sqliteSynchronousModes, synchronous) {
+		errs = append(errs, fmt.Errorf("invalid value for %s: use %s", sqliteSynchronousKey, strings.Join(sqliteSynchronousModes, ", ")))
+	}
+	if mode := v.GetString(smtpTLSKey); !slices.Contains([]string{interfaces.SMTPTLSStartTLS, interfaces.SMTPTLSImplicit, interfaces.SMTPTLSNone}, mode) {
+		errs = append(errs, fmt.Errorf("invalid value for %s: use starttls, tls or none", smtpTLSKey))
+	}
+	if port, err := cast.ToIntE(v.Get(smtpPortKey)); err == nil && (port < 1 || port > 65535) {
+		errs = append(errs, fmt.Errorf("invalid value for %s: %d is not between 1 and 65535", smtpPortKey, port))
+	}
+	if v.GetString(smtpHostKey) != "" && v.GetString(mailFromKey) == "" {
+		errs = append(errs, fmt.Errorf("invalid value for %s: the sender address is required to send mail", mailFromKey))
+	}
+	if format := v.GetString(logFormatKey); format != "json" && format != "text" {
+		errs = append(errs, fmt.Errorf("invalid value for %s: use json or text", logFormatKey))
+	}
+	// browsers refuse credentials for a wildcard origin
+	if v.GetBool(interfaces.ConfigKeyCORSAllowCredentials) && slices.Contains(v.GetStringSlice(interfaces.ConfigKeyCORSAllowOrigins), "*") {
+		errs = append(errs, fmt.Errorf("invalid value for %s: credentials cannot be allowed for any origin, list the origins instead", interfaces.ConfigKeyCORSAllowCredentials))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(v.GetString(interfaces.ConfigKeyLogLevel))); err != nil {
+		errs = append(errs, fmt.Errorf("invalid value for %s: use debug, info, warn or error", interfaces.ConfigKeyLogLevel))
+	}
+	return errors.Join(errs...)
+}
+
+// redact replaces a secret that is set with REDACTED
+func redact(key string, value interface{}) interface{} {
+	// covers both secret strings and lists of secrets
+	if secretKeys[key] && len(cast.ToStringSlice(value)) > 0 {
+		return redacted
+	}
+	return value
+}
+
+// loggable redacts a value and writes durations like 1h30m rather than in nanoseconds
+func loggable(key string, value interface{}) interface{} {
+	if duration, ok := value.(time.Duration); ok {
+		return duration.String()
+	}
+	return redact(key, value)
+}
+
+// GetRedactedSettings returns the effective value of every key, secrets that are set are replaced with REDACTED
+func (c *viperConfig) GetRedactedSettings() map[string]interface{} {
+	v := c.v()
+	settings := map[string]interface{}{}
+	for _, key := range c.keys() {
+		value, _ := c.typed(v, key)
+		settings[key] = redact(key, value)
+	}
+	return settings
+}
+
+// diff compares the effective values of two configurations
+func (c *viperConfig) diff(old *viper.Viper, new *viper.Viper) []interfaces.ConfigChange {
+	changes := []interfaces.ConfigChange{}
+	for _, key := range c.keys() {
+		oldValue, _ := c.typed(old, key)
+		newValue, _ := c.typed(new, key)
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, interfaces.ConfigChange{Key: key, Old: loggable(key, oldValue), New: loggable(key, newValue)})
+		}
+	}
+	return changes
+}
+
+// Watch applies changes to the config file while the application runs
+func (c *viperConfig) Watch(components ...interfaces.IReloadable) error {
+	file := c.v().ConfigFileUsed()
+	if file == "" {
+		return ErrNoConfigFile
+	}
+	// viper re-reads a watched file into the instance being watched, a separate instance is used so a change
+	// is only applied after it has been validated and readers never see a half applied configuration
+	watcher := viper.New()
+	watcher.SetConfigFile(file)
+	var mu sync.Mutex
+	var pending *time.Timer
+	watcher.OnConfigChange(func(fsnotify.Event) {
+		// editors and os.WriteFile truncate before writing, the file is read once the writes settle
+		// so an empty file is not mistaken for a configuration of only defaults
+		mu.Lock()
+		defer mu.Unlock()
+		if pending != nil {
+			pending.Stop()
+		}
+		pending = time.AfterFunc(reloadDelay, func() {
+			c.reload(components)
+		})
+	})
+	watcher.WatchConfig()
+	slog.Info("Watching config file for changes", "path", file)
+	return nil
+}
+
+func (c *viperConfig) reload(components []interfaces.IReloadable) {
+	next, err := c.build()
+	if err != nil {
+		slog.Error("Ignoring invalid config change", "error", err)
+		return
+	}
+	changes := c.diff(c.v(), next)
+	if len(changes) == 0 {
+		return
+	}
+	c.current.Store(next)
+
+	changed := map[string]bool{}
+	for _, change := range changes {
+		changed[change.Key] = true
+	}
+	reloaded := map[string]bool{}
+	for _, component := range components {
+		for _, key := range component.ReloadKeys() {
+			if changed[key] {
+				reloaded[key] = true
+			}
+		}
+	}
+	restart := []string{}
+	for _, change := range changes {
+		if !reloaded[change.Key] {
+			restart = append(restart, change.Key)
+		}
+	}
+	slog.Info("Config changed", "changes", changes)
+	if len(restart) > 0 {
+		slog.Warn("Config changes need a restart to take effect", "keys", restart)
+	}
+
+	for _, component := range components {
+		for _, key := range component.ReloadKeys() {
+			if !changed[key] {
+				continue
+			}
+			if err := component.Reload(c); err != nil {
+				slog.Error("Failed to apply config change", "keys", component.ReloadKeys(), "error", err)
+			}
+			break
+		}
+	}
+}
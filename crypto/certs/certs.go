@@ -0,0 +1,217 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// ClientAuthNone does not ask for client certificates
+	ClientAuthNone = "none"
+	// ClientAuthOptional verifies client certificates against the CA when one is presented
+	ClientAuthOptional = "optional"
+	// ClientAuthRequire rejects connections without a client certificate signed by the CA
+	ClientAuthRequire = "require"
+)
+
+// reloadDelay lets writers finish replacing the files before they are read, editors and
+// secret mounts usually produce several events for one change
+const reloadDelay = 250 * time.Millisecond
+
+// Reloader serves the server certificate and client CA for new TLS handshakes and reloads them when
+// their files change, connections that are already established keep the certificate they started with
+type Reloader struct {
+	config interfaces.IConfig
+	// base is the configuration servers are started with, it is never modified once returned by TLSConfig
+	base *tls.Config
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	clientAuth  tls.ClientAuthType
+	// clientCAPEM is the CA clientConfig verifies client certificates with, to rebuild it only when the CA changes
+	clientCAPEM string
+	// clientConfig is a clone of base that verifies client certificates, nil when they are not requested
+	clientConfig *tls.Config
+	watcher      *fsnotify.Watcher
+}
+
+func parseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q, use none, optional or require", mode)
+	}
+}
+
+// NewReloader loads the server certificate, key and CA from the configuration
+// - config: provides the PEM encoded certificate, key and CA either in memory or from files
+// Returns the reloader, or an error if the certificates cannot be loaded
+func NewReloader(config interfaces.IConfig) (*Reloader, error) {
+	reloader := &Reloader{config: config}
+	reloader.base = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetCertificate:     reloader.getCertificate,
+		GetConfigForClient: reloader.getConfigForClient,
+	}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// load reads the certificates again, the current ones are kept if the new ones are invalid
+func (r *Reloader) load() error {
+	clientAuth, err := parseClientAuth(r.config.GetServerClientAuth())
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.X509KeyPair([]byte(r.config.GetServerCert()), []byte(r.config.GetServerKey()))
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	clientCAPEM := ""
+	var clientCAs *x509.CertPool
+	if clientAuth != tls.NoClientCert {
+		clientCAPEM = r.config.GetServerCA()
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM([]byte(clientCAPEM)) {
+			return errors.New("client certificate verification needs a CA, none could be loaded")
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certificate = &certificate
+	if r.clientConfig != nil && clientAuth == r.clientAuth && clientCAPEM == r.clientCAPEM {
+		return nil
+	}
+	r.clientAuth = clientAuth
+	r.clientCAPEM = clientCAPEM
+	r.clientConfig = nil
+	if clientAuth != tls.NoClientCert {
+		// the clone keeps every setting of the base, it sets no session ticket keys of its own
+		// so tickets are issued and resumed with the keys of the base
+		clientConfig := r.base.Clone()
+		clientConfig.GetConfigForClient = nil
+		clientConfig.ClientAuth = clientAuth
+		clientConfig.ClientCAs = clientCAs
+		r.clientConfig = clientConfig
+	}
+	return nil
+}
+
+// getCertificate serves the latest server certificate
+func (r *Reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.certificate, nil
+}
+
+// getConfigForClient switches to the configuration verifying client certificates when they are requested,
+// nil keeps the base configuration
+func (r *Reloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientConfig, nil
+}
+
+// ReloadKeys returns the keys of the certificates and client certificate verification
+func (r *Reloader) ReloadKeys() []string {
+	return []string{
+		interfaces.ConfigKeyServerTLSCert, interfaces.ConfigKeyServerTLSCertPath,
+		interfaces.ConfigKeyServerTLSKey, interfaces.ConfigKeyServerTLSKeyPath,
+		interfaces.ConfigKeyServerTLSCA, interfaces.ConfigKeyServerTLSCAPath,
+		interfaces.ConfigKeyServerTLSClientAuth,
+	}
+}
+
+// Reload reads the certificates again after the configuration changed, directories of new paths are watched too
+func (r *Reloader) Reload(config interfaces.IConfig) error {
+	if err := r.load(); err != nil {
+		return err
+	}
+	r.mu.RLock()
+	watcher := r.watcher
+	r.mu.RUnlock()
+	if watcher == nil {
+		return nil
+	}
+	return r.watchPaths(watcher)
+}
+
+// watchPaths watches the directories of the configured paths, directories already watched are skipped
+func (r *Reloader) watchPaths(watcher *fsnotify.Watcher) error {
+	watched := map[string]bool{}
+	for _, path := range watcher.WatchList() {
+		watched[path] = true
+	}
+	for _, path := range []string{r.config.GetServerCertPath(), r.config.GetServerKeyPath(), r.config.GetServerCAPath()} {
+		if path == "" || watched[filepath.Dir(path)] {
+			continue
+		}
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			return err
+		}
+		watched[filepath.Dir(path)] = true
+	}
+	return nil
+}
+
+// TLSConfig returns a configuration that always uses the latest certificates, every call returns the same one
+func (r *Reloader) TLSConfig() *tls.Config {
+	return r.base
+}
+
+// Watch reloads the certificates whenever a file in the directories of the configured paths changes until ctx is cancelled,
+// directories are watched rather than files so replacing a file or swapping a mounted secret is noticed
+func (r *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := r.watchPaths(watcher); err != nil {
+		watcher.Close()
+		return err
+	}
+	r.mu.Lock()
+	r.watcher = watcher
+	r.mu.Unlock()
+
+	go func() {
+		defer watcher.Close()
+		var pending <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-watcher.Events:
+				slog.Debug("TLS certificate directory changed", "event", event.String())
+				pending = time.After(reloadDelay)
+			case err := <-watcher.Errors:
+				slog.Error("Error watching TLS certificates", "error", err)
+			case <-pending:
+				pending = nil
+				if err := r.load(); err != nil {
+					slog.Error("Failed to reload TLS certificates, keeping the current ones", "error", err)
+					continue
+				}
+				slog.Info("Reloaded TLS certificates")
+			}
+		}
+	}()
+	return nil
+}
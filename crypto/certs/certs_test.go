@@ -0,0 +1,177 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileConfig embeds the interface so only the TLS methods need implementing, it reads the files on every call
+type fileConfig struct {
+	interfaces.IConfig
+	certPath   string
+	keyPath    string
+	clientAuth string
+}
+
+func read(path string) string {
+	content, _ := os.ReadFile(path)
+	return string(content)
+}
+
+func (c *fileConfig) GetServerCert() string       { return read(c.certPath) }
+func (c *fileConfig) GetServerKey() string        { return read(c.keyPath) }
+func (c *fileConfig) GetServerCA() string         { return read(c.certPath) }
+func (c *fileConfig) GetServerCertPath() string   { return c.certPath }
+func (c *fileConfig) GetServerKeyPath() string    { return c.keyPath }
+func (c *fileConfig) GetServerCAPath() string     { return "" }
+func (c *fileConfig) GetServerClientAuth() string { return c.clientAuth }
+
+// writeSelfSigned writes a new self signed certificate and key for commonName
+func writeSelfSigned(t *testing.T, config *fileConfig, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{commonName},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(config.keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	assert.NoError(t, os.WriteFile(config.certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+}
+
+func servedName(t *testing.T, reloader *Reloader) string {
+	certificate, err := reloader.TLSConfig().GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	assert.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func newFileConfig(t *testing.T) *fileConfig {
+	dir := t.TempDir()
+	return &fileConfig{certPath: filepath.Join(dir, "tls.crt"), keyPath: filepath.Join(dir, "tls.key")}
+}
+
+func TestReload(t *testing.T) {
+	config := newFileConfig(t)
+	writeSelfSigned(t, config, "first")
+	reloader, err := NewReloader(config)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", servedName(t, reloader))
+
+	writeSelfSigned(t, config, "second")
+	assert.NoError(t, reloader.Reload(config))
+	assert.Equal(t, "second", servedName(t, reloader))
+
+	assert.NoError(t, os.WriteFile(config.certPath, []byte("garbage"), 0600))
+	assert.Error(t, reloader.Reload(config))
+	assert.Equal(t, "second", servedName(t, reloader), "invalid certificates keep the current ones")
+}
+
+func TestClientAuth(t *testing.T) {
+	config := newFileConfig(t)
+	writeSelfSigned(t, config, "server")
+
+	config.clientAuth = "sometimes"
+	_, err := NewReloader(config)
+	assert.Error(t, err)
+
+	config.clientAuth = ClientAuthRequire
+	reloader, err := NewReloader(config)
+	assert.NoError(t, err)
+	served, _ := reloader.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.Equal(t, tls.RequireAndVerifyClientCert, served.ClientAuth)
+	assert.NotNil(t, served.ClientCAs)
+	assert.Equal(t, uint16(tls.VersionTLS12), served.MinVersion, "the settings of the base are kept")
+
+	assert.NoError(t, reloader.Reload(config))
+	again, _ := reloader.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.Same(t, served, again, "the configuration is only rebuilt when the CA changes")
+	writeSelfSigned(t, config, "server")
+	assert.NoError(t, reloader.Reload(config))
+	again, _ = reloader.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.NotSame(t, served, again)
+
+	config.clientAuth = ClientAuthNone
+	assert.NoError(t, reloader.Reload(config))
+	served, _ = reloader.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.Nil(t, served, "the base is used when client certificates are not requested")
+}
+
+func TestSessionResumption(t *testing.T) {
+	config := newFileConfig(t)
+	writeSelfSigned(t, config, "localhost")
+	config.clientAuth = ClientAuthOptional
+	reloader, err := NewReloader(config)
+	require.NoError(t, err)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", reloader.TLSConfig())
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// the session ticket is sent after the handshake along with the first write
+			conn.Write([]byte("x"))
+			conn.Close()
+		}
+	}()
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(read(config.certPath)))
+	client := &tls.Config{RootCAs: roots, ServerName: "localhost", ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+	connect := func() bool {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), client)
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Read(make([]byte, 1))
+		require.NoError(t, err)
+		return conn.ConnectionState().DidResume
+	}
+
+	assert.False(t, connect())
+	assert.True(t, connect(), "handshakes share the session ticket keys")
+	// a reload that keeps the CA keeps the sessions too
+	require.NoError(t, reloader.Reload(config))
+	assert.True(t, connect())
+}
+
+func TestWatch(t *testing.T) {
+	config := newFileConfig(t)
+	writeSelfSigned(t, config, "first")
+	reloader, err := NewReloader(config)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, reloader.Watch(ctx))
+
+	writeSelfSigned(t, config, "second")
+
+	assert.Eventually(t, func() bool {
+		return servedName(t, reloader) == "second"
+	}, 5*time.Second, 50*time.Millisecond)
+}
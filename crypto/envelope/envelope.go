@@ -0,0 +1,256 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+const (
+	// prefix marks a value as sealed by this package and versions the encoding
+	prefix = "enc:v1:"
+	// KeySize is the size in bytes of key encryption keys and data keys
+	KeySize = 32
+)
+
+// keyEncryptionKey is a key used to wrap data keys, identified by a hash of the key
+type keyEncryptionKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+type envelopeCipher struct {
+	current keyEncryptionKey
+	keys    map[string]keyEncryptionKey
+}
+
+// NewEnvelopeCipher creates a new envelopeCipher instance
+// - current: the key encryption key new values are wrapped with
+// - previous: retired key encryption keys that are still accepted for decryption and re-wrapping
+func NewEnvelopeCipher(current []byte, previous ...[]byte) (interfaces.ISecretCipher, error) {
+	currentKey, err := newKeyEncryptionKey(current)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]keyEncryptionKey{currentKey.id: currentKey}
+	for _, key := range previous {
+		previousKey, err := newKeyEncryptionKey(key)
+		if err != nil {
+			return nil, err
+		}
+		keys[previousKey.id] = previousKey
+	}
+	return &envelopeCipher{current: currentKey, keys: keys}, nil
+}
+
+// DecodeKey decodes a base64 encoded key encryption key
+func DecodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("key encryption key is not valid base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// CheckKeyFileLocation refuses a key file inside any of the directories holding the data it protects,
+// a copy of such a directory would include the key and could decrypt the secrets
+// - path: the key file
+// - dataDirs: the directories holding the database, blobs and backups
+func CheckKeyFileLocation(path string, dataDirs ...string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dataDirs {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(absDir, absPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("key file %s is inside the data directory %s, move it elsewhere so copies of the data do not include the key", path, dir)
+		}
+	}
+	return nil
+}
+
+// LoadOrCreateKeyFile reads a base64 encoded key encryption key from a file,
+// if the file does not exist it is created with a new random key
+func LoadOrCreateKeyFile(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err == nil {
+		return DecodeKey(string(content))
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)), 0o600); err != nil {
+		return nil, err
+	}
+	slog.Warn("Generated a new key encryption key, keep it separate from database backups", "path", path)
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newKeyEncryptionKey(key []byte) (keyEncryptionKey, error) {
+	if len(key) != KeySize {
+		return keyEncryptionKey{}, fmt.Errorf("key encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return keyEncryptionKey{}, err
+	}
+	sum := sha256.Sum256(key)
+	return keyEncryptionKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// seal encrypts plaintext with a random nonce which is prepended to the result
+// - associatedData: authenticated along with the plaintext, nil for none
+func seal(aead cipher.AEAD, plaintext []byte, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+// open decrypts a value produced by seal with the same associated data
+func open(aead cipher.AEAD, sealed []byte, associatedData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, interfaces.ErrSecretUndecryptable
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, associatedData)
+	if err != nil {
+		return nil, interfaces.ErrSecretUndecryptable
+	}
+	return plaintext, nil
+}
+
+// envelope is the decoded form of an encrypted value
+type envelope struct {
+	keyID      string
+	wrappedKey []byte
+	data       []byte
+}
+
+func (e envelope) encode() string {
+	return prefix + e.keyID + ":" + base64.RawURLEncoding.EncodeToString(e.wrappedKey) + ":" + base64.RawURLEncoding.EncodeToString(e.data)
+}
+
+func decode(value string) (envelope, error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if !strings.HasPrefix(value, prefix) || len(parts) != 3 {
+		return envelope{}, interfaces.ErrSecretUndecryptable
+	}
+	wrappedKey, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return envelope{}, interfaces.ErrSecretUndecryptable
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return envelope{}, interfaces.ErrSecretUndecryptable
+	}
+	return envelope{keyID: parts[0], wrappedKey: wrappedKey, data: data}, nil
+}
+
+// unwrap decrypts the data key of an envelope with the key encryption key it was wrapped by
+func (c *envelopeCipher) unwrap(e envelope) ([]byte, error) {
+	kek, ok := c.keys[e.keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key encryption key %s", interfaces.ErrSecretUndecryptable, e.keyID)
+	}
+	return open(kek.aead, e.wrappedKey, nil)
+}
+
+func (c *envelopeCipher) Encrypt(plaintext string, associatedData string) (string, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := seal(dataAEAD, []byte(plaintext), []byte(associatedData))
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := seal(c.current.aead, dataKey, nil)
+	if err != nil {
+		return "", err
+	}
+	return envelope{keyID: c.current.id, wrappedKey: wrappedKey, data: data}.encode(), nil
+}
+
+func (c *envelopeCipher) Decrypt(ciphertext string, associatedData string) (string, error) {
+	e, err := decode(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := c.unwrap(e)
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataAEAD, e.data, []byte(associatedData))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func (c *envelopeCipher) Rewrap(ciphertext string) (string, bool, error) {
+	e, err := decode(ciphertext)
+	if err != nil {
+		return "", false, err
+	}
+	if e.keyID == c.current.id {
+		return ciphertext, false, nil
+	}
+	dataKey, err := c.unwrap(e)
+	if err != nil {
+		return "", false, err
+	}
+	wrappedKey, err := seal(c.current.aead, dataKey, nil)
+	if err != nil {
+		return "", false, err
+	}
+	e.keyID = c.current.id
+	e.wrappedKey = wrappedKey
+	return e.encode(), true, nil
+}
+
+func (c *envelopeCipher) IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
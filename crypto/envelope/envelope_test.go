@@ -0,0 +1,75 @@
+package envelope
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	cipher, err := NewEnvelopeCipher(bytes.Repeat([]byte{1}, KeySize))
+	assert.NoError(t, err)
+
+	ciphertext, err := cipher.Encrypt("hunter2", "jwt_signing_key")
+	assert.NoError(t, err)
+	assert.True(t, cipher.IsEncrypted(ciphertext))
+	assert.NotContains(t, ciphertext, "hunter2")
+
+	plaintext, err := cipher.Decrypt(ciphertext, "jwt_signing_key")
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", plaintext)
+
+	_, err = cipher.Decrypt(ciphertext[:len(ciphertext)-2]+"AA", "jwt_signing_key")
+	assert.ErrorIs(t, err, interfaces.ErrSecretUndecryptable)
+
+	// a value copied to another setting does not open there
+	_, err = cipher.Decrypt(ciphertext, "cookie_encryption_key")
+	assert.ErrorIs(t, err, interfaces.ErrSecretUndecryptable)
+}
+
+func TestRewrap(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, KeySize)
+	newKey := bytes.Repeat([]byte{2}, KeySize)
+	oldCipher, _ := NewEnvelopeCipher(oldKey)
+	ciphertext, _ := oldCipher.Encrypt("hunter2", "jwt_signing_key")
+
+	rotated, err := NewEnvelopeCipher(newKey, oldKey)
+	assert.NoError(t, err)
+	rewrapped, changed, err := rotated.Rewrap(ciphertext)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	_, changed, _ = rotated.Rewrap(rewrapped)
+	assert.False(t, changed)
+
+	// once rewrapped the old key is no longer needed
+	newOnly, _ := NewEnvelopeCipher(newKey)
+	plaintext, err := newOnly.Decrypt(rewrapped, "jwt_signing_key")
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", plaintext)
+	_, err = newOnly.Decrypt(ciphertext, "jwt_signing_key")
+	assert.ErrorIs(t, err, interfaces.ErrSecretUndecryptable)
+}
+
+func TestCheckKeyFileLocation(t *testing.T) {
+	assert.NoError(t, CheckKeyFileLocation("/etc/app/secrets.key", "data", "/var/lib/app"))
+	assert.NoError(t, CheckKeyFileLocation("data-keys/secrets.key", "data"), "a sibling with a common prefix is outside")
+	assert.Error(t, CheckKeyFileLocation("data/secrets.key", "data"))
+	assert.Error(t, CheckKeyFileLocation("./data/keys/../secrets.key", "data/"))
+	assert.Error(t, CheckKeyFileLocation("/var/lib/app/backups/secrets.key", "/tmp", "/var/lib/app"))
+}
+
+func TestLoadOrCreateKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "secrets.key")
+
+	created, err := LoadOrCreateKeyFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, created, KeySize)
+
+	loaded, err := LoadOrCreateKeyFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, created, loaded)
+}
@@ -0,0 +1,203 @@
+package envelope
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+const (
+	// streamMagic starts every stream and versions the format
+	streamMagic = "ENVSTRM1"
+	// chunkSize is the plaintext size of every chunk but the last
+	chunkSize = 64 * 1024
+	// maxWrappedKeySize bounds the header so a corrupt length cannot allocate unbounded memory
+	maxWrappedKeySize = 4096
+)
+
+// The stream format is the magic, the length and value of the data key sealed by Encrypt, then the chunks.
+// Each chunk is sealed with a nonce made of its counter and a flag set on the last chunk,
+// so reordered, dropped or truncated chunks fail to open.
+
+// IsStream reports whether the start of some data is a stream written by NewStreamWriter
+func IsStream(header []byte) bool {
+	return bytes.HasPrefix(header, []byte(streamMagic))
+}
+
+// chunkNonce returns the nonce of a chunk
+func chunkNonce(aead cipher.AEAD, counter uint64, last bool) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+type streamWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+// NewStreamWriter encrypts everything written to it under a new data key wrapped by a cipher,
+// for data too large for Encrypt such as backups. Close must be called to write the last chunk
+// - w: where the encrypted stream is written
+// - secretCipher: wraps the data key, the same or a newer cipher holding its key encryption key reads the stream
+func NewStreamWriter(w io.Writer, secretCipher interfaces.ISecretCipher) (io.WriteCloser, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	wrapped, err := secretCipher.Encrypt(base64.StdEncoding.EncodeToString(dataKey), streamMagic)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, len(streamMagic)+4+len(wrapped))
+	header = append(header, streamMagic...)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(wrapped)))
+	header = append(header, wrapped...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &streamWriter{w: w, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("write to closed stream")
+	}
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is only sealed once more data arrives, as the last chunk must be marked
+		if len(s.buf) == chunkSize {
+			if err := s.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(s.buf[len(s.buf):chunkSize], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (s *streamWriter) flush(last bool) error {
+	sealed := s.aead.Seal(nil, chunkNonce(s.aead, s.counter, last), s.buf, nil)
+	s.counter++
+	s.buf = s.buf[:0]
+	_, err := s.w.Write(sealed)
+	return err
+}
+
+// Close writes the last chunk, it does not close the underlying writer
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.flush(true)
+}
+
+type streamReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	chunk   []byte
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+// NewStreamReader decrypts a stream written by NewStreamWriter,
+// reads fail with ErrSecretUndecryptable if the stream was modified or truncated
+// - r: the encrypted stream
+// - secretCipher: unwraps the data key with any of its key encryption keys
+func NewStreamReader(r io.Reader, secretCipher interfaces.ISecretCipher) (io.Reader, error) {
+	header := make([]byte, len(streamMagic)+4)
+	if _, err := io.ReadFull(r, header); err != nil || !IsStream(header) {
+		return nil, fmt.Errorf("%w: not an encrypted stream", interfaces.ErrSecretUndecryptable)
+	}
+	wrappedSize := binary.BigEndian.Uint32(header[len(streamMagic):])
+	if wrappedSize > maxWrappedKeySize {
+		return nil, interfaces.ErrSecretUndecryptable
+	}
+	wrapped := make([]byte, wrappedSize)
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, interfaces.ErrSecretUndecryptable
+	}
+	encodedKey, err := secretCipher.Decrypt(string(wrapped), streamMagic)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(dataKey) != KeySize {
+		return nil, interfaces.ErrSecretUndecryptable
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		r:     bufio.NewReaderSize(r, chunkSize+aead.Overhead()),
+		aead:  aead,
+		chunk: make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// next opens the next chunk, a short chunk or one followed by the end of the stream is the last
+func (s *streamReader) next() error {
+	n, err := io.ReadFull(s.r, s.chunk)
+	last := false
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case errors.Is(err, io.EOF):
+		// the last chunk was full but not marked as last, so the stream was truncated
+		return interfaces.ErrSecretUndecryptable
+	case err != nil:
+		return err
+	default:
+		if _, err := s.r.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plain, err := s.aead.Open(s.chunk[:0], chunkNonce(s.aead, s.counter, last), s.chunk[:n], nil)
+	if err != nil {
+		return interfaces.ErrSecretUndecryptable
+	}
+	s.counter++
+	s.plain = plain
+	s.done = last
+	return nil
+}
@@ -0,0 +1,87 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encryptStream(t *testing.T, cipher interfaces.ISecretCipher, plaintext []byte) []byte {
+	var encrypted bytes.Buffer
+	writer, err := NewStreamWriter(&encrypted, cipher)
+	require.NoError(t, err)
+	// odd sized writes so chunks are filled across calls
+	for len(plaintext) > 0 {
+		n := min(len(plaintext), 1000)
+		_, err := writer.Write(plaintext[:n])
+		require.NoError(t, err)
+		plaintext = plaintext[n:]
+	}
+	require.NoError(t, writer.Close())
+	return encrypted.Bytes()
+}
+
+func decryptStream(cipher interfaces.ISecretCipher, encrypted []byte) ([]byte, error) {
+	reader, err := NewStreamReader(bytes.NewReader(encrypted), cipher)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	cipher, err := NewEnvelopeCipher(bytes.Repeat([]byte{1}, KeySize))
+	require.NoError(t, err)
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+		encrypted := encryptStream(t, cipher, plaintext)
+		assert.True(t, IsStream(encrypted))
+
+		decrypted, err := decryptStream(cipher, encrypted)
+		assert.NoError(t, err, "size %d", size)
+		assert.Equal(t, plaintext, decrypted, "size %d", size)
+	}
+}
+
+func TestStreamAfterRotation(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, KeySize)
+	oldCipher, _ := NewEnvelopeCipher(oldKey)
+	encrypted := encryptStream(t, oldCipher, []byte("backup"))
+
+	rotated, _ := NewEnvelopeCipher(bytes.Repeat([]byte{2}, KeySize), oldKey)
+	decrypted, err := decryptStream(rotated, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("backup"), decrypted)
+
+	unrelated, _ := NewEnvelopeCipher(bytes.Repeat([]byte{3}, KeySize))
+	_, err = decryptStream(unrelated, encrypted)
+	assert.ErrorIs(t, err, interfaces.ErrSecretUndecryptable)
+}
+
+func TestStreamTampering(t *testing.T) {
+	cipher, _ := NewEnvelopeCipher(bytes.Repeat([]byte{1}, KeySize))
+	plaintext := bytes.Repeat([]byte("a"), 2*chunkSize)
+	encrypted := encryptStream(t, cipher, plaintext)
+	sealedChunk := chunkSize + 16
+
+	flipped := bytes.Clone(encrypted)
+	flipped[len(flipped)-1] ^= 1
+	_, err := decryptStream(cipher, flipped)
+	assert.ErrorIs(t, err, interfaces.ErrSecretUndecryptable, "a modified chunk fails")
+
+	_, err = decryptStream(cipher, encrypted[:len(encrypted)-sealedChunk])
+	assert.ErrorIs(t, err, interfaces.ErrSecretUndecryptable, "dropping the last chunk fails")
+
+	_, err = decryptStream(cipher, encrypted[:len(encrypted)-10])
+	assert.ErrorIs(t, err, interfaces.ErrSecretUndecryptable, "a truncated chunk fails")
+
+	_, err = decryptStream(cipher, []byte("SQLite format 3\x00"))
+	assert.ErrorIs(t, err, interfaces.ErrSecretUndecryptable, "plaintext is rejected")
+}
@@ -0,0 +1,413 @@
+// Package backup takes online snapshots of the SQLite database and restores them
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/crypto/envelope"
+	"github.com/bryopsida/gofiber-pug-starter/database"
+	"github.com/bryopsida/gofiber-pug-starter/database/migrations"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	// filePrefix starts the name of every backup in the backup path
+	filePrefix = "backup-"
+	// partialSuffix marks a backup that is still being written
+	partialSuffix = ".partial"
+	// preRestoreSuffix is added to the database replaced by a restore
+	preRestoreSuffix = ".pre-restore"
+	// lockSuffix names the file next to the database that processes using it lock, a restore locks it exclusively
+	lockSuffix = ".lock"
+)
+
+var (
+	// sqliteHeader starts every SQLite database file
+	sqliteHeader = []byte("SQLite format 3\x00")
+	// gzipHeader starts every gzip stream
+	gzipHeader = []byte{0x1f, 0x8b}
+	// sqliteSidecars are the files SQLite keeps next to a database
+	sqliteSidecars = []string{"-wal", "-shm", "-journal"}
+)
+
+type backupService struct {
+	db     *gorm.DB
+	config interfaces.IConfig
+	cipher interfaces.ISecretCipher
+	// shared is the lock file held by LockShared, it is never closed so the lock lasts as long as the process
+	shared *os.File
+}
+
+// NewBackupService creates a new backupService instance
+// - db: the database backups are taken of and restored to
+// - config: provides the backup path and retention
+// - cipher: encrypts backups with the key encryption key
+func NewBackupService(db *gorm.DB, config interfaces.IConfig, cipher interfaces.ISecretCipher) interfaces.IBackupService {
+	return &backupService{db: db, config: config, cipher: cipher}
+}
+
+// supported reports whether the database is SQLite
+func (s *backupService) supported() bool {
+	return s.db.Dialector.Name() == "sqlite"
+}
+
+// databasePath returns the file of the SQLite database
+func (s *backupService) databasePath(ctx context.Context) (string, error) {
+	if !s.supported() {
+		return "", interfaces.ErrBackupUnsupported
+	}
+	var databases []struct {
+		Name string
+		File string
+	}
+	if err := s.db.WithContext(ctx).Raw("PRAGMA database_list").Scan(&databases).Error; err != nil {
+		return "", err
+	}
+	for _, database := range databases {
+		if database.Name == "main" && database.File != "" {
+			return database.File, nil
+		}
+	}
+	return "", fmt.Errorf("%w: the database is not a file", interfaces.ErrBackupUnsupported)
+}
+
+// snapshot is a copy of the database next to it, removed when it is closed
+type snapshot struct {
+	service *backupService
+	file    *os.File
+	options interfaces.BackupOptions
+}
+
+func (s *snapshot) Encode(w io.Writer) error {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return s.service.encode(w, s.file, s.options)
+}
+
+func (s *snapshot) Close() error {
+	closeErr := s.file.Close()
+	if err := os.Remove(s.file.Name()); err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (s *backupService) Backup(ctx context.Context, w io.Writer, options interfaces.BackupOptions) error {
+	snapshot, err := s.Snapshot(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+	return snapshot.Encode(w)
+}
+
+func (s *backupService) Snapshot(ctx context.Context, options interfaces.BackupOptions) (interfaces.IBackupSnapshot, error) {
+	path, err := s.databasePath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// VACUUM INTO writes a consistent copy while other connections keep reading and writing
+	file, err := os.CreateTemp(filepath.Dir(path), ".backup-*.sqlite")
+	if err != nil {
+		return nil, err
+	}
+	name := file.Name()
+	file.Close()
+	if err := s.db.WithContext(database.WithoutQueryTimeout(ctx)).Exec("VACUUM INTO ?", name).Error; err != nil {
+		os.Remove(name)
+		return nil, fmt.Errorf("failed to snapshot the database: %w", err)
+	}
+	if file, err = os.Open(name); err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	return &snapshot{service: s, file: file, options: options}, nil
+}
+
+// encode copies a snapshot to w, compressing and then encrypting it as asked
+func (s *backupService) encode(w io.Writer, snapshot io.Reader, options interfaces.BackupOptions) error {
+	closers := []io.Closer{}
+	if options.Encrypt {
+		encrypted, err := envelope.NewStreamWriter(w, s.cipher)
+		if err != nil {
+			return err
+		}
+		w = encrypted
+		closers = append(closers, encrypted)
+	}
+	if options.Compress {
+		compressed := gzip.NewWriter(w)
+		w = compressed
+		closers = append(closers, compressed)
+	}
+	if _, err := io.Copy(w, snapshot); err != nil {
+		return err
+	}
+	// the outermost writer is closed first so it flushes into the ones below it
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *backupService) FileName(options interfaces.BackupOptions) string {
+	name := filePrefix + time.Now().UTC().Format("20060102T150405.000Z") + ".sqlite"
+	if options.Compress {
+		name += ".gz"
+	}
+	if options.Encrypt {
+		name += ".enc"
+	}
+	return name
+}
+
+func (s *backupService) BackupToPath(ctx context.Context, options interfaces.BackupOptions) (string, error) {
+	if _, err := s.databasePath(ctx); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(s.config.GetBackupPath(), 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(s.config.GetBackupPath(), s.FileName(options))
+	// written under another name first so an interrupted backup is never listed or restored
+	file, err := os.OpenFile(path+partialSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(path + partialSuffix)
+	if err := s.Backup(ctx, file, options); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(path+partialSuffix, path); err != nil {
+		return "", err
+	}
+	return path, s.prune()
+}
+
+func (s *backupService) List() ([]interfaces.BackupFile, error) {
+	if !s.supported() {
+		return nil, interfaces.ErrBackupUnsupported
+	}
+	entries, err := os.ReadDir(s.config.GetBackupPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return []interfaces.BackupFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	backups := []interfaces.BackupFile{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || strings.HasSuffix(name, partialSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, interfaces.BackupFile{Name: name, Size: info.Size(), CreatedAt: info.ModTime()})
+	}
+	// names start with the time the backup was taken
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+// prune removes the oldest backups beyond the retention
+func (s *backupService) prune() error {
+	backups, err := s.List()
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups[min(len(backups), s.config.GetBackupRetention()):] {
+		if err := os.Remove(filepath.Join(s.config.GetBackupPath(), backup.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lock opens the lock file of the database at path and locks it
+// - exclusive: takes an exclusive lock instead of a shared one
+// Returns the locked file, the lock is released when it is closed, or ErrDatabaseInUse if a conflicting lock is held
+func lock(path string, exclusive bool) (*os.File, error) {
+	file, err := os.OpenFile(path+lockSuffix, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := lockFile(file, exclusive)
+	if err == nil && !locked {
+		err = interfaces.ErrDatabaseInUse
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func (s *backupService) LockShared(ctx context.Context) error {
+	path, err := s.databasePath(ctx)
+	if errors.Is(err, interfaces.ErrBackupUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.shared != nil {
+		return nil
+	}
+	s.shared, err = lock(path, false)
+	return err
+}
+
+func (s *backupService) Restore(ctx context.Context, r io.Reader) error {
+	path, err := s.databasePath(ctx)
+	if err != nil {
+		return err
+	}
+	// held until the database is replaced, the server and commands cannot start while it is
+	exclusive, err := lock(path, true)
+	if err != nil {
+		return err
+	}
+	defer exclusive.Close()
+	decoded, err := s.decode(r)
+	if err != nil {
+		return err
+	}
+	restored, err := os.CreateTemp(filepath.Dir(path), ".restore-*.sqlite")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(restored.Name())
+	if _, err := io.Copy(restored, decoded); err != nil {
+		restored.Close()
+		return invalid(err)
+	}
+	if err := restored.Sync(); err != nil {
+		restored.Close()
+		return err
+	}
+	if err := restored.Close(); err != nil {
+		return err
+	}
+	if err := validate(ctx, restored.Name()); err != nil {
+		return err
+	}
+
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.Close(); err != nil {
+		return err
+	}
+	// the replaced database is kept with its sidecars so it can still be opened
+	for _, suffix := range append([]string{""}, sqliteSidecars...) {
+		os.Remove(path + preRestoreSuffix + suffix)
+		if err := os.Rename(path+suffix, path+preRestoreSuffix+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(restored.Name(), path)
+}
+
+// invalid wraps the reason a backup cannot be restored
+func invalid(err error) error {
+	return fmt.Errorf("%w: %w", interfaces.ErrBackupInvalid, err)
+}
+
+// decode undoes the encryption and compression of a backup, both are detected from the start of the data
+func (s *backupService) decode(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	header, _ := buffered.Peek(len(sqliteHeader))
+	if envelope.IsStream(header) {
+		decrypted, err := envelope.NewStreamReader(buffered, s.cipher)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		buffered = bufio.NewReader(decrypted)
+		header, _ = buffered.Peek(len(sqliteHeader))
+	}
+	if bytes.HasPrefix(header, gzipHeader) {
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		return decompressed, nil
+	}
+	return buffered, nil
+}
+
+// validate checks a restored file is an intact database of this application
+// with a schema version the migrations know
+func validate(ctx context.Context, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, len(sqliteHeader))
+	_, err = io.ReadFull(file, header)
+	file.Close()
+	if err != nil || !bytes.Equal(header, sqliteHeader) {
+		return invalid(errors.New("not a SQLite database"))
+	}
+
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return invalid(err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	var integrity string
+	if err := db.WithContext(ctx).Raw("PRAGMA integrity_check").Scan(&integrity).Error; err != nil {
+		return invalid(err)
+	}
+	if integrity != "ok" {
+		return invalid(fmt.Errorf("integrity check failed: %s", integrity))
+	}
+	migrator, err := migrations.NewMigrator(db, "sqlite3", migrations.Dependencies{})
+	if err != nil {
+		return err
+	}
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return invalid(err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return invalid(err)
+	}
+	latest := statuses[len(statuses)-1].Version
+	if version == 0 {
+		return invalid(errors.New("no migrations have been applied to it"))
+	}
+	if version > latest {
+		return invalid(fmt.Errorf("its schema version %d is newer than the latest migration %d, restore it with a newer build", version, latest))
+	}
+	return nil
+}
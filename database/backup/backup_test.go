@@ -0,0 +1,187 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/crypto/envelope"
+	"github.com/bryopsida/gofiber-pug-starter/database/dbtest"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// backupConfig embeds the interface so only the backup methods need implementing
+type backupConfig struct {
+	interfaces.IConfig
+	path      string
+	retention int
+}
+
+func (c *backupConfig) GetBackupPath() string   { return c.path }
+func (c *backupConfig) GetBackupRetention() int { return c.retention }
+
+type number struct {
+	ID    string `gorm:"primaryKey"`
+	Value uint64
+}
+
+// openDB returns a migrated SQLite database with a counter and the file it is stored in
+func openDB(t *testing.T) (*gorm.DB, interfaces.ISecretCipher, string) {
+	db, cipher := dbtest.Open(t, dbtest.Backend{Driver: interfaces.DatabaseDriverSQLite})
+	require.NoError(t, db.Create(&number{ID: "counter", Value: 1}).Error)
+	var databases []struct {
+		Name string
+		File string
+	}
+	require.NoError(t, db.Raw("PRAGMA database_list").Scan(&databases).Error)
+	return db, cipher, databases[0].File
+}
+
+func counter(t *testing.T, path string) uint64 {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	defer sqlDB.Close()
+	var stored number
+	require.NoError(t, db.First(&stored, "id = ?", "counter").Error)
+	return stored.Value
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	for _, options := range []interfaces.BackupOptions{
+		{}, {Compress: true}, {Encrypt: true}, {Compress: true, Encrypt: true},
+	} {
+		db, cipher, path := openDB(t)
+		service := NewBackupService(db, &backupConfig{path: t.TempDir(), retention: 1}, cipher)
+		var backup bytes.Buffer
+		require.NoError(t, service.Backup(ctx, &backup, options))
+		assert.Equal(t, options.Encrypt, envelope.IsStream(backup.Bytes()), "%+v", options)
+		assert.Equal(t, !options.Encrypt && !options.Compress, bytes.HasPrefix(backup.Bytes(), sqliteHeader), "%+v", options)
+
+		require.NoError(t, db.Model(&number{}).Where("id = ?", "counter").Update("value", 2).Error)
+		require.NoError(t, service.Restore(ctx, &backup), "%+v", options)
+		assert.Equal(t, uint64(1), counter(t, path), "%+v", options)
+		assert.Equal(t, uint64(2), counter(t, path+preRestoreSuffix), "the replaced database is kept")
+	}
+}
+
+func TestSnapshotIsTakenBeforeItIsWritten(t *testing.T) {
+	ctx := context.Background()
+	db, cipher, path := openDB(t)
+	service := NewBackupService(db, &backupConfig{path: t.TempDir(), retention: 1}, cipher)
+	snapshot, err := service.Snapshot(ctx, interfaces.BackupOptions{Compress: true})
+	require.NoError(t, err)
+
+	// writes after the snapshot are not in the backup
+	require.NoError(t, db.Model(&number{}).Where("id = ?", "counter").Update("value", 2).Error)
+	var backup bytes.Buffer
+	require.NoError(t, snapshot.Encode(&backup))
+	require.NoError(t, snapshot.Close())
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.False(t, strings.HasPrefix(entry.Name(), ".backup-"), "the snapshot is removed once closed")
+	}
+
+	require.NoError(t, service.Restore(ctx, &backup))
+	assert.Equal(t, uint64(1), counter(t, path))
+}
+
+func TestRestoreRefusesWhileTheDatabaseIsInUse(t *testing.T) {
+	ctx := context.Background()
+	db, cipher, path := openDB(t)
+	service := NewBackupService(db, &backupConfig{path: t.TempDir(), retention: 1}, cipher)
+	var backup bytes.Buffer
+	require.NoError(t, service.Backup(ctx, &backup, interfaces.BackupOptions{}))
+	require.NoError(t, db.Model(&number{}).Where("id = ?", "counter").Update("value", 2).Error)
+
+	// the server runs in another process with its own connection
+	serverDB, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	server := NewBackupService(serverDB, &backupConfig{path: t.TempDir(), retention: 1}, cipher).(*backupService)
+	require.NoError(t, server.LockShared(ctx))
+	assert.ErrorIs(t, service.Restore(ctx, bytes.NewReader(backup.Bytes())), interfaces.ErrDatabaseInUse)
+	assert.Equal(t, uint64(2), counter(t, path), "the database is left alone")
+	assert.NoFileExists(t, path+preRestoreSuffix)
+
+	// the server stops and cannot start again while a restore runs
+	require.NoError(t, server.shared.Close())
+	server.shared = nil
+	restoring, err := lock(path, true)
+	require.NoError(t, err)
+	assert.ErrorIs(t, server.LockShared(ctx), interfaces.ErrDatabaseInUse)
+	require.NoError(t, restoring.Close())
+	sqlDB, _ := serverDB.DB()
+	require.NoError(t, sqlDB.Close())
+
+	require.NoError(t, service.Restore(ctx, &backup))
+	assert.Equal(t, uint64(1), counter(t, path))
+}
+
+func TestBackupToPathKeepsRetention(t *testing.T) {
+	db, cipher, _ := openDB(t)
+	dir := filepath.Join(t.TempDir(), "backups")
+	service := NewBackupService(db, &backupConfig{path: dir, retention: 2}, cipher)
+	paths := []string{}
+	for i := 0; i < 3; i++ {
+		path, err := service.BackupToPath(context.Background(), interfaces.BackupOptions{Compress: true, Encrypt: true})
+		require.NoError(t, err)
+		paths = append(paths, path)
+		// backup names have millisecond precision
+		time.Sleep(2 * time.Millisecond)
+	}
+	backups, err := service.List()
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	assert.Equal(t, filepath.Base(paths[2]), backups[0].Name, "newest first")
+	assert.Equal(t, filepath.Base(paths[1]), backups[1].Name)
+	assert.NoFileExists(t, paths[0])
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "no partial backups are left behind")
+}
+
+func TestRestoreRejectsInvalidBackups(t *testing.T) {
+	ctx := context.Background()
+	db, cipher, path := openDB(t)
+	service := NewBackupService(db, &backupConfig{path: t.TempDir(), retention: 1}, cipher)
+
+	garbage := make([]byte, 4096)
+	_, _ = rand.Read(garbage)
+	assert.ErrorIs(t, service.Restore(ctx, bytes.NewReader(garbage)), interfaces.ErrBackupInvalid)
+
+	key := make([]byte, envelope.KeySize)
+	_, _ = rand.Read(key)
+	otherCipher, err := envelope.NewEnvelopeCipher(key)
+	require.NoError(t, err)
+	var foreign bytes.Buffer
+	otherService := NewBackupService(db, &backupConfig{}, otherCipher)
+	require.NoError(t, otherService.Backup(ctx, &foreign, interfaces.BackupOptions{Encrypt: true}))
+	assert.ErrorIs(t, service.Restore(ctx, &foreign), interfaces.ErrBackupInvalid, "encrypted with another key")
+
+	other, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "other.sqlite")), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, other.Migrator().CreateTable(&number{}))
+	var unrelated bytes.Buffer
+	require.NoError(t, NewBackupService(other, &backupConfig{}, cipher).Backup(ctx, &unrelated, interfaces.BackupOptions{}))
+	assert.ErrorIs(t, service.Restore(ctx, &unrelated), interfaces.ErrBackupInvalid, "not migrated")
+
+	require.NoError(t, db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)", 9999, true).Error)
+	var newer bytes.Buffer
+	require.NoError(t, service.Backup(ctx, &newer, interfaces.BackupOptions{Compress: true}))
+	assert.ErrorIs(t, service.Restore(ctx, &newer), interfaces.ErrBackupInvalid, "newer than the migrations")
+
+	assert.NoFileExists(t, path+preRestoreSuffix, "nothing was swapped")
+	assert.Equal(t, uint64(1), counter(t, path))
+}
@@ -1,10 +1,169 @@
 package database
 
 import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
 var (
 	// DBConn is the database connection, can be referenced in case its not passed but passing it is recommended
 	DBConn *gorm.DB
 )
+
+// Open connects to the configured database and applies the pool settings and query timeout
+// - config: provides the driver, data source name and pool settings
+// Returns the connection, or an error if the driver is unknown or the database cannot be reached
+func Open(config interfaces.IConfig) (*gorm.DB, error) {
+	dsn := config.GetDatabaseDSN()
+	if config.GetDatabaseDriver() == interfaces.DatabaseDriverSQLite {
+		if dsn == "" {
+			dsn = config.GetDatabasePath()
+		}
+		// the pool sizes are fixed by OpenSQLite
+		db, err := OpenSQLite(dsn, SQLiteOptions{
+			JournalMode: config.GetSQLiteJournalMode(),
+			Synchronous: config.GetSQLiteSynchronous(),
+			BusyTimeout: config.GetSQLiteBusyTimeout(),
+			ForeignKeys: config.GetSQLiteForeignKeys(),
+			ReadConns:   config.GetSQLiteReadConns(),
+		}, &gorm.Config{Logger: NewLogger()})
+		if err != nil {
+			return nil, err
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetConnMaxLifetime(config.GetDatabaseConnMaxLifetime())
+		sqlDB.SetConnMaxIdleTime(config.GetDatabaseConnMaxIdleTime())
+		return db, UseQueryTimeout(db, config.GetDatabaseQueryTimeout())
+	}
+	dialector, err := NewDialector(config.GetDatabaseDriver(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: NewLogger()})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(config.GetDatabaseMaxOpenConns())
+	sqlDB.SetMaxIdleConns(config.GetDatabaseMaxIdleConns())
+	sqlDB.SetConnMaxLifetime(config.GetDatabaseConnMaxLifetime())
+	sqlDB.SetConnMaxIdleTime(config.GetDatabaseConnMaxIdleTime())
+	return db, UseQueryTimeout(db, config.GetDatabaseQueryTimeout())
+}
+
+// SQLiteOptions are the pragmas and read pool size SQLite databases are opened with
+type SQLiteOptions struct {
+	// JournalMode is a journal_mode pragma value such as WAL, which lets readers continue while a write is in progress
+	JournalMode string
+	// Synchronous is a synchronous pragma value such as NORMAL
+	Synchronous string
+	// BusyTimeout is how long a connection waits for a lock held by another process before failing with database is locked
+	BusyTimeout time.Duration
+	ForeignKeys bool
+	// ReadConns is the number of read only connections, 0 reads on the writer connection
+	ReadConns int
+}
+
+// OpenSQLite opens a SQLite database with a single writer connection, so concurrent writes wait for the pool
+// instead of failing with database is locked, and a pool of read only connections the queries are sent to.
+// Transactions, including the migrations, stay on the writer connection
+// - dsn: the database file, pragmas already set in its query string are kept
+// - options: the pragmas and read pool size
+// - gormConfig: the gorm config the database is opened with
+func OpenSQLite(dsn string, options SQLiteOptions, gormConfig *gorm.Config) (*gorm.DB, error) {
+	pragmas := map[string]string{
+		"_journal_mode": options.JournalMode,
+		"_synchronous":  options.Synchronous,
+		"_busy_timeout": strconv.FormatInt(options.BusyTimeout.Milliseconds(), 10),
+		"_foreign_keys": strconv.FormatBool(options.ForeignKeys),
+		// takes the write lock when a transaction begins, so a transaction never fails to upgrade its read lock
+		"_txlock": "immediate",
+	}
+	db, err := gorm.Open(sqlite.Open(sqliteDSN(dsn, pragmas)), gormConfig)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetMaxIdleConns(1)
+	if options.ReadConns == 0 {
+		return db, nil
+	}
+	// the journal mode is stored in the database by the writer so the readers only need the connection pragmas
+	delete(pragmas, "_journal_mode")
+	delete(pragmas, "_txlock")
+	pragmas["_query_only"] = "true"
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{sqlite.Open(sqliteDSN(dsn, pragmas))},
+	}).SetMaxOpenConns(options.ReadConns).SetMaxIdleConns(options.ReadConns)
+	if err := db.Use(resolver); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// sqliteDSN adds pragmas to a SQLite data source name unless it already sets them
+func sqliteDSN(dsn string, pragmas map[string]string) string {
+	path, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		// left for the driver to report
+		return dsn
+	}
+	for key, value := range pragmas {
+		if value != "" && !params.Has(key) {
+			params.Set(key, value)
+		}
+	}
+	return path + "?" + params.Encode()
+}
+
+// NewDialector returns the gorm dialector of a driver
+// - driver: sqlite, postgres or mysql
+// - dsn: the data source name, a file path for SQLite
+func NewDialector(driver string, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case interfaces.DatabaseDriverSQLite:
+		return sqlite.Open(dsn), nil
+	case interfaces.DatabaseDriverPostgres:
+		return postgres.Open(dsn), nil
+	case interfaces.DatabaseDriverMySQL:
+		mysqlConfig, err := mysqldriver.ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		// timestamps are scanned into time.Time
+		mysqlConfig.ParseTime = true
+		return mysql.Open(mysqlConfig.FormatDSN()), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+}
+
+// GooseDialect returns the goose dialect of a driver
+func GooseDialect(driver string) string {
+	if driver == interfaces.DatabaseDriverSQLite {
+		return "sqlite3"
+	}
+	return driver
+}
@@ -0,0 +1,213 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/database"
+	"github.com/bryopsida/gofiber-pug-starter/database/dbtest"
+	"github.com/bryopsida/gofiber-pug-starter/database/migrations"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/bryopsida/gofiber-pug-starter/logging"
+	number_repository "github.com/bryopsida/gofiber-pug-starter/repositories/number"
+	users_repository "github.com/bryopsida/gofiber-pug-starter/repositories/users"
+	increment_service "github.com/bryopsida/gofiber-pug-starter/services/increment"
+	password_service "github.com/bryopsida/gofiber-pug-starter/services/password"
+	users_service "github.com/bryopsida/gofiber-pug-starter/services/users"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+func openTuned(t testing.TB) *gorm.DB {
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "db.sqlite"), dbtest.SQLiteOptions, &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestOpenSQLiteAppliesPragmas(t *testing.T) {
+	db := openTuned(t)
+	var journalMode string
+	var busyTimeout, foreignKeys int
+	require.NoError(t, db.Raw("PRAGMA journal_mode").Scan(&journalMode).Error)
+	require.NoError(t, db.Raw("PRAGMA busy_timeout").Scan(&busyTimeout).Error)
+	require.NoError(t, db.Raw("PRAGMA foreign_keys").Scan(&foreignKeys).Error)
+	assert.Equal(t, "wal", journalMode)
+	assert.Equal(t, 5000, busyTimeout)
+	assert.Equal(t, 1, foreignKeys)
+
+	var readForeignKeys int
+	require.NoError(t, db.Clauses(dbresolver.Read).Raw("PRAGMA foreign_keys").Scan(&readForeignKeys).Error)
+	assert.Equal(t, 1, readForeignKeys, "the read pool has the connection pragmas too")
+	assert.Error(t, db.Clauses(dbresolver.Read).Exec("CREATE TABLE widgets (id INTEGER)").Error, "the read pool is read only")
+	assert.NoError(t, db.Exec("CREATE TABLE widgets (id INTEGER)").Error)
+}
+
+func TestOpenSQLiteKeepsPragmasInTheDSN(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "db.sqlite") + "?_journal_mode=DELETE"
+	db, err := database.OpenSQLite(dsn, dbtest.SQLiteOptions, &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	defer sqlDB.Close()
+	var journalMode string
+	require.NoError(t, db.Raw("PRAGMA journal_mode").Scan(&journalMode).Error)
+	assert.Equal(t, "delete", journalMode)
+}
+
+func TestConcurrentWritesDoNotFail(t *testing.T) {
+	db, _ := dbtest.Open(t, dbtest.Backend{Driver: interfaces.DatabaseDriverSQLite})
+	repo := number_repository.NewNumberRepository(db)
+	var wg sync.WaitGroup
+	errs := make(chan error, 200)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("n%d", i%20)
+			if err := repo.Save(context.Background(), interfaces.Number{ID: id, Number: uint64(i)}); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := repo.FindByID(context.Background(), id); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	db := openTuned(t)
+	require.NoError(t, database.UseQueryTimeout(db, 50*time.Millisecond))
+	// counts long enough to outlast the timeout but still finishes when it is not applied
+	slow := "WITH RECURSIVE counter(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM counter WHERE x < 5000000) SELECT count(*) FROM counter"
+
+	start := time.Now()
+	assert.Error(t, db.WithContext(context.Background()).Exec(slow).Error)
+	assert.Less(t, time.Since(start), time.Second, "the query is interrupted")
+	assert.NoError(t, db.WithContext(database.WithoutQueryTimeout(context.Background())).Exec(slow).Error)
+	assert.NoError(t, db.Exec("SELECT 1").Error, "the connection is usable after a timeout")
+}
+
+func TestLoggerIncludesRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	defer slog.SetDefault(previous)
+	db, err := database.OpenSQLite(filepath.Join(t.TempDir(), "db.sqlite"), dbtest.SQLiteOptions, &gorm.Config{Logger: database.NewLogger()})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	defer sqlDB.Close()
+
+	ctx := logging.WithRequestID(context.Background(), "request-1")
+	assert.Error(t, db.WithContext(ctx).Exec("SELECT * FROM missing").Error)
+	assert.Contains(t, logs.String(), `"msg":"Query failed"`)
+	assert.Contains(t, logs.String(), `"request_id":"request-1"`)
+}
+
+// benchmarkDatabases returns a migrated database opened with the driver defaults and one opened with OpenSQLite
+func benchmarkDatabases(b *testing.B) map[string]*gorm.DB {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defaults, err := gorm.Open(sqlite.Open(filepath.Join(b.TempDir(), "db.sqlite")), &gorm.Config{Logger: logger.Discard})
+	require.NoError(b, err)
+	dbs := map[string]*gorm.DB{"defaults": defaults, "tuned": openTuned(b)}
+	for _, db := range dbs {
+		migrator, err := migrations.NewMigrator(db, "sqlite3", migrations.Dependencies{})
+		require.NoError(b, err)
+		_, err = migrator.UpTo(context.Background(), 8, false)
+		require.NoError(b, err)
+	}
+	return dbs
+}
+
+// reportErrors reports the share of operations that failed, with the driver defaults these are database is locked errors
+func reportErrors(b *testing.B, failed *atomic.Int64) {
+	b.ReportMetric(float64(failed.Load())/float64(b.N), "errors/op")
+}
+
+// BenchmarkIncrement increments the counter from many goroutines at once
+func BenchmarkIncrement(b *testing.B) {
+	for name, db := range benchmarkDatabases(b) {
+		b.Run(name, func(b *testing.B) {
+			ctx := context.Background()
+			service := increment_service.NewIncrementService(number_repository.NewNumberRepository(db), "counter")
+			var failed atomic.Int64
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := service.Increment(ctx, "counter"); err != nil {
+						failed.Add(1)
+					}
+				}
+			})
+			reportErrors(b, &failed)
+		})
+	}
+}
+
+// BenchmarkLogin looks up a user and verifies their password from many goroutines while the counter is incremented,
+// argon2 is tuned down so the database rather than hashing is measured
+func BenchmarkLogin(b *testing.B) {
+	passwords := password_service.NewPasswordServiceWithParams(interfaces.Argon2Params{
+		Time: 1, Memory: 8 * 1024, Threads: 1, KeyLength: 32, SaltLength: 16,
+	})
+	hash, err := passwords.Hash("bench")
+	require.NoError(b, err)
+	for name, db := range benchmarkDatabases(b) {
+		b.Run(name, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			users := users_service.NewUsersService(users_repository.NewUserRepository(db))
+			if _, err := users.GetUserByUsername(ctx, "bench"); err != nil {
+				require.NoError(b, users.CreateUser(ctx, &interfaces.User{
+					Username: "bench", Email: "bench@localhost", Role: interfaces.RoleUser, PasswordHash: hash,
+				}))
+			}
+			increments := increment_service.NewIncrementService(number_repository.NewNumberRepository(db), "counter")
+			go func() {
+				for ctx.Err() == nil {
+					increments.Increment(ctx, "counter")
+					time.Sleep(time.Millisecond)
+				}
+			}()
+
+			var failed atomic.Int64
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					user, err := users.GetUserByUsername(ctx, "bench")
+					if err != nil {
+						failed.Add(1)
+						continue
+					}
+					if ok, err := passwords.Verify("bench", user.PasswordHash); err != nil || !ok {
+						failed.Add(1)
+					}
+				}
+			})
+			reportErrors(b, &failed)
+		})
+	}
+}
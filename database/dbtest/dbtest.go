@@ -0,0 +1,110 @@
+// Package dbtest runs repository tests against every database backend
+package dbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/crypto/envelope"
+	"github.com/bryopsida/gofiber-pug-starter/database"
+	"github.com/bryopsida/gofiber-pug-starter/database/migrations"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/pressly/goose/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Backend is a database the repository tests run against
+type Backend struct {
+	Driver string
+	// DSN is the data source name, empty for SQLite which uses a new file per test
+	DSN string
+}
+
+// SQLiteOptions match the configuration defaults, so the tests go through the writer connection and read pool
+var SQLiteOptions = database.SQLiteOptions{
+	JournalMode: "WAL",
+	Synchronous: "NORMAL",
+	BusyTimeout: 5 * time.Second,
+	ForeignKeys: true,
+	ReadConns:   4,
+}
+
+// Backends returns SQLite and every backend with a data source name in the environment,
+// APP_TEST_POSTGRES_DSN and APP_TEST_MYSQL_DSN, those databases are emptied before each test
+func Backends() []Backend {
+	backends := []Backend{{Driver: interfaces.DatabaseDriverSQLite}}
+	if dsn := os.Getenv("APP_TEST_POSTGRES_DSN"); dsn != "" {
+		backends = append(backends, Backend{Driver: interfaces.DatabaseDriverPostgres, DSN: dsn})
+	}
+	if dsn := os.Getenv("APP_TEST_MYSQL_DSN"); dsn != "" {
+		backends = append(backends, Backend{Driver: interfaces.DatabaseDriverMySQL, DSN: dsn})
+	}
+	return backends
+}
+
+// Run runs a test against a freshly migrated database of every backend
+// - test: the test, cipher encrypts the secret settings of the database
+func Run(t *testing.T, test func(t *testing.T, db *gorm.DB, cipher interfaces.ISecretCipher)) {
+	for _, backend := range Backends() {
+		t.Run(backend.Driver, func(t *testing.T) {
+			db, cipher := Open(t, backend)
+			test(t, db, cipher)
+		})
+	}
+}
+
+// Open connects to an empty database of a backend and migrates it, the connection is closed when the test ends
+func Open(t *testing.T, backend Backend) (*gorm.DB, interfaces.ISecretCipher) {
+	t.Helper()
+	var db *gorm.DB
+	var err error
+	if backend.Driver == interfaces.DatabaseDriverSQLite {
+		db, err = database.OpenSQLite(filepath.Join(t.TempDir(), "db.sqlite"), SQLiteOptions, &gorm.Config{Logger: logger.Discard})
+	} else {
+		var dialector gorm.Dialector
+		dialector, err = database.NewDialector(backend.Driver, backend.DSN)
+		if err == nil {
+			db, err = gorm.Open(dialector, &gorm.Config{Logger: logger.Discard})
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tables {
+		if err := db.Migrator().DropTable(table); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := envelope.NewEnvelopeCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goose.SetLogger(goose.NopLogger())
+	migrator, err := migrations.NewMigrator(db, database.GooseDialect(backend.Driver), migrations.Dependencies{Cipher: cipher})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background(), false); err != nil {
+		t.Fatalf("failed to migrate %s: %v", backend.Driver, err)
+	}
+	return db, cipher
+}
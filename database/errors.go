@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+const (
+	// mysqlDuplicateEntry is the MySQL error number of a unique constraint violation
+	mysqlDuplicateEntry = 1062
+	// postgresUniqueViolation is the Postgres SQLSTATE of a unique constraint violation
+	postgresUniqueViolation = "23505"
+)
+
+// mysqlTransientErrors are the MySQL error numbers worth retrying: too many connections, lock wait timeout and deadlock
+var mysqlTransientErrors = map[uint16]bool{1040: true, 1205: true, 1213: true}
+
+// postgresTransientStates are the Postgres SQLSTATEs and classes worth retrying: serialization failure, deadlock,
+// connection exceptions, insufficient resources and the server shutting down
+var postgresTransientStates = map[string]bool{"40001": true, "40P01": true, "08": true, "53": true, "57P01": true, "57P02": true, "57P03": true}
+
+var (
+	// sqliteUniqueColumn matches the column in "UNIQUE constraint failed: users.username"
+	sqliteUniqueColumn = regexp.MustCompile(`constraint failed: [^.,\s]+\.([^,\s]+)`)
+	// postgresUniqueColumn matches the column in "Key (username)=(jane) already exists."
+	postgresUniqueColumn = regexp.MustCompile(`^Key \(([^,)]+)`)
+	// mysqlUniqueKey matches the table and key in "Duplicate entry 'jane' for key 'users.idx_users_username'"
+	mysqlUniqueKey = regexp.MustCompile(`for key '(?:([^'.]+)\.)?([^'.]+)'$`)
+)
+
+// MapError maps a storage error to the domain errors repositories return, so callers do not depend on gorm or a driver
+// - err: the error returned by gorm, nil is returned as is
+// Returns ErrNotFound for missing records, a ConflictError naming the column of a unique constraint violation,
+// an error wrapping ErrUnavailable for failures that may succeed when retried, otherwise err
+func MapError(err error) error {
+	if err == nil || errors.Is(err, interfaces.ErrNotFound) || errors.Is(err, interfaces.ErrConflict) || errors.Is(err, interfaces.ErrUnavailable) {
+		return err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return interfaces.ErrNotFound
+	}
+	if field, ok := uniqueViolation(err); ok {
+		return &interfaces.ConflictError{Field: field}
+	}
+	if transient(err) {
+		return fmt.Errorf("%w: %w", interfaces.ErrUnavailable, err)
+	}
+	return err
+}
+
+// uniqueViolation reports whether err is a unique constraint violation and the column it is on
+func uniqueViolation(err error) (string, bool) {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		if sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique && sqliteErr.ExtendedCode != sqlite3.ErrConstraintPrimaryKey {
+			return "", false
+		}
+		if match := sqliteUniqueColumn.FindStringSubmatch(sqliteErr.Error()); match != nil {
+			return match[1], true
+		}
+		return "", true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if pgErr.Code != postgresUniqueViolation {
+			return "", false
+		}
+		if match := postgresUniqueColumn.FindStringSubmatch(pgErr.Detail); match != nil {
+			return match[1], true
+		}
+		return pgErr.ConstraintName, true
+	}
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		if mysqlErr.Number != mysqlDuplicateEntry {
+			return "", false
+		}
+		match := mysqlUniqueKey.FindStringSubmatch(mysqlErr.Message)
+		if match == nil {
+			return "", true
+		}
+		table, key := match[1], match[2]
+		if key == "PRIMARY" {
+			return "id", true
+		}
+		// gorm names unique indexes idx_<table>_<column>, MySQL before 8.0.19 leaves out the table so the index name is returned
+		return strings.TrimPrefix(key, "idx_"+table+"_"), true
+	}
+	return "", false
+}
+
+// transient reports whether err is a failure of the database rather than the query, such as a lost connection
+// or a lock that could not be taken in time
+func transient(err error) bool {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, mysqldriver.ErrInvalidConn) || errors.As(err, &netErr) {
+		return true
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return postgresTransientStates[pgErr.Code] || len(pgErr.Code) > 2 && postgresTransientStates[pgErr.Code[:2]]
+	}
+	var pgConnectErr *pgconn.ConnectError
+	if errors.As(err, &pgConnectErr) || pgconn.Timeout(err) {
+		return true
+	}
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlTransientErrors[mysqlErr.Number]
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/database"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestMapError(t *testing.T) {
+	assert.NoError(t, database.MapError(nil))
+	assert.ErrorIs(t, database.MapError(gorm.ErrRecordNotFound), interfaces.ErrNotFound)
+	assert.ErrorIs(t, database.MapError(fmt.Errorf("query: %w", context.DeadlineExceeded)), interfaces.ErrUnavailable)
+	other := errors.New("syntax error")
+	assert.Equal(t, other, database.MapError(other), "other errors are returned as is")
+
+	conflicts := map[string]error{
+		"username": &pgconn.PgError{Code: "23505", ConstraintName: "idx_users_username", Detail: "Key (username)=(jane) already exists."},
+		"email":    &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'jane@example.com' for key 'users.idx_users_email'"},
+		"id":       &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'counter' for key 'numbers.PRIMARY'"},
+		"key":      &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'name' for key 'settings.idx_settings_key'"},
+	}
+	for field, err := range conflicts {
+		var conflict *interfaces.ConflictError
+		if assert.ErrorAs(t, database.MapError(err), &conflict) {
+			assert.Equal(t, field, conflict.Field)
+		}
+	}
+
+	for _, err := range []error{
+		&pgconn.PgError{Code: "40P01"},
+		&pgconn.PgError{Code: "08006"},
+		&mysqldriver.MySQLError{Number: 1213},
+		mysqldriver.ErrInvalidConn,
+	} {
+		mapped := database.MapError(err)
+		assert.ErrorIs(t, mapped, interfaces.ErrUnavailable)
+		assert.ErrorIs(t, mapped, err, "the cause is kept")
+	}
+	assert.NotErrorIs(t, database.MapError(&pgconn.PgError{Code: "42601"}), interfaces.ErrUnavailable)
+}
+
+func TestMapErrorSQLite(t *testing.T) {
+	db := openTuned(t)
+	ctx := context.Background()
+	assert.NoError(t, db.Exec("CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT UNIQUE)").Error)
+	assert.NoError(t, db.WithContext(ctx).Exec("INSERT INTO widgets (id, name) VALUES (1, 'a')").Error)
+
+	var conflict *interfaces.ConflictError
+	if assert.ErrorAs(t, database.MapError(db.Exec("INSERT INTO widgets (id, name) VALUES (2, 'a')").Error), &conflict) {
+		assert.Equal(t, "name", conflict.Field)
+	}
+	if assert.ErrorAs(t, database.MapError(db.Exec("INSERT INTO widgets (id, name) VALUES (1, 'b')").Error), &conflict) {
+		assert.Equal(t, "id", conflict.Field)
+	}
+}
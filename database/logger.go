@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/logging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// slowQueryThreshold is how long a query runs before it is logged as slow
+const slowQueryThreshold = 200 * time.Millisecond
+
+// slogLogger writes gorm logs to the default slog logger along with the ID of the request that made the query
+type slogLogger struct {
+	level logger.LogLevel
+}
+
+// NewLogger creates a gorm logger writing failed and slow queries to the default slog logger,
+// queries made with a request context are logged with its request ID
+func NewLogger() logger.Interface {
+	return &slogLogger{level: logger.Warn}
+}
+
+func (l *slogLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &slogLogger{level: level}
+}
+
+func (l *slogLogger) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if requestID := logging.RequestID(ctx); requestID != "" {
+		args = append(args, "request_id", requestID)
+	}
+	slog.Log(ctx, level, msg, args...)
+}
+
+func (l *slogLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Info {
+		l.log(ctx, slog.LevelInfo, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *slogLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Warn {
+		l.log(ctx, slog.LevelWarn, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *slogLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Error {
+		l.log(ctx, slog.LevelError, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *slogLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	switch {
+	// a missing record is an expected outcome that callers handle
+	case err != nil && l.level >= logger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		l.log(ctx, slog.LevelError, "Query failed", "sql", sql, "rows", rows, "elapsed", elapsed, "error", err)
+	case elapsed > slowQueryThreshold && l.level >= logger.Warn:
+		sql, rows := fc()
+		l.log(ctx, slog.LevelWarn, "Slow query", "sql", sql, "rows", rows, "elapsed", elapsed)
+	case l.level >= logger.Info:
+		sql, rows := fc()
+		l.log(ctx, slog.LevelDebug, "Query", "sql", sql, "rows", rows, "elapsed", elapsed)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 
-	"github.com/pressly/goose/v3"
 	"gorm.io/gorm"
 )
 
@@ -12,7 +11,7 @@ import (
 // to ensure consistent behavior in cases when the model changes in the future
 type v001setting struct {
 	ID    uint   `gorm:"primaryKey"`
-	Key   string `gorm:"uniqueIndex"`
+	Key   string `gorm:"uniqueIndex;size:255"`
 	Value string
 }
 
@@ -31,8 +30,8 @@ func (v001number) TableName() string {
 
 type v001user struct {
 	ID           uint   `gorm:"primaryKey"`
-	Username     string `gorm:"uniqueIndex;not null"`
-	Email        string `gorm:"uniqueIndex;not null"`
+	Username     string `gorm:"uniqueIndex;size:255;not null"`
+	Email        string `gorm:"uniqueIndex;size:255;not null"`
 	Role         string `gorm:"not null"`
 	PasswordHash string `gorm:"not null"`
 }
@@ -48,7 +47,8 @@ type V001Migration struct {
 
 // Up creates the user, settings and number tables
 func (m *V001Migration) Up(ctx context.Context, tx *sql.Tx) error {
-	mig := m.DB.Migrator()
+	db := withTx(ctx, &m.DB, tx)
+	mig := db.Migrator()
 	// needs to be consistent even when the model changes in the future
 	err := mig.CreateTable(&v001setting{})
 	if err != nil {
@@ -67,7 +67,8 @@ func (m *V001Migration) Up(ctx context.Context, tx *sql.Tx) error {
 
 // Down drops the user, settings and number tables
 func (m *V001Migration) Down(ctx context.Context, tx *sql.Tx) error {
-	mig := m.DB.Migrator()
+	db := withTx(ctx, &m.DB, tx)
+	mig := db.Migrator()
 	err := mig.DropTable(&v001setting{})
 	if err != nil {
 		return err
@@ -87,7 +88,11 @@ func (m *V001Migration) Down(ctx context.Context, tx *sql.Tx) error {
 
 // InitializeV001Migration initializes the first migration
 func InitializeV001Migration(db gorm.DB) *V001Migration {
-	migration := &V001Migration{DB: db}
-	goose.AddMigrationContext(migration.Up, migration.Down)
-	return migration
+	return &V001Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV001Migration(db)
+	})
 }
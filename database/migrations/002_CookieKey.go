@@ -6,7 +6,6 @@ import (
 	"database/sql"
 	"encoding/base64"
 
-	"github.com/pressly/goose/v3"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -18,6 +17,7 @@ type V002Migration struct {
 
 // Up adds a cookie encryption key to the settings table
 func (m *V002Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
 	// Generate a random 32-byte string
 	randomBytes := make([]byte, 32)
 	_, err := rand.Read(randomBytes)
@@ -25,7 +25,7 @@ func (m *V002Migration) Up(ctx context.Context, tx *sql.Tx) error {
 		return err
 	}
 	encodedValue := base64.StdEncoding.EncodeToString(randomBytes)
-	settingsModel := m.DB.Model(&v001setting{})
+	settingsModel := db.Model(&v001setting{})
 	err = settingsModel.Clauses(clause.OnConflict{
 		UpdateAll: true,
 	}).Create(&v001setting{
@@ -40,9 +40,10 @@ func (m *V002Migration) Up(ctx context.Context, tx *sql.Tx) error {
 
 // Down removes the cookie encryption key from the settings table
 func (m *V002Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
 	// Remove the row with the key cookie_encryption_key from the settings table using GORM
-	settingsModel := m.DB.Model(&v001setting{})
-	err := settingsModel.Where("key = ?", "cookie_encryption_key").Delete(&v001setting{}).Error
+	settingsModel := db.Model(&v001setting{})
+	err := settingsModel.Where(&v001setting{Key: "cookie_encryption_key"}).Delete(&v001setting{}).Error
 	if err != nil {
 		return err
 	}
@@ -52,7 +53,11 @@ func (m *V002Migration) Down(ctx context.Context, tx *sql.Tx) error {
 
 // InitializeV002Migration initializes the V002Migration
 func InitializeV002Migration(db gorm.DB) *V002Migration {
-	migration := &V002Migration{DB: db}
-	goose.AddMigrationContext(migration.Up, migration.Down)
-	return migration
+	return &V002Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV002Migration(db)
+	})
 }
@@ -5,7 +5,6 @@ import (
 	"database/sql"
 
 	"github.com/bryopsida/gofiber-pug-starter/services/password"
-	"github.com/pressly/goose/v3"
 	"gorm.io/gorm"
 )
 
@@ -16,9 +15,10 @@ type V003Migration struct {
 
 // Up creates the default admin user
 func (m *V003Migration) Up(ctx context.Context, tx *sql.Tx) error {
-	userModel := m.DB.Model(&v001user{})
+	db := withTx(ctx, &m.DB, tx)
+	userModel := db.Model(&v001user{})
 	// Initialize the password service
-	passwordService := password.NewPasswordService()
+	passwordService := password.NewPasswordServiceWithParams(password.DefaultParams)
 
 	// Hash the password "admin"
 	passwordHash, err := passwordService.Hash("admin")
@@ -44,7 +44,8 @@ func (m *V003Migration) Up(ctx context.Context, tx *sql.Tx) error {
 
 // Down removes the default admin user
 func (m *V003Migration) Down(ctx context.Context, tx *sql.Tx) error {
-	userModel := m.DB.Model(&v001user{})
+	db := withTx(ctx, &m.DB, tx)
+	userModel := db.Model(&v001user{})
 
 	// Remove the admin user from the database
 	if err := userModel.Where("username = ?", "admin").Delete(&v001user{}).Error; err != nil {
@@ -56,7 +57,11 @@ func (m *V003Migration) Down(ctx context.Context, tx *sql.Tx) error {
 
 // InitializeV003Migration initializes the V003Migration
 func InitializeV003Migration(db gorm.DB) *V003Migration {
-	migration := &V003Migration{DB: db}
-	goose.AddMigrationContext(migration.Up, migration.Down)
-	return migration
+	return &V003Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV003Migration(db)
+	})
 }
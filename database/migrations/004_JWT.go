@@ -6,7 +6,6 @@ import (
 	"database/sql"
 	"encoding/base64"
 
-	"github.com/pressly/goose/v3"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -18,6 +17,7 @@ type V004Migration struct {
 
 // Up adds a jwt signing key to the settings table
 func (m *V004Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
 	// Generate a random 32-byte string
 	randomBytes := make([]byte, 32)
 	_, err := rand.Read(randomBytes)
@@ -25,7 +25,7 @@ func (m *V004Migration) Up(ctx context.Context, tx *sql.Tx) error {
 		return err
 	}
 	encodedValue := base64.StdEncoding.EncodeToString(randomBytes)
-	settingsModel := m.DB.Model(&v001setting{})
+	settingsModel := db.Model(&v001setting{})
 	err = settingsModel.Clauses(clause.OnConflict{
 		UpdateAll: true,
 	}).Create(&v001setting{
@@ -40,9 +40,10 @@ func (m *V004Migration) Up(ctx context.Context, tx *sql.Tx) error {
 
 // Down removes the cookie encryption key from the settings table
 func (m *V004Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
 	// Remove the row with the key cookie_encryption_key from the settings table using GORM
-	settingsModel := m.DB.Model(&v001setting{})
-	err := settingsModel.Where("key = ?", "jwt_signing_key").Delete(&v001setting{}).Error
+	settingsModel := db.Model(&v001setting{})
+	err := settingsModel.Where(&v001setting{Key: "jwt_signing_key"}).Delete(&v001setting{}).Error
 	if err != nil {
 		return err
 	}
@@ -52,7 +53,11 @@ func (m *V004Migration) Down(ctx context.Context, tx *sql.Tx) error {
 
 // InitializeV004Migration initializes the V004Migration
 func InitializeV004Migration(db gorm.DB) *V004Migration {
-	migration := &V004Migration{DB: db}
-	goose.AddMigrationContext(migration.Up, migration.Down)
-	return migration
+	return &V004Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV004Migration(db)
+	})
 }
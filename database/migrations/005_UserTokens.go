@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type v005userToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Purpose   string `gorm:"index;not null"`
+	TokenHash string `gorm:"uniqueIndex;size:255;not null"`
+	Data      string
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+func (v005userToken) TableName() string {
+	return "user_tokens"
+}
+
+// V005Migration represents the fifth migration, creates the user tokens table used for invitations
+type V005Migration struct {
+	gorm.DB
+}
+
+// Up creates the user tokens table
+func (m *V005Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Migrator().CreateTable(&v005userToken{})
+}
+
+// Down drops the user tokens table
+func (m *V005Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Migrator().DropTable(&v005userToken{})
+}
+
+// InitializeV005Migration initializes the V005Migration
+func InitializeV005Migration(db gorm.DB) *V005Migration {
+	return &V005Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV005Migration(db)
+	})
+}
@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+type v006user struct {
+	ID           uint   `gorm:"primaryKey"`
+	Username     string `gorm:"uniqueIndex;size:255;not null"`
+	Email        string `gorm:"uniqueIndex;size:255;not null"`
+	Role         string `gorm:"not null"`
+	PasswordHash string `gorm:"not null"`
+	FirstName    string `gorm:"not null;default:''"`
+	LastName     string `gorm:"not null;default:''"`
+	AvatarKey    string `gorm:"not null;default:''"`
+}
+
+func (v006user) TableName() string {
+	return "users"
+}
+
+var v006columns = []string{"FirstName", "LastName", "AvatarKey"}
+
+// V006Migration represents the sixth migration, adds the profile columns to the users table
+type V006Migration struct {
+	gorm.DB
+}
+
+// Up adds the first name, last name and avatar key columns
+func (m *V006Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	mig := db.Migrator()
+	for _, column := range v006columns {
+		if err := mig.AddColumn(&v006user{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down drops the first name, last name and avatar key columns
+func (m *V006Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	mig := db.Migrator()
+	for _, column := range v006columns {
+		if err := mig.DropColumn(&v006user{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitializeV006Migration initializes the V006Migration
+func InitializeV006Migration(db gorm.DB) *V006Migration {
+	return &V006Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV006Migration(db)
+	})
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+type v007preferences struct {
+	UserID     uint   `gorm:"primaryKey;autoIncrement:false"`
+	Theme      string `gorm:"not null"`
+	Timezone   string `gorm:"not null"`
+	Locale     string `gorm:"not null"`
+	DateFormat string `gorm:"not null"`
+	PageSize   int    `gorm:"not null"`
+}
+
+func (v007preferences) TableName() string {
+	return "user_preferences"
+}
+
+// V007Migration represents the seventh migration, creates the user preferences table
+type V007Migration struct {
+	gorm.DB
+}
+
+// Up creates the user preferences table
+func (m *V007Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Migrator().CreateTable(&v007preferences{})
+}
+
+// Down drops the user preferences table
+func (m *V007Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Migrator().DropTable(&v007preferences{})
+}
+
+// InitializeV007Migration initializes the V007Migration
+func InitializeV007Migration(db gorm.DB) *V007Migration {
+	return &V007Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV007Migration(db)
+	})
+}
@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type v008user struct {
+	ID           uint       `gorm:"primaryKey"`
+	Username     string     `gorm:"uniqueIndex;size:255;not null"`
+	Email        string     `gorm:"uniqueIndex;size:255;not null"`
+	Role         string     `gorm:"not null"`
+	PasswordHash string     `gorm:"not null"`
+	FirstName    string     `gorm:"not null;default:''"`
+	LastName     string     `gorm:"not null;default:''"`
+	AvatarKey    string     `gorm:"not null;default:''"`
+	DeleteAfter  *time.Time `gorm:"index"`
+}
+
+func (v008user) TableName() string {
+	return "users"
+}
+
+// V008Migration represents the eighth migration, adds the scheduled deletion time to the users table
+type V008Migration struct {
+	gorm.DB
+}
+
+// Up adds the delete after column
+func (m *V008Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	mig := db.Migrator()
+	if err := mig.AddColumn(&v008user{}, "DeleteAfter"); err != nil {
+		return err
+	}
+	return mig.CreateIndex(&v008user{}, "DeleteAfter")
+}
+
+// Down drops the delete after column
+func (m *V008Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	mig := db.Migrator()
+	if err := mig.DropIndex(&v008user{}, "DeleteAfter"); err != nil {
+		return err
+	}
+	return mig.DropColumn(&v008user{}, "DeleteAfter")
+}
+
+// InitializeV008Migration initializes the V008Migration
+func InitializeV008Migration(db gorm.DB) *V008Migration {
+	return &V008Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV008Migration(db)
+	})
+}
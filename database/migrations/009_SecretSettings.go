@@ -0,0 +1,90 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"gorm.io/gorm"
+)
+
+type v009setting struct {
+	ID     uint   `gorm:"primaryKey"`
+	Key    string `gorm:"uniqueIndex;size:255"`
+	Value  string
+	Secret bool `gorm:"not null;default:false"`
+}
+
+func (v009setting) TableName() string {
+	return "settings"
+}
+
+// v009secretKeys are the settings created by earlier migrations that must not be stored in plaintext
+var v009secretKeys = []string{"cookie_encryption_key", "jwt_signing_key"}
+
+// V009Migration represents the ninth migration, marks settings as secret and encrypts the existing secrets in place
+type V009Migration struct {
+	gorm.DB
+	cipher interfaces.ISecretCipher
+}
+
+// Up adds the secret column and encrypts the cookie and jwt keys
+func (m *V009Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	if err := db.Migrator().AddColumn(&v009setting{}, "Secret"); err != nil {
+		return err
+	}
+	for _, key := range v009secretKeys {
+		var setting v009setting
+		err := db.Where(&v009setting{Key: key}).First(&setting).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		encrypted, err := m.cipher.Encrypt(setting.Value, setting.Key)
+		if err != nil {
+			return err
+		}
+		setting.Value = encrypted
+		setting.Secret = true
+		if err := db.Save(&setting).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down decrypts all secret settings and drops the secret column
+func (m *V009Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	var settings []v009setting
+	if err := db.Where("secret = ?", true).Find(&settings).Error; err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		decrypted, err := m.cipher.Decrypt(setting.Value, setting.Key)
+		if err != nil {
+			return err
+		}
+		setting.Value = decrypted
+		if err := db.Save(&setting).Error; err != nil {
+			return err
+		}
+	}
+	return db.Migrator().DropColumn(&v009setting{}, "Secret")
+}
+
+// InitializeV009Migration initializes the V009Migration
+// - cipher: encrypts the secret settings, it must use the same key encryption key as the settings repository
+func InitializeV009Migration(db gorm.DB, cipher interfaces.ISecretCipher) *V009Migration {
+	return &V009Migration{DB: db, cipher: cipher}
+}
+
+func init() {
+	register(func(db gorm.DB, deps Dependencies) Migration {
+		return InitializeV009Migration(db, deps.Cipher)
+	})
+}
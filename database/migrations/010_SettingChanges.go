@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type v010settingChange struct {
+	ID        uint   `gorm:"primaryKey"`
+	Key       string `gorm:"index;not null"`
+	OldValue  string
+	NewValue  string
+	Secret    bool   `gorm:"not null;default:false"`
+	Actor     string `gorm:"not null"`
+	RequestID string
+	CreatedAt time.Time
+}
+
+func (v010settingChange) TableName() string {
+	return "setting_changes"
+}
+
+// V010Migration represents the tenth migration, creates the append-only settings history table
+type V010Migration struct {
+	gorm.DB
+}
+
+// Up creates the setting changes table
+func (m *V010Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Migrator().CreateTable(&v010settingChange{})
+}
+
+// Down drops the setting changes table
+func (m *V010Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Migrator().DropTable(&v010settingChange{})
+}
+
+// InitializeV010Migration initializes the V010Migration
+func InitializeV010Migration(db gorm.DB) *V010Migration {
+	return &V010Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV010Migration(db)
+	})
+}
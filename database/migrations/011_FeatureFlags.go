@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type v011featureFlag struct {
+	ID          uint   `gorm:"primaryKey"`
+	Key         string `gorm:"uniqueIndex;size:255;not null"`
+	Description string
+	Enabled     bool `gorm:"not null;default:false"`
+	Percentage  int  `gorm:"not null;default:100"`
+	UserIDs     string
+	Roles       string
+	Groups      string
+	UpdatedAt   time.Time
+}
+
+func (v011featureFlag) TableName() string {
+	return "feature_flags"
+}
+
+// V011Migration represents the eleventh migration, creates the feature flags table
+type V011Migration struct {
+	gorm.DB
+}
+
+// Up creates the feature flags table
+func (m *V011Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Migrator().CreateTable(&v011featureFlag{})
+}
+
+// Down drops the feature flags table
+func (m *V011Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Migrator().DropTable(&v011featureFlag{})
+}
+
+// InitializeV011Migration initializes the V011Migration
+func InitializeV011Migration(db gorm.DB) *V011Migration {
+	return &V011Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV011Migration(db)
+	})
+}
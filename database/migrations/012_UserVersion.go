@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type v012user struct {
+	ID           uint       `gorm:"primaryKey"`
+	Username     string     `gorm:"uniqueIndex;size:255;not null"`
+	Email        string     `gorm:"uniqueIndex;size:255;not null"`
+	Role         string     `gorm:"not null"`
+	PasswordHash string     `gorm:"not null"`
+	FirstName    string     `gorm:"not null;default:''"`
+	LastName     string     `gorm:"not null;default:''"`
+	AvatarKey    string     `gorm:"not null;default:''"`
+	DeleteAfter  *time.Time `gorm:"index"`
+	Version      uint       `gorm:"not null;default:1"`
+}
+
+func (v012user) TableName() string {
+	return "users"
+}
+
+// V012Migration represents the twelfth migration, adds the version used to detect concurrent updates to the users table
+type V012Migration struct {
+	gorm.DB
+}
+
+// Up adds the version column, existing users start at version 1
+func (m *V012Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Migrator().AddColumn(&v012user{}, "Version")
+}
+
+// Down drops the version column
+func (m *V012Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	// the gorm SQLite migrator drops a column by rebuilding the table, which loses the indexes added by later migrations
+	return db.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: v012user{}.TableName()}, clause.Column{Name: "version"}).Error
+}
+
+// InitializeV012Migration initializes the V012Migration
+func InitializeV012Migration(db gorm.DB) *V012Migration {
+	return &V012Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV012Migration(db)
+	})
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type v013userSession struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Method    string `gorm:"not null"`
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+func (v013userSession) TableName() string {
+	return "user_sessions"
+}
+
+// V013Migration represents the thirteenth migration, creates the user sessions table that records sign ins
+type V013Migration struct {
+	gorm.DB
+}
+
+// Up creates the user sessions table
+func (m *V013Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Migrator().CreateTable(&v013userSession{})
+}
+
+// Down drops the user sessions table
+func (m *V013Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Migrator().DropTable(&v013userSession{})
+}
+
+// InitializeV013Migration initializes the V013Migration
+func InitializeV013Migration(db gorm.DB) *V013Migration {
+	return &V013Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV013Migration(db)
+	})
+}
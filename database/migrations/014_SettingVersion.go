@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type v014setting struct {
+	ID      uint `gorm:"primaryKey"`
+	Version uint `gorm:"not null;default:1"`
+}
+
+func (v014setting) TableName() string {
+	return "settings"
+}
+
+type v014featureFlag struct {
+	ID      uint `gorm:"primaryKey"`
+	Version uint `gorm:"not null;default:1"`
+}
+
+func (v014featureFlag) TableName() string {
+	return "feature_flags"
+}
+
+// V014Migration represents the fourteenth migration, adds the version used to detect concurrent updates
+// to the settings and feature flags tables
+type V014Migration struct {
+	gorm.DB
+}
+
+// Up adds the version columns, existing rows start at version 1
+func (m *V014Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	if err := db.Migrator().AddColumn(&v014setting{}, "Version"); err != nil {
+		return err
+	}
+	return db.Migrator().AddColumn(&v014featureFlag{}, "Version")
+}
+
+// Down drops the version columns
+func (m *V014Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	// the gorm SQLite migrator drops a column by rebuilding the table, which loses the indexes added by earlier migrations
+	for _, table := range []string{v014setting{}.TableName(), v014featureFlag{}.TableName()} {
+		if err := db.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: table}, clause.Column{Name: "version"}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitializeV014Migration initializes the V014Migration
+func InitializeV014Migration(db gorm.DB) *V014Migration {
+	return &V014Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV014Migration(db)
+	})
+}
@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+type v015settingChange struct {
+	ID      uint  `gorm:"primaryKey"`
+	ActorID *uint `gorm:"index"`
+}
+
+func (v015settingChange) TableName() string {
+	return "setting_changes"
+}
+
+// v015pseudoActors are the actors recorded for changes not made by a user, a user of the same name did not make them
+var v015pseudoActors = []string{"system", "cli", "deleted user"}
+
+// V015Migration represents the fifteenth migration, records the ID of the user that made a setting change
+// so their changes are found by ID rather than by a username that may match a pseudo actor
+type V015Migration struct {
+	gorm.DB
+}
+
+// Up adds the actor ID column and fills it for the changes made by users that still exist
+func (m *V015Migration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	if err := db.Migrator().AddColumn(&v015settingChange{}, "ActorID"); err != nil {
+		return err
+	}
+	if err := db.Migrator().CreateIndex(&v015settingChange{}, "ActorID"); err != nil {
+		return err
+	}
+	return db.Exec(`UPDATE setting_changes SET actor_id = (SELECT users.id FROM users WHERE users.username = setting_changes.actor)
+		WHERE actor NOT IN ?`, v015pseudoActors).Error
+}
+
+// Down drops the actor ID column, the recorded usernames are kept
+func (m *V015Migration) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	if err := db.Migrator().DropIndex(&v015settingChange{}, "ActorID"); err != nil {
+		return err
+	}
+	// the gorm SQLite migrator drops a column by rebuilding the table, which loses the indexes added by earlier migrations
+	return db.Exec("ALTER TABLE setting_changes DROP COLUMN actor_id").Error
+}
+
+// InitializeV015Migration initializes the V015Migration
+func InitializeV015Migration(db gorm.DB) *V015Migration {
+	return &V015Migration{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return InitializeV015Migration(db)
+	})
+}
@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/pressly/goose/v3"
+	"gorm.io/gorm"
+)
+
+//go:embed sql/*
+var sqlMigrations embed.FS
+
+// Migration is a Go migration, Up and Down run inside the transaction goose records the version in
+// and must run their statements on it, see withTx, so a failure rolls back the migration with its version
+type Migration interface {
+	Up(ctx context.Context, tx *sql.Tx) error
+	Down(ctx context.Context, tx *sql.Tx) error
+}
+
+// withTx returns a session of db that runs every statement in the goose transaction,
+// the gorm migrator nests its own transactions in it as savepoints.
+// MySQL commits schema changes implicitly so only the data changes of a failed migration are rolled back there
+func withTx(ctx context.Context, db *gorm.DB, tx *sql.Tx) *gorm.DB {
+	session := db.Session(&gorm.Session{Context: ctx, NewDB: true})
+	session.Statement.ConnPool = tx
+	return session
+}
+
+// Dependencies are passed to migrations that need more than the database
+type Dependencies struct {
+	// Cipher encrypts the secret settings, it must use the same key encryption key as the settings repository
+	Cipher interfaces.ISecretCipher
+}
+
+// registration is a migration registered by the file it is defined in
+type registration struct {
+	version int64
+	name    string
+	build   func(db gorm.DB, deps Dependencies) Migration
+}
+
+// registry holds every registered migration by version
+var registry = map[int64]registration{}
+
+// register adds a migration, it is called from the init function of the file the migration is defined in
+// and the version is the number that file name starts with, like goose does for its own registrations
+// - build: creates the migration for a database
+func register(build func(db gorm.DB, deps Dependencies) Migration) {
+	_, filename, _, ok := runtime.Caller(1)
+	if !ok {
+		panic("failed to find the file registering a migration")
+	}
+	version, err := goose.NumericComponent(filename)
+	if err != nil {
+		panic(fmt.Sprintf("migration file %s must start with its version: %v", filename, err))
+	}
+	if existing, ok := registry[version]; ok {
+		panic(fmt.Sprintf("migration %s has the same version as %s", filepath.Base(filename), existing.name))
+	}
+	registry[version] = registration{version: version, name: filepath.Base(filename), build: build}
+}
+
+// registrations returns the registered migrations ordered by version
+func registrations() []registration {
+	ordered := make([]registration, 0, len(registry))
+	for _, migration := range registry {
+		ordered = append(ordered, migration)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].version < ordered[j].version
+	})
+	return ordered
+}
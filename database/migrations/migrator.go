@@ -0,0 +1,312 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/bryopsida/gofiber-pug-starter/database"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/pressly/goose/v3"
+	"gorm.io/gorm"
+)
+
+// nameWord splits a migration name like add_widgets or add-widgets into its words
+var nameWord = regexp.MustCompile(`[A-Za-z0-9]+`)
+
+type migrator struct {
+	provider *goose.Provider
+	// names are the files the migrations are defined in by version
+	names map[int64]string
+}
+
+// NewMigrator creates a migrator for every registered migration
+// - db: the database to migrate
+// - dialect: the goose dialect of the database
+// - deps: passed to the migrations that need more than the database
+func NewMigrator(db *gorm.DB, dialect string, deps Dependencies) (interfaces.IMigrator, error) {
+	return newMigrator(db, dialect, deps, registrations())
+}
+
+// newMigrator creates a migrator for a set of registrations ordered by version
+func newMigrator(db *gorm.DB, dialect string, deps Dependencies, registered []registration) (*migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	names := map[int64]string{}
+	goMigrations := []*goose.Migration{}
+	for _, registration := range registered {
+		migration := registration.build(*db, deps)
+		names[registration.version] = registration.name
+		goMigrations = append(goMigrations, goose.NewGoMigration(registration.version,
+			&goose.GoFunc{RunTx: migration.Up}, &goose.GoFunc{RunTx: migration.Down}))
+	}
+	sqlFS, err := fs.Sub(sqlMigrations, "sql")
+	if err != nil {
+		return nil, err
+	}
+	provider, err := goose.NewProvider(goose.Dialect(dialect), sqlDB, sqlFS,
+		goose.WithGoMigrations(goMigrations...), goose.WithDisableGlobalRegistry(true))
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{provider: provider, names: names}, nil
+}
+
+// name returns the file a migration is defined in
+func (m *migrator) name(source *goose.Source) string {
+	if name, ok := m.names[source.Version]; ok {
+		return name
+	}
+	return filepath.Base(source.Path)
+}
+
+func (m *migrator) Status(ctx context.Context) ([]interfaces.MigrationStatus, error) {
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	retStatuses := make([]interfaces.MigrationStatus, len(statuses))
+	for i, status := range statuses {
+		retStatuses[i] = interfaces.MigrationStatus{
+			Version:   status.Source.Version,
+			Name:      m.name(status.Source),
+			Applied:   status.State == goose.StateApplied,
+			AppliedAt: status.AppliedAt,
+		}
+	}
+	return retStatuses, nil
+}
+
+func (m *migrator) HasPending(ctx context.Context) (bool, error) {
+	return m.provider.HasPending(ctx)
+}
+
+func (m *migrator) Version(ctx context.Context) (int64, error) {
+	return m.provider.GetDBVersion(ctx)
+}
+
+func (m *migrator) Up(ctx context.Context, dryRun bool) ([]interfaces.MigrationStep, error) {
+	if dryRun {
+		return m.plan(ctx, interfaces.MigrationUp, 0)
+	}
+	// migrations can rewrite whole tables so they are not limited by the query timeout
+	return m.steps(m.provider.Up(database.WithoutQueryTimeout(ctx)))
+}
+
+func (m *migrator) UpTo(ctx context.Context, version int64, dryRun bool) ([]interfaces.MigrationStep, error) {
+	if dryRun {
+		return m.plan(ctx, interfaces.MigrationUp, version)
+	}
+	return m.steps(m.provider.UpTo(database.WithoutQueryTimeout(ctx), version))
+}
+
+func (m *migrator) Down(ctx context.Context, dryRun bool) ([]interfaces.MigrationStep, error) {
+	latest, err := m.latestApplied(ctx)
+	if err != nil || latest == nil {
+		return nil, err
+	}
+	if dryRun {
+		return []interfaces.MigrationStep{m.step(latest.Source, interfaces.MigrationDown)}, nil
+	}
+	result, err := m.provider.Down(database.WithoutQueryTimeout(ctx))
+	return m.steps([]*goose.MigrationResult{result}, err)
+}
+
+func (m *migrator) DownTo(ctx context.Context, version int64, dryRun bool) ([]interfaces.MigrationStep, error) {
+	if dryRun {
+		return m.plan(ctx, interfaces.MigrationDown, version)
+	}
+	return m.steps(m.provider.DownTo(database.WithoutQueryTimeout(ctx), version))
+}
+
+func (m *migrator) Redo(ctx context.Context, dryRun bool) ([]interfaces.MigrationStep, error) {
+	latest, err := m.latestApplied(ctx)
+	if err != nil || latest == nil {
+		return nil, err
+	}
+	if dryRun {
+		return []interfaces.MigrationStep{
+			m.step(latest.Source, interfaces.MigrationDown),
+			m.step(latest.Source, interfaces.MigrationUp),
+		}, nil
+	}
+	ctx = database.WithoutQueryTimeout(ctx)
+	down, err := m.provider.ApplyVersion(ctx, latest.Source.Version, false)
+	steps, err := m.steps([]*goose.MigrationResult{down}, err)
+	if err != nil {
+		return steps, err
+	}
+	up, err := m.provider.ApplyVersion(ctx, latest.Source.Version, true)
+	upSteps, err := m.steps([]*goose.MigrationResult{up}, err)
+	return append(steps, upSteps...), err
+}
+
+// latestApplied returns the applied migration with the highest version, nil if none is applied
+func (m *migrator) latestApplied(ctx context.Context) (*goose.MigrationStatus, error) {
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(statuses) - 1; i >= 0; i-- {
+		if statuses[i].State == goose.StateApplied {
+			return statuses[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// plan returns the steps a run would take without running them
+// - direction: MigrationUp applies the pending migrations up to version, 0 applies all of them,
+// MigrationDown rolls back the applied migrations newer than version
+func (m *migrator) plan(ctx context.Context, direction string, version int64) ([]interfaces.MigrationStep, error) {
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	steps := []interfaces.MigrationStep{}
+	if direction == interfaces.MigrationUp {
+		for _, status := range statuses {
+			if status.State == goose.StatePending && (version == 0 || status.Source.Version <= version) {
+				steps = append(steps, m.step(status.Source, direction))
+			}
+		}
+		return steps, nil
+	}
+	for i := len(statuses) - 1; i >= 0; i-- {
+		if statuses[i].State == goose.StateApplied && statuses[i].Source.Version > version {
+			steps = append(steps, m.step(statuses[i].Source, direction))
+		}
+	}
+	return steps, nil
+}
+
+func (m *migrator) step(source *goose.Source, direction string) interfaces.MigrationStep {
+	return interfaces.MigrationStep{Version: source.Version, Name: m.name(source), Direction: direction}
+}
+
+// steps converts the results of a run, the migrations that ran before an error are included
+func (m *migrator) steps(results []*goose.MigrationResult, err error) ([]interfaces.MigrationStep, error) {
+	var partial *goose.PartialError
+	if errors.As(err, &partial) {
+		results = partial.Applied
+		if partial.Failed != nil {
+			err = fmt.Errorf("migration %s failed: %w", m.name(partial.Failed.Source), partial.Err)
+		}
+	}
+	steps := []interfaces.MigrationStep{}
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		step := m.step(result.Source, result.Direction)
+		step.Duration = result.Duration
+		steps = append(steps, step)
+	}
+	if errors.Is(err, goose.ErrNoNextVersion) {
+		err = nil
+	}
+	return steps, err
+}
+
+// skeleton is the source of a new migration, it follows the pattern of the existing migrations
+var skeleton = template.Must(template.New("migration").Parse(`package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+// {{ .Type }} {{ .Description }}
+type {{ .Type }} struct {
+	gorm.DB
+}
+
+// Up {{ .Description }}
+func (m *{{ .Type }}) Up(ctx context.Context, tx *sql.Tx) error {
+	// run every statement on db so a failure rolls back the whole migration
+	db := withTx(ctx, &m.DB, tx)
+	return db.Error
+}
+
+// Down reverts {{ .Type }}
+func (m *{{ .Type }}) Down(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	return db.Error
+}
+
+// Initialize{{ .Type }} initializes the {{ .Type }}
+func Initialize{{ .Type }}(db gorm.DB) *{{ .Type }} {
+	return &{{ .Type }}{DB: db}
+}
+
+func init() {
+	register(func(db gorm.DB, _ Dependencies) Migration {
+		return Initialize{{ .Type }}(db)
+	})
+}
+`))
+
+func (m *migrator) Create(dir string, name string, dryRun bool) (string, error) {
+	words := nameWord.FindAllString(name, -1)
+	if len(words) == 0 {
+		return "", errors.New("migration name must contain letters or digits")
+	}
+	// the next version follows both the compiled in migrations and files created since the build
+	version := int64(0)
+	for known := range m.names {
+		version = max(version, known)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if known, err := goose.NumericComponent(file); err == nil {
+			version = max(version, known)
+		}
+	}
+	version++
+
+	title := make([]string, len(words))
+	for i, word := range words {
+		title[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%03d_%s.go", version, strings.Join(title, "")))
+	var source bytes.Buffer
+	err = skeleton.Execute(&source, map[string]string{
+		"Type":        fmt.Sprintf("V%03dMigration", version),
+		"Description": strings.ToLower(strings.Join(words, " ")),
+	})
+	if err != nil {
+		return "", err
+	}
+	formatted, err := format.Source(source.Bytes())
+	if err != nil {
+		return "", err
+	}
+	if dryRun {
+		return path, nil
+	}
+	// O_EXCL so a file created concurrently is never overwritten
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(formatted); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
@@ -0,0 +1,157 @@
+package migrations
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/crypto/envelope"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB returns an empty SQLite database and the dependencies of the migrations
+func openTestDB(t *testing.T) (*gorm.DB, Dependencies) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "db.sqlite")), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	require.NoError(t, err)
+	cipher, err := envelope.NewEnvelopeCipher(key)
+	require.NoError(t, err)
+	return db, Dependencies{Cipher: cipher}
+}
+
+// newTestMigrator returns a migrator for an empty SQLite database and the number of registered migrations
+func newTestMigrator(t *testing.T) (interfaces.IMigrator, *gorm.DB, int64) {
+	db, deps := openTestDB(t)
+	migrator, err := NewMigrator(db, "sqlite3", deps)
+	require.NoError(t, err)
+	ordered := registrations()
+	return migrator, db, ordered[len(ordered)-1].version
+}
+
+func TestStatusBeforeMigrating(t *testing.T) {
+	migrator, _, latest := newTestMigrator(t)
+	statuses, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, statuses, int(latest))
+	assert.Equal(t, "001_Initial.go", statuses[0].Name)
+	for _, status := range statuses {
+		assert.False(t, status.Applied)
+	}
+	pending, err := migrator.HasPending(context.Background())
+	require.NoError(t, err)
+	assert.True(t, pending)
+}
+
+func TestUpDryRunChangesNothing(t *testing.T) {
+	migrator, db, latest := newTestMigrator(t)
+	steps, err := migrator.Up(context.Background(), true)
+	require.NoError(t, err)
+	assert.Len(t, steps, int(latest))
+	assert.Equal(t, interfaces.MigrationUp, steps[0].Direction)
+	assert.False(t, db.Migrator().HasTable("users"))
+}
+
+func TestUpToAndDown(t *testing.T) {
+	ctx := context.Background()
+	migrator, db, latest := newTestMigrator(t)
+	steps, err := migrator.UpTo(ctx, 3, false)
+	require.NoError(t, err)
+	assert.Len(t, steps, 3)
+	assert.True(t, db.Migrator().HasTable("users"))
+
+	steps, err = migrator.Up(ctx, false)
+	require.NoError(t, err)
+	assert.Len(t, steps, int(latest)-3)
+	pending, err := migrator.HasPending(ctx)
+	require.NoError(t, err)
+	assert.False(t, pending)
+
+	steps, err = migrator.Up(ctx, false)
+	require.NoError(t, err)
+	assert.Empty(t, steps, "nothing is left to apply")
+
+	steps, err = migrator.Down(ctx, true)
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+	assert.Equal(t, latest, steps[0].Version)
+	assert.Equal(t, interfaces.MigrationDown, steps[0].Direction)
+
+	steps, err = migrator.Down(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.False(t, statuses[latest-1].Applied)
+	assert.True(t, statuses[latest-2].Applied)
+}
+
+func TestDownToZeroAndUpAgain(t *testing.T) {
+	ctx := context.Background()
+	migrator, db, latest := newTestMigrator(t)
+	_, err := migrator.Up(ctx, false)
+	require.NoError(t, err)
+	steps, err := migrator.DownTo(ctx, 0, false)
+	require.NoError(t, err)
+	assert.Len(t, steps, int(latest))
+	assert.False(t, db.Migrator().HasTable("users"))
+	steps, err = migrator.Up(ctx, false)
+	require.NoError(t, err)
+	assert.Len(t, steps, int(latest))
+}
+
+func TestRedo(t *testing.T) {
+	ctx := context.Background()
+	migrator, _, latest := newTestMigrator(t)
+	_, err := migrator.Up(ctx, false)
+	require.NoError(t, err)
+	steps, err := migrator.Redo(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+	assert.Equal(t, interfaces.MigrationDown, steps[0].Direction)
+	assert.Equal(t, interfaces.MigrationUp, steps[1].Direction)
+	assert.Equal(t, latest, steps[1].Version)
+	pending, err := migrator.HasPending(ctx)
+	require.NoError(t, err)
+	assert.False(t, pending)
+}
+
+func TestCreate(t *testing.T) {
+	migrator, _, latest := newTestMigrator(t)
+	dir := t.TempDir()
+	path, err := migrator.Create(dir, "add widgets", true)
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "a dry run does not write the file")
+
+	path, err = migrator.Create(dir, "add-widgets", false)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, fmt.Sprintf("%03d_AddWidgets.go", latest+1)), path)
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	require.NoError(t, err)
+	assert.NotNil(t, file.Scope.Lookup(fmt.Sprintf("V%03dMigration", latest+1)))
+	assert.NotNil(t, file.Scope.Lookup(fmt.Sprintf("InitializeV%03dMigration", latest+1)))
+
+	path, err = migrator.Create(dir, "add_gadgets", false)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, fmt.Sprintf("%03d_AddGadgets.go", latest+2)), path, "files created since the build are numbered after")
+
+	_, err = migrator.Create(dir, "--", false)
+	assert.Error(t, err)
+}
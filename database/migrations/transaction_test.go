@@ -0,0 +1,167 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failingMigration runs a migration and then fails, so everything the migration did must be rolled back
+type failingMigration struct {
+	Migration
+	failUp   bool
+	failDown bool
+}
+
+func (m *failingMigration) Up(ctx context.Context, tx *sql.Tx) error {
+	if err := m.Migration.Up(ctx, tx); err != nil {
+		return err
+	}
+	if m.failUp {
+		return errInjected
+	}
+	return nil
+}
+
+func (m *failingMigration) Down(ctx context.Context, tx *sql.Tx) error {
+	if err := m.Migration.Down(ctx, tx); err != nil {
+		return err
+	}
+	if m.failDown {
+		return errInjected
+	}
+	return nil
+}
+
+// withFailure returns the registered migrations with the migration of a version failing after it runs
+func withFailure(version int64, failUp bool, failDown bool) []registration {
+	registered := registrations()
+	for i, registration := range registered {
+		if registration.version != version {
+			continue
+		}
+		build := registration.build
+		registered[i].build = func(db gorm.DB, deps Dependencies) Migration {
+			return &failingMigration{Migration: build(db, deps), failUp: failUp, failDown: failDown}
+		}
+	}
+	return registered
+}
+
+type widget struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+// widgetMigration creates a table and a setting before failing
+type widgetMigration struct {
+	gorm.DB
+}
+
+func (m *widgetMigration) Up(ctx context.Context, tx *sql.Tx) error {
+	db := withTx(ctx, &m.DB, tx)
+	if err := db.Migrator().CreateTable(&widget{}); err != nil {
+		return err
+	}
+	if err := db.Create(&widget{Name: "sprocket"}).Error; err != nil {
+		return err
+	}
+	if err := db.Create(&v009setting{Key: "widgets_enabled", Value: "true"}).Error; err != nil {
+		return err
+	}
+	return errInjected
+}
+
+func (m *widgetMigration) Down(ctx context.Context, tx *sql.Tx) error {
+	return withTx(ctx, &m.DB, tx).Migrator().DropTable(&widget{})
+}
+
+func appliedVersions(t *testing.T, m *migrator) []int64 {
+	statuses, err := m.Status(context.Background())
+	require.NoError(t, err)
+	applied := []int64{}
+	for _, status := range statuses {
+		if status.Applied {
+			applied = append(applied, status.Version)
+		}
+	}
+	return applied
+}
+
+func TestFailedMigrationRollsBackSchemaAndData(t *testing.T) {
+	db, deps := openTestDB(t)
+	registered := registrations()
+	latest := registered[len(registered)-1].version
+	registered = append(registered, registration{
+		version: latest + 1,
+		name:    "widgets.go",
+		build: func(db gorm.DB, _ Dependencies) Migration {
+			return &widgetMigration{DB: db}
+		},
+	})
+	m, err := newMigrator(db, "sqlite3", deps, registered)
+	require.NoError(t, err)
+
+	steps, err := m.Up(context.Background(), false)
+	assert.ErrorIs(t, err, errInjected)
+	assert.ErrorContains(t, err, "widgets.go")
+	assert.Len(t, steps, int(latest), "the migrations before the failure stay applied")
+	assert.False(t, db.Migrator().HasTable(&widget{}))
+	var count int64
+	require.NoError(t, db.Model(&v009setting{}).Where(&v009setting{Key: "widgets_enabled"}).Count(&count).Error)
+	assert.Zero(t, count)
+	assert.NotContains(t, appliedVersions(t, m), latest+1)
+}
+
+func TestFailedColumnMigrationRollsBack(t *testing.T) {
+	db, deps := openTestDB(t)
+	m, err := newMigrator(db, "sqlite3", deps, withFailure(6, true, false))
+	require.NoError(t, err)
+
+	_, err = m.Up(context.Background(), false)
+	assert.ErrorIs(t, err, errInjected)
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, appliedVersions(t, m))
+	for _, column := range v006columns {
+		assert.False(t, db.Migrator().HasColumn(&v006user{}, column), column)
+	}
+}
+
+func TestFailedDataMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db, deps := openTestDB(t)
+	m, err := newMigrator(db, "sqlite3", deps, withFailure(9, true, false))
+	require.NoError(t, err)
+	_, err = m.UpTo(ctx, 8, false)
+	require.NoError(t, err)
+	var before v001setting
+	require.NoError(t, db.Where(&v001setting{Key: "jwt_signing_key"}).First(&before).Error)
+
+	_, err = m.Up(ctx, false)
+	assert.ErrorIs(t, err, errInjected)
+	assert.NotContains(t, appliedVersions(t, m), int64(9))
+	assert.False(t, db.Migrator().HasColumn(&v009setting{}, "Secret"))
+	var after v001setting
+	require.NoError(t, db.Where(&v001setting{Key: "jwt_signing_key"}).First(&after).Error)
+	assert.Equal(t, before.Value, after.Value, "the key is not left encrypted")
+}
+
+func TestFailedDownMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db, deps := openTestDB(t)
+	m, err := newMigrator(db, "sqlite3", deps, withFailure(11, false, true))
+	require.NoError(t, err)
+	_, err = m.Up(ctx, false)
+	require.NoError(t, err)
+
+	_, err = m.DownTo(ctx, 10, false)
+	assert.ErrorIs(t, err, errInjected)
+	assert.Contains(t, appliedVersions(t, m), int64(11))
+	assert.True(t, db.Migrator().HasTable(&v011featureFlag{}))
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// noQueryTimeoutKey marks a context whose queries are not limited by the query timeout
+type noQueryTimeoutKey struct{}
+
+// queryTimeoutCancelKey is the statement instance key the cancel function of a query is kept under
+const queryTimeoutCancelKey = "database:query_timeout_cancel"
+
+// WithoutQueryTimeout returns a context whose queries may run for as long as the context allows,
+// for long running work such as migrations and backups
+func WithoutQueryTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noQueryTimeoutKey{}, true)
+}
+
+// UseQueryTimeout cancels every query that runs for longer than a timeout, the timeout applies to each
+// statement on its own so the statements of a transaction or a batched read each get the full timeout
+// - db: the database to register the callbacks on
+// - timeout: how long a query may run, 0 does nothing
+// Returns an error if the callbacks cannot be registered
+func UseQueryTimeout(db *gorm.DB, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+	start := func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if ctx.Value(noQueryTimeoutKey{}) != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		tx.Statement.Context = ctx
+		tx.InstanceSet(queryTimeoutCancelKey, cancel)
+	}
+	finish := func(tx *gorm.DB) {
+		if cancel, ok := tx.InstanceGet(queryTimeoutCancelKey); ok {
+			cancel.(context.CancelFunc)()
+		}
+	}
+	callbacks := db.Callback()
+	// rows read with Rows and Row outlive their callbacks, so they are left to the request context
+	return errors.Join(
+		callbacks.Create().Before("*").Register("database:query_timeout_start", start),
+		callbacks.Create().After("*").Register("database:query_timeout_finish", finish),
+		callbacks.Query().Before("*").Register("database:query_timeout_start", start),
+		callbacks.Query().After("*").Register("database:query_timeout_finish", finish),
+		callbacks.Update().Before("*").Register("database:query_timeout_start", start),
+		callbacks.Update().After("*").Register("database:query_timeout_finish", finish),
+		callbacks.Delete().Before("*").Register("database:query_timeout_start", start),
+		callbacks.Delete().After("*").Register("database:query_timeout_finish", finish),
+		callbacks.Raw().Before("*").Register("database:query_timeout_start", start),
+		callbacks.Raw().After("*").Register("database:query_timeout_finish", finish),
+	)
+}
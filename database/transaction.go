@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"gorm.io/gorm"
+)
+
+// txKey is the context key the transaction of a context is kept under
+type txKey struct{}
+
+// transaction is a running transaction and the functions to call once it commits
+type transaction struct {
+	tx *gorm.DB
+
+	mu          sync.Mutex
+	afterCommit []func()
+}
+
+func (t *transaction) addAfterCommit(fns ...func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.afterCommit = append(t.afterCommit, fns...)
+}
+
+type transactionManager struct {
+	db *gorm.DB
+}
+
+// NewTransactionManager creates a transaction manager for a database
+// - db: the database transactions are started on
+func NewTransactionManager(db *gorm.DB) interfaces.ITransactionManager {
+	return &transactionManager{db: db}
+}
+
+func (m *transactionManager) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	parent, _ := ctx.Value(txKey{}).(*transaction)
+	current := &transaction{}
+	err := Conn(ctx, m.db).Transaction(func(tx *gorm.DB) error {
+		current.tx = tx
+		return fn(context.WithValue(ctx, txKey{}, current))
+	})
+	if err != nil {
+		return err
+	}
+	if parent != nil {
+		// a nested transaction only commits with the transaction it runs in
+		parent.addAfterCommit(current.afterCommit...)
+		return nil
+	}
+	for _, fn := range current.afterCommit {
+		fn()
+	}
+	return nil
+}
+
+func (m *transactionManager) AfterCommit(ctx context.Context, fn func()) {
+	if current, ok := ctx.Value(txKey{}).(*transaction); ok {
+		current.addAfterCommit(fn)
+		return
+	}
+	fn()
+}
+
+// Conn returns the session repositories run their queries on, the transaction of the context when there is one
+// - ctx: the context of the call, it may carry a transaction started by a transaction manager
+// - db: the database used when the context has no transaction
+func Conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if current, ok := ctx.Value(txKey{}).(*transaction); ok {
+		return current.tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
@@ -0,0 +1,114 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/database"
+	"github.com/bryopsida/gofiber-pug-starter/database/dbtest"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	number_repository "github.com/bryopsida/gofiber-pug-starter/repositories/number"
+	settings_repository "github.com/bryopsida/gofiber-pug-starter/repositories/settings"
+	users_repository "github.com/bryopsida/gofiber-pug-starter/repositories/users"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestTransactionManager(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *gorm.DB, cipher interfaces.ISecretCipher) {
+		ctx := context.Background()
+		transactions := database.NewTransactionManager(db)
+		numbers := number_repository.NewNumberRepository(db)
+		settings := settings_repository.NewSettingsRepository(db, cipher)
+		users := users_repository.NewUserRepository(db)
+		actor := interfaces.SettingActor{Username: interfaces.SettingActorSystem}
+		write := func(ctx context.Context, name string) error {
+			if err := users.CreateUser(ctx, &interfaces.User{Username: name, Email: name + "@example.com", Role: interfaces.RoleUser}); err != nil {
+				return err
+			}
+			if err := numbers.Save(ctx, interfaces.Number{ID: name, Number: 1}); err != nil {
+				return err
+			}
+			return settings.SetMany(ctx, map[string]string{name: "1"}, actor)
+		}
+		written := func(name string) bool {
+			_, userErr := users.GetUserByUsername(ctx, name)
+			_, numberErr := numbers.FindByID(ctx, name)
+			all, err := settings.GetAll(ctx)
+			require.NoError(t, err)
+			_, setting := all[name]
+			assert.Equal(t, userErr == nil, numberErr == nil, "the user and number of %s are written together", name)
+			assert.Equal(t, userErr == nil, setting, "the user and setting of %s are written together", name)
+			return userErr == nil
+		}
+
+		err := transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := write(ctx, "rolledback"); err != nil {
+				return err
+			}
+			return assert.AnError
+		})
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.False(t, written("rolledback"), "nothing is written when the work fails")
+
+		assert.NoError(t, transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+			return write(ctx, "committed")
+		}))
+		assert.True(t, written("committed"))
+
+		assert.NoError(t, transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := write(ctx, "outer"); err != nil {
+				return err
+			}
+			err := transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+				if err := write(ctx, "inner"); err != nil {
+					return err
+				}
+				return assert.AnError
+			})
+			assert.ErrorIs(t, err, assert.AnError)
+			return nil
+		}))
+		assert.True(t, written("outer"))
+		assert.False(t, written("inner"), "a failed nested transaction only rolls back its own work")
+	})
+}
+
+func TestTransactionManagerAfterCommit(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *gorm.DB, cipher interfaces.ISecretCipher) {
+		ctx := context.Background()
+		transactions := database.NewTransactionManager(db)
+		ran := []string{}
+		hook := func(name string) func() {
+			return func() { ran = append(ran, name) }
+		}
+
+		transactions.AfterCommit(ctx, hook("immediate"))
+		assert.Equal(t, []string{"immediate"}, ran, "hooks outside a transaction run right away")
+
+		ran = []string{}
+		err := transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+			transactions.AfterCommit(ctx, hook("rolledback"))
+			return assert.AnError
+		})
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Empty(t, ran, "hooks of a rolled back transaction are dropped")
+
+		assert.NoError(t, transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+			transactions.AfterCommit(ctx, hook("outer"))
+			assert.NoError(t, transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+				transactions.AfterCommit(ctx, hook("inner"))
+				return nil
+			}))
+			err := transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+				transactions.AfterCommit(ctx, hook("failed"))
+				return assert.AnError
+			})
+			assert.ErrorIs(t, err, assert.AnError)
+			assert.Empty(t, ran, "hooks of a nested transaction wait for the outer one")
+			return nil
+		}))
+		assert.Equal(t, []string{"outer", "inner"}, ran)
+	})
+}
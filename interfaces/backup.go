@@ -0,0 +1,63 @@
+package interfaces
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// BackupOptions choose how a backup is encoded
+type BackupOptions struct {
+	// Compress gzip compresses the backup
+	Compress bool
+	// Encrypt encrypts the backup with the key encryption key, after it is compressed
+	Encrypt bool
+}
+
+// BackupFile is a backup in the backup path
+type BackupFile struct {
+	Name      string
+	Size      int64
+	CreatedAt time.Time
+}
+
+// IBackupSnapshot is a consistent copy of the database taken before it is written anywhere
+type IBackupSnapshot interface {
+	// Encode writes the snapshot, compressed and encrypted as asked when it was taken
+	// - w: where the backup is written
+	Encode(w io.Writer) error
+	// Close removes the copy, the snapshot cannot be written afterwards
+	Close() error
+}
+
+// IBackupService takes consistent snapshots of the running SQLite database and restores them,
+// every method returns ErrBackupUnsupported for other databases
+type IBackupService interface {
+	// Backup writes a snapshot of the database
+	// - w: where the backup is written
+	// - options: whether the backup is compressed and encrypted
+	Backup(ctx context.Context, w io.Writer, options BackupOptions) error
+	// Snapshot copies the database to be written later, so a failure is known before anything is written.
+	// The snapshot must be closed
+	// - options: whether the backup is compressed and encrypted
+	Snapshot(ctx context.Context, options BackupOptions) (IBackupSnapshot, error)
+	// BackupToPath writes a snapshot to a new file in the backup path and removes the oldest backups beyond the retention
+	// Returns the path of the new backup
+	BackupToPath(ctx context.Context, options BackupOptions) (string, error)
+	// FileName returns the name a backup taken now is saved as
+	FileName(options BackupOptions) string
+	// List returns the backups in the backup path, newest first
+	List() ([]BackupFile, error)
+	// Restore replaces the database with a backup, compressed and encrypted backups are detected.
+	// The backup must be a database of this application that the migrations know the schema version of.
+	// The previous database is kept next to it with a .pre-restore suffix and the database connection is closed,
+	// so the server must be stopped first, the process restoring must not call LockShared
+	// - r: the backup
+	// Returns ErrDatabaseInUse if another process holds the lock of LockShared,
+	// or ErrBackupInvalid if the backup cannot be restored
+	Restore(ctx context.Context, r io.Reader) error
+	// LockShared marks the database as in use by this process until it exits, so a restore refuses to replace it.
+	// Platforms without file locks are not protected. Does nothing for databases that are not SQLite files
+	// Returns ErrDatabaseInUse while a restore is running
+	LockShared(ctx context.Context) error
+}
@@ -1,13 +1,216 @@
 package interfaces
 
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	// DatabaseDriverSQLite stores data in a SQLite file
+	DatabaseDriverSQLite = "sqlite"
+	// DatabaseDriverPostgres stores data in PostgreSQL
+	DatabaseDriverPostgres = "postgres"
+	// DatabaseDriverMySQL stores data in MySQL
+	DatabaseDriverMySQL = "mysql"
+)
+
+const (
+	// ConfigKeyLogLevel is the minimum level logged, debug, info, warn or error
+	ConfigKeyLogLevel = "log.level"
+	// ConfigKeyCORSAllowOrigins lists the origins allowed to make cross origin requests
+	ConfigKeyCORSAllowOrigins = "server.cors.allow_origins"
+	// ConfigKeyCORSAllowMethods lists the methods allowed in cross origin requests
+	ConfigKeyCORSAllowMethods = "server.cors.allow_methods"
+	// ConfigKeyCORSAllowHeaders lists the headers allowed in cross origin requests, empty allows the requested headers
+	ConfigKeyCORSAllowHeaders = "server.cors.allow_headers"
+	// ConfigKeyCORSAllowCredentials allows cross origin requests to send cookies, it cannot be combined with any origin
+	ConfigKeyCORSAllowCredentials = "server.cors.allow_credentials"
+	// ConfigKeyCORSMaxAge is how long browsers may cache a preflight response
+	ConfigKeyCORSMaxAge = "server.cors.max_age"
+	// ConfigKeyRateLimitMax is the number of requests a client can make per window, 0 disables rate limiting
+	ConfigKeyRateLimitMax = "server.rate_limit.max"
+	// ConfigKeyRateLimitWindow is the window requests are counted in
+	ConfigKeyRateLimitWindow = "server.rate_limit.window"
+	// ConfigKeyServerTLSCert is the PEM encoded server certificate
+	ConfigKeyServerTLSCert = "server.tls.cert"
+	// ConfigKeyServerTLSCertPath is the file the server certificate is read from
+	ConfigKeyServerTLSCertPath = "server.tls.cert_path"
+	// ConfigKeyServerTLSKey is the PEM encoded server key
+	ConfigKeyServerTLSKey = "server.tls.key"
+	// ConfigKeyServerTLSKeyPath is the file the server key is read from
+	ConfigKeyServerTLSKeyPath = "server.tls.key_path"
+	// ConfigKeyServerTLSCA is the PEM encoded CA client certificates are verified against
+	ConfigKeyServerTLSCA = "server.tls.ca"
+	// ConfigKeyServerTLSCAPath is the file the client CA is read from
+	ConfigKeyServerTLSCAPath = "server.tls.ca_path"
+	// ConfigKeyServerTLSClientAuth is none, optional or require
+	ConfigKeyServerTLSClientAuth = "server.tls.client_auth"
+)
+
+// Argon2Params are the argon2id parameters new password hashes are made with, existing hashes keep theirs
+type Argon2Params struct {
+	// Time is the number of passes over the memory
+	Time uint32
+	// Memory is the memory used in KiB
+	Memory uint32
+	// Threads is the number of lanes hashed in parallel
+	Threads uint8
+	// KeyLength is the length of the hash in bytes
+	KeyLength uint32
+	// SaltLength is the length of the random salt in bytes
+	SaltLength uint32
+}
+
+// SMTP TLS modes
+const (
+	// SMTPTLSStartTLS upgrades the connection with STARTTLS and fails if the server does not offer it
+	SMTPTLSStartTLS = "starttls"
+	// SMTPTLSImplicit connects with TLS, usually on port 465
+	SMTPTLSImplicit = "tls"
+	// SMTPTLSNone sends in plaintext, only for relays on the same host or network
+	SMTPTLSNone = "none"
+)
+
+// SMTPConfig is the mail server emails are sent through
+type SMTPConfig struct {
+	// Host is the mail server, empty when no mail server is configured
+	Host string
+	Port uint16
+	// Username and Password authenticate with PLAIN auth, no authentication when Username is empty
+	Username string
+	Password string
+	// TLS is SMTPTLSStartTLS, SMTPTLSImplicit or SMTPTLSNone
+	TLS string
+	// From is the sender address of every email
+	From string
+}
+
+// ConfigChange is a config key whose effective value changed, secrets are redacted
+type ConfigChange struct {
+	Key string      `json:"key"`
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// IReloadable is implemented by components that apply configuration changes without a restart
+type IReloadable interface {
+	// ReloadKeys returns the config keys the component applies live
+	ReloadKeys() []string
+	// Reload applies the current configuration, it is called after one of the keys changed
+	// - config: the configuration with the changes applied
+	// Returns an error if the configuration cannot be applied, the component keeps its previous state
+	Reload(config IConfig) error
+}
+
 // IConfig is an interface for configuration
 type IConfig interface {
 	// GetDatabasePath returns the database path
 	GetDatabasePath() string
+	// GetDatabaseDriver returns sqlite, postgres or mysql
+	GetDatabaseDriver() string
+	// GetDatabaseDSN returns the data source name of the database, SQLite uses the database path when it is empty
+	GetDatabaseDSN() string
+	// GetDatabaseMaxOpenConns returns the maximum number of open connections, 0 is unlimited
+	GetDatabaseMaxOpenConns() int
+	// GetDatabaseMaxIdleConns returns the maximum number of idle connections kept in the pool
+	GetDatabaseMaxIdleConns() int
+	// GetDatabaseConnMaxLifetime returns how long a connection is reused before it is closed, 0 reuses it forever
+	GetDatabaseConnMaxLifetime() time.Duration
+	// GetDatabaseConnMaxIdleTime returns how long a connection can be idle before it is closed, 0 keeps it open
+	GetDatabaseConnMaxIdleTime() time.Duration
+	// GetDatabaseAutoMigrate returns whether pending migrations are applied at startup
+	GetDatabaseAutoMigrate() bool
+	// GetDatabaseQueryTimeout returns how long a single query may run before it is cancelled, 0 never cancels it
+	GetDatabaseQueryTimeout() time.Duration
+	// GetSQLiteJournalMode returns the journal_mode pragma SQLite databases are opened with
+	GetSQLiteJournalMode() string
+	// GetSQLiteSynchronous returns the synchronous pragma SQLite databases are opened with
+	GetSQLiteSynchronous() string
+	// GetSQLiteBusyTimeout returns how long SQLite waits for a lock held by another process
+	GetSQLiteBusyTimeout() time.Duration
+	// GetSQLiteForeignKeys returns whether SQLite enforces foreign keys
+	GetSQLiteForeignKeys() bool
+	// GetSQLiteReadConns returns the number of read only SQLite connections, 0 reads on the writer connection
+	GetSQLiteReadConns() int
 	GetServerAddress() string
 	GetServerPort() uint16
 	GetServerCert() string
 	GetServerKey() string
 	GetServerCA() string
+	// GetServerCertPath returns the file the server certificate is read from when it is not set directly
+	GetServerCertPath() string
+	// GetServerKeyPath returns the file the server key is read from when it is not set directly
+	GetServerKeyPath() string
+	// GetServerCAPath returns the file the client CA is read from when it is not set directly
+	GetServerCAPath() string
+	// GetServerClientAuth returns none, optional or require, client certificates are verified against the server CA
+	GetServerClientAuth() string
 	IsTLSEnabled() bool
+	// GetStoragePath returns the directory blobs such as avatars are stored in
+	GetStoragePath() string
+	// GetAccountDeletionGracePeriod returns how long a deleted account can be restored before it is purged
+	GetAccountDeletionGracePeriod() time.Duration
+	// GetAccountDeletionInterval returns how often accounts past their grace period are purged
+	GetAccountDeletionInterval() time.Duration
+	// GetSecretsKey returns the base64 encoded key encryption key if it is set directly or through the environment
+	GetSecretsKey() string
+	// GetSecretsKeyPath returns the file the key encryption key is read from, and created in, when it is not set directly,
+	// it must be outside the data directories
+	GetSecretsKeyPath() string
+	// GetPreviousSecretsKeys returns retired base64 encoded key encryption keys, secrets wrapped with them are re-wrapped on startup
+	GetPreviousSecretsKeys() []string
+	// GetSettingsPollInterval returns how often settings are reloaded to pick up changes made by other instances
+	GetSettingsPollInterval() time.Duration
+	// GetBackupPath returns the directory scheduled backups are written to
+	GetBackupPath() string
+	// GetBackupInterval returns how often a backup is written to the backup path, 0 disables scheduled backups
+	GetBackupInterval() time.Duration
+	// GetBackupRetention returns how many backups are kept in the backup path, older ones are removed
+	GetBackupRetention() int
+	// GetBackupCompress returns whether backups are gzip compressed unless asked otherwise
+	GetBackupCompress() bool
+	// GetBackupEncrypt returns whether backups are encrypted with the key encryption key unless asked otherwise
+	GetBackupEncrypt() bool
+	// GetLogLevel returns the minimum level logged
+	GetLogLevel() slog.Level
+	// GetCORSAllowOrigins returns the origins allowed to make cross origin requests
+	GetCORSAllowOrigins() []string
+	// GetRateLimitMax returns the number of requests a client can make per window, 0 disables rate limiting
+	GetRateLimitMax() int
+	// GetRateLimitWindow returns the window requests are counted in
+	GetRateLimitWindow() time.Duration
+	// GetLogFormat returns json or text
+	GetLogFormat() string
+	// GetViewsPath returns the directory the page templates are loaded from
+	GetViewsPath() string
+	// GetJWTLifetime returns how long a session token is valid after sign in
+	GetJWTLifetime() time.Duration
+	// GetCSRFExpiration returns how long a CSRF token is valid
+	GetCSRFExpiration() time.Duration
+	// GetCORSAllowMethods returns the methods allowed in cross origin requests
+	GetCORSAllowMethods() []string
+	// GetCORSAllowHeaders returns the headers allowed in cross origin requests, empty allows the requested headers
+	GetCORSAllowHeaders() []string
+	// GetCORSAllowCredentials returns whether cross origin requests can send cookies
+	GetCORSAllowCredentials() bool
+	// GetCORSMaxAge returns how long browsers may cache a preflight response, 0 leaves it to the browser
+	GetCORSMaxAge() time.Duration
+	// GetCacheExpiration returns how long static assets are cached by the server
+	GetCacheExpiration() time.Duration
+	// GetCacheControl returns whether cached static assets are sent with a Cache-Control header
+	GetCacheControl() bool
+	// GetArgon2Params returns the parameters new password hashes are made with
+	GetArgon2Params() Argon2Params
+	// GetSMTPConfig returns the mail server emails are sent through
+	GetSMTPConfig() SMTPConfig
+	// GetMailLog returns whether emails are written to the log, links included, when no mail server is configured.
+	// It is meant for development only
+	GetMailLog() bool
+	// Watch applies changes to the config file while the application runs, changed keys that no component
+	// reloads only take effect after a restart and are logged as a warning
+	// - components: the components to reload when one of their keys changes
+	// Returns an error if there is no config file to watch
+	Watch(components ...IReloadable) error
+	// GetRedactedSettings returns the effective value of every key, secrets that are set are replaced with REDACTED
+	GetRedactedSettings() map[string]interface{}
 }
@@ -2,11 +2,44 @@ package interfaces
 
 import "errors"
 
+// FieldVersion is the field of a ConflictError when a record changed since it was loaded
+const FieldVersion = "version"
+
 const (
 	// ErrMsgNotFound is the error message for when a resource is not found
 	ErrMsgNotFound = "not found"
 	// ErrMsgSaveFailed is the error message for when a save operation fails
 	ErrMsgSaveFailed = "save failed"
+	// ErrMsgConflict is the error message for when a write conflicts with the stored data
+	ErrMsgConflict = "conflict"
+	// ErrMsgUnavailable is the error message for when the storage cannot be reached or is too busy, retrying may succeed
+	ErrMsgUnavailable = "storage unavailable"
+	// ErrMsgTokenInvalid is the error message for when a token is unknown, expired or already used
+	ErrMsgTokenInvalid = "token invalid"
+	// ErrMsgImportInvalid is the error message for when an import contains invalid rows
+	ErrMsgImportInvalid = "import contains invalid rows"
+	// ErrMsgInvalidImage is the error message for when an uploaded image cannot be decoded or is too large
+	ErrMsgInvalidImage = "invalid image"
+	// ErrMsgInvalidPreferences is the error message for when preferences fail validation
+	ErrMsgInvalidPreferences = "invalid preferences"
+	// ErrMsgSecretUndecryptable is the error message for when a secret cannot be decrypted with any known key
+	ErrMsgSecretUndecryptable = "secret cannot be decrypted"
+	// ErrMsgUnknownSetting is the error message for when a setting is not in the registry
+	ErrMsgUnknownSetting = "unknown setting"
+	// ErrMsgInvalidSetting is the error message for when a setting value does not match its definition
+	ErrMsgInvalidSetting = "invalid setting"
+	// ErrMsgSettingReadOnly is the error message for when a read only setting is changed
+	ErrMsgSettingReadOnly = "setting is read only"
+	// ErrMsgInvalidFeatureFlag is the error message for when a feature flag fails validation
+	ErrMsgInvalidFeatureFlag = "invalid feature flag"
+	// ErrMsgBackupUnsupported is the error message for when the database does not support online backups
+	ErrMsgBackupUnsupported = "backups are only supported for SQLite, use the tools of the database server"
+	// ErrMsgBackupInvalid is the error message for when a backup cannot be restored
+	ErrMsgBackupInvalid = "invalid backup"
+	// ErrMsgDatabaseInUse is the error message for when another process is using or restoring the database
+	ErrMsgDatabaseInUse = "the database is in use by another process"
+	// ErrMsgMailUnavailable is the error message for when no mail transport is configured
+	ErrMsgMailUnavailable = "no mail transport is configured"
 )
 
 var (
@@ -14,4 +47,50 @@ var (
 	ErrNotFound = errors.New(ErrMsgNotFound)
 	// ErrSaveFailed is an error for when a save operation fails
 	ErrSaveFailed = errors.New(ErrMsgSaveFailed)
+	// ErrConflict is an error for when a write conflicts with the stored data, match it with errors.Is to catch every ConflictError
+	ErrConflict = errors.New(ErrMsgConflict)
+	// ErrUnavailable is an error for when the storage cannot be reached or is too busy, retrying may succeed
+	ErrUnavailable = errors.New(ErrMsgUnavailable)
+	// ErrTokenInvalid is an error for when a token is unknown, expired or already used
+	ErrTokenInvalid = errors.New(ErrMsgTokenInvalid)
+	// ErrImportInvalid is an error for when an import contains invalid rows
+	ErrImportInvalid = errors.New(ErrMsgImportInvalid)
+	// ErrInvalidImage is an error for when an uploaded image cannot be decoded or is too large
+	ErrInvalidImage = errors.New(ErrMsgInvalidImage)
+	// ErrInvalidPreferences is an error for when preferences fail validation
+	ErrInvalidPreferences = errors.New(ErrMsgInvalidPreferences)
+	// ErrSecretUndecryptable is an error for when a secret cannot be decrypted with any known key
+	ErrSecretUndecryptable = errors.New(ErrMsgSecretUndecryptable)
+	// ErrUnknownSetting is an error for when a setting is not in the registry
+	ErrUnknownSetting = errors.New(ErrMsgUnknownSetting)
+	// ErrInvalidSetting is an error for when a setting value does not match its definition
+	ErrInvalidSetting = errors.New(ErrMsgInvalidSetting)
+	// ErrSettingReadOnly is an error for when a read only setting is changed
+	ErrSettingReadOnly = errors.New(ErrMsgSettingReadOnly)
+	// ErrInvalidFeatureFlag is an error for when a feature flag fails validation
+	ErrInvalidFeatureFlag = errors.New(ErrMsgInvalidFeatureFlag)
+	// ErrBackupUnsupported is an error for when the database does not support online backups
+	ErrBackupUnsupported = errors.New(ErrMsgBackupUnsupported)
+	// ErrBackupInvalid is an error for when a backup cannot be restored
+	ErrBackupInvalid = errors.New(ErrMsgBackupInvalid)
+	// ErrDatabaseInUse is an error for when another process is using or restoring the database
+	ErrDatabaseInUse = errors.New(ErrMsgDatabaseInUse)
+	// ErrMailUnavailable is an error for when no mail transport is configured
+	ErrMailUnavailable = errors.New(ErrMsgMailUnavailable)
 )
+
+// ConflictError is an error for when a write conflicts with the stored data, it matches ErrConflict
+type ConflictError struct {
+	// Field is the field that conflicts, such as the column of a unique constraint,
+	// FieldVersion when the record changed since it was loaded
+	Field string
+}
+
+func (e *ConflictError) Error() string {
+	return ErrMsgConflict + " on " + e.Field
+}
+
+// Is reports whether target is ErrConflict
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
@@ -0,0 +1,34 @@
+package interfaces
+
+import "time"
+
+// FeatureFlag is a feature that can be shipped dark and rolled out gradually
+type FeatureFlag struct {
+	ID          uint
+	Key         string
+	Description string
+	// Enabled turns the flag off for everyone when false, regardless of targeting and rollout
+	Enabled bool
+	// Percentage of the remaining users the flag is on for, 100 turns it on for everyone
+	Percentage int
+	// UserIDs, Roles and Groups are always targeted while the flag is enabled
+	UserIDs []uint
+	Roles   []string
+	// Groups are names from the SettingFeatureFlagGroups setting
+	Groups    []string
+	UpdatedAt time.Time
+	// Version is incremented by every save, 0 for a flag that has not been saved yet
+	Version uint
+}
+
+// FlagSubject is who a flag is evaluated for, a nil subject is an anonymous visitor
+type FlagSubject struct {
+	UserID uint
+	Role   string
+}
+
+// FlagEvaluations counts how often a flag was evaluated by this instance since it started
+type FlagEvaluations struct {
+	On  uint64
+	Off uint64
+}
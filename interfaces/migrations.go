@@ -0,0 +1,58 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// MigrationUp applies a migration
+	MigrationUp = "up"
+	// MigrationDown rolls a migration back
+	MigrationDown = "down"
+)
+
+// MigrationStatus is a known migration and whether it has been applied
+type MigrationStatus struct {
+	Version int64
+	// Name is the file the migration is defined in
+	Name    string
+	Applied bool
+	// AppliedAt is zero for migrations that are pending
+	AppliedAt time.Time
+}
+
+// MigrationStep is a migration that was, or in a dry run would be, applied or rolled back
+type MigrationStep struct {
+	Version int64
+	Name    string
+	// Direction is MigrationUp or MigrationDown
+	Direction string
+	// Duration is zero in a dry run
+	Duration time.Duration
+}
+
+// IMigrator applies and rolls back database migrations, with dryRun set the steps are returned without running them
+type IMigrator interface {
+	// Status returns every known migration ordered by version
+	Status(ctx context.Context) ([]MigrationStatus, error)
+	// HasPending returns whether there are migrations to apply
+	HasPending(ctx context.Context) (bool, error)
+	// Version returns the highest applied version, 0 if none is applied
+	Version(ctx context.Context) (int64, error)
+	// Up applies every pending migration
+	Up(ctx context.Context, dryRun bool) ([]MigrationStep, error)
+	// UpTo applies the pending migrations up to and including a version
+	UpTo(ctx context.Context, version int64, dryRun bool) ([]MigrationStep, error)
+	// Down rolls back the latest applied migration
+	Down(ctx context.Context, dryRun bool) ([]MigrationStep, error)
+	// DownTo rolls back every applied migration newer than a version, 0 rolls back all of them
+	DownTo(ctx context.Context, version int64, dryRun bool) ([]MigrationStep, error)
+	// Redo rolls back the latest applied migration and applies it again
+	Redo(ctx context.Context, dryRun bool) ([]MigrationStep, error)
+	// Create writes the skeleton of a new Go migration numbered after the newest known migration
+	// - dir: the directory the migrations are defined in
+	// - name: what the migration does, like add_widgets
+	// Returns the path of the new file, which is not written in a dry run
+	Create(dir string, name string, dryRun bool) (string, error)
+}
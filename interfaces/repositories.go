@@ -1,5 +1,10 @@
 package interfaces
 
+import (
+	"context"
+	"time"
+)
+
 // Number is a struct to represent a number
 type Number struct {
 	// ID is the unique identifier of the number
@@ -13,17 +18,26 @@ type INumberRepository interface {
 	// Save saves a number
 	// - number: the number to save
 	// Returns an error if the save operation fails
-	Save(number Number) error
+	Save(ctx context.Context, number Number) error
 	// FindByID finds a number by its ID
 	// - id: the ID of the number to find
-	// Returns the number if found, otherwise returns an error
-	FindByID(id string) (*Number, error)
+	// Returns the number if found, ErrNotFound if it does not exist
+	FindByID(ctx context.Context, id string) (*Number, error)
 	// DeleteByID deletes a number by its ID
 	// - id: the ID of the number to delete
 	// Returns an error if the delete operation fails
-	DeleteByID(id string) error
+	DeleteByID(ctx context.Context, id string) error
 }
 
+const (
+	// RoleAdmin is the role for administrators
+	RoleAdmin = "admin"
+	// RoleUser is the role for regular users
+	RoleUser = "user"
+	// RoleViewer is the role for read only users
+	RoleViewer = "viewer"
+)
+
 // User is a struct to represent a user
 type User struct {
 	ID           uint
@@ -31,21 +45,184 @@ type User struct {
 	Email        string
 	Role         string
 	PasswordHash string
+	FirstName    string
+	LastName     string
+	// AvatarKey is the storage key of the user's avatar, empty when the user has none
+	AvatarKey string
+	// DeleteAfter is when the account is purged, nil unless the user asked for their account to be deleted
+	DeleteAfter *time.Time
+	// Version counts the updates of the user, an update only applies to the version it was loaded at
+	Version uint
 }
 
 // IUserRepository is an interface for user repositories
 type IUserRepository interface {
-	CreateUser(user *User) error
-	GetUserByID(id uint) (*User, error)
-	GetUserByUsername(username string) (*User, error)
-	UpdateUser(user *User) error
-	DeleteUser(id uint) error
+	CreateUser(ctx context.Context, user *User) error
+	// CreateUsers creates all users in a single transaction, either all are created or none are
+	// - users: the users to create, IDs are populated on success
+	// Returns an error if any user fails to be created
+	CreateUsers(ctx context.Context, users []*User) error
+	// GetUserByID gets a user by ID, returns ErrNotFound if it does not exist
+	GetUserByID(ctx context.Context, id uint) (*User, error)
+	// GetUserByUsername gets a user by username, returns ErrNotFound if it does not exist
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	// GetUserByEmail gets a user by email, returns ErrNotFound if it does not exist
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	// ForEachUser calls fn for every user ordered by ID, loading users in batches
+	// - fn: the callback, returning an error stops the iteration
+	// Returns the first error encountered
+	ForEachUser(ctx context.Context, fn func(user *User) error) error
+	// GetUsersDueForDeletion gets the users whose deletion grace period ended before the given time
+	GetUsersDueForDeletion(ctx context.Context, before time.Time) ([]*User, error)
+	// UpdateUser saves a user if it has not changed since it was loaded
+	// - user: the user to save, its version is incremented on success
+	// Returns a ConflictError on the version field if the stored user has a different version, ErrNotFound if it does not exist
+	UpdateUser(ctx context.Context, user *User) error
+	DeleteUser(ctx context.Context, id uint) error
+}
+
+// UserToken is a struct to represent a single use token issued to a user, such as an invitation
+type UserToken struct {
+	ID uint
+	// UserID is the ID of the user the token was issued to
+	UserID uint
+	// Purpose is what the token may be used for
+	Purpose string
+	// TokenHash is the SHA-256 hash of the token, the plaintext token is never stored
+	TokenHash string
+	// Data is optional purpose specific data
+	Data      string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// IUserTokenRepository is an interface for user token repositories
+type IUserTokenRepository interface {
+	// CreateToken creates a token
+	CreateToken(ctx context.Context, token *UserToken) error
+	// GetTokenByHash gets a token by its purpose and hash
+	GetTokenByHash(ctx context.Context, purpose string, tokenHash string) (*UserToken, error)
+	// DeleteToken deletes a token by ID and hash if it has not expired at now
+	// Returns the number of deleted tokens, 0 when another caller already deleted it
+	DeleteToken(ctx context.Context, id uint, tokenHash string, now time.Time) (int64, error)
+	// DeleteTokensForUser deletes all tokens for a user with the given purpose
+	DeleteTokensForUser(ctx context.Context, userID uint, purpose string) error
+	// GetTokensForUser gets all tokens issued to a user
+	GetTokensForUser(ctx context.Context, userID uint) ([]UserToken, error)
+	// DeleteAllTokensForUser deletes all tokens issued to a user regardless of purpose
+	DeleteAllTokensForUser(ctx context.Context, userID uint) error
+}
+
+// UserSession is a struct to represent a sign in, sessions are signed cookies so this is
+// a record of the sign in rather than the session itself
+type UserSession struct {
+	ID     uint
+	UserID uint
+	// Method is how the user signed in, SessionMethodPassword or SessionMethodClientCertificate
+	Method    string
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+	// ExpiresAt is when the session token issued at sign in stops being valid
+	ExpiresAt time.Time
+}
+
+// IUserSessionRepository is an interface for user session repositories
+type IUserSessionRepository interface {
+	// CreateSession records a sign in
+	CreateSession(ctx context.Context, session *UserSession) error
+	// GetSessionsForUser gets the recorded sessions of a user, newest first
+	GetSessionsForUser(ctx context.Context, userID uint) ([]UserSession, error)
+	// DeleteSessionsForUser deletes every recorded session of a user
+	DeleteSessionsForUser(ctx context.Context, userID uint) error
+	// DeleteExpiredSessions deletes the sessions of every user that expired before a time
+	DeleteExpiredSessions(ctx context.Context, before time.Time) error
 }
 
 // ISettingsRepository is an interface for settings repositories
 type ISettingsRepository interface {
-	GetString(key string) (string, error)
-	GetInt(key string) (int, error)
-	GetBool(key string) (bool, error)
-	Set(key string, value interface{}) error
+	// GetString gets the value of a key, returns ErrNotFound if it has not been set
+	GetString(ctx context.Context, key string) (string, error)
+	GetInt(ctx context.Context, key string) (int, error)
+	GetBool(ctx context.Context, key string) (bool, error)
+	// Set sets a value and records the change in the setting history
+	Set(ctx context.Context, key string, value interface{}, actor SettingActor) error
+	// SetMany sets several values in a single transaction, recording each change in the setting history
+	SetMany(ctx context.Context, values map[string]string, actor SettingActor) error
+	// SetManyIfVersion sets several values like SetMany only if every setting is still at its version in versions,
+	// 0 for a key that has not been set. Returns a ConflictError on FieldVersion if any changed since, setting none
+	SetManyIfVersion(ctx context.Context, values map[string]string, versions map[string]uint, actor SettingActor) error
+	// SetSecret sets a value and marks the key as secret so it is encrypted at rest and redacted in the history
+	SetSecret(ctx context.Context, key string, value string, actor SettingActor) error
+	// GetStringVersion gets the value of a key along with its version, which every write increments
+	// Returns ErrNotFound if it has not been set
+	GetStringVersion(ctx context.Context, key string) (string, uint, error)
+	// SetIfVersion sets a value like Set, or like SetSecret when secret is true, only if the setting is still at version,
+	// 0 for a key that has not been set. Returns a ConflictError on FieldVersion if it changed since
+	SetIfVersion(ctx context.Context, key string, value string, secret bool, version uint, actor SettingActor) error
+	// MarkSecret marks an existing key as secret, encrypts its current value in place and redacts the values
+	// recorded in its history in the same transaction, returns ErrNotFound for unset keys
+	MarkSecret(ctx context.Context, key string) error
+	// RewrapSecrets re-wraps secrets encrypted with a retired key encryption key under the current one
+	// Returns the number of secrets that were re-wrapped
+	RewrapSecrets(ctx context.Context) (int, error)
+	// GetAll returns every stored setting keyed by key, secrets are decrypted
+	GetAll(ctx context.Context) (map[string]string, error)
+	// GetHistory returns the recorded changes of a setting, newest first
+	GetHistory(ctx context.Context, key string) ([]SettingChange, error)
+	// GetChange returns a single recorded change or ErrNotFound
+	GetChange(ctx context.Context, id uint) (*SettingChange, error)
+	// GetChangesByActor returns the recorded changes of every setting made by a user, newest first
+	GetChangesByActor(ctx context.Context, userID uint) ([]SettingChange, error)
+	// ReplaceActor replaces the actor of every recorded change made by a user and forgets their ID,
+	// used to anonymise the history
+	ReplaceActor(ctx context.Context, userID uint, replacement string) error
+}
+
+const (
+	// ThemeLight is the light color theme
+	ThemeLight = "light"
+	// ThemeDark is the dark color theme
+	ThemeDark = "dark"
+	// ThemeAuto follows the color scheme of the browser
+	ThemeAuto = "auto"
+)
+
+// Preferences is a struct to represent the display preferences of a user
+type Preferences struct {
+	UserID uint
+	// Theme is one of ThemeLight, ThemeDark or ThemeAuto
+	Theme string
+	// Timezone is an IANA timezone name such as Europe/Berlin
+	Timezone string
+	// Locale is a BCP 47 language tag such as en-US
+	Locale string
+	// DateFormat is a Go time layout used to render timestamps
+	DateFormat string
+	// PageSize is the number of items shown per page in lists
+	PageSize int
+}
+
+// IPreferencesRepository is an interface for user preferences repositories
+type IPreferencesRepository interface {
+	// GetPreferences gets the preferences of a user
+	GetPreferences(ctx context.Context, userID uint) (*Preferences, error)
+	// SavePreferences creates or replaces the preferences of a user
+	SavePreferences(ctx context.Context, preferences *Preferences) error
+	// DeletePreferences deletes the preferences of a user
+	DeletePreferences(ctx context.Context, userID uint) error
+}
+
+// IFeatureFlagRepository is an interface for feature flag repositories
+type IFeatureFlagRepository interface {
+	// GetFlags gets all flags ordered by key
+	GetFlags(ctx context.Context) ([]FeatureFlag, error)
+	// GetFlag gets a flag by key
+	// Returns ErrNotFound if the flag does not exist
+	GetFlag(ctx context.Context, key string) (*FeatureFlag, error)
+	// SaveFlag creates a flag with Version 0 or replaces the flag with the same key if it is still at Version,
+	// then sets the new Version. Returns a ConflictError on FieldVersion if the key is taken or the flag changed since
+	SaveFlag(ctx context.Context, flag *FeatureFlag) error
+	// DeleteFlag deletes a flag by key
+	DeleteFlag(ctx context.Context, key string) error
 }
@@ -0,0 +1,25 @@
+package interfaces
+
+// ISecretCipher encrypts small secrets such as signing keys before they are persisted
+// Each value is sealed with its own data key which is wrapped by a key encryption key,
+// rotating the key encryption key only requires re-wrapping the data keys.
+// Values are bound to associated data, such as the key of the setting they are stored in,
+// so a ciphertext copied to another place fails to decrypt
+type ISecretCipher interface {
+	// Encrypt seals a value under a new data key wrapped by the current key encryption key
+	// - plaintext: the value to seal
+	// - associatedData: what the value belongs to, the same must be passed to Decrypt
+	// Returns the encoded ciphertext
+	Encrypt(plaintext string, associatedData string) (string, error)
+	// Decrypt opens a value produced by Encrypt using any known key encryption key
+	// - ciphertext: the encoded ciphertext
+	// - associatedData: what the value belongs to
+	// Returns the plaintext or ErrSecretUndecryptable, also when associatedData differs from the one it was sealed with
+	Decrypt(ciphertext string, associatedData string) (string, error)
+	// Rewrap wraps the data key of a value with the current key encryption key
+	// - ciphertext: the encoded ciphertext
+	// Returns the new ciphertext and true if it was wrapped by an older key encryption key
+	Rewrap(ciphertext string) (string, bool, error)
+	// IsEncrypted reports whether a value was produced by Encrypt
+	IsEncrypted(value string) bool
+}
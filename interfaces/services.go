@@ -1,6 +1,10 @@
 package interfaces
 
 import (
+	"context"
+	"io"
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -9,7 +13,7 @@ type IIncrementService interface {
 	// Increment increments a number
 	// - id: the ID of the number to increment
 	// Returns the incremented number if successful, otherwise returns an error
-	Increment(id string) (uint64, error)
+	Increment(ctx context.Context, id string) (uint64, error)
 }
 
 // IPasswordService is an interface for password hashing and verification
@@ -20,59 +24,191 @@ type IPasswordService interface {
 	Verify(plaintext, encodedHash string) (bool, error)
 }
 
-// ISettingsService is an interface fetching and setting settings
+// ISettingsService is an interface fetching and setting settings, values are cached after the first read,
+// changes made without an actor are recorded in the history as SettingActorSystem,
+// every getter and setter returns ErrUnknownSetting for keys missing from the registry
+// and ErrInvalidSetting when the value does not match the registered type
 type ISettingsService interface {
 	// GetString gets a string setting by key
 	// - key: the key of the setting to get
 	// Returns the setting value if found, otherwise returns an error
-	GetString(key string) (string, error)
+	GetString(ctx context.Context, key string) (string, error)
 	// GetInt gets an integer setting by key
 	// - key: the key of the setting to get
 	// Returns the setting value if found, otherwise returns an error
-	GetInt(key string) (int, error)
+	GetInt(ctx context.Context, key string) (int, error)
 	// GetBool gets a boolean setting by key
 	// - key: the key of the setting to get
 	// Returns the setting value if found, otherwise returns an error
-	GetBool(key string) (bool, error)
+	GetBool(ctx context.Context, key string) (bool, error)
 	// SetString sets a string setting by key
 	// - key: the key of the setting to set
 	// - value: the value to set
 	// Returns an error if the set operation fails
-	SetString(key string, value string) error
+	SetString(ctx context.Context, key string, value string) error
 	// SetInt sets an integer setting by key
 	// - key: the key of the setting to set
 	// - value: the value to set
 	// Returns an error if the set operation fails
-	SetInt(key string, value int) error
+	SetInt(ctx context.Context, key string, value int) error
 	// SetBool sets a boolean setting by key
 	// - key: the key of the setting to set
 	// - value: the value to set
 	// Returns an error if the set operation fails
-	SetBool(key string, value bool) error
+	SetBool(ctx context.Context, key string, value bool) error
+	// GetDuration gets a duration setting by key
+	// - key: the key of the setting to get
+	// Returns the setting value or its default, otherwise returns an error
+	GetDuration(ctx context.Context, key string) (time.Duration, error)
+	// GetFloat gets a floating point setting by key
+	// - key: the key of the setting to get
+	// Returns the setting value or its default, otherwise returns an error
+	GetFloat(ctx context.Context, key string) (float64, error)
+	// GetStringList gets a string list setting by key
+	// - key: the key of the setting to get
+	// Returns the setting value or its default, otherwise returns an error
+	GetStringList(ctx context.Context, key string) ([]string, error)
+	// GetJSON decodes a JSON setting by key
+	// - key: the key of the setting to get
+	// - target: a pointer the setting value or its default is decoded into
+	// Returns an error if the setting cannot be read or decoded
+	GetJSON(ctx context.Context, key string, target interface{}) error
+	// SetDuration sets a duration setting by key
+	// - key: the key of the setting to set
+	// - value: the value to set
+	// Returns an error if the set operation fails
+	SetDuration(ctx context.Context, key string, value time.Duration) error
+	// SetFloat sets a floating point setting by key
+	// - key: the key of the setting to set
+	// - value: the value to set
+	// Returns an error if the set operation fails
+	SetFloat(ctx context.Context, key string, value float64) error
+	// SetStringList sets a string list setting by key
+	// - key: the key of the setting to set
+	// - value: the value to set
+	// Returns an error if the set operation fails
+	SetStringList(ctx context.Context, key string, value []string) error
+	// SetJSON encodes and sets a JSON setting by key
+	// - key: the key of the setting to set
+	// - value: the value to encode
+	// Returns an error if the set operation fails
+	SetJSON(ctx context.Context, key string, value interface{}) error
+	// Definitions returns every registered setting in the order it was registered
+	Definitions() []SettingDefinition
+	// GetText gets the text form of a setting as shown on the admin page
+	// - key: the key of the setting to get
+	// Returns the text form, secret settings always return an empty string
+	GetText(ctx context.Context, key string) (string, error)
+	// SetText parses, validates and sets the text form of a setting as submitted from the admin page
+	// - key: the key of the setting to set
+	// - text: the text form of the value
+	// - actor: who made the change, recorded in the setting history
+	// Returns ErrSettingReadOnly for read only settings or ErrInvalidSetting if the value is rejected
+	SetText(ctx context.Context, key string, text string, actor SettingActor) error
+	// GetTextVersion gets the text form of a setting from the repository along with its version, for forms that
+	// must not overwrite changes made since they were loaded
+	// - key: the key of the setting to get
+	// Returns the text form, empty for secret settings, and the version, 0 while the default applies
+	GetTextVersion(ctx context.Context, key string) (string, uint, error)
+	// SetTextIfVersion is SetText that only sets the setting if it is still at the version returned by GetTextVersion
+	// - key: the key of the setting to set
+	// - text: the text form of the value
+	// - version: the version the text was loaded at
+	// - actor: who made the change, recorded in the setting history
+	// Returns a ConflictError on FieldVersion if the setting changed since, otherwise the errors of SetText
+	SetTextIfVersion(ctx context.Context, key string, text string, version uint, actor SettingActor) error
+	// GetValue gets a setting as the Go type matching its definition, durations are time.Duration,
+	// floats are float64, string lists are []string and JSON is json.RawMessage
+	// - key: the key of the setting to get
+	// Returns the setting value or its default, otherwise returns an error
+	GetValue(ctx context.Context, key string) (interface{}, error)
+	// ValidateText checks the text form of a setting would be accepted by SetText without setting it
+	// - key: the key of the setting
+	// - text: the text form of the value
+	// Returns ErrUnknownSetting, ErrSettingReadOnly or ErrInvalidSetting if the value would be rejected
+	ValidateText(key string, text string) error
+	// SetTexts validates and sets several settings in a single transaction, secret settings must be set individually
+	// - texts: the text form of each setting keyed by key
+	// - actor: who made the change, recorded in the setting history
+	// Returns the first validation error, in which case nothing is set
+	SetTexts(ctx context.Context, texts map[string]string, actor SettingActor) error
+	// SetTextsIfVersion is SetTexts that only sets the settings if each is still at its version in versions,
+	// as returned by GetTextVersion
+	// - texts: the text form of each setting keyed by key
+	// - versions: the version each setting was loaded at keyed by key, a key missing from it is a conflict
+	// - actor: who made the change, recorded in the setting history
+	// Returns a ConflictError on FieldVersion if any setting changed since, in which case nothing is set,
+	// otherwise the errors of SetTexts
+	SetTextsIfVersion(ctx context.Context, texts map[string]string, versions map[string]uint, actor SettingActor) error
+	// History gets the recorded changes of a setting, newest first
+	// - key: the key of the setting
+	// Returns the changes, values of secret settings are redacted
+	History(ctx context.Context, key string) ([]SettingChange, error)
+	// Rollback sets a setting back to the value a recorded change set it to, through the same path as SetTextIfVersion
+	// - changeID: the ID of the change to restore
+	// - version: the version the setting was at when the history was loaded, as returned by GetTextVersion
+	// - actor: who made the rollback, recorded in the setting history
+	// Returns the change, ErrNotFound for unknown changes, ErrInvalidSetting for secret settings
+	// or a ConflictError on FieldVersion if the setting changed since
+	Rollback(ctx context.Context, changeID uint, version uint, actor SettingActor) (*SettingChange, error)
+	// Subscribe registers a callback for changes to a setting, made locally or picked up by Refresh
+	// - key: the key of the setting to watch
+	// - fn: called with the key after the new value is visible to getters
+	// Returns a function that removes the subscription
+	Subscribe(key string, fn func(key string)) func()
+	// Refresh reloads every setting from the repository and notifies subscribers of values changed elsewhere,
+	// it is polled so instances sharing a database converge
+	// Returns an error if the settings cannot be loaded
+	Refresh(ctx context.Context) error
 }
 
 // IUsersService is an interface for user operations
 type IUsersService interface {
+	IPersonalDataProvider
 	// CreateUser creates a new user
 	// - user: the user to create
 	// Returns an error if the create operation fails
-	CreateUser(user *User) error
+	CreateUser(ctx context.Context, user *User) error
+	// CreateUsers creates all users in a single transaction
+	// - users: the users to create
+	// Returns an error if any user fails to be created, in which case none are created
+	CreateUsers(ctx context.Context, users []*User) error
 	// GetUserByID gets a user by ID
 	// - id: the ID of the user to get
 	// Returns the user if found, otherwise returns an error
-	GetUserByID(id uint) (*User, error)
+	GetUserByID(ctx context.Context, id uint) (*User, error)
 	// GetUserByUsername gets a user by username
 	// - username: the username of the user to get
 	// Returns the user if found, otherwise returns an error
-	GetUserByUsername(username string) (*User, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	// GetUserByEmail gets a user by email
+	// - email: the email of the user to get
+	// Returns the user if found, otherwise returns an error
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	// ForEachUser calls fn for every user
+	// - fn: the callback, returning an error stops the iteration
+	// Returns the first error encountered
+	ForEachUser(ctx context.Context, fn func(user *User) error) error
+	// GetUsersDueForDeletion gets the users whose deletion grace period ended before the given time
+	// - before: the cut off time
+	// Returns the users due for deletion
+	GetUsersDueForDeletion(ctx context.Context, before time.Time) ([]*User, error)
 	// UpdateUser updates a user
 	// - user: the user to update
 	// Returns an error if the update operation fails
-	UpdateUser(user *User) error
+	UpdateUser(ctx context.Context, user *User) error
 	// DeleteUser deletes a user by ID
 	// - id: the ID of the user to delete
 	// Returns an error if the delete operation fails
-	DeleteUser(id uint) error
+	DeleteUser(ctx context.Context, id uint) error
+}
+
+// UserClaims are the claims of the tokens issued to users, the subject is the user ID in decimal
+type UserClaims struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	jwt.RegisteredClaims
 }
 
 // IJWTService is an interface for JWT operations
@@ -83,8 +219,272 @@ type IJWTService interface {
 	Generate(user *User) (string, error)
 	// Validate validates a JWT token
 	// - token: the token to validate
-	// Returns the token if valid, otherwise returns an error
+	// Returns the token with *UserClaims claims if valid, otherwise returns an error
 	Validate(token string) (*jwt.Token, error)
-
+	// UserFromClaims builds a user from the claims of the token the JWT middleware stored on the request,
+	// the claims are a snapshot from login so handlers should load the stored user by ID before trusting them
+	// - ctx: the request context
+	// Returns the user, nil if the request has no token, or an error if the claims are malformed
 	UserFromClaims(ctx IRequestContext) (*User, error)
+	// KeyFunc returns the current signing key for a token, it rejects tokens using any other algorithm
+	// - token: the parsed but unverified token
+	// Returns the key to verify the token with
+	KeyFunc(token *jwt.Token) (interface{}, error)
+}
+
+const (
+	// TokenPurposeInvitation is the purpose of tokens that let an invited user set their password
+	TokenPurposeInvitation = "invitation"
+	// TokenPurposeEmailVerification is the purpose of tokens that confirm a change of email, the new email is the token data
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// ITokenService is an interface for issuing and redeeming single use user tokens
+type ITokenService interface {
+	IPersonalDataProvider
+	// Issue issues a new token for a user
+	// - userID: the user the token is for
+	// - purpose: what the token may be used for
+	// - data: optional purpose specific data
+	// - ttl: how long the token is valid for
+	// Returns the plaintext token, which is not stored and must be handed to the user
+	Issue(ctx context.Context, userID uint, purpose string, data string, ttl time.Duration) (string, error)
+	// Verify checks a token is valid without using it up
+	// - purpose: the expected purpose of the token
+	// - token: the plaintext token
+	// Returns the token if valid, otherwise returns ErrTokenInvalid
+	Verify(ctx context.Context, purpose string, token string) (*UserToken, error)
+	// Consume checks a token is valid and removes it so it cannot be used again
+	// - purpose: the expected purpose of the token
+	// - token: the plaintext token
+	// Returns the token if valid, otherwise returns ErrTokenInvalid, also when a concurrent caller consumed it first
+	Consume(ctx context.Context, purpose string, token string) (*UserToken, error)
+}
+
+const (
+	// SessionMethodPassword is the method of sessions signed in with a username and password
+	SessionMethodPassword = "password"
+	// SessionMethodClientCertificate is the method of sessions signed in with a client certificate
+	SessionMethodClientCertificate = "client_certificate"
+)
+
+// ISessionService is an interface for recording sign ins, so a user's sessions can be exported
+type ISessionService interface {
+	IPersonalDataProvider
+	// Record records a sign in, sessions that have expired are forgotten
+	// - userID: the user that signed in
+	// - method: how the user signed in
+	// - ipAddress: the address the sign in came from
+	// - userAgent: the user agent of the client
+	// Returns an error if the sign in cannot be recorded
+	Record(ctx context.Context, userID uint, method string, ipAddress string, userAgent string) error
+}
+
+const (
+	// ImportFormatCSV is the CSV format for user import and export
+	ImportFormatCSV = "csv"
+	// ImportFormatJSON is the JSON format for user and settings import and export
+	ImportFormatJSON = "json"
+	// ImportFormatYAML is the YAML format for settings import and export
+	ImportFormatYAML = "yaml"
+	// ImportModeTemporaryPassword generates a temporary password for each imported user
+	ImportModeTemporaryPassword = "password"
+	// ImportModeInvitation generates an invitation token for each imported user
+	ImportModeInvitation = "invitation"
+)
+
+// UserImportRow is a single row of a user import
+type UserImportRow struct {
+	// Line is the line (CSV) or element (JSON) number the row came from, starting at 1
+	Line     int    `json:"-"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	// Errors are the validation errors for the row, the row is valid when empty
+	Errors []string `json:"-"`
+	// TemporaryPassword is set after import when using ImportModeTemporaryPassword
+	TemporaryPassword string `json:"-"`
+	// InvitationToken is set after import when using ImportModeInvitation
+	InvitationToken string `json:"-"`
+}
+
+// IUserBulkService is an interface for importing and exporting users in bulk
+type IUserBulkService interface {
+	// PreviewImport parses and validates an import without applying it
+	// - format: ImportFormatCSV or ImportFormatJSON
+	// - data: the raw import file
+	// Returns the parsed rows with any validation errors, or an error if the file cannot be parsed
+	PreviewImport(ctx context.Context, format string, data []byte) ([]UserImportRow, error)
+	// ApplyImport parses, validates and creates the users in a single transaction
+	// - format: ImportFormatCSV or ImportFormatJSON
+	// - data: the raw import file
+	// - mode: ImportModeTemporaryPassword or ImportModeInvitation
+	// Returns the imported rows with their temporary password or invitation token,
+	// ErrImportInvalid along with the rows if any row fails validation
+	ApplyImport(ctx context.Context, format string, data []byte, mode string) ([]UserImportRow, error)
+	// ExportUsers streams all users, excluding password hashes, CSV cells that would start a spreadsheet formula are prefixed with '
+	// - format: ImportFormatCSV or ImportFormatJSON
+	// - w: the writer to stream to
+	// Returns an error if the export fails
+	ExportUsers(ctx context.Context, format string, w io.Writer) error
+}
+
+// SettingImportRow is a setting from an import compared with its current value
+type SettingImportRow struct {
+	Key string
+	// Current is the text form of the current value
+	Current string
+	// Version is the version Current was read at, 0 while the default applies
+	Version uint
+	// New is the text form of the imported value
+	New string
+	// Changed is true when applying the import changes the setting
+	Changed bool
+	// Error is the validation error for the setting, the row is valid when empty
+	Error string
+}
+
+// ISettingsBulkService is an interface for exporting settings from one environment and importing them into another,
+// secret settings are never exported or imported
+type ISettingsBulkService interface {
+	// ExportSettings writes the current value of every non-secret setting
+	// - format: ImportFormatYAML or ImportFormatJSON
+	// - w: the writer to write to
+	// Returns an error if the export fails
+	ExportSettings(ctx context.Context, format string, w io.Writer) error
+	// PreviewImport parses and validates an import against the settings registry without applying it
+	// - format: ImportFormatYAML or ImportFormatJSON
+	// - data: the raw import file
+	// Returns a row per imported setting sorted by key, or an error if the file cannot be parsed
+	PreviewImport(ctx context.Context, format string, data []byte) ([]SettingImportRow, error)
+	// ApplyImport parses, validates and applies every changed setting in a single transaction
+	// - format: ImportFormatYAML or ImportFormatJSON
+	// - data: the raw import file
+	// - versions: the Version of each row of the preview that was reviewed keyed by key,
+	//   nil to apply over whatever the settings are at
+	// - actor: who made the change, recorded in the setting history
+	// Returns the rows, ErrImportInvalid along with the rows if any setting fails validation,
+	// or a ConflictError on FieldVersion if a setting changed since the preview, in which case nothing is applied
+	ApplyImport(ctx context.Context, format string, data []byte, versions map[string]uint, actor SettingActor) ([]SettingImportRow, error)
+}
+
+// IAvatarService is an interface for managing user avatars
+type IAvatarService interface {
+	IPersonalDataProvider
+	// SetAvatar resizes an uploaded image, stores it and updates the user's avatar key
+	// - user: the user to set the avatar for
+	// - r: the uploaded image, PNG, JPEG and GIF are supported
+	// Returns an error if the image is invalid or cannot be stored
+	SetAvatar(ctx context.Context, user *User, r io.Reader) error
+	// RemoveAvatar removes the user's avatar
+	// - user: the user to remove the avatar from
+	// Returns an error if the avatar cannot be removed
+	RemoveAvatar(ctx context.Context, user *User) error
+	// OpenAvatar opens a stored avatar for reading, the caller must close it
+	// - key: the avatar key
+	// Returns the avatar content and info, or ErrNotFound if it does not exist
+	OpenAvatar(key string) (io.ReadCloser, *BlobInfo, error)
+}
+
+// IMailer is an interface for sending email
+type IMailer interface {
+	// Send sends a plain text email
+	// - to: the recipient address
+	// - subject: the subject of the email
+	// - body: the plain text body of the email
+	// Returns an error if the email cannot be sent
+	Send(to string, subject string, body string) error
+}
+
+// IPreferencesService is an interface for user preference operations
+type IPreferencesService interface {
+	IPersonalDataProvider
+	// GetPreferences gets the preferences of a user
+	// - userID: the user to get the preferences for
+	// Returns the stored preferences, or the defaults when the user has not saved any
+	GetPreferences(ctx context.Context, userID uint) (*Preferences, error)
+	// ValidatePreferences validates preferences
+	// - preferences: the preferences to validate
+	// Returns a map of field name to error message, empty when valid
+	ValidatePreferences(preferences *Preferences) map[string]string
+	// SavePreferences validates and saves the preferences of a user
+	// - preferences: the preferences to save
+	// Returns ErrInvalidPreferences if validation fails, otherwise an error if the save fails
+	SavePreferences(ctx context.Context, preferences *Preferences) error
+	// DateFormats returns the date layouts a user may choose from
+	DateFormats() []string
+	// PageSizes returns the page sizes a user may choose from
+	PageSizes() []int
+}
+
+// PersonalDataFile is a file included in a personal data export
+type PersonalDataFile struct {
+	// Name is the file name within the provider's folder of the export
+	Name string
+	// Content is the content of the file
+	Content []byte
+}
+
+// IPersonalDataProvider is implemented by components that store data about a user, so it can be
+// included in data subject exports and erased when the user's account is deleted
+type IPersonalDataProvider interface {
+	// PersonalDataName names the data, the files are placed in a folder of this name in the export
+	PersonalDataName() string
+	// ExportPersonalData exports everything stored about a user
+	// - userID: the user to export
+	// Returns the files to include in the export
+	ExportPersonalData(ctx context.Context, userID uint) ([]PersonalDataFile, error)
+	// ErasePersonalData erases or anonymises everything stored about a user
+	// - userID: the user to erase
+	// Returns an error if the data cannot be erased
+	ErasePersonalData(ctx context.Context, userID uint) error
+}
+
+// IPrivacyService is an interface for data subject requests
+type IPrivacyService interface {
+	// ExportPersonalData writes a ZIP archive of everything stored about a user
+	// - userID: the user to export
+	// - w: the writer to stream the archive to
+	// Returns an error if the export fails
+	ExportPersonalData(ctx context.Context, userID uint, w io.Writer) error
+	// RequestDeletion schedules a user's account for deletion once the grace period ends
+	// - user: the user to delete
+	// Returns an error if the request cannot be recorded
+	RequestDeletion(ctx context.Context, user *User) error
+	// CancelDeletion cancels a pending deletion
+	// - user: the user to keep
+	// Returns an error if the cancellation cannot be recorded
+	CancelDeletion(ctx context.Context, user *User) error
+	// PurgeDueDeletions erases every account whose grace period has ended
+	// - now: the current time
+	// Returns the number of accounts erased
+	PurgeDueDeletions(ctx context.Context, now time.Time) (int, error)
+}
+
+// IFeatureFlagService is an interface for evaluating and managing feature flags,
+// flags are cached in memory so evaluating them does not hit the database
+type IFeatureFlagService interface {
+	// IsEnabled evaluates a flag and counts the evaluation, unknown flags are off
+	// - key: the flag key
+	// - subject: who the flag is evaluated for, nil for anonymous visitors
+	// Returns true if the flag is on for the subject
+	IsEnabled(key string, subject *FlagSubject) bool
+	// Flags gets all flags ordered by key
+	Flags() []FeatureFlag
+	// Flag gets a flag by key
+	// Returns ErrNotFound if the flag does not exist
+	Flag(key string) (*FeatureFlag, error)
+	// SaveFlag validates and creates a flag with Version 0 or replaces a flag that is still at Version
+	// Returns ErrInvalidFeatureFlag if validation fails or a ConflictError on FieldVersion if the flag changed since,
+	// Flag returns the stored flag afterwards
+	SaveFlag(ctx context.Context, flag *FeatureFlag) error
+	// SetEnabled turns a flag on or off without changing its targeting
+	// Returns ErrNotFound if the flag does not exist or a ConflictError on FieldVersion if another instance changed it
+	SetEnabled(ctx context.Context, key string, enabled bool) error
+	// DeleteFlag deletes a flag, it evaluates as off afterwards
+	DeleteFlag(ctx context.Context, key string) error
+	// Evaluations gets the evaluation counts of a flag
+	Evaluations(key string) FlagEvaluations
+	// Refresh reloads the flags from the repository to pick up changes made by other instances
+	Refresh(ctx context.Context) error
 }
@@ -0,0 +1,80 @@
+package interfaces
+
+import "time"
+
+const (
+	// SettingTypeString is a free form string setting
+	SettingTypeString = "string"
+	// SettingTypeInt is an integer setting
+	SettingTypeInt = "int"
+	// SettingTypeBool is a boolean setting
+	SettingTypeBool = "bool"
+	// SettingTypeDuration is a duration setting written like 1h30m
+	SettingTypeDuration = "duration"
+	// SettingTypeFloat is a floating point setting
+	SettingTypeFloat = "float"
+	// SettingTypeStringList is a list of strings, written one per line
+	SettingTypeStringList = "string_list"
+	// SettingTypeJSON is an arbitrary JSON document
+	SettingTypeJSON = "json"
+)
+
+const (
+	// SettingCookieEncryptionKey is the base64 encoded key cookies are encrypted with
+	SettingCookieEncryptionKey = "cookie_encryption_key"
+	// SettingJWTSigningKey is the key session tokens are signed with
+	SettingJWTSigningKey = "jwt_signing_key"
+	// SettingFeatureFlagGroups maps the group names feature flags can target to the IDs of their members
+	SettingFeatureFlagGroups = "feature_flag_groups"
+)
+
+// SettingDefinition describes a setting known to the settings registry
+type SettingDefinition struct {
+	// Key is the unique key the setting is stored under
+	Key string
+	// Type is one of the SettingType constants
+	Type string
+	// Default is the value used when the setting has not been set, in its text form
+	Default string
+	// Description explains the setting to administrators
+	Description string
+	// Secret settings are encrypted at rest and never shown
+	Secret bool
+	// ReadOnly settings cannot be changed from the admin page
+	ReadOnly bool
+	// Validate optionally checks a parsed value, it receives the Go type matching Type
+	Validate func(value interface{}) error
+}
+
+// SettingActorSystem is the actor recorded for changes the application makes itself
+const SettingActorSystem = "system"
+
+// SettingActorDeleted replaces the actor of changes made by a user whose account was erased
+const SettingActorDeleted = "deleted user"
+
+// SettingActor identifies who changed a setting, recorded in the setting history
+type SettingActor struct {
+	// Username is the user that made the change or SettingActorSystem
+	Username string
+	// UserID is the ID of the user that made the change, 0 for actors that are not users
+	UserID uint
+	// RequestID is the ID of the request that made the change, empty for changes outside a request
+	RequestID string
+}
+
+// SettingChange is an entry in the append-only history of a setting
+type SettingChange struct {
+	ID  uint
+	Key string
+	// OldValue is the text form before the change, empty when the setting was unset or is secret
+	OldValue string
+	// NewValue is the text form after the change, empty when the setting is secret
+	NewValue string
+	// Secret changes never record their values
+	Secret bool
+	Actor  string
+	// ActorID is the ID of the user that made the change, 0 for actors that are not users or were erased
+	ActorID   uint
+	RequestID string
+	CreatedAt time.Time
+}
@@ -0,0 +1,31 @@
+package interfaces
+
+import (
+	"io"
+	"time"
+)
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	// Size is the size of the blob in bytes
+	Size int64
+	// ModTime is when the blob was last written
+	ModTime time.Time
+}
+
+// IBlobStorage is an interface for storing binary objects such as avatars
+type IBlobStorage interface {
+	// Put stores a blob, replacing any existing blob with the same key
+	// - key: the key of the blob, may contain / separated segments
+	// - r: the content of the blob
+	// Returns an error if the blob cannot be stored
+	Put(key string, r io.Reader) error
+	// Open opens a blob for reading, the caller must close it
+	// - key: the key of the blob
+	// Returns the blob content and info, or ErrNotFound if it does not exist
+	Open(key string) (io.ReadCloser, *BlobInfo, error)
+	// Delete deletes a blob, deleting a blob that does not exist is not an error
+	// - key: the key of the blob
+	// Returns an error if the delete fails
+	Delete(key string) error
+}
@@ -0,0 +1,17 @@
+package interfaces
+
+import "context"
+
+// ITransactionManager runs work in a database transaction, repositories called with the context passed to the
+// work take part in the transaction so services can compose several repositories atomically
+type ITransactionManager interface {
+	// WithinTransaction runs fn in a transaction, calls made inside a transaction use a savepoint
+	// - fn: the work, it must use the context it is given, returning an error rolls the transaction back
+	// Returns the error returned by fn, or an error if the transaction cannot be started or committed
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	// AfterCommit defers work that must only happen once the changes of a transaction are visible,
+	// such as updating caches, it is dropped if the transaction rolls back
+	// - ctx: the context of the call, fn runs right away when it carries no transaction
+	// - fn: the work to run after the outermost transaction commits
+	AfterCommit(ctx context.Context, fn func())
+}
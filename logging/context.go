@@ -0,0 +1,17 @@
+package logging
+
+import "context"
+
+// requestIDKey is the context key the request ID is stored under
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request it was created for
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID stored by WithRequestID, empty outside of a request
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,31 @@
+package logging
+
+import (
+	"log/slog"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// Level is the minimum level logged, it follows the log level in the configuration as it changes
+type Level struct {
+	slog.LevelVar
+}
+
+// NewLevel creates a level set to the configured log level
+// - config: provides the log level
+func NewLevel(config interfaces.IConfig) *Level {
+	level := &Level{}
+	level.Set(config.GetLogLevel())
+	return level
+}
+
+// ReloadKeys returns the log level key
+func (l *Level) ReloadKeys() []string {
+	return []string{interfaces.ConfigKeyLogLevel}
+}
+
+// Reload sets the level to the configured log level
+func (l *Level) Reload(config interfaces.IConfig) error {
+	l.Set(config.GetLogLevel())
+	return nil
+}
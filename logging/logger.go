@@ -0,0 +1,20 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// NewLogger creates a logger writing in the configured format
+// - output: where the logs are written
+// - config: provides the log format
+// - level: the minimum level logged
+func NewLogger(output io.Writer, config interfaces.IConfig, level *Level) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+	if config.GetLogFormat() == "text" {
+		return slog.New(slog.NewTextHandler(output, options))
+	}
+	return slog.New(slog.NewJSONHandler(output, options))
+}
@@ -2,19 +2,26 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"embed"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
+	// embed the timezone database so user timezones resolve in minimal images
+	_ "time/tzdata"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cache"
 	"github.com/gofiber/fiber/v2/middleware/compress"
-	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/csrf"
 	"github.com/gofiber/fiber/v2/middleware/encryptcookie"
 	"github.com/gofiber/fiber/v2/middleware/etag"
@@ -24,46 +31,79 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/fiber/v2/utils"
 	"github.com/gofiber/template/html/v2"
-	"github.com/pressly/goose/v3"
 	slogfiber "github.com/samber/slog-fiber"
-	"gorm.io/driver/sqlite"
+	"github.com/spf13/pflag"
 	"gorm.io/gorm"
 
 	"github.com/bryopsida/gofiber-pug-starter/auth"
+	"github.com/bryopsida/gofiber-pug-starter/commands"
 	"github.com/bryopsida/gofiber-pug-starter/config"
+	"github.com/bryopsida/gofiber-pug-starter/crypto/certs"
+	"github.com/bryopsida/gofiber-pug-starter/crypto/envelope"
 	"github.com/bryopsida/gofiber-pug-starter/database"
+	"github.com/bryopsida/gofiber-pug-starter/database/backup"
 	"github.com/bryopsida/gofiber-pug-starter/database/migrations"
 	_ "github.com/bryopsida/gofiber-pug-starter/docs"
 	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/bryopsida/gofiber-pug-starter/logging"
+	"github.com/bryopsida/gofiber-pug-starter/middleware"
 	"github.com/bryopsida/gofiber-pug-starter/pages"
+	flags_repository "github.com/bryopsida/gofiber-pug-starter/repositories/flags"
 	number_repsitory "github.com/bryopsida/gofiber-pug-starter/repositories/number"
+	preferences_repository "github.com/bryopsida/gofiber-pug-starter/repositories/preferences"
+	sessions_repository "github.com/bryopsida/gofiber-pug-starter/repositories/sessions"
 	settings_repository "github.com/bryopsida/gofiber-pug-starter/repositories/settings"
+	tokens_repository "github.com/bryopsida/gofiber-pug-starter/repositories/tokens"
 	users_repository "github.com/bryopsida/gofiber-pug-starter/repositories/users"
+	avatars_service "github.com/bryopsida/gofiber-pug-starter/services/avatars"
+	flags_service "github.com/bryopsida/gofiber-pug-starter/services/flags"
 	increment_service "github.com/bryopsida/gofiber-pug-starter/services/increment"
 	jwt_service "github.com/bryopsida/gofiber-pug-starter/services/jwt"
+	mail_service "github.com/bryopsida/gofiber-pug-starter/services/mail"
 	password_service "github.com/bryopsida/gofiber-pug-starter/services/password"
+	preferences_service "github.com/bryopsida/gofiber-pug-starter/services/preferences"
+	privacy_service "github.com/bryopsida/gofiber-pug-starter/services/privacy"
+	sessions_service "github.com/bryopsida/gofiber-pug-starter/services/sessions"
 	settings_service "github.com/bryopsida/gofiber-pug-starter/services/settings"
+	settingsbulk_service "github.com/bryopsida/gofiber-pug-starter/services/settingsbulk"
+	tokens_service "github.com/bryopsida/gofiber-pug-starter/services/tokens"
+	userbulk_service "github.com/bryopsida/gofiber-pug-starter/services/userbulk"
 	users_service "github.com/bryopsida/gofiber-pug-starter/services/users"
+	filesystem_storage "github.com/bryopsida/gofiber-pug-starter/storage/filesystem"
 )
 
-//go:embed database/migrations/sql/*
-var sqlMigrations embed.FS
-
 //go:embed public/*
 var embedDirPubic embed.FS
 
 type repositories struct {
-	NumberRepository   interfaces.INumberRepository
-	SettingsRepository interfaces.ISettingsRepository
-	UsersRepository    interfaces.IUserRepository
+	NumberRepository      interfaces.INumberRepository
+	SettingsRepository    interfaces.ISettingsRepository
+	UsersRepository       interfaces.IUserRepository
+	TokensRepository      interfaces.IUserTokenRepository
+	SessionsRepository    interfaces.IUserSessionRepository
+	BlobStorage           interfaces.IBlobStorage
+	PreferencesRepository interfaces.IPreferencesRepository
+	FeatureFlagRepository interfaces.IFeatureFlagRepository
+	TransactionManager    interfaces.ITransactionManager
 }
 
 type services struct {
-	IncrementService interfaces.IIncrementService
-	SettingsService  interfaces.ISettingsService
-	PasswordService  interfaces.IPasswordService
-	UsersService     interfaces.IUsersService
-	JWTService       interfaces.IJWTService
+	IncrementService    interfaces.IIncrementService
+	SettingsService     interfaces.ISettingsService
+	SettingsBulkService interfaces.ISettingsBulkService
+	PasswordService     interfaces.IPasswordService
+	UsersService        interfaces.IUsersService
+	JWTService          interfaces.IJWTService
+	TokenService        interfaces.ITokenService
+	SessionService      interfaces.ISessionService
+	UserBulkService     interfaces.IUserBulkService
+	AvatarService       interfaces.IAvatarService
+	Mailer              interfaces.IMailer
+	PreferencesService  interfaces.IPreferencesService
+	PrivacyService      interfaces.IPrivacyService
+	FeatureFlagService  interfaces.IFeatureFlagService
+	BackupService       interfaces.IBackupService
+	TransactionManager  interfaces.ITransactionManager
 }
 
 func buildConfig(view fiber.Views) fiber.Config {
@@ -72,11 +112,17 @@ func buildConfig(view fiber.Views) fiber.Config {
 		ViewsLayout:           "layouts/main",
 		PassLocalsToViews:     true,
 		DisableStartupMessage: true,
+		ErrorHandler:          middleware.ErrorHandler,
+		// form values are cached by the settings and feature flag services, so they must not share
+		// buffers that fasthttp reuses for the next request
+		Immutable: true,
 	}
 }
 
-func buildViewEngine() *html.Engine {
-	engine := html.New("./views", ".html")
+func buildViewEngine(config interfaces.IConfig) fiber.Views {
+	engine := html.New(config.GetViewsPath(), ".html")
+	engine.AddFuncMap(preferences_service.TemplateFuncs())
+	engine.AddFuncMap(flags_service.TemplateFuncs())
 	return engine
 }
 
@@ -84,18 +130,53 @@ func buildApp(config fiber.Config) *fiber.App {
 	return fiber.New(config)
 }
 
-func attachMiddleware(app *fiber.App, services *services) {
-	// get the cookie encryption key
-	encryptionKey, err := services.SettingsService.GetString("cookie_encryption_key")
+// newEncryptCookieMiddleware builds the cookie encryption middleware and rebuilds it whenever the key changes,
+// cookies encrypted with the previous key can no longer be read so everyone is signed out
+func newEncryptCookieMiddleware(settingsService interfaces.ISettingsService) fiber.Handler {
+	build := func() (fiber.Handler, error) {
+		encryptionKey, err := settingsService.GetString(context.Background(), interfaces.SettingCookieEncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		return encryptcookie.New(encryptcookie.Config{
+			Key: encryptionKey,
+		}), nil
+	}
+	handler, err := build()
 	if err != nil {
 		slog.Error("Error getting cookie encryption key", "error", err)
 		panic("failed to get cookie encryption key")
 	}
+	var current atomic.Value
+	current.Store(handler)
+	settingsService.Subscribe(interfaces.SettingCookieEncryptionKey, func(key string) {
+		handler, err := build()
+		if err != nil {
+			slog.Error("Failed to reload cookie encryption key", "error", err)
+			return
+		}
+		current.Store(handler)
+		slog.Info("Reloaded cookie encryption key")
+	})
+	return func(c *fiber.Ctx) error {
+		return current.Load().(fiber.Handler)(c)
+	}
+}
+
+// attachMiddleware adds the middleware shared by every route, handlers get a user context that is cancelled with ctx
+// Returns the middleware that follows changes to the configuration
+func attachMiddleware(ctx context.Context, app *fiber.App, services *services, config interfaces.IConfig) []interfaces.IReloadable {
+	corsMiddleware := middleware.NewCORS(config)
+	rateLimiter := middleware.NewRateLimiter(config)
 	app.Use(slogfiber.New(slog.Default()))
 	app.Use(helmet.New())
 	app.Use(etag.New())
 	app.Use(requestid.New())
-	app.Use(cors.New())
+	app.Use(middleware.NewRequestContext(ctx))
+	app.Use(corsMiddleware.Handle)
+	app.Use(rateLimiter.Handle)
+	// cookies must be decrypted before any middleware that reads them
+	app.Use(newEncryptCookieMiddleware(services.SettingsService))
 	app.Use(csrf.New(csrf.Config{
 		KeyLookup:         "cookie:csrf_",
 		CookieName:        "csrf_",
@@ -103,135 +184,450 @@ func attachMiddleware(app *fiber.App, services *services) {
 		CookieSessionOnly: true,
 		CookieHTTPOnly:    true,
 		Extractor:         csrf.CsrfFromCookie("csrf_"),
-		Expiration:        1 * time.Hour,
+		Expiration:        config.GetCSRFExpiration(),
 		KeyGenerator:      utils.UUIDv4,
 	}))
 	app.Use(compress.New())
-	app.Use(cache.New())
-	app.Use(encryptcookie.New(encryptcookie.Config{
-		Key: encryptionKey,
+	app.Use(cache.New(cache.Config{
+		// only cache the static assets, pages are rendered per user
+		Next: func(c *fiber.Ctx) bool {
+			return !strings.HasPrefix(c.Path(), "/public")
+		},
+		Expiration:   config.GetCacheExpiration(),
+		CacheControl: config.GetCacheControl(),
 	}))
 	app.Use(healthcheck.New())
+	app.Use(flags_service.Middleware(services.FeatureFlagService))
 
 	app.Use("/public", filesystem.New(filesystem.Config{
 		Root:       http.FS(embedDirPubic),
 		PathPrefix: "public",
 		Browse:     false,
 	}))
-
+	return []interfaces.IReloadable{corsMiddleware, rateLimiter}
 }
 
-func runServer(app *fiber.App, address string) {
-	err := app.Listen(address)
+func runServer(app *fiber.App, address string, tlsConfig *tls.Config) {
+	var err error
+	if tlsConfig == nil {
+		err = app.Listen(address)
+	} else {
+		var listener net.Listener
+		listener, err = tls.Listen("tcp", address, tlsConfig)
+		if err == nil {
+			err = app.Listener(listener)
+		}
+	}
 	if err != nil {
 		slog.Error("Error starting server", "error", err)
 	}
 }
 
-func startServer(app *fiber.App, config interfaces.IConfig) {
+// buildTLSReloader loads the server certificates and watches their files until ctx is cancelled
+// Returns nil when TLS is disabled
+func buildTLSReloader(ctx context.Context, config interfaces.IConfig) *certs.Reloader {
+	if !config.IsTLSEnabled() {
+		return nil
+	}
+	reloader, err := certs.NewReloader(config)
+	if err != nil {
+		slog.Error("Error loading TLS certificates", "error", err)
+		panic("failed to load TLS certificates")
+	}
+	if err := reloader.Watch(ctx); err != nil {
+		slog.Error("Error watching TLS certificates, changes require a restart", "error", err)
+	}
+	return reloader
+}
+
+// startServer starts listening in the background
+// Returns the TLS certificates so they can follow changes to the configuration, nil when TLS is disabled
+func startServer(ctx context.Context, app *fiber.App, config interfaces.IConfig) *certs.Reloader {
 	address := config.GetServerAddress()
 	port := config.GetServerPort()
-	slog.Info("Starting server", "address", address, "port", port)
+	reloader := buildTLSReloader(ctx, config)
+	var tlsConfig *tls.Config
+	if reloader != nil {
+		tlsConfig = reloader.TLSConfig()
+	}
+	slog.Info("Starting server", "address", address, "port", port, "tls", tlsConfig != nil, "clientAuth", config.GetServerClientAuth())
 	serverListenAddress := fmt.Sprintf("%s:%d", address, port)
-	go runServer(app, serverListenAddress)
+	go runServer(app, serverListenAddress, tlsConfig)
+	return reloader
+}
+
+// watchConfig applies changes to the config file to the components that can follow them without a restart
+func watchConfig(cfg interfaces.IConfig, components ...interfaces.IReloadable) {
+	err := cfg.Watch(components...)
+	if errors.Is(err, config.ErrNoConfigFile) {
+		slog.Info("No config file loaded, configuration changes require a restart")
+		return
+	}
+	if err != nil {
+		slog.Error("Error watching config file, changes require a restart", "error", err)
+	}
+}
+
+// startSettingsPoller periodically reloads settings and feature flags so changes made by other instances are applied
+// until ctx is cancelled
+func startSettingsPoller(ctx context.Context, settingsService interfaces.ISettingsService, flagsService interfaces.IFeatureFlagService, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := settingsService.Refresh(ctx); err != nil {
+					slog.Error("Error refreshing settings", "error", err)
+				}
+				if err := flagsService.Refresh(ctx); err != nil {
+					slog.Error("Error refreshing feature flags", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// startBackupJob periodically writes a backup to the backup path until ctx is cancelled, an interval of 0 disables it
+func startBackupJob(ctx context.Context, backupService interfaces.IBackupService, cfg interfaces.IConfig) {
+	interval := cfg.GetBackupInterval()
+	if interval == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				path, err := backupService.BackupToPath(ctx, backupOptions(cfg))
+				if err != nil {
+					slog.Error("Error writing scheduled backup", "error", err)
+					continue
+				}
+				slog.Info("Wrote scheduled backup", "path", path)
+			}
+		}
+	}()
+}
+
+// backupOptions returns whether backups are compressed and encrypted unless asked otherwise
+func backupOptions(cfg interfaces.IConfig) interfaces.BackupOptions {
+	return interfaces.BackupOptions{Compress: cfg.GetBackupCompress(), Encrypt: cfg.GetBackupEncrypt()}
+}
+
+// initializeMailer picks the mail transport, emails are refused when neither a mail server nor logging is configured
+func initializeMailer(cfg interfaces.IConfig) interfaces.IMailer {
+	if smtpConfig := cfg.GetSMTPConfig(); smtpConfig.Host != "" {
+		return mail_service.NewSMTPMailer(smtpConfig)
+	}
+	if cfg.GetMailLog() {
+		slog.Warn("Emails are written to the log instead of being sent, their links can be used by anyone reading it, only use mail.log in development")
+		return mail_service.NewLogMailer()
+	}
+	slog.Warn("No mail server is configured, set mail.smtp.host to let users change their email address")
+	return mail_service.NewDisabledMailer()
+}
+
+// startAccountDeletionJob periodically purges accounts whose deletion grace period has ended until ctx is cancelled
+func startAccountDeletionJob(ctx context.Context, privacyService interfaces.IPrivacyService, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			purged, err := privacyService.PurgeDueDeletions(ctx, time.Now())
+			if err != nil {
+				slog.Error("Error purging deleted accounts", "error", err)
+			}
+			if purged > 0 {
+				slog.Info("Purged deleted accounts", "count", purged)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// initializeCipher builds the cipher used to encrypt secret settings from the configured key encryption keys
+func initializeCipher(cfg interfaces.IConfig) interfaces.ISecretCipher {
+	var key []byte
+	var err error
+	if cfg.GetSecretsKey() != "" {
+		key, err = envelope.DecodeKey(cfg.GetSecretsKey())
+	} else {
+		keyPath := cfg.GetSecretsKeyPath()
+		if keyPath == "" {
+			slog.Error("No key encryption key configured, set secrets.key (APP_SECRETS_KEY) or point secrets.key_path at a file outside the data directory")
+			os.Exit(2)
+		}
+		dataDirs := []string{cfg.GetStoragePath(), cfg.GetBackupPath()}
+		if cfg.GetDatabaseDriver() == interfaces.DatabaseDriverSQLite {
+			dataDirs = append(dataDirs, filepath.Dir(cfg.GetDatabasePath()))
+		}
+		if err := envelope.CheckKeyFileLocation(keyPath, dataDirs...); err != nil {
+			slog.Error("Invalid value for secrets.key_path", "error", err)
+			os.Exit(2)
+		}
+		key, err = envelope.LoadOrCreateKeyFile(keyPath)
+	}
+	if err != nil {
+		slog.Error("Error loading key encryption key", "error", err)
+		panic("failed to load key encryption key")
+	}
+	previousKeys := [][]byte{}
+	for _, encoded := range cfg.GetPreviousSecretsKeys() {
+		previousKey, err := envelope.DecodeKey(encoded)
+		if err != nil {
+			slog.Error("Error loading previous key encryption key", "error", err)
+			panic("failed to load previous key encryption key")
+		}
+		previousKeys = append(previousKeys, previousKey)
+	}
+	cipher, err := envelope.NewEnvelopeCipher(key, previousKeys...)
+	if err != nil {
+		slog.Error("Error creating secrets cipher", "error", err)
+		panic("failed to create secrets cipher")
+	}
+	return cipher
 }
 
 func initializeDatabase(cfg interfaces.IConfig) *gorm.DB {
 
 	var err error
-	database.DBConn, err = gorm.Open(sqlite.Open(cfg.GetDatabasePath()), &gorm.Config{})
+	database.DBConn, err = database.Open(cfg)
 	if err != nil {
+		slog.Error("Error connecting to database", "driver", cfg.GetDatabaseDriver(), "error", err)
 		panic("failed to connect database")
 	}
-	slog.Info("Connection Opened to Database")
-	sqlDb, err := database.DBConn.DB()
+	slog.Info("Connection Opened to Database", "driver", cfg.GetDatabaseDriver())
+	return database.DBConn
+}
+
+func initializeMigrator(db *gorm.DB, cfg interfaces.IConfig, cipher interfaces.ISecretCipher) interfaces.IMigrator {
+	migrator, err := migrations.NewMigrator(db, database.GooseDialect(cfg.GetDatabaseDriver()), migrations.Dependencies{Cipher: cipher})
 	if err != nil {
-		panic("failed to get database connection")
+		slog.Error("Error loading migrations", "error", err)
+		panic("failed to load migrations")
 	}
-	goose.SetBaseFS(sqlMigrations)
-	goose.SetDialect("sqlite3")
-	migrations.InitializeV001Migration(*database.DBConn)
-	migrations.InitializeV002Migration(*database.DBConn)
-	migrations.InitializeV003Migration(*database.DBConn)
-	migrations.InitializeV004Migration(*database.DBConn)
-	err = goose.Up(sqlDb, "database/migrations/sql")
+	return migrator
+}
 
+// migrateDatabase applies the pending migrations, or when auto migration is off refuses to start until they are applied
+func migrateDatabase(ctx context.Context, cfg interfaces.IConfig, migrator interfaces.IMigrator) {
+	if !cfg.GetDatabaseAutoMigrate() {
+		pending, err := migrator.HasPending(ctx)
+		if err != nil {
+			slog.Error("Error checking for pending migrations", "error", err)
+			panic("failed to check for pending migrations")
+		}
+		if pending {
+			slog.Error("The database has pending migrations and auto migration is off, apply them with the migrate up command")
+			os.Exit(1)
+		}
+		return
+	}
+	steps, err := migrator.Up(ctx, false)
+	for _, step := range steps {
+		slog.Info("Applied migration", "version", step.Version, "name", step.Name, "duration", step.Duration)
+	}
 	if err != nil {
 		slog.Error("Error migrating database", "error", err)
 		panic("failed to migrate database")
 	}
 	slog.Info("Database Migrated")
-	return database.DBConn
 }
 
-func initializeRepositories(db *gorm.DB) *repositories {
+func initializeRepositories(db *gorm.DB, cfg interfaces.IConfig, cipher interfaces.ISecretCipher) *repositories {
 	// Initialize repositories
 	repositories := &repositories{}
 	repositories.NumberRepository = number_repsitory.NewNumberRepository(db)
-	repositories.SettingsRepository = settings_repository.NewSettingsRepository(db)
+	repositories.SettingsRepository = settings_repository.NewSettingsRepository(db, cipher)
 	repositories.UsersRepository = users_repository.NewUserRepository(db)
+	repositories.TokensRepository = tokens_repository.NewUserTokenRepository(db)
+	repositories.SessionsRepository = sessions_repository.NewUserSessionRepository(db)
+	repositories.BlobStorage = filesystem_storage.NewFilesystemStorage(cfg.GetStoragePath())
+	repositories.PreferencesRepository = preferences_repository.NewPreferencesRepository(db)
+	repositories.FeatureFlagRepository = flags_repository.NewFeatureFlagRepository(db)
+	repositories.TransactionManager = database.NewTransactionManager(db)
 	return repositories
 }
 
-func initializeServices(repos *repositories) *services {
+func initializeServices(repos *repositories, cfg interfaces.IConfig) *services {
 	// Initialize services
 	services := &services{}
+	services.TransactionManager = repos.TransactionManager
 	services.IncrementService = increment_service.NewIncrementService(repos.NumberRepository, "counter")
-	services.PasswordService = password_service.NewPasswordService()
-	services.SettingsService = settings_service.NewSettingsService(repos.SettingsRepository)
-	services.JWTService = jwt_service.NewJWTService(services.SettingsService)
+	services.PasswordService = password_service.NewPasswordService(cfg)
+	services.SettingsService = settings_service.NewSettingsService(repos.SettingsRepository, repos.TransactionManager, settings_service.Registry())
+	services.SettingsBulkService = settingsbulk_service.NewSettingsBulkService(services.SettingsService)
+	services.JWTService = jwt_service.NewJWTService(services.SettingsService, cfg)
 	services.UsersService = users_service.NewUsersService(repos.UsersRepository)
+	services.TokenService = tokens_service.NewTokenService(repos.TokensRepository)
+	services.SessionService = sessions_service.NewSessionService(repos.SessionsRepository, cfg.GetJWTLifetime())
+	services.UserBulkService = userbulk_service.NewUserBulkService(services.UsersService, services.PasswordService, services.TokenService, services.TransactionManager)
+	services.AvatarService = avatars_service.NewAvatarService(repos.BlobStorage, services.UsersService, services.TransactionManager)
+	services.Mailer = initializeMailer(cfg)
+	services.PreferencesService = preferences_service.NewPreferencesService(repos.PreferencesRepository)
+	services.FeatureFlagService = flags_service.NewFeatureFlagService(repos.FeatureFlagRepository, services.SettingsService)
+	// the users service erases the user record so it must be the last provider
+	services.PrivacyService = privacy_service.NewPrivacyService(services.UsersService, services.TransactionManager, cfg.GetAccountDeletionGracePeriod(),
+		services.AvatarService, services.PreferencesService, services.TokenService, services.SessionService,
+		settings_service.NewHistoryPersonalDataProvider(repos.SettingsRepository), services.UsersService)
 	return services
 }
 
 func addPublicRoutes(app *fiber.App, services *services) {
-	auth.RegisterPublicRoutes(app.Group("/auth"), services.PasswordService, services.UsersService, services.JWTService)
+	auth.RegisterPublicRoutes(app.Group("/auth"), services.PasswordService, services.UsersService, services.JWTService, services.SessionService)
 }
-func addPublicPages(app *fiber.App) {
+func addPublicPages(app *fiber.App, services *services) {
 	pages.RegisterGlobalPages(app)
+	pages.RegisterInvitationPages(app, services.TokenService, services.UsersService, services.PasswordService, services.TransactionManager)
+	pages.RegisterEmailVerificationPages(app, services.TokenService, services.UsersService)
 	pages.AddSwagger(app)
 }
 
 func addPrivateRoutes(app *fiber.App, services *services) {
 	auth.RegisterPrivateRoutes(app.Group("/auth"), services.PasswordService, services.UsersService, services.JWTService)
 }
-func addPrivatePages(app *fiber.App, services *services) {
-	pages.RegisterPrivateGlobalPages(app, services.JWTService)
-	pages.RegisterPrivateUserPages(app, services.UsersService, services.PasswordService)
+func addPrivatePages(app *fiber.App, services *services, cfg interfaces.IConfig) {
+	pages.AddPreferences(app, services.PreferencesService)
+	pages.RegisterPrivateGlobalPages(app)
+	pages.RegisterPrivateProfilePages(app, services.UsersService, services.AvatarService, services.TokenService, services.Mailer, services.PrivacyService, services.PasswordService)
+	pages.RegisterPrivatePreferencesPages(app, services.PreferencesService)
+	pages.RegisterPrivateUserPages(app, services.UsersService, services.PasswordService, services.UserBulkService)
+	pages.RegisterPrivateSettingsPages(app, services.SettingsService, services.SettingsBulkService)
+	pages.RegisterPrivateFlagPages(app, services.FeatureFlagService)
+	pages.RegisterPrivateBackupPages(app, services.BackupService, backupOptions(cfg))
 }
 
 func addAuthMiddleware(app *fiber.App, services *services) {
-	auth.AddJWTAuth(app, services.SettingsService)
+	auth.AddClientCertAuth(app, services.JWTService, services.UsersService, services.SessionService)
+	auth.AddJWTAuth(app, services.JWTService)
+	auth.AddCurrentUser(app, services.JWTService, services.UsersService)
+}
+
+// databaseCommands run before the automatic migration so they work on the database as it is
+var databaseCommands = map[string]bool{"migrate": true, "backup": true, "restore": true}
+
+// runDatabaseCommand runs a command line subcommand that works on the database before it is migrated
+func runDatabaseCommand(args []string, migrator interfaces.IMigrator, backupService interfaces.IBackupService, cfg interfaces.IConfig) error {
+	ctx := context.Background()
+	switch args[0] {
+	case "migrate":
+		return commands.RunMigrate(ctx, args[1:], migrator, os.Stdout)
+	case "backup":
+		return commands.RunBackup(ctx, args[1:], backupService, backupOptions(cfg), os.Stdout)
+	case "restore":
+		return commands.RunRestore(ctx, args[1:], backupService, os.Stdin, os.Stdout)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// runCommand runs a command line subcommand instead of the server
+func runCommand(args []string, services *services) error {
+	switch args[0] {
+	case "settings":
+		return commands.RunSettings(context.Background(), args[1:], services.SettingsBulkService, os.Stdout)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
 }
+
+// exitOnCommandError ends the process with a failure status if a command failed
+func exitOnCommandError(err error) {
+	if err != nil {
+		slog.Error("Command failed", "error", err)
+		os.Exit(1)
+	}
+}
+
 func main() {
-	defaultLogger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelDebug,
-	}))
-	slog.SetDefault(defaultLogger)
+	config, args, err := config.NewViperConfig(os.Args[1:])
+	if errors.Is(err, pflag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		os.Exit(2)
+	}
+	// commands write their output to stdout so logs go to stderr instead
+	logOutput := os.Stdout
+	if len(args) > 0 {
+		logOutput = os.Stderr
+	}
+	logLevel := logging.NewLevel(config)
+	slog.SetDefault(logging.NewLogger(logOutput, config, logLevel))
 	slog.Info("Starting")
-	config := config.NewViperConfig()
+	// the config command must work without a database
+	if len(args) > 0 && args[0] == "config" {
+		exitOnCommandError(commands.RunConfig(args[1:], config, os.Stdout))
+		return
+	}
 	slog.Info("Getting database")
+	cipher := initializeCipher(config)
 	db := initializeDatabase(config)
+	migrator := initializeMigrator(db, config, cipher)
+	backupService := backup.NewBackupService(db, config, cipher)
+	// every process but the one restoring marks the database as in use, so a restore cannot replace it under them
+	if len(args) == 0 || args[0] != "restore" {
+		if err := backupService.LockShared(context.Background()); err != nil {
+			slog.Error("Error locking database, a restore may be running", "error", err)
+			panic("failed to lock database")
+		}
+	}
+	if len(args) > 0 && databaseCommands[args[0]] {
+		exitOnCommandError(runDatabaseCommand(args, migrator, backupService, config))
+		return
+	}
+	migrateDatabase(context.Background(), config, migrator)
 
-	repos := initializeRepositories(db)
-	services := initializeServices(repos)
+	repos := initializeRepositories(db, config, cipher)
+	rewrapped, err := repos.SettingsRepository.RewrapSecrets(context.Background())
+	if err != nil {
+		slog.Error("Error re-wrapping secrets", "error", err)
+		panic("failed to re-wrap secrets")
+	}
+	if rewrapped > 0 {
+		slog.Info("Re-wrapped secrets under the current key encryption key", "count", rewrapped)
+	}
+	services := initializeServices(repos, config)
+	services.BackupService = backupService
+	if len(args) > 0 {
+		exitOnCommandError(runCommand(args, services))
+		return
+	}
 
 	// Create a context with cancellation
-	_, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
 	// ensure this is always called on func exit
 	defer cancel()
+	startAccountDeletionJob(ctx, services.PrivacyService, config.GetAccountDeletionInterval())
+	startSettingsPoller(ctx, services.SettingsService, services.FeatureFlagService, config.GetSettingsPollInterval())
+	startBackupJob(ctx, services.BackupService, config)
 
-	appViews := buildViewEngine()
+	appViews := buildViewEngine(config)
 	appConfig := buildConfig(appViews)
 	app := buildApp(appConfig)
-	attachMiddleware(app, services)
+	reloadables := attachMiddleware(ctx, app, services, config)
 	addPublicRoutes(app, services)
-	addPublicPages(app)
+	addPublicPages(app, services)
 	addAuthMiddleware(app, services)
 	addPrivateRoutes(app, services)
-	addPrivatePages(app, services)
+	addPrivatePages(app, services, config)
 
-	startServer(app, config)
+	reloadables = append(reloadables, logLevel)
+	if tlsReloader := startServer(ctx, app, config); tlsReloader != nil {
+		reloadables = append(reloadables, tlsReloader)
+	}
+	watchConfig(config, reloadables...)
 
 	// Set up signal handling
 	sigChan := make(chan os.Signal, 1)
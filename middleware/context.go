@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/logging"
+	"github.com/gofiber/fiber/v2"
+)
+
+// cancelLocal holds the function cancelling the user context, SetBodyStreamWriter takes it over
+const cancelLocal = "cancelRequestContext"
+
+// disconnectPollInterval is how often the connection of a running handler is checked for a disconnected client
+var disconnectPollInterval = 250 * time.Millisecond
+
+// NewRequestContext sets the user context of every request to one carrying the request ID that is cancelled
+// when ctx is, when the client disconnects while the handler runs or when the handler returns,
+// so queries started by handlers stop once nobody waits for them. Responses streamed after the handler returns
+// must be written with SetBodyStreamWriter to keep using it, it must be added after the requestid middleware
+// - ctx: the context of the server
+func NewRequestContext(ctx context.Context) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID, _ := c.Locals("requestid").(string)
+		requestCtx, cancel := context.WithCancel(logging.WithRequestID(ctx, requestID))
+		c.SetUserContext(requestCtx)
+		c.Locals(cancelLocal, cancel)
+		stopWatching := watchDisconnect(c.Context().Conn(), cancel)
+		err := c.Next()
+		stopWatching()
+		if cancel, ok := c.Locals(cancelLocal).(context.CancelFunc); ok {
+			cancel()
+		}
+		return err
+	}
+}
+
+// SetBodyStreamWriter streams the response body once the handler returns, the user context stays usable
+// until writer returns and is cancelled afterwards. c must not be used by writer
+// - writer: writes the body, ctx is the user context of the request
+func SetBodyStreamWriter(c *fiber.Ctx, writer func(ctx context.Context, w *bufio.Writer)) {
+	ctx := c.UserContext()
+	cancel, ok := c.Locals(cancelLocal).(context.CancelFunc)
+	if !ok {
+		cancel = func() {}
+	}
+	c.Locals(cancelLocal, nil)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		writer(ctx, w)
+	})
+}
+
+// watchDisconnect calls cancel if the peer of conn closes it before the returned stop function is called
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) func() {
+	if conn == nil || !canDetectDisconnect(conn) {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(disconnectPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if peerClosed(conn) {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
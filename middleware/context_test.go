@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRequestContextCancelledWhenHandlerReturns(t *testing.T) {
+	app := fiber.New()
+	app.Use(NewRequestContext(context.Background()))
+	handled := make(chan context.Context, 1)
+	app.Get("/", func(c *fiber.Ctx) error {
+		handled <- c.UserContext()
+		return c.SendString("ok")
+	})
+	streamed := make(chan error, 1)
+	app.Get("/stream", func(c *fiber.Ctx) error {
+		SetBodyStreamWriter(c, func(ctx context.Context, w *bufio.Writer) {
+			// the handler has returned, the context is still usable by the stream
+			streamed <- ctx.Err()
+			w.WriteString("streamed")
+		})
+		return nil
+	})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.ErrorIs(t, (<-handled).Err(), context.Canceled)
+
+	resp, err = app.Test(httptest.NewRequest(fiber.MethodGet, "/stream", nil))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "streamed", string(body))
+	assert.NoError(t, <-streamed)
+}
+
+func TestRequestContextCancelledOnDisconnect(t *testing.T) {
+	if !canDetectDisconnect(&net.TCPConn{}) {
+		t.Skip("disconnects cannot be detected on this platform")
+	}
+	disconnectPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { disconnectPollInterval = 250 * time.Millisecond })
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "db.sqlite")), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	// shutting the server down stops the query if the disconnect goes unnoticed
+	serverCtx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(NewRequestContext(serverCtx))
+	started := make(chan struct{})
+	queried := make(chan error, 1)
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		// counts for far longer than the test may run unless the query is interrupted
+		var count int64
+		err := db.WithContext(c.UserContext()).Raw(`WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c)
+			SELECT count(*) FROM (SELECT x FROM c LIMIT 100000000000)`).Scan(&count).Error
+		queried <- err
+		return err
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(listener)
+	t.Cleanup(func() { app.Shutdown() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+	require.NoError(t, conn.Close())
+
+	select {
+	case err := <-queried:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(10 * time.Second):
+		shutdown()
+		t.Error("the query kept running after the client disconnected")
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// NewCORS creates the CORS middleware, it follows the CORS options in the configuration
+// - config: provides the allowed origins, methods and headers
+func NewCORS(config interfaces.IConfig) *Reloadable {
+	return newReloadable(config, func(config interfaces.IConfig) fiber.Handler {
+		return cors.New(cors.Config{
+			AllowOrigins:     strings.Join(config.GetCORSAllowOrigins(), ","),
+			AllowMethods:     strings.Join(config.GetCORSAllowMethods(), ","),
+			AllowHeaders:     strings.Join(config.GetCORSAllowHeaders(), ","),
+			AllowCredentials: config.GetCORSAllowCredentials(),
+			MaxAge:           int(config.GetCORSMaxAge().Seconds()),
+		})
+	}, interfaces.ConfigKeyCORSAllowOrigins, interfaces.ConfigKeyCORSAllowMethods, interfaces.ConfigKeyCORSAllowHeaders,
+		interfaces.ConfigKeyCORSAllowCredentials, interfaces.ConfigKeyCORSMaxAge)
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package middleware
+
+import "net"
+
+// canDetectDisconnect is false where the socket cannot be peeked at,
+// the user context is then only cancelled when the handler returns
+func canDetectDisconnect(conn net.Conn) bool {
+	return false
+}
+
+func peerClosed(conn net.Conn) bool {
+	return false
+}
@@ -0,0 +1,54 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package middleware
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// socket returns the connection a socket can be read from, unwrapping TLS
+func socket(conn net.Conn) (syscall.Conn, bool) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	return sc, ok
+}
+
+func canDetectDisconnect(conn net.Conn) bool {
+	_, ok := socket(conn)
+	return ok
+}
+
+// peerClosed peeks at the socket without consuming anything the client sent,
+// the end of the stream or a reset means the client is gone. A client that only
+// closed its sending side counts as disconnected, HTTP clients do not do that while waiting for a response
+func peerClosed(conn net.Conn) bool {
+	sc, ok := socket(conn)
+	if !ok {
+		return false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+	closed := false
+	buf := make([]byte, 1)
+	err = raw.Read(func(fd uintptr) bool {
+		n, _, err := syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		switch {
+		case err == nil:
+			closed = n == 0
+		case errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EWOULDBLOCK), errors.Is(err, syscall.EINTR):
+			closed = false
+		default:
+			closed = true
+		}
+		// never wait for the socket to become readable
+		return true
+	})
+	return err == nil && closed
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/gofiber/fiber/v2"
+)
+
+// errorStatus returns the status code a domain error is answered with
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, interfaces.ErrNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, interfaces.ErrConflict):
+		return fiber.StatusConflict
+	case errors.Is(err, interfaces.ErrUnavailable):
+		return fiber.StatusServiceUnavailable
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
+
+// errorViews are the pages rendered for the domain errors, other statuses keep the fiber default response
+var errorViews = map[int]string{
+	fiber.StatusNotFound:            "404",
+	fiber.StatusConflict:            "409",
+	fiber.StatusServiceUnavailable:  "503",
+	fiber.StatusInternalServerError: "500",
+}
+
+// errorMessages are the messages clients are answered with, error details may describe the storage
+// and are only logged
+var errorMessages = map[int]string{
+	fiber.StatusNotFound:            interfaces.ErrMsgNotFound,
+	fiber.StatusConflict:            interfaces.ErrMsgConflict,
+	fiber.StatusServiceUnavailable:  interfaces.ErrMsgUnavailable,
+	fiber.StatusInternalServerError: fiber.ErrInternalServerError.Message,
+}
+
+// ErrorHandler answers the errors returned by handlers, domain errors become 404, 409 and 503 responses and
+// anything else a 500, as JSON for clients that prefer it or send JSON and as a page otherwise
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiber.DefaultErrorHandler(c, err)
+	}
+	status := errorStatus(err)
+	if status == fiber.StatusInternalServerError {
+		slog.Error("Request failed", "path", c.Path(), "error", err)
+	} else {
+		slog.Warn("Request failed", "path", c.Path(), "status", status, "error", err)
+	}
+	message := errorMessages[status]
+	field := ""
+	var conflict *interfaces.ConflictError
+	if errors.As(err, &conflict) {
+		field = conflict.Field
+	}
+	if status == fiber.StatusServiceUnavailable {
+		c.Set(fiber.HeaderRetryAfter, "5")
+	}
+
+	if c.Is("json") || c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+		body := fiber.Map{"error": message}
+		if field != "" {
+			body["field"] = field
+		}
+		return c.Status(status).JSON(body)
+	}
+	if renderErr := c.Status(status).Render(errorViews[status], fiber.Map{
+		"Field": field,
+		"Stale": field == interfaces.FieldVersion,
+	}); renderErr != nil {
+		slog.Error("Failed to render error page", "status", status, "error", renderErr)
+		return c.Status(status).SendString(message)
+	}
+	return nil
+}
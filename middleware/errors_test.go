@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/template/html/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newErrorApp returns an app rendering the error pages of the views directory that fails every request with err
+func newErrorApp(t *testing.T, err error) *fiber.App {
+	dir := t.TempDir()
+	for _, view := range errorViews {
+		page, readErr := os.ReadFile(filepath.Join("..", "views", view+".html"))
+		require.NoError(t, readErr)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, view+".html"), page, 0o644))
+	}
+	app := fiber.New(fiber.Config{Views: html.New(dir, ".html"), ErrorHandler: ErrorHandler})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return err
+	})
+	return app
+}
+
+func TestErrorHandler(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		err        error
+		status     int
+		message    string
+		page       string
+		field      string
+		retryAfter string
+	}{
+		{
+			name:    "not found",
+			err:     fmt.Errorf("user 7: %w", interfaces.ErrNotFound),
+			status:  fiber.StatusNotFound,
+			message: interfaces.ErrMsgNotFound,
+			page:    "Not found",
+		},
+		{
+			name:    "taken field",
+			err:     fmt.Errorf("create user: %w", &interfaces.ConflictError{Field: "email"}),
+			status:  fiber.StatusConflict,
+			message: interfaces.ErrMsgConflict,
+			page:    "The email is already in use",
+			field:   "email",
+		},
+		{
+			name:    "stale version",
+			err:     &interfaces.ConflictError{Field: interfaces.FieldVersion},
+			status:  fiber.StatusConflict,
+			message: interfaces.ErrMsgConflict,
+			page:    "This record changed since you loaded it, reload and try again",
+			field:   interfaces.FieldVersion,
+		},
+		{
+			name:       "unavailable",
+			err:        fmt.Errorf("dial tcp 10.0.0.5:5432: %w", interfaces.ErrUnavailable),
+			status:     fiber.StatusServiceUnavailable,
+			message:    interfaces.ErrMsgUnavailable,
+			page:       "Service unavailable, try again shortly",
+			retryAfter: "5",
+		},
+		{
+			name:    "unexpected",
+			err:     errors.New("near \"SELEC\": syntax error"),
+			status:  fiber.StatusInternalServerError,
+			message: fiber.ErrInternalServerError.Message,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newErrorApp(t, tc.err)
+
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			req.Header.Set(fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.status, resp.StatusCode)
+			assert.Equal(t, tc.retryAfter, resp.Header.Get(fiber.HeaderRetryAfter))
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, tc.message, body["error"], "only the fixed message is sent")
+			assert.Equal(t, tc.field, body["field"])
+
+			if tc.page == "" {
+				return
+			}
+			req = httptest.NewRequest(fiber.MethodGet, "/", nil)
+			req.Header.Set(fiber.HeaderAccept, fiber.MIMETextHTML)
+			resp, err = app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.status, resp.StatusCode)
+			assert.Equal(t, tc.retryAfter, resp.Header.Get(fiber.HeaderRetryAfter))
+			page, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(page), tc.page)
+			assert.NotContains(t, string(page), tc.err.Error())
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// NewRateLimiter creates the middleware limiting how many requests a client can make, it follows the
+// limit and window in the configuration, counts start over when either changes
+// - config: provides the limit and window
+func NewRateLimiter(config interfaces.IConfig) *Reloadable {
+	return newReloadable(config, func(config interfaces.IConfig) fiber.Handler {
+		max := config.GetRateLimitMax()
+		return limiter.New(limiter.Config{
+			Next: func(c *fiber.Ctx) bool {
+				// static assets are cached by the browser and not worth counting
+				return max == 0 || strings.HasPrefix(c.Path(), "/public")
+			},
+			Max:        max,
+			Expiration: config.GetRateLimitWindow(),
+			LimitReached: func(c *fiber.Ctx) error {
+				return c.Status(fiber.StatusTooManyRequests).Render("429", fiber.Map{})
+			},
+		})
+	}, interfaces.ConfigKeyRateLimitMax, interfaces.ConfigKeyRateLimitWindow)
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"sync/atomic"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Reloadable is a fiber middleware that is rebuilt from the configuration whenever one of its keys changes
+type Reloadable struct {
+	handler atomic.Value
+	keys    []string
+	build   func(config interfaces.IConfig) fiber.Handler
+}
+
+func newReloadable(config interfaces.IConfig, build func(config interfaces.IConfig) fiber.Handler, keys ...string) *Reloadable {
+	reloadable := &Reloadable{keys: keys, build: build}
+	reloadable.handler.Store(build(config))
+	return reloadable
+}
+
+// Handle runs the current middleware, pass it to app.Use
+func (r *Reloadable) Handle(c *fiber.Ctx) error {
+	return r.handler.Load().(fiber.Handler)(c)
+}
+
+// ReloadKeys returns the keys the middleware is built from
+func (r *Reloadable) ReloadKeys() []string {
+	return r.keys
+}
+
+// Reload rebuilds the middleware, requests already being handled finish with the previous one
+func (r *Reloadable) Reload(config interfaces.IConfig) error {
+	r.handler.Store(r.build(config))
+	return nil
+}
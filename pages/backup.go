@@ -0,0 +1,89 @@
+package pages
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bryopsida/gofiber-pug-starter/auth"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/bryopsida/gofiber-pug-starter/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+// backupRow is a backup in the backup path along with its size for display
+type backupRow struct {
+	interfaces.BackupFile
+	SizeText string
+}
+
+// formatSize formats a number of bytes with a binary unit
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size) / unit
+	for _, suffix := range []string{"KiB", "MiB", "GiB"} {
+		if value < unit || suffix == "GiB" {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return ""
+}
+
+// RegisterPrivateBackupPages registers the admin page that downloads backups and lists the scheduled ones
+// - app: *fiber.App fiber app
+// - defaults: whether backups are compressed and encrypted unless the admin unticks it
+func RegisterPrivateBackupPages(app *fiber.App, backupService interfaces.IBackupService, defaults interfaces.BackupOptions) {
+	requireAdmin := auth.RequireRole(interfaces.RoleAdmin)
+
+	app.Get("/backups", requireAdmin, func(c *fiber.Ctx) error {
+		backups, err := backupService.List()
+		if errors.Is(err, interfaces.ErrBackupUnsupported) {
+			return c.Render("backups", fiber.Map{"Unsupported": err.Error()})
+		}
+		if err != nil {
+			slog.Error("Failed to list backups", "error", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		rows := make([]backupRow, len(backups))
+		for i, backup := range backups {
+			rows[i] = backupRow{BackupFile: backup, SizeText: formatSize(backup.Size)}
+		}
+		return c.Render("backups", fiber.Map{
+			"Items":    rows,
+			"Defaults": defaults,
+		})
+	})
+
+	app.Get("/backups/download", requireAdmin, func(c *fiber.Ctx) error {
+		options := interfaces.BackupOptions{
+			Compress: c.Query("compress") == "on",
+			Encrypt:  c.Query("encrypt") == "on",
+		}
+		// the snapshot is taken before the status and headers are sent, so failing to take it is still reported
+		snapshot, err := backupService.Snapshot(c.UserContext(), options)
+		if errors.Is(err, interfaces.ErrBackupUnsupported) {
+			return fiber.NewError(fiber.StatusNotImplemented, interfaces.ErrMsgBackupUnsupported)
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("Backup downloaded", "user", auth.CurrentUser(c).Username, "compress", options.Compress, "encrypt", options.Encrypt)
+		c.Type("bin")
+		setAttachment(c, backupService.FileName(options))
+		// c must not be used once the handler returns, which is before the body is written
+		middleware.SetBodyStreamWriter(c, func(_ context.Context, w *bufio.Writer) {
+			defer snapshot.Close()
+			if err := snapshot.Encode(w); err != nil {
+				slog.Error("Failed to write backup", "error", err)
+			}
+			w.Flush()
+		})
+		return nil
+	})
+}
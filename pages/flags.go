@@ -0,0 +1,191 @@
+package pages
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bryopsida/gofiber-pug-starter/auth"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/gofiber/fiber/v2"
+)
+
+// flagRow is a feature flag along with how often it was evaluated
+type flagRow struct {
+	interfaces.FeatureFlag
+	Evaluations interfaces.FlagEvaluations
+}
+
+// flagForm is a feature flag as shown in the edit form, with the targeting lists as comma separated text
+type flagForm struct {
+	Key         string
+	Description string
+	Enabled     bool
+	Percentage  int
+	UserIDs     string
+	Roles       string
+	Groups      string
+	// Version is the version the form was loaded at, 0 for a new flag
+	Version uint
+}
+
+func splitFormList(text string) []string {
+	items := []string{}
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func toFlagForm(flag *interfaces.FeatureFlag) flagForm {
+	ids := make([]string, len(flag.UserIDs))
+	for i, id := range flag.UserIDs {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return flagForm{
+		Key:         flag.Key,
+		Description: flag.Description,
+		Enabled:     flag.Enabled,
+		Percentage:  flag.Percentage,
+		UserIDs:     strings.Join(ids, ", "),
+		Roles:       strings.Join(flag.Roles, ", "),
+		Groups:      strings.Join(flag.Groups, ", "),
+		Version:     flag.Version,
+	}
+}
+
+// readFlagForm reads the submitted flag form
+// Returns the form to render again and the flag, or an error if a field cannot be parsed
+func readFlagForm(c *fiber.Ctx) (flagForm, *interfaces.FeatureFlag, error) {
+	form := flagForm{
+		Key:         strings.TrimSpace(c.FormValue("key")),
+		Description: c.FormValue("description"),
+		Enabled:     c.FormValue("enabled") == "true",
+		UserIDs:     c.FormValue("userIDs"),
+		Roles:       c.FormValue("roles"),
+		Groups:      c.FormValue("groups"),
+	}
+	percentage, err := strconv.Atoi(c.FormValue("percentage", "100"))
+	if err != nil {
+		return form, nil, errors.New("percentage must be a whole number")
+	}
+	form.Percentage = percentage
+	version, err := strconv.ParseUint(c.FormValue("version", "0"), 10, 0)
+	if err != nil {
+		return form, nil, errors.New("the form is missing the version it was loaded at")
+	}
+	form.Version = uint(version)
+	flag := &interfaces.FeatureFlag{
+		Key:         form.Key,
+		Description: form.Description,
+		Enabled:     form.Enabled,
+		Percentage:  form.Percentage,
+		UserIDs:     []uint{},
+		Roles:       splitFormList(form.Roles),
+		Groups:      splitFormList(form.Groups),
+		Version:     form.Version,
+	}
+	for _, text := range splitFormList(form.UserIDs) {
+		id, err := strconv.ParseUint(text, 10, 0)
+		if err != nil {
+			return form, nil, errors.New("user IDs must be whole numbers")
+		}
+		flag.UserIDs = append(flag.UserIDs, uint(id))
+	}
+	return form, flag, nil
+}
+
+// RegisterPrivateFlagPages registers the admin pages to manage feature flags
+// - app: *fiber.App fiber app
+func RegisterPrivateFlagPages(app *fiber.App, flagsService interfaces.IFeatureFlagService) {
+	requireAdmin := auth.RequireRole(interfaces.RoleAdmin)
+
+	app.Get("/flags", requireAdmin, func(c *fiber.Ctx) error {
+		rows := []flagRow{}
+		for _, flag := range flagsService.Flags() {
+			rows = append(rows, flagRow{FeatureFlag: flag, Evaluations: flagsService.Evaluations(flag.Key)})
+		}
+		return c.Render("flags", fiber.Map{
+			"Items": rows,
+			"Saved": c.Query("saved"),
+		})
+	})
+
+	app.Get("/flags/edit", requireAdmin, func(c *fiber.Ctx) error {
+		key := c.Query("key")
+		if key == "" {
+			return c.Render("flag-edit", fiber.Map{
+				"Form": flagForm{Percentage: 100},
+				"New":  true,
+			})
+		}
+		flag, err := flagsService.Flag(key)
+		if errors.Is(err, interfaces.ErrNotFound) {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		if err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.Render("flag-edit", fiber.Map{
+			"Form": toFlagForm(flag),
+		})
+	})
+
+	app.Post("/flags", requireAdmin, func(c *fiber.Ctx) error {
+		isNew := c.FormValue("new") == "true"
+		form, flag, err := readFlagForm(c)
+		if err == nil {
+			err = flagsService.SaveFlag(c.UserContext(), flag)
+			var conflict *interfaces.ConflictError
+			if errors.As(err, &conflict) && conflict.Field == interfaces.FieldVersion {
+				// show what is stored now next to what was submitted, saving again overwrites the other change
+				if stored, storedErr := flagsService.Flag(flag.Key); storedErr == nil {
+					return c.Status(fiber.StatusConflict).Render("flag-edit", fiber.Map{
+						"Form":      toFlagForm(stored),
+						"Conflict":  true,
+						"Submitted": form,
+					})
+				}
+			}
+			if err != nil && !errors.Is(err, interfaces.ErrInvalidFeatureFlag) {
+				return err
+			}
+		}
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).Render("flag-edit", fiber.Map{
+				"Form":  form,
+				"New":   isNew,
+				"Error": err.Error(),
+			})
+		}
+		slog.Info("Feature flag saved", "key", flag.Key, "user", auth.CurrentUser(c).Username)
+		return c.Redirect("/flags?saved=" + url.QueryEscape(flag.Key))
+	})
+
+	app.Post("/flags/toggle", requireAdmin, func(c *fiber.Ctx) error {
+		key := c.FormValue("key")
+		enabled := c.FormValue("enabled") == "true"
+		err := flagsService.SetEnabled(c.UserContext(), key, enabled)
+		if errors.Is(err, interfaces.ErrNotFound) {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("Feature flag toggled", "key", key, "enabled", enabled, "user", auth.CurrentUser(c).Username)
+		return c.Redirect("/flags")
+	})
+
+	app.Post("/flags/delete", requireAdmin, func(c *fiber.Ctx) error {
+		key := c.FormValue("key")
+		if err := flagsService.DeleteFlag(c.UserContext(), key); err != nil {
+			return err
+		}
+		slog.Info("Feature flag deleted", "key", key, "user", auth.CurrentUser(c).Username)
+		return c.Redirect("/flags")
+	})
+}
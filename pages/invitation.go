@@ -0,0 +1,73 @@
+package pages
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RegisterInvitationPages registers the public pages used to accept an invitation
+// - app: *fiber.App fiber app
+func RegisterInvitationPages(app *fiber.App, tokenService interfaces.ITokenService, userService interfaces.IUsersService, passwordService interfaces.IPasswordService, transactions interfaces.ITransactionManager) {
+	app.Get("/invitation", func(c *fiber.Ctx) error {
+		token := c.Query("token")
+		userToken, err := tokenService.Verify(c.UserContext(), interfaces.TokenPurposeInvitation, token)
+		if err != nil {
+			return c.Render("invitation", fiber.Map{"Invalid": true})
+		}
+		user, err := userService.GetUserByID(c.UserContext(), userToken.UserID)
+		if err != nil {
+			return c.Render("invitation", fiber.Map{"Invalid": true})
+		}
+		return c.Render("invitation", fiber.Map{
+			"Token":    token,
+			"Username": user.Username,
+		})
+	})
+
+	app.Post("/invitation", func(c *fiber.Ctx) error {
+		token := c.FormValue("token")
+		password := c.FormValue("password")
+		confirmPassword := c.FormValue("confirmPassword")
+		if password == "" || password != confirmPassword {
+			return c.Status(fiber.StatusBadRequest).Render("invitation", fiber.Map{
+				"Token":                token,
+				"Username":             c.FormValue("username"),
+				"PasswordError":        true,
+				"PasswordErrorMessage": "Passwords must be provided and match",
+			})
+		}
+		// hashed up front so the transaction is not held open while hashing
+		passwordHash, err := passwordService.Hash(password)
+		if err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		// the invitation is only used up once the password is set, so a failed save can be retried
+		var user *interfaces.User
+		invalid := false
+		err = transactions.WithinTransaction(c.UserContext(), func(ctx context.Context) error {
+			userToken, err := tokenService.Consume(ctx, interfaces.TokenPurposeInvitation, token)
+			if err != nil {
+				invalid = true
+				return err
+			}
+			user, err = userService.GetUserByID(ctx, userToken.UserID)
+			if err != nil {
+				invalid = true
+				return err
+			}
+			user.PasswordHash = passwordHash
+			return userService.UpdateUser(ctx, user)
+		})
+		if invalid {
+			return c.Status(fiber.StatusBadRequest).Render("invitation", fiber.Map{"Invalid": true})
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("Invitation accepted", "user", user.Username)
+		return c.Redirect("/login")
+	})
+}
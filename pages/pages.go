@@ -1,10 +1,16 @@
 package pages
 
 import (
-	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"mime"
+
 	"github.com/gofiber/fiber/v2"
 )
 
+// setAttachment marks the response as a download, the file name is quoted and escaped as needed
+func setAttachment(c *fiber.Ctx, filename string) {
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+}
+
 // RegisterGlobalPages registers global pages
 // - app: *fiber.App fiber app
 func RegisterGlobalPages(app *fiber.App) {
@@ -32,12 +38,10 @@ func RegisterGlobalPages(app *fiber.App) {
 	})
 }
 
-func RegisterPrivateGlobalPages(app *fiber.App, jwtService interfaces.IJWTService) {
+func RegisterPrivateGlobalPages(app *fiber.App) {
 	app.Get("/", func(c *fiber.Ctx) error {
-		userObj, _ := jwtService.UserFromClaims(c)
 		return c.Render("index", fiber.Map{
 			"cardRows": []fiber.Map{},
-			"User":     userObj,
 		})
 	})
 
@@ -0,0 +1,80 @@
+package pages
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/auth"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/gofiber/fiber/v2"
+)
+
+const preferencesLocal = "Preferences"
+
+// AddPreferences exposes the logged in user's preferences to handlers and views as the Preferences local,
+// it must be added after auth.AddCurrentUser
+// - app: *fiber.App fiber app
+func AddPreferences(app *fiber.App, preferencesService interfaces.IPreferencesService) {
+	app.Use(func(c *fiber.Ctx) error {
+		if user := auth.CurrentUser(c); user != nil {
+			prefs, err := preferencesService.GetPreferences(c.UserContext(), user.ID)
+			if err != nil {
+				slog.Warn("Failed to load preferences", "user", user.Username, "error", err)
+			} else {
+				c.Locals(preferencesLocal, prefs)
+			}
+		}
+		return c.Next()
+	})
+}
+
+func renderPreferences(c *fiber.Ctx, preferencesService interfaces.IPreferencesService, prefs *interfaces.Preferences, bind fiber.Map) error {
+	if bind["Errors"] == nil {
+		bind["Errors"] = map[string]string{}
+	}
+	bind["Item"] = prefs
+	bind["Now"] = time.Now()
+	bind["DateFormats"] = preferencesService.DateFormats()
+	bind["PageSizes"] = preferencesService.PageSizes()
+	bind["Themes"] = []string{interfaces.ThemeAuto, interfaces.ThemeLight, interfaces.ThemeDark}
+	return c.Render("preferences", bind)
+}
+
+// RegisterPrivatePreferencesPages registers the page a logged in user uses to manage their preferences
+// - app: *fiber.App fiber app
+func RegisterPrivatePreferencesPages(app *fiber.App, preferencesService interfaces.IPreferencesService) {
+	app.Get("/preferences", func(c *fiber.Ctx) error {
+		prefs, err := preferencesService.GetPreferences(c.UserContext(), auth.CurrentUser(c).ID)
+		if err != nil {
+			return err
+		}
+		return renderPreferences(c, preferencesService, prefs, fiber.Map{
+			"Saved": c.Query("saved") == "true",
+		})
+	})
+
+	app.Post("/preferences", func(c *fiber.Ctx) error {
+		pageSize, _ := strconv.Atoi(c.FormValue("pageSize"))
+		prefs := &interfaces.Preferences{
+			UserID:     auth.CurrentUser(c).ID,
+			Theme:      c.FormValue("theme"),
+			Timezone:   c.FormValue("timezone"),
+			Locale:     c.FormValue("locale"),
+			DateFormat: c.FormValue("dateFormat"),
+			PageSize:   pageSize,
+		}
+		err := preferencesService.SavePreferences(c.UserContext(), prefs)
+		if errors.Is(err, interfaces.ErrInvalidPreferences) {
+			c.Status(fiber.StatusBadRequest)
+			return renderPreferences(c, preferencesService, prefs, fiber.Map{
+				"Errors": preferencesService.ValidatePreferences(prefs),
+			})
+		}
+		if err != nil {
+			return err
+		}
+		return c.Redirect("/preferences?saved=true")
+	})
+}
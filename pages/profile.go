@@ -0,0 +1,201 @@
+package pages
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/auth"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/bryopsida/gofiber-pug-starter/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// avatarNamePattern matches the file names generated by the avatar service
+var avatarNamePattern = regexp.MustCompile(`^[0-9]+-[0-9a-f]+\.png$`)
+
+func sendEmailVerification(c *fiber.Ctx, mailer interfaces.IMailer, tokenService interfaces.ITokenService, user *interfaces.User, email string) error {
+	token, err := tokenService.Issue(c.UserContext(), user.ID, interfaces.TokenPurposeEmailVerification, email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	link := c.BaseURL() + "/verify-email?token=" + token
+	body := fmt.Sprintf("Hi %s,\n\nConfirm %s as your new email address by opening %s\n\nThe link expires in 24 hours, you can ignore this email if you did not request the change.\n", user.Username, email, link)
+	return mailer.Send(email, "Confirm your email address", body)
+}
+
+// RegisterPrivateProfilePages registers the pages a logged in user uses to manage their own profile
+// - app: *fiber.App fiber app
+func RegisterPrivateProfilePages(app *fiber.App, userService interfaces.IUsersService, avatarService interfaces.IAvatarService, tokenService interfaces.ITokenService, mailer interfaces.IMailer, privacyService interfaces.IPrivacyService, passwordService interfaces.IPasswordService) {
+	app.Get("/profile", func(c *fiber.Ctx) error {
+		return c.Render("profile", fiber.Map{
+			"Item":             auth.CurrentUser(c),
+			"Saved":            c.Query("saved") == "true",
+			"EmailPending":     c.Query("emailPending") == "true",
+			"EmailUnavailable": c.Query("emailUnavailable") == "true",
+			"AvatarError":      c.Query("avatarError") == "true",
+			"PasswordError":    c.Query("passwordError") == "true",
+		})
+	})
+
+	app.Post("/profile", func(c *fiber.Ctx) error {
+		user := auth.CurrentUser(c)
+		email := strings.TrimSpace(c.FormValue("email"))
+		user.FirstName = strings.TrimSpace(c.FormValue("firstName"))
+		user.LastName = strings.TrimSpace(c.FormValue("lastName"))
+
+		emailChanged := email != user.Email
+		if emailChanged {
+			errorMessage := ""
+			if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+				errorMessage = "Please provide a valid email address"
+			} else if _, err := userService.GetUserByEmail(c.UserContext(), email); err == nil {
+				errorMessage = "This email address is already in use"
+			}
+			if errorMessage != "" {
+				return c.Status(fiber.StatusBadRequest).Render("profile", fiber.Map{
+					"Item":              user,
+					"EmailValue":        email,
+					"EmailError":        true,
+					"EmailErrorMessage": errorMessage,
+				})
+			}
+		}
+
+		if err := userService.UpdateUser(c.UserContext(), user); err != nil {
+			return err
+		}
+		if emailChanged {
+			// the email is only changed once the new address is verified
+			err := sendEmailVerification(c, mailer, tokenService, user, email)
+			if errors.Is(err, interfaces.ErrMailUnavailable) {
+				return c.Redirect("/profile?emailUnavailable=true")
+			}
+			if err != nil {
+				slog.Error("Failed to send email verification", "user", user.Username, "error", err)
+				return c.SendStatus(fiber.StatusInternalServerError)
+			}
+			return c.Redirect("/profile?emailPending=true")
+		}
+		return c.Redirect("/profile?saved=true")
+	})
+
+	app.Post("/profile/avatar", func(c *fiber.Ctx) error {
+		user := auth.CurrentUser(c)
+		file, err := c.FormFile("avatar")
+		if err != nil {
+			return c.Redirect("/profile?avatarError=true")
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		defer reader.Close()
+		err = avatarService.SetAvatar(c.UserContext(), user, reader)
+		if errors.Is(err, interfaces.ErrInvalidImage) {
+			return c.Redirect("/profile?avatarError=true")
+		}
+		if err != nil {
+			slog.Error("Failed to set avatar", "user", user.Username, "error", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.Redirect("/profile?saved=true")
+	})
+
+	app.Post("/profile/avatar/delete", func(c *fiber.Ctx) error {
+		user := auth.CurrentUser(c)
+		if err := avatarService.RemoveAvatar(c.UserContext(), user); err != nil {
+			slog.Error("Failed to remove avatar", "user", user.Username, "error", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.Redirect("/profile?saved=true")
+	})
+
+	app.Get("/profile/export", func(c *fiber.Ctx) error {
+		user := auth.CurrentUser(c)
+		slog.Info("Exporting personal data", "user", user.Username)
+		c.Type("zip")
+		setAttachment(c, user.Username+"-data.zip")
+		// c must not be used once the handler returns, which is before the body is written
+		middleware.SetBodyStreamWriter(c, func(ctx context.Context, w *bufio.Writer) {
+			if err := privacyService.ExportPersonalData(ctx, user.ID, w); err != nil {
+				slog.Error("Failed to export personal data", "user", user.Username, "error", err)
+			}
+			w.Flush()
+		})
+		return nil
+	})
+
+	app.Post("/profile/delete", func(c *fiber.Ctx) error {
+		user := auth.CurrentUser(c)
+		validPass, err := passwordService.Verify(c.FormValue("password"), user.PasswordHash)
+		if err != nil || !validPass {
+			return c.Redirect("/profile?passwordError=true")
+		}
+		if err := privacyService.RequestDeletion(c.UserContext(), user); err != nil {
+			return err
+		}
+		slog.Info("Account deletion requested", "user", user.Username, "deleteAfter", user.DeleteAfter)
+		return c.Redirect("/profile")
+	})
+
+	app.Post("/profile/delete/cancel", func(c *fiber.Ctx) error {
+		user := auth.CurrentUser(c)
+		if err := privacyService.CancelDeletion(c.UserContext(), user); err != nil {
+			return err
+		}
+		slog.Info("Account deletion cancelled", "user", user.Username)
+		return c.Redirect("/profile?saved=true")
+	})
+
+	app.Get("/avatars/:name", func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if !avatarNamePattern.MatchString(name) {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		reader, info, err := avatarService.OpenAvatar("avatars/" + name)
+		if errors.Is(err, interfaces.ErrNotFound) {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		if err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		// avatar keys change whenever the content does so they never need revalidating
+		c.Set(fiber.HeaderCacheControl, "private, max-age=31536000, immutable")
+		c.Set(fiber.HeaderLastModified, info.ModTime.UTC().Format(time.RFC1123))
+		c.Type("png")
+		return c.SendStream(reader, int(info.Size))
+	})
+}
+
+// RegisterEmailVerificationPages registers the public page that confirms a change of email
+// - app: *fiber.App fiber app
+func RegisterEmailVerificationPages(app *fiber.App, tokenService interfaces.ITokenService, userService interfaces.IUsersService) {
+	app.Get("/verify-email", func(c *fiber.Ctx) error {
+		userToken, err := tokenService.Consume(c.UserContext(), interfaces.TokenPurposeEmailVerification, c.Query("token"))
+		if err != nil {
+			return c.Render("verify-email", fiber.Map{"Invalid": true})
+		}
+		user, err := userService.GetUserByID(c.UserContext(), userToken.UserID)
+		if err != nil {
+			return c.Render("verify-email", fiber.Map{"Invalid": true})
+		}
+		if existing, err := userService.GetUserByEmail(c.UserContext(), userToken.Data); err == nil && existing.ID != user.ID {
+			return c.Render("verify-email", fiber.Map{"Invalid": true})
+		}
+		user.Email = userToken.Data
+		if err := userService.UpdateUser(c.UserContext(), user); err != nil {
+			return err
+		}
+		slog.Info("Email verified", "user", user.Username)
+		return c.Render("verify-email", fiber.Map{"Email": user.Email})
+	})
+}
@@ -0,0 +1,262 @@
+package pages
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bryopsida/gofiber-pug-starter/auth"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/bryopsida/gofiber-pug-starter/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+// settingRow is a registered setting along with the text shown in its input
+type settingRow struct {
+	interfaces.SettingDefinition
+	Text    string
+	Version uint
+	Error   string
+}
+
+// settingActor identifies the logged in user and request for the setting history
+func settingActor(c *fiber.Ctx) interfaces.SettingActor {
+	requestID, _ := c.Locals("requestid").(string)
+	user := auth.CurrentUser(c)
+	return interfaces.SettingActor{Username: user.Username, UserID: user.ID, RequestID: requestID}
+}
+
+func renderSettings(c *fiber.Ctx, settingsService interfaces.ISettingsService, bind fiber.Map, submitted map[string]string, errs map[string]string) error {
+	rows := []settingRow{}
+	for _, definition := range settingsService.Definitions() {
+		text, version, err := settingsService.GetTextVersion(c.UserContext(), definition.Key)
+		if err != nil {
+			return err
+		}
+		if submittedText, ok := submitted[definition.Key]; ok {
+			text = submittedText
+		}
+		rows = append(rows, settingRow{SettingDefinition: definition, Text: text, Version: version, Error: errs[definition.Key]})
+	}
+	bind["Items"] = rows
+	return c.Render("settings", bind)
+}
+
+// isSecretSetting reports whether a key is registered as a secret setting
+func isSecretSetting(settingsService interfaces.ISettingsService, key string) bool {
+	for _, definition := range settingsService.Definitions() {
+		if definition.Key == key {
+			return definition.Secret
+		}
+	}
+	return false
+}
+
+func settingsImportIsValid(rows []interfaces.SettingImportRow) bool {
+	for _, row := range rows {
+		if row.Error != "" {
+			return false
+		}
+	}
+	return len(rows) > 0
+}
+
+// settingsImportVersions encodes the version of every previewed setting for the apply form,
+// applying fails if a setting changed since it was previewed
+func settingsImportVersions(rows []interfaces.SettingImportRow) (string, error) {
+	versions := make(map[string]uint, len(rows))
+	for _, row := range rows {
+		versions[row.Key] = row.Version
+	}
+	encoded, err := json.Marshal(versions)
+	return string(encoded), err
+}
+
+// RegisterPrivateSettingsPages registers the admin page generated from the settings registry
+// - app: *fiber.App fiber app
+func RegisterPrivateSettingsPages(app *fiber.App, settingsService interfaces.ISettingsService, bulkService interfaces.ISettingsBulkService) {
+	requireAdmin := auth.RequireRole(interfaces.RoleAdmin)
+
+	app.Get("/settings", requireAdmin, func(c *fiber.Ctx) error {
+		return renderSettings(c, settingsService, fiber.Map{
+			"Saved":    c.Query("saved"),
+			"Imported": c.Query("imported"),
+		}, nil, nil)
+	})
+
+	app.Post("/settings", requireAdmin, func(c *fiber.Ctx) error {
+		key := c.FormValue("key")
+		value := c.FormValue("value")
+		// a blank secret keeps the current value since secrets are never shown
+		if isSecretSetting(settingsService, key) && strings.TrimSpace(value) == "" {
+			return c.Redirect("/settings")
+		}
+		// the version the form was loaded at, the setting is not saved if it changed since
+		version, err := strconv.ParseUint(c.FormValue("version"), 10, 0)
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		err = settingsService.SetTextIfVersion(c.UserContext(), key, value, uint(version), settingActor(c))
+		if errors.Is(err, interfaces.ErrUnknownSetting) {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		var conflict *interfaces.ConflictError
+		if errors.As(err, &conflict) && conflict.Field == interfaces.FieldVersion {
+			// show what is stored now along with what was submitted, saving again overwrites the other change
+			bind := fiber.Map{"Conflict": key}
+			if !isSecretSetting(settingsService, key) {
+				bind["Submitted"] = value
+			}
+			c.Status(fiber.StatusConflict)
+			return renderSettings(c, settingsService, bind, nil, nil)
+		}
+		if errors.Is(err, interfaces.ErrInvalidSetting) || errors.Is(err, interfaces.ErrSettingReadOnly) {
+			c.Status(fiber.StatusBadRequest)
+			return renderSettings(c, settingsService, fiber.Map{}, map[string]string{key: value}, map[string]string{key: err.Error()})
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("Setting changed", "key", key, "user", auth.CurrentUser(c).Username)
+		return c.Redirect("/settings?saved=" + key)
+	})
+
+	app.Get("/settings/history", requireAdmin, func(c *fiber.Ctx) error {
+		key := c.Query("key")
+		changes, err := settingsService.History(c.UserContext(), key)
+		if errors.Is(err, interfaces.ErrUnknownSetting) {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		// rolling back does not overwrite a change made after the history was loaded
+		_, version, err := settingsService.GetTextVersion(c.UserContext(), key)
+		if err != nil {
+			return err
+		}
+		return c.Render("settings-history", fiber.Map{
+			"Key":      key,
+			"Version":  version,
+			"Items":    changes,
+			"Restored": c.Query("restored") == "true",
+			"Error":    c.Query("error"),
+		})
+	})
+
+	app.Post("/settings/rollback", requireAdmin, func(c *fiber.Ctx) error {
+		id, err := strconv.ParseUint(c.FormValue("id"), 10, 0)
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		version, err := strconv.ParseUint(c.FormValue("version"), 10, 0)
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		change, err := settingsService.Rollback(c.UserContext(), uint(id), uint(version), settingActor(c))
+		if errors.Is(err, interfaces.ErrNotFound) {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		var conflict *interfaces.ConflictError
+		if errors.As(err, &conflict) && conflict.Field == interfaces.FieldVersion {
+			message := "The setting changed since the history was loaded, review it before rolling back."
+			return c.Redirect("/settings/history?key=" + url.QueryEscape(change.Key) + "&error=" + url.QueryEscape(message))
+		}
+		if errors.Is(err, interfaces.ErrInvalidSetting) || errors.Is(err, interfaces.ErrSettingReadOnly) {
+			return c.Redirect("/settings/history?key=" + url.QueryEscape(change.Key) + "&error=" + url.QueryEscape(err.Error()))
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("Setting rolled back", "key", change.Key, "change", id, "user", auth.CurrentUser(c).Username)
+		return c.Redirect("/settings/history?key=" + url.QueryEscape(change.Key) + "&restored=true")
+	})
+
+	app.Get("/settings/export", requireAdmin, func(c *fiber.Ctx) error {
+		format := c.Query("format", interfaces.ImportFormatYAML)
+		if format != interfaces.ImportFormatYAML && format != interfaces.ImportFormatJSON {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		c.Type(format)
+		setAttachment(c, "settings."+format)
+		// c must not be used once the handler returns, which is before the body is written
+		middleware.SetBodyStreamWriter(c, func(ctx context.Context, w *bufio.Writer) {
+			if err := bulkService.ExportSettings(ctx, format, w); err != nil {
+				slog.Error("Failed to export settings", "error", err)
+			}
+			w.Flush()
+		})
+		return nil
+	})
+
+	app.Get("/settings/import", requireAdmin, func(c *fiber.Ctx) error {
+		return c.Render("settings-import", fiber.Map{})
+	})
+	app.Post("/settings/import", requireAdmin, func(c *fiber.Ctx) error {
+		format, data, err := readImportForm(c, interfaces.ImportFormatYAML)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).Render("settings-import", fiber.Map{
+				"Error": err.Error(),
+			})
+		}
+		bind := fiber.Map{
+			"Format":  format,
+			"Payload": base64.StdEncoding.EncodeToString(data),
+		}
+
+		preview := func() error {
+			rows, err := bulkService.PreviewImport(c.UserContext(), format, data)
+			if err != nil {
+				bind["Error"] = err.Error()
+				return c.Status(fiber.StatusBadRequest).Render("settings-import", bind)
+			}
+			if bind["Versions"], err = settingsImportVersions(rows); err != nil {
+				return err
+			}
+			bind["Rows"] = rows
+			bind["Valid"] = settingsImportIsValid(rows)
+			return c.Render("settings-import", bind)
+		}
+		if c.FormValue("action") != "apply" {
+			return preview()
+		}
+
+		var versions map[string]uint
+		if err := json.Unmarshal([]byte(c.FormValue("versions")), &versions); err != nil || versions == nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		rows, err := bulkService.ApplyImport(c.UserContext(), format, data, versions, settingActor(c))
+		var conflict *interfaces.ConflictError
+		if errors.As(err, &conflict) && conflict.Field == interfaces.FieldVersion {
+			// preview again against what is stored now, applying then holds the import to the new preview
+			bind["Error"] = "Settings changed since the preview, review the changes again before applying them."
+			c.Status(fiber.StatusConflict)
+			return preview()
+		}
+		if errors.Is(err, interfaces.ErrImportInvalid) {
+			bind["Rows"] = rows
+			bind["Valid"] = false
+			return c.Status(fiber.StatusBadRequest).Render("settings-import", bind)
+		}
+		if err != nil {
+			slog.Error("Failed to import settings", "error", err)
+			bind["Error"] = err.Error()
+			return c.Status(fiber.StatusBadRequest).Render("settings-import", bind)
+		}
+		changed := 0
+		for _, row := range rows {
+			if row.Changed {
+				changed++
+			}
+		}
+		slog.Info("Imported settings", "changed", changed, "user", auth.CurrentUser(c).Username)
+		return c.Redirect(fmt.Sprintf("/settings?imported=%d", changed))
+	})
+}
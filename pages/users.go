@@ -1,7 +1,20 @@
 package pages
 
 import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"net/mail"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bryopsida/gofiber-pug-starter/auth"
 	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/bryopsida/gofiber-pug-starter/middleware"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -22,14 +35,50 @@ func validateAddUserForm(c *fiber.Ctx) (bool, error) {
 	return true, nil
 }
 
-func RegisterPrivateUserPages(app *fiber.App, userService interfaces.IUsersService, passwordService interfaces.IPasswordService) {
-	app.Get("/users", func(c *fiber.Ctx) error {
+// readImportForm reads the import either from an uploaded file or from the payload of a previous preview
+// Uploaded files are treated as defaultFormat unless they have a .json extension
+// Returns the format, raw data and any error reading them
+func readImportForm(c *fiber.Ctx, defaultFormat string) (string, []byte, error) {
+	if file, err := c.FormFile("file"); err == nil {
+		format := defaultFormat
+		if strings.EqualFold(filepath.Ext(file.Filename), ".json") {
+			format = interfaces.ImportFormatJSON
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return "", nil, err
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		return format, data, err
+	}
+	payload := c.FormValue("payload")
+	if payload == "" {
+		return "", nil, errors.New("no file was uploaded")
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	return c.FormValue("format"), data, err
+}
+
+func importIsValid(rows []interfaces.UserImportRow) bool {
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			return false
+		}
+	}
+	return len(rows) > 0
+}
+
+func RegisterPrivateUserPages(app *fiber.App, userService interfaces.IUsersService, passwordService interfaces.IPasswordService, bulkService interfaces.IUserBulkService) {
+	requireAdmin := auth.RequireRole(interfaces.RoleAdmin)
+
+	app.Get("/users", requireAdmin, func(c *fiber.Ctx) error {
 		return c.Render("users", fiber.Map{})
 	})
-	app.Get("/add-user", func(c *fiber.Ctx) error {
+	app.Get("/add-user", requireAdmin, func(c *fiber.Ctx) error {
 		return c.Render("add-user", fiber.Map{})
 	})
-	app.Post("/add-user", func(c *fiber.Ctx) error {
+	app.Post("/add-user", requireAdmin, func(c *fiber.Ctx) error {
 		valid, err := validateAddUserForm(c)
 		if !valid {
 			return err
@@ -44,16 +93,140 @@ func RegisterPrivateUserPages(app *fiber.App, userService interfaces.IUsersServi
 		if err != nil {
 			return c.SendStatus(fiber.StatusInternalServerError)
 		}
-		err = userService.CreateUser(&interfaces.User{
+		err = userService.CreateUser(c.UserContext(), &interfaces.User{
 			Username:     username,
 			Email:        email,
 			PasswordHash: passwordHash,
 			Role:         role,
 		})
 		if err != nil {
-			return c.SendStatus(fiber.StatusInternalServerError)
+			// a taken username or email is answered with a conflict
+			return err
+		}
+
+		return c.Redirect("/users")
+	})
+
+	app.Get("/edit-user", requireAdmin, func(c *fiber.Ctx) error {
+		user, err := userService.GetUserByUsername(c.UserContext(), c.Query("username"))
+		if err != nil {
+			return err
+		}
+		return c.Render("edit-user", fiber.Map{"Item": user})
+	})
+	app.Post("/edit-user", requireAdmin, func(c *fiber.Ctx) error {
+		current, err := userService.GetUserByUsername(c.UserContext(), c.Query("username"))
+		if err != nil {
+			return err
+		}
+		// the version the form was loaded at, the update is refused if the user changed since
+		version, err := strconv.ParseUint(c.FormValue("version"), 10, 0)
+		if err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		user := *current
+		user.FirstName = strings.TrimSpace(c.FormValue("firstName"))
+		user.LastName = strings.TrimSpace(c.FormValue("lastName"))
+		user.Email = strings.TrimSpace(c.FormValue("email"))
+		user.Version = uint(version)
+
+		if user.Email != current.Email {
+			errorMessage := ""
+			if addr, err := mail.ParseAddress(user.Email); err != nil || addr.Address != user.Email {
+				errorMessage = "Please provide a valid email address"
+			} else if _, err := userService.GetUserByEmail(c.UserContext(), user.Email); err == nil {
+				errorMessage = "This email address is already in use"
+			}
+			if errorMessage != "" {
+				return c.Status(fiber.StatusBadRequest).Render("edit-user", fiber.Map{
+					"Item":              &user,
+					"EmailError":        true,
+					"EmailErrorMessage": errorMessage,
+				})
+			}
 		}
 
+		err = userService.UpdateUser(c.UserContext(), &user)
+		var conflict *interfaces.ConflictError
+		if errors.As(err, &conflict) && conflict.Field == interfaces.FieldVersion {
+			// show what is stored now next to what was submitted, saving again overwrites the other change
+			return c.Status(fiber.StatusConflict).Render("edit-user", fiber.Map{
+				"Item":      current,
+				"Conflict":  true,
+				"Submitted": user,
+			})
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("User updated", "username", user.Username, "user", auth.CurrentUser(c).Username)
 		return c.Redirect("/users")
 	})
+
+	app.Get("/import-users", requireAdmin, func(c *fiber.Ctx) error {
+		return c.Render("import-users", fiber.Map{
+			"Mode": interfaces.ImportModeInvitation,
+		})
+	})
+	app.Post("/import-users", requireAdmin, func(c *fiber.Ctx) error {
+		mode := c.FormValue("mode", interfaces.ImportModeInvitation)
+		format, data, err := readImportForm(c, interfaces.ImportFormatCSV)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).Render("import-users", fiber.Map{
+				"Mode":  mode,
+				"Error": err.Error(),
+			})
+		}
+		bind := fiber.Map{
+			"Mode":    mode,
+			"Format":  format,
+			"Payload": base64.StdEncoding.EncodeToString(data),
+		}
+
+		if c.FormValue("action") != "apply" {
+			rows, err := bulkService.PreviewImport(c.UserContext(), format, data)
+			if err != nil {
+				bind["Error"] = err.Error()
+				return c.Status(fiber.StatusBadRequest).Render("import-users", bind)
+			}
+			bind["Rows"] = rows
+			bind["Valid"] = importIsValid(rows)
+			return c.Render("import-users", bind)
+		}
+
+		rows, err := bulkService.ApplyImport(c.UserContext(), format, data, mode)
+		if errors.Is(err, interfaces.ErrImportInvalid) {
+			bind["Rows"] = rows
+			bind["Valid"] = false
+			return c.Status(fiber.StatusBadRequest).Render("import-users", bind)
+		}
+		if err != nil {
+			slog.Error("Failed to import users", "error", err)
+			bind["Error"] = err.Error()
+			return c.Status(fiber.StatusBadRequest).Render("import-users", bind)
+		}
+		slog.Info("Imported users", "count", len(rows), "mode", mode)
+		return c.Render("import-users", fiber.Map{
+			"Mode":          mode,
+			"Results":       rows,
+			"InvitationURL": c.BaseURL() + "/invitation?token=",
+		})
+	})
+
+	app.Get("/export-users", requireAdmin, func(c *fiber.Ctx) error {
+		format := c.Query("format", interfaces.ImportFormatCSV)
+		if format != interfaces.ImportFormatCSV && format != interfaces.ImportFormatJSON {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		c.Type(format)
+		setAttachment(c, "users."+format)
+		// c must not be used once the handler returns, which is before the body is written
+		middleware.SetBodyStreamWriter(c, func(ctx context.Context, w *bufio.Writer) {
+			if err := bulkService.ExportUsers(ctx, format, w); err != nil {
+				slog.Error("Failed to export users", "error", err)
+			}
+			w.Flush()
+		})
+		return nil
+	})
 }
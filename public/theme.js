@@ -0,0 +1,13 @@
+// resolves the auto theme to the color scheme preferred by the browser
+(function () {
+    var root = document.documentElement;
+    if (root.getAttribute("data-bs-theme") !== "auto") {
+        return;
+    }
+    var query = window.matchMedia("(prefers-color-scheme: dark)");
+    var apply = function () {
+        root.setAttribute("data-bs-theme", query.matches ? "dark" : "light");
+    };
+    apply();
+    query.addEventListener("change", apply);
+})();
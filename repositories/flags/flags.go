@@ -0,0 +1,148 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/database"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// featureFlag stores the targeting lists as comma separated text
+type featureFlag struct {
+	ID          uint   `gorm:"primaryKey"`
+	Key         string `gorm:"uniqueIndex;not null"`
+	Description string
+	Enabled     bool
+	Percentage  int
+	UserIDs     string
+	Roles       string
+	Groups      string
+	UpdatedAt   time.Time
+	Version     uint `gorm:"not null;default:1"`
+}
+
+func (featureFlag) TableName() string {
+	return "feature_flags"
+}
+
+type flagsRepository struct {
+	db *gorm.DB
+}
+
+// NewFeatureFlagRepository creates a new flagsRepository instance
+func NewFeatureFlagRepository(db *gorm.DB) interfaces.IFeatureFlagRepository {
+	return &flagsRepository{db: db}
+}
+
+func splitList(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, ",")
+}
+
+func (flagsRepository) FromDTO(dto interfaces.FeatureFlag) featureFlag {
+	ids := make([]string, len(dto.UserIDs))
+	for i, id := range dto.UserIDs {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return featureFlag{
+		ID:          dto.ID,
+		Key:         dto.Key,
+		Description: dto.Description,
+		Enabled:     dto.Enabled,
+		Percentage:  dto.Percentage,
+		UserIDs:     strings.Join(ids, ","),
+		Roles:       strings.Join(dto.Roles, ","),
+		Groups:      strings.Join(dto.Groups, ","),
+		UpdatedAt:   dto.UpdatedAt,
+		Version:     dto.Version,
+	}
+}
+
+func (flagsRepository) ToDTO(flag featureFlag) interfaces.FeatureFlag {
+	ids := []uint{}
+	for _, text := range splitList(flag.UserIDs) {
+		if id, err := strconv.ParseUint(text, 10, 0); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return interfaces.FeatureFlag{
+		ID:          flag.ID,
+		Key:         flag.Key,
+		Description: flag.Description,
+		Enabled:     flag.Enabled,
+		Percentage:  flag.Percentage,
+		UserIDs:     ids,
+		Roles:       splitList(flag.Roles),
+		Groups:      splitList(flag.Groups),
+		UpdatedAt:   flag.UpdatedAt,
+		Version:     flag.Version,
+	}
+}
+
+func (r *flagsRepository) GetFlags(ctx context.Context) ([]interfaces.FeatureFlag, error) {
+	var flags []featureFlag
+	if err := database.Conn(ctx, r.db).Order(clause.OrderByColumn{Column: clause.Column{Name: "key"}}).Find(&flags).Error; err != nil {
+		return nil, database.MapError(err)
+	}
+	dtos := make([]interfaces.FeatureFlag, len(flags))
+	for i, flag := range flags {
+		dtos[i] = r.ToDTO(flag)
+	}
+	return dtos, nil
+}
+
+func (r *flagsRepository) GetFlag(ctx context.Context, key string) (*interfaces.FeatureFlag, error) {
+	var flag featureFlag
+	if err := database.Conn(ctx, r.db).Where(&featureFlag{Key: key}).First(&flag).Error; err != nil {
+		return nil, database.MapError(err)
+	}
+	dto := r.ToDTO(flag)
+	return &dto, nil
+}
+
+func (r *flagsRepository) SaveFlag(ctx context.Context, dto *interfaces.FeatureFlag) error {
+	flag := r.FromDTO(*dto)
+	flag.ID = 0
+	flag.UpdatedAt = time.Now()
+	flag.Version = dto.Version + 1
+	db := database.Conn(ctx, r.db)
+	if dto.Version == 0 {
+		err := database.MapError(db.Create(&flag).Error)
+		var conflict *interfaces.ConflictError
+		if errors.As(err, &conflict) {
+			return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		// compare and swap on the version so a flag that changed since it was loaded is not overwritten
+		result := db.Model(&featureFlag{}).Where(&featureFlag{Key: dto.Key}).Where("version = ?", dto.Version).
+			Select("description", "enabled", "percentage", "user_ids", "roles", "groups", "updated_at", "version").
+			Updates(&flag)
+		if result.Error != nil {
+			return database.MapError(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			if _, err := r.GetFlag(ctx, dto.Key); err != nil {
+				return err
+			}
+			return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+		}
+	}
+	dto.UpdatedAt = flag.UpdatedAt
+	dto.Version = flag.Version
+	return nil
+}
+
+func (r *flagsRepository) DeleteFlag(ctx context.Context, key string) error {
+	return database.MapError(database.Conn(ctx, r.db).Where(&featureFlag{Key: key}).Delete(&featureFlag{}).Error)
+}
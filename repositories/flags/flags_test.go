@@ -0,0 +1,52 @@
+package flags
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/database/dbtest"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestFeatureFlagRepository(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *gorm.DB, _ interfaces.ISecretCipher) {
+		ctx := context.Background()
+		repo := NewFeatureFlagRepository(db)
+
+		_, err := repo.GetFlag(ctx, "beta")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+
+		beta := &interfaces.FeatureFlag{Key: "beta", Percentage: 50, UserIDs: []uint{1, 2}, Roles: []string{"admin"}}
+		assert.NoError(t, repo.SaveFlag(ctx, beta))
+		assert.Equal(t, uint(1), beta.Version)
+		assert.NoError(t, repo.SaveFlag(ctx, &interfaces.FeatureFlag{Key: "alpha", Enabled: true, Percentage: 100}))
+		var conflict *interfaces.ConflictError
+		assert.ErrorAs(t, repo.SaveFlag(ctx, &interfaces.FeatureFlag{Key: "beta", Percentage: 100}), &conflict,
+			"creating a flag with a taken key")
+		assert.NoError(t, repo.SaveFlag(ctx, &interfaces.FeatureFlag{Key: "beta", Enabled: true, Percentage: 25, Groups: []string{"staff"}, Version: beta.Version}),
+			"saving a flag again updates it")
+		if assert.ErrorAs(t, repo.SaveFlag(ctx, beta), &conflict, "saving a flag that changed since it was loaded") {
+			assert.Equal(t, interfaces.FieldVersion, conflict.Field)
+		}
+		assert.ErrorIs(t, repo.SaveFlag(ctx, &interfaces.FeatureFlag{Key: "missing", Version: 1}), interfaces.ErrNotFound)
+
+		flag, err := repo.GetFlag(ctx, "beta")
+		assert.NoError(t, err)
+		assert.True(t, flag.Enabled)
+		assert.Equal(t, 25, flag.Percentage)
+		assert.Empty(t, flag.UserIDs)
+		assert.Equal(t, []string{"staff"}, flag.Groups)
+
+		flags, err := repo.GetFlags(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, flags, 2) {
+			assert.Equal(t, "alpha", flags[0].Key, "flags are ordered by key")
+		}
+
+		assert.NoError(t, repo.DeleteFlag(ctx, "beta"))
+		_, err = repo.GetFlag(ctx, "beta")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+	})
+}
@@ -0,0 +1,43 @@
+package number
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// memoryNumberRepository keeps numbers in memory, it is meant for tests and does not take part in transactions
+type memoryNumberRepository struct {
+	mu      sync.RWMutex
+	numbers map[string]uint64
+}
+
+// NewMemoryNumberRepository creates an empty in-memory number repository
+func NewMemoryNumberRepository() interfaces.INumberRepository {
+	return &memoryNumberRepository{numbers: map[string]uint64{}}
+}
+
+func (r *memoryNumberRepository) Save(ctx context.Context, number interfaces.Number) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.numbers[number.ID] = number.Number
+	return nil
+}
+
+func (r *memoryNumberRepository) FindByID(ctx context.Context, id string) (*interfaces.Number, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	value, ok := r.numbers[id]
+	if !ok {
+		return nil, interfaces.ErrNotFound
+	}
+	return &interfaces.Number{ID: id, Number: value}, nil
+}
+
+func (r *memoryNumberRepository) DeleteByID(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.numbers, id)
+	return nil
+}
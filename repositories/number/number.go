@@ -1,6 +1,9 @@
 package number
 
 import (
+	"context"
+
+	"github.com/bryopsida/gofiber-pug-starter/database"
 	"github.com/bryopsida/gofiber-pug-starter/interfaces"
 	"gorm.io/gorm"
 )
@@ -29,21 +32,21 @@ func NewNumberRepository(db *gorm.DB) interfaces.INumberRepository {
 // Save saves a number
 // - number: the number to save
 // Returns an error if the save operation fails
-func (r *gormNumberRepository) Save(incomingNumb interfaces.Number) error {
+func (r *gormNumberRepository) Save(ctx context.Context, incomingNumb interfaces.Number) error {
 	num := number{
 		ID:    incomingNumb.ID,
 		Value: uint64(incomingNumb.Number),
 	}
-	return r.db.Save(&num).Error
+	return database.MapError(database.Conn(ctx, r.db).Save(&num).Error)
 }
 
 // FindByID finds a number by its ID
 // - id: the ID of the number to find
-// Returns the number if found, otherwise returns an error
-func (r *gormNumberRepository) FindByID(id string) (*interfaces.Number, error) {
+// Returns the number if found, ErrNotFound if it does not exist
+func (r *gormNumberRepository) FindByID(ctx context.Context, id string) (*interfaces.Number, error) {
 	var num number
-	if err := r.db.First(&num, "id = ?", id).Error; err != nil {
-		return nil, err
+	if err := database.Conn(ctx, r.db).First(&num, "id = ?", id).Error; err != nil {
+		return nil, database.MapError(err)
 	}
 	return &interfaces.Number{
 		ID:     num.ID,
@@ -54,6 +57,6 @@ func (r *gormNumberRepository) FindByID(id string) (*interfaces.Number, error) {
 // DeleteByID deletes a number by its ID
 // - id: the ID of the number to delete
 // Returns an error if the delete operation fails
-func (r *gormNumberRepository) DeleteByID(id string) error {
-	return r.db.Delete(&number{}, "id = ?", id).Error
+func (r *gormNumberRepository) DeleteByID(ctx context.Context, id string) error {
+	return database.MapError(database.Conn(ctx, r.db).Delete(&number{}, "id = ?", id).Error)
 }
@@ -0,0 +1,26 @@
+package number
+
+import (
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/database/dbtest"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/bryopsida/gofiber-pug-starter/repositories/repotest"
+)
+
+func TestNumberRepository(t *testing.T) {
+	for _, backend := range dbtest.Backends() {
+		t.Run(backend.Driver, func(t *testing.T) {
+			repotest.NumberRepository(t, func(t *testing.T) interfaces.INumberRepository {
+				db, _ := dbtest.Open(t, backend)
+				return NewNumberRepository(db)
+			})
+		})
+	}
+}
+
+func TestMemoryNumberRepository(t *testing.T) {
+	repotest.NumberRepository(t, func(t *testing.T) interfaces.INumberRepository {
+		return NewMemoryNumberRepository()
+	})
+}
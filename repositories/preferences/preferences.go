@@ -0,0 +1,74 @@
+package preferences
+
+import (
+	"context"
+	"github.com/bryopsida/gofiber-pug-starter/database"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type preferences struct {
+	UserID     uint   `gorm:"primaryKey;autoIncrement:false"`
+	Theme      string `gorm:"not null"`
+	Timezone   string `gorm:"not null"`
+	Locale     string `gorm:"not null"`
+	DateFormat string `gorm:"not null"`
+	PageSize   int    `gorm:"not null"`
+}
+
+func (preferences) TableName() string {
+	return "user_preferences"
+}
+
+type preferencesRepository struct {
+	db *gorm.DB
+}
+
+// NewPreferencesRepository creates a new preferencesRepository instance
+func NewPreferencesRepository(db *gorm.DB) interfaces.IPreferencesRepository {
+	return &preferencesRepository{db: db}
+}
+
+func (preferencesRepository) FromDTO(dto interfaces.Preferences) preferences {
+	return preferences{
+		UserID:     dto.UserID,
+		Theme:      dto.Theme,
+		Timezone:   dto.Timezone,
+		Locale:     dto.Locale,
+		DateFormat: dto.DateFormat,
+		PageSize:   dto.PageSize,
+	}
+}
+
+func (preferencesRepository) ToDTO(prefs preferences) interfaces.Preferences {
+	return interfaces.Preferences{
+		UserID:     prefs.UserID,
+		Theme:      prefs.Theme,
+		Timezone:   prefs.Timezone,
+		Locale:     prefs.Locale,
+		DateFormat: prefs.DateFormat,
+		PageSize:   prefs.PageSize,
+	}
+}
+
+func (r *preferencesRepository) GetPreferences(ctx context.Context, userID uint) (*interfaces.Preferences, error) {
+	var prefs preferences
+	if err := database.Conn(ctx, r.db).First(&prefs, "user_id = ?", userID).Error; err != nil {
+		return nil, database.MapError(err)
+	}
+	var retPrefs = r.ToDTO(prefs)
+	return &retPrefs, nil
+}
+
+func (r *preferencesRepository) SavePreferences(ctx context.Context, dto *interfaces.Preferences) error {
+	prefs := r.FromDTO(*dto)
+	err := database.Conn(ctx, r.db).Clauses(clause.OnConflict{
+		UpdateAll: true,
+	}).Create(&prefs).Error
+	return database.MapError(err)
+}
+
+func (r *preferencesRepository) DeletePreferences(ctx context.Context, userID uint) error {
+	return database.MapError(database.Conn(ctx, r.db).Delete(&preferences{}, "user_id = ?", userID).Error)
+}
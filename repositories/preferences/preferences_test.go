@@ -0,0 +1,34 @@
+package preferences
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/database/dbtest"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestPreferencesRepository(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *gorm.DB, _ interfaces.ISecretCipher) {
+		ctx := context.Background()
+		repo := NewPreferencesRepository(db)
+
+		_, err := repo.GetPreferences(ctx, 1)
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+
+		prefs := &interfaces.Preferences{UserID: 1, Theme: interfaces.ThemeDark, Timezone: "UTC", Locale: "en", DateFormat: "2006-01-02", PageSize: 25}
+		assert.NoError(t, repo.SavePreferences(ctx, prefs))
+		prefs.Theme = interfaces.ThemeLight
+		assert.NoError(t, repo.SavePreferences(ctx, prefs), "saving again updates the preferences")
+
+		stored, err := repo.GetPreferences(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, *prefs, *stored)
+
+		assert.NoError(t, repo.DeletePreferences(ctx, 1))
+		_, err = repo.GetPreferences(ctx, 1)
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+	})
+}
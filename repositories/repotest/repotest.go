@@ -0,0 +1,359 @@
+// Package repotest is the conformance suite every implementation of a repository interface must pass,
+// so services can be tested against the in-memory repositories and run against the gorm ones
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// actor is recorded as the author of the setting changes made by the suite
+var actor = interfaces.SettingActor{Username: "tester", RequestID: "request"}
+
+// NumberRepository runs the number repository suite
+// - open: returns a repository without the numbers saved by the suite, it is called once per subtest
+func NumberRepository(t *testing.T, open func(t *testing.T) interfaces.INumberRepository) {
+	ctx := context.Background()
+
+	t.Run("saves and updates numbers", func(t *testing.T) {
+		repo := open(t)
+		require.NoError(t, repo.Save(ctx, interfaces.Number{ID: "counter", Number: 1}))
+		require.NoError(t, repo.Save(ctx, interfaces.Number{ID: "counter", Number: 2}), "saving again updates the number")
+		number, err := repo.FindByID(ctx, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, interfaces.Number{ID: "counter", Number: 2}, *number)
+	})
+
+	t.Run("returns ErrNotFound for missing numbers", func(t *testing.T) {
+		repo := open(t)
+		_, err := repo.FindByID(ctx, "missing")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+
+		require.NoError(t, repo.Save(ctx, interfaces.Number{ID: "counter", Number: 1}))
+		require.NoError(t, repo.DeleteByID(ctx, "counter"))
+		_, err = repo.FindByID(ctx, "counter")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound, "deleted numbers are not found")
+		assert.NoError(t, repo.DeleteByID(ctx, "counter"), "deleting a missing number is not an error")
+	})
+}
+
+// UserRepository runs the user repository suite
+// - open: returns a repository without the users created by the suite, it is called once per subtest
+func UserRepository(t *testing.T, open func(t *testing.T) interfaces.IUserRepository) {
+	ctx := context.Background()
+	newUser := func(name string) *interfaces.User {
+		return &interfaces.User{Username: name, Email: name + "@example.com", Role: interfaces.RoleUser, PasswordHash: "hash"}
+	}
+
+	t.Run("creates and finds users", func(t *testing.T) {
+		repo := open(t)
+		user := newUser("jane")
+		require.NoError(t, repo.CreateUser(ctx, user))
+		assert.NotZero(t, user.ID)
+		assert.Equal(t, uint(1), user.Version, "new users start at version 1")
+
+		byID, err := repo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, *user, *byID)
+		byName, err := repo.GetUserByUsername(ctx, "jane")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, byName.ID)
+		byEmail, err := repo.GetUserByEmail(ctx, "jane@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, byEmail.ID)
+	})
+
+	t.Run("returns ErrNotFound for missing users", func(t *testing.T) {
+		repo := open(t)
+		_, err := repo.GetUserByID(ctx, 1000)
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+		_, err = repo.GetUserByUsername(ctx, "missing")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+		_, err = repo.GetUserByEmail(ctx, "missing@example.com")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+		assert.ErrorIs(t, repo.UpdateUser(ctx, &interfaces.User{ID: 1000, Version: 1}), interfaces.ErrNotFound)
+
+		user := newUser("jane")
+		require.NoError(t, repo.CreateUser(ctx, user))
+		require.NoError(t, repo.DeleteUser(ctx, user.ID))
+		_, err = repo.GetUserByID(ctx, user.ID)
+		assert.ErrorIs(t, err, interfaces.ErrNotFound, "deleted users are not found")
+	})
+
+	t.Run("keeps usernames and emails unique", func(t *testing.T) {
+		repo := open(t)
+		require.NoError(t, repo.CreateUser(ctx, newUser("jane")))
+		var conflict *interfaces.ConflictError
+		taken := newUser("jane")
+		taken.Email = "other@example.com"
+		if assert.ErrorAs(t, repo.CreateUser(ctx, taken), &conflict, "usernames are unique") {
+			assert.Equal(t, "username", conflict.Field)
+		}
+		taken = newUser("other")
+		taken.Email = "jane@example.com"
+		if assert.ErrorAs(t, repo.CreateUser(ctx, taken), &conflict, "emails are unique") {
+			assert.Equal(t, "email", conflict.Field)
+		}
+		other := newUser("other")
+		require.NoError(t, repo.CreateUser(ctx, other))
+		other.Email = "jane@example.com"
+		if assert.ErrorAs(t, repo.UpdateUser(ctx, other), &conflict, "emails stay unique on update") {
+			assert.Equal(t, "email", conflict.Field)
+		}
+	})
+
+	t.Run("creates all users of a batch or none", func(t *testing.T) {
+		repo := open(t)
+		require.NoError(t, repo.CreateUser(ctx, newUser("jane")))
+		assert.ErrorIs(t, repo.CreateUsers(ctx, []*interfaces.User{newUser("john"), newUser("jane")}), interfaces.ErrConflict)
+		_, err := repo.GetUserByUsername(ctx, "john")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound, "a failed batch creates none of the users")
+
+		batch := []*interfaces.User{newUser("john"), newUser("mary")}
+		require.NoError(t, repo.CreateUsers(ctx, batch))
+		for _, user := range batch {
+			assert.NotZero(t, user.ID, "IDs are populated")
+		}
+		var usernames []string
+		require.NoError(t, repo.ForEachUser(ctx, func(user *interfaces.User) error {
+			usernames = append(usernames, user.Username)
+			return nil
+		}))
+		assert.Subset(t, usernames, []string{"jane", "john", "mary"})
+		assert.Equal(t, []string{"jane", "john", "mary"}, usernames[len(usernames)-3:], "users are visited in ID order")
+	})
+
+	t.Run("only updates users that did not change since they were loaded", func(t *testing.T) {
+		repo := open(t)
+		user := newUser("jane")
+		require.NoError(t, repo.CreateUser(ctx, user))
+		stale, err := repo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+
+		user.FirstName = "Jane"
+		require.NoError(t, repo.UpdateUser(ctx, user))
+		assert.Equal(t, uint(2), user.Version, "an update increments the version")
+
+		stale.LastName = "Doe"
+		err = repo.UpdateUser(ctx, stale)
+		assert.ErrorIs(t, err, interfaces.ErrConflict, "a user loaded before the last update is not saved")
+		var conflict *interfaces.ConflictError
+		if assert.ErrorAs(t, err, &conflict) {
+			assert.Equal(t, interfaces.FieldVersion, conflict.Field)
+		}
+		current, err := repo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Jane", current.FirstName)
+		assert.Empty(t, current.LastName)
+	})
+
+	t.Run("finds users due for deletion", func(t *testing.T) {
+		repo := open(t)
+		due := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+		later := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		for name, deleteAfter := range map[string]*time.Time{"due": &due, "later": &later, "kept": nil} {
+			user := newUser(name)
+			user.DeleteAfter = deleteAfter
+			require.NoError(t, repo.CreateUser(ctx, user))
+		}
+		dueUsers, err := repo.GetUsersDueForDeletion(ctx, time.Now())
+		require.NoError(t, err)
+		if assert.Len(t, dueUsers, 1) {
+			assert.Equal(t, "due", dueUsers[0].Username)
+			assert.True(t, due.Equal(*dueUsers[0].DeleteAfter))
+		}
+	})
+}
+
+// SettingsRepository runs the settings repository suite
+// - open: returns a repository without the settings written by the suite, it is called once per subtest
+func SettingsRepository(t *testing.T, open func(t *testing.T) interfaces.ISettingsRepository) {
+	ctx := context.Background()
+
+	t.Run("returns ErrNotFound for missing settings", func(t *testing.T) {
+		repo := open(t)
+		_, err := repo.GetString(ctx, "missing")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+		_, err = repo.GetInt(ctx, "missing")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+		_, err = repo.GetBool(ctx, "missing")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+		assert.ErrorIs(t, repo.MarkSecret(ctx, "missing"), interfaces.ErrNotFound)
+		_, err = repo.GetChange(ctx, 0)
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+	})
+
+	t.Run("records the history of changes", func(t *testing.T) {
+		repo := open(t)
+		require.NoError(t, repo.Set(ctx, "count", 1, actor))
+		require.NoError(t, repo.Set(ctx, "count", 2, actor))
+		require.NoError(t, repo.Set(ctx, "count", 2, actor), "writing the current value records nothing")
+		count, err := repo.GetInt(ctx, "count")
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		history, err := repo.GetHistory(ctx, "count")
+		require.NoError(t, err)
+		if assert.Len(t, history, 2) {
+			assert.Equal(t, "1", history[0].OldValue)
+			assert.Equal(t, "2", history[0].NewValue)
+			assert.Equal(t, "tester", history[0].Actor)
+			assert.Equal(t, "request", history[0].RequestID)
+			assert.Empty(t, history[1].OldValue, "the first change has no old value")
+			change, err := repo.GetChange(ctx, history[1].ID)
+			require.NoError(t, err)
+			assert.Equal(t, "1", change.NewValue)
+		}
+	})
+
+	t.Run("finds and replaces the actor of changes", func(t *testing.T) {
+		repo := open(t)
+		user := interfaces.SettingActor{Username: "tester", UserID: 7}
+		other := interfaces.SettingActor{Username: "other", UserID: 8}
+		// a user may have the name of an actor that is not a user
+		namesake := interfaces.SettingActor{Username: interfaces.SettingActorSystem, UserID: 9}
+		require.NoError(t, repo.Set(ctx, "count", 1, user))
+		require.NoError(t, repo.Set(ctx, "name", "app", other))
+		require.NoError(t, repo.Set(ctx, "count", 2, user))
+		require.NoError(t, repo.Set(ctx, "name", "system", interfaces.SettingActor{Username: interfaces.SettingActorSystem}))
+
+		changes, err := repo.GetChangesByActor(ctx, 7)
+		require.NoError(t, err)
+		if assert.Len(t, changes, 2) {
+			assert.Equal(t, "2", changes[0].NewValue)
+			assert.Equal(t, "1", changes[1].NewValue)
+			assert.Equal(t, uint(7), changes[0].ActorID)
+		}
+		changes, err = repo.GetChangesByActor(ctx, namesake.UserID)
+		require.NoError(t, err)
+		assert.Empty(t, changes, "changes of the system are not the changes of a user named after it")
+		require.NoError(t, repo.ReplaceActor(ctx, namesake.UserID, interfaces.SettingActorDeleted))
+		history, err := repo.GetHistory(ctx, "name")
+		require.NoError(t, err)
+		assert.Equal(t, interfaces.SettingActorSystem, history[0].Actor, "erasing the namesake keeps the system changes")
+
+		require.NoError(t, repo.ReplaceActor(ctx, 7, interfaces.SettingActorDeleted))
+		changes, err = repo.GetChangesByActor(ctx, 7)
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+		history, err = repo.GetHistory(ctx, "count")
+		require.NoError(t, err)
+		for _, change := range history {
+			assert.Equal(t, interfaces.SettingActorDeleted, change.Actor)
+			assert.Zero(t, change.ActorID)
+		}
+		changes, err = repo.GetChangesByActor(ctx, 8)
+		require.NoError(t, err)
+		assert.Len(t, changes, 1, "changes of other actors are kept")
+	})
+
+	t.Run("only sets settings that did not change since they were loaded", func(t *testing.T) {
+		repo := open(t)
+		var conflict *interfaces.ConflictError
+		require.NoError(t, repo.SetIfVersion(ctx, "name", "app", false, 0, actor), "0 is the version of unset keys")
+		err := repo.SetIfVersion(ctx, "name", "other", false, 0, actor)
+		if assert.ErrorAs(t, err, &conflict) {
+			assert.Equal(t, interfaces.FieldVersion, conflict.Field)
+		}
+
+		name, version, err := repo.GetStringVersion(ctx, "name")
+		require.NoError(t, err)
+		assert.Equal(t, "app", name)
+		require.NoError(t, repo.Set(ctx, "name", "changed", actor))
+		assert.ErrorAs(t, repo.SetIfVersion(ctx, "name", "stale", false, version, actor), &conflict)
+		_, version, err = repo.GetStringVersion(ctx, "name")
+		require.NoError(t, err)
+		require.NoError(t, repo.SetIfVersion(ctx, "name", "fresh", false, version, actor))
+		name, _, err = repo.GetStringVersion(ctx, "name")
+		require.NoError(t, err)
+		assert.Equal(t, "fresh", name)
+
+		require.NoError(t, repo.SetIfVersion(ctx, "token", "hunter2", true, 0, actor))
+		token, _, err := repo.GetStringVersion(ctx, "token")
+		require.NoError(t, err)
+		assert.Equal(t, "hunter2", token)
+		history, err := repo.GetHistory(ctx, "token")
+		require.NoError(t, err)
+		if assert.Len(t, history, 1) {
+			assert.True(t, history[0].Secret)
+		}
+		_, _, err = repo.GetStringVersion(ctx, "missing")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound)
+	})
+
+	t.Run("sets several settings at once", func(t *testing.T) {
+		repo := open(t)
+		require.NoError(t, repo.SetMany(ctx, map[string]string{"enabled": "true", "name": "app"}, actor))
+		enabled, err := repo.GetBool(ctx, "enabled")
+		require.NoError(t, err)
+		assert.True(t, enabled)
+		all, err := repo.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "true", all["enabled"])
+		assert.Equal(t, "app", all["name"])
+
+		_, version, err := repo.GetStringVersion(ctx, "name")
+		require.NoError(t, err)
+		err = repo.SetManyIfVersion(ctx, map[string]string{"name": "renamed", "retries": "3"}, map[string]uint{"name": version + 1, "retries": 0}, actor)
+		assert.ErrorIs(t, err, interfaces.ErrConflict)
+		err = repo.SetManyIfVersion(ctx, map[string]string{"name": "renamed", "retries": "3"}, map[string]uint{"name": version}, actor)
+		assert.ErrorIs(t, err, interfaces.ErrConflict, "a key without a version is a conflict")
+		all, err = repo.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "app", all["name"], "nothing is set on a conflict")
+		assert.NotContains(t, all, "retries")
+		require.NoError(t, repo.SetManyIfVersion(ctx, map[string]string{"name": "renamed", "retries": "3"}, map[string]uint{"name": version, "retries": 0}, actor))
+		all, err = repo.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "renamed", all["name"])
+		assert.Equal(t, "3", all["retries"])
+	})
+
+	t.Run("keeps secrets out of the history", func(t *testing.T) {
+		repo := open(t)
+		require.NoError(t, repo.SetSecret(ctx, "token", "hunter2", actor))
+		require.NoError(t, repo.Set(ctx, "token", "hunter3", actor), "secrets stay secret when they are set again")
+		token, err := repo.GetString(ctx, "token")
+		require.NoError(t, err)
+		assert.Equal(t, "hunter3", token)
+		history, err := repo.GetHistory(ctx, "token")
+		require.NoError(t, err)
+		if assert.Len(t, history, 2) {
+			for _, change := range history {
+				assert.True(t, change.Secret)
+				assert.Empty(t, change.OldValue)
+				assert.Empty(t, change.NewValue)
+			}
+		}
+
+		require.NoError(t, repo.Set(ctx, "name", "app", actor))
+		require.NoError(t, repo.Set(ctx, "greeting", "hello", actor))
+		require.NoError(t, repo.MarkSecret(ctx, "name"))
+		require.NoError(t, repo.Set(ctx, "name", "other", actor))
+		history, err = repo.GetHistory(ctx, "name")
+		require.NoError(t, err)
+		if assert.Len(t, history, 2) {
+			for _, change := range history {
+				assert.True(t, change.Secret, "settings marked secret are redacted from then on and in the past")
+				assert.Empty(t, change.OldValue)
+				assert.Empty(t, change.NewValue)
+			}
+		}
+		other, err := repo.GetHistory(ctx, "greeting")
+		require.NoError(t, err)
+		if assert.Len(t, other, 1) {
+			assert.Equal(t, "hello", other[0].NewValue, "the history of other settings is left alone")
+		}
+		all, err := repo.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "other", all["name"], "secrets are decrypted")
+		assert.Equal(t, "hunter3", all["token"])
+		_, err = repo.RewrapSecrets(ctx)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,86 @@
+package sessions
+
+import (
+	"context"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/database"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"gorm.io/gorm"
+)
+
+type userSession struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Method    string `gorm:"not null"`
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+func (userSession) TableName() string {
+	return "user_sessions"
+}
+
+type userSessionRepository struct {
+	db *gorm.DB
+}
+
+// NewUserSessionRepository creates a new userSessionRepository instance
+func NewUserSessionRepository(db *gorm.DB) interfaces.IUserSessionRepository {
+	return &userSessionRepository{db: db}
+}
+
+func (userSessionRepository) FromDTO(sessionDTO interfaces.UserSession) userSession {
+	return userSession{
+		ID:        sessionDTO.ID,
+		UserID:    sessionDTO.UserID,
+		Method:    sessionDTO.Method,
+		IPAddress: sessionDTO.IPAddress,
+		UserAgent: sessionDTO.UserAgent,
+		CreatedAt: sessionDTO.CreatedAt,
+		ExpiresAt: sessionDTO.ExpiresAt,
+	}
+}
+
+func (userSessionRepository) ToDTO(session userSession) interfaces.UserSession {
+	return interfaces.UserSession{
+		ID:        session.ID,
+		UserID:    session.UserID,
+		Method:    session.Method,
+		IPAddress: session.IPAddress,
+		UserAgent: session.UserAgent,
+		CreatedAt: session.CreatedAt,
+		ExpiresAt: session.ExpiresAt,
+	}
+}
+
+func (r *userSessionRepository) CreateSession(ctx context.Context, session *interfaces.UserSession) error {
+	sessionDb := r.FromDTO(*session)
+	if err := database.Conn(ctx, r.db).Create(&sessionDb).Error; err != nil {
+		return database.MapError(err)
+	}
+	*session = r.ToDTO(sessionDb)
+	return nil
+}
+
+func (r *userSessionRepository) GetSessionsForUser(ctx context.Context, userID uint) ([]interfaces.UserSession, error) {
+	var sessions []userSession
+	if err := database.Conn(ctx, r.db).Where("user_id = ?", userID).Order("id desc").Find(&sessions).Error; err != nil {
+		return nil, database.MapError(err)
+	}
+	retSessions := make([]interfaces.UserSession, len(sessions))
+	for i, session := range sessions {
+		retSessions[i] = r.ToDTO(session)
+	}
+	return retSessions, nil
+}
+
+func (r *userSessionRepository) DeleteSessionsForUser(ctx context.Context, userID uint) error {
+	return database.MapError(database.Conn(ctx, r.db).Where("user_id = ?", userID).Delete(&userSession{}).Error)
+}
+
+func (r *userSessionRepository) DeleteExpiredSessions(ctx context.Context, before time.Time) error {
+	return database.MapError(database.Conn(ctx, r.db).Where("expires_at < ?", before).Delete(&userSession{}).Error)
+}
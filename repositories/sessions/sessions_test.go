@@ -0,0 +1,45 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/database/dbtest"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestUserSessionRepository(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *gorm.DB, _ interfaces.ISecretCipher) {
+		ctx := context.Background()
+		repo := NewUserSessionRepository(db)
+		now := time.Now().UTC().Truncate(time.Second)
+
+		expired := &interfaces.UserSession{UserID: 1, Method: interfaces.SessionMethodPassword, ExpiresAt: now.Add(-time.Hour)}
+		assert.NoError(t, repo.CreateSession(ctx, expired))
+		assert.NoError(t, repo.CreateSession(ctx, &interfaces.UserSession{UserID: 1, Method: interfaces.SessionMethodClientCertificate, IPAddress: "192.0.2.1", UserAgent: "curl", ExpiresAt: now.Add(time.Hour)}))
+		assert.NoError(t, repo.CreateSession(ctx, &interfaces.UserSession{UserID: 2, Method: interfaces.SessionMethodPassword, ExpiresAt: now.Add(time.Hour)}))
+
+		sessions, err := repo.GetSessionsForUser(ctx, 1)
+		assert.NoError(t, err)
+		if assert.Len(t, sessions, 2) {
+			assert.Equal(t, "192.0.2.1", sessions[0].IPAddress, "the newest session is first")
+			assert.Equal(t, expired.ID, sessions[1].ID)
+		}
+
+		assert.NoError(t, repo.DeleteExpiredSessions(ctx, now))
+		sessions, err = repo.GetSessionsForUser(ctx, 1)
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 1)
+
+		assert.NoError(t, repo.DeleteSessionsForUser(ctx, 1))
+		sessions, err = repo.GetSessionsForUser(ctx, 1)
+		assert.NoError(t, err)
+		assert.Empty(t, sessions)
+		sessions, err = repo.GetSessionsForUser(ctx, 2)
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 1, "the sessions of other users are kept")
+	})
+}
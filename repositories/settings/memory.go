@@ -0,0 +1,247 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// memorySetting is a stored setting, secrets are kept in plaintext as nothing is persisted
+type memorySetting struct {
+	value   string
+	secret  bool
+	version uint
+}
+
+// memorySettingsRepository keeps settings and their history in memory, it is meant for tests and does not
+// take part in transactions
+type memorySettingsRepository struct {
+	mu       sync.RWMutex
+	settings map[string]memorySetting
+	changes  []interfaces.SettingChange
+}
+
+// NewMemorySettingsRepository creates an empty in-memory settings repository
+func NewMemorySettingsRepository() interfaces.ISettingsRepository {
+	return &memorySettingsRepository{settings: map[string]memorySetting{}}
+}
+
+func (r *memorySettingsRepository) GetString(ctx context.Context, key string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stored, ok := r.settings[key]
+	if !ok {
+		return "", interfaces.ErrNotFound
+	}
+	return stored.value, nil
+}
+
+func (r *memorySettingsRepository) GetStringVersion(ctx context.Context, key string) (string, uint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stored, ok := r.settings[key]
+	if !ok {
+		return "", 0, interfaces.ErrNotFound
+	}
+	return stored.value, stored.version, nil
+}
+
+func (r *memorySettingsRepository) GetInt(ctx context.Context, key string) (int, error) {
+	value, err := r.GetString(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+func (r *memorySettingsRepository) GetBool(ctx context.Context, key string) (bool, error) {
+	value, err := r.GetString(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(value)
+}
+
+func (r *memorySettingsRepository) Set(ctx context.Context, key string, value interface{}, actor interfaces.SettingActor) error {
+	strValue := ""
+	switch v := value.(type) {
+	case string:
+		strValue = v
+	case int:
+		strValue = strconv.Itoa(v)
+	case bool:
+		strValue = strconv.FormatBool(v)
+	default:
+		return errors.New("unsupported value type")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.upsert(key, strValue, false, actor)
+	return nil
+}
+
+func (r *memorySettingsRepository) SetMany(ctx context.Context, values map[string]string, actor interfaces.SettingActor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setMany(values, actor)
+	return nil
+}
+
+func (r *memorySettingsRepository) SetManyIfVersion(ctx context.Context, values map[string]string, versions map[string]uint, actor interfaces.SettingActor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range values {
+		if version, ok := versions[key]; !ok || r.settings[key].version != version {
+			return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+		}
+	}
+	r.setMany(values, actor)
+	return nil
+}
+
+func (r *memorySettingsRepository) SetSecret(ctx context.Context, key string, value string, actor interfaces.SettingActor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.upsert(key, value, true, actor)
+	return nil
+}
+
+func (r *memorySettingsRepository) SetIfVersion(ctx context.Context, key string, value string, secret bool, version uint, actor interfaces.SettingActor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.settings[key].version != version {
+		return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+	}
+	r.upsert(key, value, secret, actor)
+	return nil
+}
+
+func (r *memorySettingsRepository) MarkSecret(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.settings[key]
+	if !ok {
+		return interfaces.ErrNotFound
+	}
+	if stored.secret {
+		return nil
+	}
+	stored.secret = true
+	stored.version++
+	r.settings[key] = stored
+	for i := range r.changes {
+		if r.changes[i].Key == key {
+			r.changes[i].OldValue = ""
+			r.changes[i].NewValue = ""
+			r.changes[i].Secret = true
+		}
+	}
+	return nil
+}
+
+// RewrapSecrets has nothing to re-wrap as secrets are not encrypted in memory
+func (r *memorySettingsRepository) RewrapSecrets(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (r *memorySettingsRepository) GetAll(ctx context.Context) (map[string]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	values := make(map[string]string, len(r.settings))
+	for key, stored := range r.settings {
+		values[key] = stored.value
+	}
+	return values, nil
+}
+
+func (r *memorySettingsRepository) GetHistory(ctx context.Context, key string) ([]interfaces.SettingChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	changes := []interfaces.SettingChange{}
+	for i := len(r.changes) - 1; i >= 0; i-- {
+		if r.changes[i].Key == key {
+			changes = append(changes, r.changes[i])
+		}
+	}
+	return changes, nil
+}
+
+func (r *memorySettingsRepository) GetChangesByActor(ctx context.Context, userID uint) ([]interfaces.SettingChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	changes := []interfaces.SettingChange{}
+	for i := len(r.changes) - 1; i >= 0; i-- {
+		if userID != 0 && r.changes[i].ActorID == userID {
+			changes = append(changes, r.changes[i])
+		}
+	}
+	return changes, nil
+}
+
+func (r *memorySettingsRepository) ReplaceActor(ctx context.Context, userID uint, replacement string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.changes {
+		if userID != 0 && r.changes[i].ActorID == userID {
+			r.changes[i].Actor = replacement
+			r.changes[i].ActorID = 0
+		}
+	}
+	return nil
+}
+
+func (r *memorySettingsRepository) GetChange(ctx context.Context, id uint) (*interfaces.SettingChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	// change IDs start at 1 and are the position in the history
+	if id == 0 || id > uint(len(r.changes)) {
+		return nil, interfaces.ErrNotFound
+	}
+	change := r.changes[id-1]
+	return &change, nil
+}
+
+// setMany writes values in key order, the caller holds the lock
+func (r *memorySettingsRepository) setMany(values map[string]string, actor interfaces.SettingActor) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		r.upsert(key, values[key], false, actor)
+	}
+}
+
+// upsert writes a setting and appends the change to its history, writing the current value again records nothing,
+// the caller holds the lock
+// - markSecret: marks the setting as secret, settings that are already secret stay secret
+func (r *memorySettingsRepository) upsert(key string, value string, markSecret bool, actor interfaces.SettingActor) {
+	existing, found := r.settings[key]
+	secret := markSecret || existing.secret
+	if found && existing.value == value && existing.secret == secret {
+		return
+	}
+	r.settings[key] = memorySetting{value: value, secret: secret, version: existing.version + 1}
+	change := interfaces.SettingChange{
+		ID:        uint(len(r.changes) + 1),
+		Key:       key,
+		OldValue:  existing.value,
+		NewValue:  value,
+		Secret:    secret,
+		Actor:     actor.Username,
+		ActorID:   actor.UserID,
+		RequestID: actor.RequestID,
+		CreatedAt: time.Now(),
+	}
+	if secret {
+		change.OldValue = ""
+		change.NewValue = ""
+	}
+	r.changes = append(r.changes, change)
+}
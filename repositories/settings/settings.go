@@ -1,9 +1,13 @@
 package settings
 
 import (
+	"context"
 	"errors"
+	"sort"
 	"strconv"
+	"time"
 
+	"github.com/bryopsida/gofiber-pug-starter/database"
 	"github.com/bryopsida/gofiber-pug-starter/interfaces"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -11,37 +15,95 @@ import (
 
 // Setting represents a key-value pair in the settings table
 type setting struct {
-	ID    uint   `gorm:"primaryKey"`
-	Key   string `gorm:"uniqueIndex"`
-	Value string
+	ID      uint   `gorm:"primaryKey"`
+	Key     string `gorm:"uniqueIndex"`
+	Value   string
+	Secret  bool `gorm:"not null;default:false"`
+	Version uint `gorm:"not null;default:1"`
 }
 
 func (setting) TableName() string {
 	return "settings"
 }
 
+// settingChange is an entry in the append-only settings history
+type settingChange struct {
+	ID        uint   `gorm:"primaryKey"`
+	Key       string `gorm:"index;not null"`
+	OldValue  string
+	NewValue  string
+	Secret    bool   `gorm:"not null;default:false"`
+	Actor     string `gorm:"not null"`
+	ActorID   *uint  `gorm:"index"`
+	RequestID string
+	CreatedAt time.Time
+}
+
+func (settingChange) TableName() string {
+	return "setting_changes"
+}
+
+func (change settingChange) ToDTO() interfaces.SettingChange {
+	actorID := uint(0)
+	if change.ActorID != nil {
+		actorID = *change.ActorID
+	}
+	return interfaces.SettingChange{
+		ID:        change.ID,
+		Key:       change.Key,
+		OldValue:  change.OldValue,
+		NewValue:  change.NewValue,
+		Secret:    change.Secret,
+		Actor:     change.Actor,
+		ActorID:   actorID,
+		RequestID: change.RequestID,
+		CreatedAt: change.CreatedAt,
+	}
+}
+
 // SettingsRepository handles database operations for settings
 type settingsRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	cipher interfaces.ISecretCipher
 }
 
 // NewSettingsRepository initializes the repository with a database connection
-func NewSettingsRepository(db *gorm.DB) interfaces.ISettingsRepository {
-	return &settingsRepository{db: db}
+// - cipher: encrypts the values of secret settings
+func NewSettingsRepository(db *gorm.DB, cipher interfaces.ISecretCipher) interfaces.ISettingsRepository {
+	return &settingsRepository{db: db, cipher: cipher}
+}
+
+// GetString retrieves a string value for a given key, returns ErrNotFound if it has not been set
+func (r *settingsRepository) GetString(ctx context.Context, key string) (string, error) {
+	var stored setting
+	if err := database.Conn(ctx, r.db).Where(&setting{Key: key}).First(&stored).Error; err != nil {
+		return "", database.MapError(err)
+	}
+	if stored.Secret {
+		return r.cipher.Decrypt(stored.Value, key)
+	}
+	return stored.Value, nil
 }
 
-// GetString retrieves a string value for a given key
-func (r *settingsRepository) GetString(key string) (string, error) {
-	var setting setting
-	if err := r.db.Where("key = ?", key).First(&setting).Error; err != nil {
-		return "", err
+// GetStringVersion retrieves a string value and its version for a given key, returns ErrNotFound if it has not been set
+func (r *settingsRepository) GetStringVersion(ctx context.Context, key string) (string, uint, error) {
+	var stored setting
+	if err := database.Conn(ctx, r.db).Where(&setting{Key: key}).First(&stored).Error; err != nil {
+		return "", 0, database.MapError(err)
 	}
-	return setting.Value, nil
+	if !stored.Secret {
+		return stored.Value, stored.Version, nil
+	}
+	value, err := r.cipher.Decrypt(stored.Value, key)
+	if err != nil {
+		return "", 0, err
+	}
+	return value, stored.Version, nil
 }
 
 // GetInt retrieves an integer value for a given key
-func (r *settingsRepository) GetInt(key string) (int, error) {
-	value, err := r.GetString(key)
+func (r *settingsRepository) GetInt(ctx context.Context, key string) (int, error) {
+	value, err := r.GetString(ctx, key)
 	if err != nil {
 		return 0, err
 	}
@@ -49,16 +111,16 @@ func (r *settingsRepository) GetInt(key string) (int, error) {
 }
 
 // GetBool retrieves a boolean value for a given key
-func (r *settingsRepository) GetBool(key string) (bool, error) {
-	value, err := r.GetString(key)
+func (r *settingsRepository) GetBool(ctx context.Context, key string) (bool, error) {
+	value, err := r.GetString(ctx, key)
 	if err != nil {
 		return false, err
 	}
 	return strconv.ParseBool(value)
 }
 
-// Set sets a value for a given key
-func (r *settingsRepository) Set(key string, value interface{}) error {
+// Set sets a value for a given key, keys already marked as secret stay encrypted
+func (r *settingsRepository) Set(ctx context.Context, key string, value interface{}, actor interfaces.SettingActor) error {
 	strValue := ""
 	switch v := value.(type) {
 	case string:
@@ -71,8 +133,272 @@ func (r *settingsRepository) Set(key string, value interface{}) error {
 		return errors.New("unsupported value type")
 	}
 
-	setting := setting{Key: key, Value: strValue}
-	return r.db.Clauses(clause.OnConflict{
-		UpdateAll: true,
-	}).Create(&setting).Error
+	return r.upsert(ctx, key, strValue, false, nil, actor)
+}
+
+// SetMany sets several values in one transaction, keys already marked as secret stay encrypted
+func (r *settingsRepository) SetMany(ctx context.Context, values map[string]string, actor interfaces.SettingActor) error {
+	return r.setMany(ctx, values, nil, actor)
+}
+
+// SetManyIfVersion sets several values in one transaction if each is still at its version, a key missing from versions
+// is a conflict
+func (r *settingsRepository) SetManyIfVersion(ctx context.Context, values map[string]string, versions map[string]uint, actor interfaces.SettingActor) error {
+	if versions == nil {
+		versions = map[string]uint{}
+	}
+	return r.setMany(ctx, values, versions, actor)
+}
+
+// setMany writes values in key order in one transaction
+// - versions: the version each setting must be at, nil to write whatever version they are at
+func (r *settingsRepository) setMany(ctx context.Context, values map[string]string, versions map[string]uint, actor interfaces.SettingActor) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	err := database.Conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		for _, key := range keys {
+			var version *uint
+			if versions != nil {
+				expected, ok := versions[key]
+				if !ok {
+					return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+				}
+				version = &expected
+			}
+			if err := r.upsertTx(tx, key, values[key], false, version, actor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return database.MapError(err)
+}
+
+// SetSecret sets a value for a given key and marks it as secret
+func (r *settingsRepository) SetSecret(ctx context.Context, key string, value string, actor interfaces.SettingActor) error {
+	return r.upsert(ctx, key, value, true, nil, actor)
+}
+
+// SetIfVersion sets a value for a given key if it is still at version, 0 for a key that has not been set
+func (r *settingsRepository) SetIfVersion(ctx context.Context, key string, value string, secret bool, version uint, actor interfaces.SettingActor) error {
+	return r.upsert(ctx, key, value, secret, &version, actor)
+}
+
+// MarkSecret marks an existing key as secret, encrypting its current value and redacting the values in its history
+func (r *settingsRepository) MarkSecret(ctx context.Context, key string) error {
+	err := database.Conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var existing setting
+		if err := tx.Where(&setting{Key: key}).First(&existing).Error; err != nil {
+			return err
+		}
+		if existing.Secret {
+			return nil
+		}
+		if err := r.write(tx, key, &existing, existing.Value, true, nil); err != nil {
+			return err
+		}
+		// the history holds every value the setting had in plaintext, they must not outlive the plaintext setting
+		return tx.Model(&settingChange{}).Where(&settingChange{Key: key}).
+			Updates(map[string]interface{}{"old_value": "", "new_value": "", "secret": true}).Error
+	})
+	return database.MapError(err)
+}
+
+// RewrapSecrets re-wraps every secret that is not wrapped by the current key encryption key
+func (r *settingsRepository) RewrapSecrets(ctx context.Context) (int, error) {
+	rewrapped := 0
+	err := database.Conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var secrets []setting
+		if err := tx.Where("secret = ?", true).Find(&secrets).Error; err != nil {
+			return err
+		}
+		for _, secret := range secrets {
+			value, changed, err := r.cipher.Rewrap(secret.Value)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			if err := tx.Model(&secret).Update("value", value).Error; err != nil {
+				return err
+			}
+			rewrapped++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, database.MapError(err)
+	}
+	return rewrapped, nil
+}
+
+// GetAll retrieves every stored setting, decrypting secrets
+func (r *settingsRepository) GetAll(ctx context.Context) (map[string]string, error) {
+	var settings []setting
+	if err := database.Conn(ctx, r.db).Find(&settings).Error; err != nil {
+		return nil, database.MapError(err)
+	}
+	values := make(map[string]string, len(settings))
+	for _, setting := range settings {
+		value := setting.Value
+		if setting.Secret {
+			decrypted, err := r.cipher.Decrypt(value, setting.Key)
+			if err != nil {
+				return nil, err
+			}
+			value = decrypted
+		}
+		values[setting.Key] = value
+	}
+	return values, nil
+}
+
+// GetHistory retrieves the recorded changes of a setting, newest first
+func (r *settingsRepository) GetHistory(ctx context.Context, key string) ([]interfaces.SettingChange, error) {
+	var changes []settingChange
+	if err := database.Conn(ctx, r.db).Where(&settingChange{Key: key}).Order("id desc").Find(&changes).Error; err != nil {
+		return nil, database.MapError(err)
+	}
+	retChanges := make([]interfaces.SettingChange, len(changes))
+	for i, change := range changes {
+		retChanges[i] = change.ToDTO()
+	}
+	return retChanges, nil
+}
+
+// GetChange retrieves a single recorded change
+func (r *settingsRepository) GetChange(ctx context.Context, id uint) (*interfaces.SettingChange, error) {
+	var change settingChange
+	if err := database.Conn(ctx, r.db).First(&change, id).Error; err != nil {
+		return nil, database.MapError(err)
+	}
+	retChange := change.ToDTO()
+	return &retChange, nil
+}
+
+// GetChangesByActor retrieves the recorded changes made by a user, newest first
+func (r *settingsRepository) GetChangesByActor(ctx context.Context, userID uint) ([]interfaces.SettingChange, error) {
+	var changes []settingChange
+	if err := database.Conn(ctx, r.db).Where(&settingChange{ActorID: &userID}).Order("id desc").Find(&changes).Error; err != nil {
+		return nil, database.MapError(err)
+	}
+	retChanges := make([]interfaces.SettingChange, len(changes))
+	for i, change := range changes {
+		retChanges[i] = change.ToDTO()
+	}
+	return retChanges, nil
+}
+
+// ReplaceActor replaces the actor of every change made by a user and clears their ID
+func (r *settingsRepository) ReplaceActor(ctx context.Context, userID uint, replacement string) error {
+	err := database.Conn(ctx, r.db).Model(&settingChange{}).Where(&settingChange{ActorID: &userID}).
+		Updates(map[string]interface{}{"actor": replacement, "actor_id": nil}).Error
+	return database.MapError(err)
+}
+
+// upsert writes a setting and appends the change to its history in one transaction,
+// writing the current value again records nothing
+// - markSecret: marks the setting as secret, settings that are already secret stay secret
+// - version: the version the setting must be at, 0 if it must not be set yet, nil to write whatever version it is at
+func (r *settingsRepository) upsert(ctx context.Context, key string, value string, markSecret bool, version *uint, actor interfaces.SettingActor) error {
+	err := database.Conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		return r.upsertTx(tx, key, value, markSecret, version, actor)
+	})
+	return database.MapError(err)
+}
+
+// upsertTx is upsert within an existing transaction
+func (r *settingsRepository) upsertTx(tx *gorm.DB, key string, value string, markSecret bool, version *uint, actor interfaces.SettingActor) error {
+	var existing setting
+	err := tx.Where(&setting{Key: key}).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	found := err == nil
+	if version != nil && existing.Version != *version {
+		return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+	}
+	secret := markSecret || existing.Secret
+	oldValue := existing.Value
+	if existing.Secret {
+		if oldValue, err = r.cipher.Decrypt(existing.Value, key); err != nil {
+			return err
+		}
+	}
+	if found && oldValue == value && existing.Secret == secret {
+		return nil
+	}
+	stored := &existing
+	if !found {
+		stored = nil
+	}
+	if err := r.write(tx, key, stored, value, secret, version); err != nil {
+		return err
+	}
+	change := settingChange{
+		Key:       key,
+		OldValue:  oldValue,
+		NewValue:  value,
+		Secret:    secret,
+		Actor:     actor.Username,
+		RequestID: actor.RequestID,
+	}
+	if actor.UserID != 0 {
+		change.ActorID = &actor.UserID
+	}
+	if secret {
+		change.OldValue = ""
+		change.NewValue = ""
+	}
+	return tx.Create(&change).Error
+}
+
+// write stores a setting, encrypting the value when the setting is secret, and increments its version
+// - existing: the stored setting, nil if the key has not been set
+// - version: the version the setting must be at, nil to write whatever version it is at
+func (r *settingsRepository) write(db *gorm.DB, key string, existing *setting, value string, secret bool, version *uint) error {
+	if secret {
+		encrypted, err := r.cipher.Encrypt(value, key)
+		if err != nil {
+			return err
+		}
+		value = encrypted
+	}
+	if existing == nil {
+		created := setting{Key: key, Value: value, Secret: secret, Version: 1}
+		if version != nil {
+			// another writer creating the key first is a conflict
+			err := db.Create(&created).Error
+			var conflict *interfaces.ConflictError
+			if errors.As(database.MapError(err), &conflict) {
+				return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+			}
+			return err
+		}
+		return db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: append(clause.AssignmentColumns([]string{"value", "secret"}), clause.Assignment{
+				Column: clause.Column{Name: "version"},
+				// qualified so it reads the existing row on every backend
+				Value: gorm.Expr("? + 1", clause.Column{Table: setting{}.TableName(), Name: "version"}),
+			}),
+		}).Create(&created).Error
+	}
+	// compare and swap on the version so a setting that changed since it was loaded is not overwritten
+	query := db.Model(&setting{}).Where("id = ?", existing.ID)
+	if version != nil {
+		query = query.Where("version = ?", *version)
+	}
+	result := query.Updates(map[string]interface{}{"value": value, "secret": secret, "version": gorm.Expr("version + 1")})
+	if result.Error != nil {
+		return result.Error
+	}
+	if version != nil && result.RowsAffected == 0 {
+		return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+	}
+	return nil
 }
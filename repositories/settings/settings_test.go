@@ -0,0 +1,49 @@
+package settings
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/database/dbtest"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/bryopsida/gofiber-pug-starter/repositories/repotest"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var actor = interfaces.SettingActor{Username: "tester", RequestID: "request"}
+
+func TestSettingsRepository(t *testing.T) {
+	for _, backend := range dbtest.Backends() {
+		t.Run(backend.Driver, func(t *testing.T) {
+			repotest.SettingsRepository(t, func(t *testing.T) interfaces.ISettingsRepository {
+				db, cipher := dbtest.Open(t, backend)
+				return NewSettingsRepository(db, cipher)
+			})
+		})
+	}
+}
+
+func TestMemorySettingsRepository(t *testing.T) {
+	repotest.SettingsRepository(t, func(t *testing.T) interfaces.ISettingsRepository {
+		return NewMemorySettingsRepository()
+	})
+}
+
+func TestSettingsRepositoryEncryptsSecrets(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *gorm.DB, cipher interfaces.ISecretCipher) {
+		ctx := context.Background()
+		repo := NewSettingsRepository(db, cipher)
+
+		assert.NoError(t, repo.SetSecret(ctx, "token", "hunter2", actor))
+		var stored setting
+		assert.NoError(t, db.Where(&setting{Key: "token"}).First(&stored).Error)
+		assert.True(t, cipher.IsEncrypted(stored.Value), "secrets are encrypted at rest")
+
+		assert.NoError(t, repo.Set(ctx, "name", "app", actor))
+		assert.NoError(t, repo.MarkSecret(ctx, "name"))
+		var marked setting
+		assert.NoError(t, db.Where(&setting{Key: "name"}).First(&marked).Error)
+		assert.True(t, cipher.IsEncrypted(marked.Value), "marking a setting secret encrypts its value")
+	})
+}
@@ -0,0 +1,104 @@
+package tokens
+
+import (
+	"context"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/database"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"gorm.io/gorm"
+)
+
+type userToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Purpose   string `gorm:"index;not null"`
+	TokenHash string `gorm:"uniqueIndex;not null"`
+	Data      string
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+func (userToken) TableName() string {
+	return "user_tokens"
+}
+
+type userTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewUserTokenRepository creates a new userTokenRepository instance
+func NewUserTokenRepository(db *gorm.DB) interfaces.IUserTokenRepository {
+	return &userTokenRepository{db: db}
+}
+
+func (userTokenRepository) FromDTO(tokenDTO interfaces.UserToken) userToken {
+	return userToken{
+		ID:        tokenDTO.ID,
+		UserID:    tokenDTO.UserID,
+		Purpose:   tokenDTO.Purpose,
+		TokenHash: tokenDTO.TokenHash,
+		Data:      tokenDTO.Data,
+		ExpiresAt: tokenDTO.ExpiresAt,
+		CreatedAt: tokenDTO.CreatedAt,
+	}
+}
+
+func (userTokenRepository) ToDTO(token userToken) interfaces.UserToken {
+	return interfaces.UserToken{
+		ID:        token.ID,
+		UserID:    token.UserID,
+		Purpose:   token.Purpose,
+		TokenHash: token.TokenHash,
+		Data:      token.Data,
+		ExpiresAt: token.ExpiresAt,
+		CreatedAt: token.CreatedAt,
+	}
+}
+
+func (r *userTokenRepository) CreateToken(ctx context.Context, token *interfaces.UserToken) error {
+	tokenDb := r.FromDTO(*token)
+	if err := database.Conn(ctx, r.db).Create(&tokenDb).Error; err != nil {
+		return database.MapError(err)
+	}
+	*token = r.ToDTO(tokenDb)
+	return nil
+}
+
+func (r *userTokenRepository) GetTokenByHash(ctx context.Context, purpose string, tokenHash string) (*interfaces.UserToken, error) {
+	var token userToken
+	err := database.Conn(ctx, r.db).Where("purpose = ? AND token_hash = ?", purpose, tokenHash).First(&token).Error
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+	var retToken = r.ToDTO(token)
+	return &retToken, nil
+}
+
+func (r *userTokenRepository) DeleteToken(ctx context.Context, id uint, tokenHash string, now time.Time) (int64, error) {
+	result := database.Conn(ctx, r.db).Where("id = ? AND token_hash = ? AND expires_at > ?", id, tokenHash, now).Delete(&userToken{})
+	if result.Error != nil {
+		return 0, database.MapError(result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func (r *userTokenRepository) DeleteTokensForUser(ctx context.Context, userID uint, purpose string) error {
+	return database.MapError(database.Conn(ctx, r.db).Where("user_id = ? AND purpose = ?", userID, purpose).Delete(&userToken{}).Error)
+}
+
+func (r *userTokenRepository) GetTokensForUser(ctx context.Context, userID uint) ([]interfaces.UserToken, error) {
+	var tokens []userToken
+	if err := database.Conn(ctx, r.db).Where("user_id = ?", userID).Order("id").Find(&tokens).Error; err != nil {
+		return nil, database.MapError(err)
+	}
+	retTokens := make([]interfaces.UserToken, len(tokens))
+	for i, token := range tokens {
+		retTokens[i] = r.ToDTO(token)
+	}
+	return retTokens, nil
+}
+
+func (r *userTokenRepository) DeleteAllTokensForUser(ctx context.Context, userID uint) error {
+	return database.MapError(database.Conn(ctx, r.db).Where("user_id = ?", userID).Delete(&userToken{}).Error)
+}
@@ -0,0 +1,51 @@
+package tokens
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/database/dbtest"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestUserTokenRepository(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *gorm.DB, _ interfaces.ISecretCipher) {
+		ctx := context.Background()
+		repo := NewUserTokenRepository(db)
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+		reset := &interfaces.UserToken{UserID: 1, Purpose: "reset", TokenHash: "a", ExpiresAt: expiresAt}
+		assert.NoError(t, repo.CreateToken(ctx, reset))
+		assert.NoError(t, repo.CreateToken(ctx, &interfaces.UserToken{UserID: 1, Purpose: "verify", TokenHash: "b", Data: "jane@example.com", ExpiresAt: expiresAt}))
+		assert.Error(t, repo.CreateToken(ctx, &interfaces.UserToken{UserID: 2, Purpose: "reset", TokenHash: "a", ExpiresAt: expiresAt}), "token hashes are unique")
+
+		token, err := repo.GetTokenByHash(ctx, "reset", "a")
+		assert.NoError(t, err)
+		assert.Equal(t, reset.ID, token.ID)
+		assert.True(t, expiresAt.Equal(token.ExpiresAt))
+		_, err = repo.GetTokenByHash(ctx, "verify", "a")
+		assert.ErrorIs(t, err, interfaces.ErrNotFound, "tokens are only found for their purpose")
+
+		deleted, err := repo.DeleteToken(ctx, reset.ID, "a", expiresAt.Add(time.Second))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), deleted, "expired tokens are not deleted")
+		deleted, err = repo.DeleteToken(ctx, reset.ID, "b", time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), deleted, "the hash must match the id")
+
+		assert.NoError(t, repo.DeleteTokensForUser(ctx, 1, "reset"))
+		tokens, err := repo.GetTokensForUser(ctx, 1)
+		assert.NoError(t, err)
+		if assert.Len(t, tokens, 1) {
+			assert.Equal(t, "jane@example.com", tokens[0].Data)
+		}
+
+		assert.NoError(t, repo.DeleteAllTokensForUser(ctx, 1))
+		tokens, err = repo.GetTokensForUser(ctx, 1)
+		assert.NoError(t, err)
+		assert.Empty(t, tokens)
+	})
+}
@@ -0,0 +1,155 @@
+package users
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// memoryUserRepository keeps users in memory, it is meant for tests and does not take part in transactions
+type memoryUserRepository struct {
+	mu     sync.RWMutex
+	users  map[uint]interfaces.User
+	nextID uint
+}
+
+// NewMemoryUserRepository creates an empty in-memory user repository
+func NewMemoryUserRepository() interfaces.IUserRepository {
+	return &memoryUserRepository{users: map[uint]interfaces.User{}, nextID: 1}
+}
+
+// detach copies the deletion time so a stored user does not share it with the caller
+func detach(user interfaces.User) interfaces.User {
+	if user.DeleteAfter != nil {
+		deleteAfter := *user.DeleteAfter
+		user.DeleteAfter = &deleteAfter
+	}
+	return user
+}
+
+// conflict returns a ConflictError when another user already has the username or email of a user
+func (r *memoryUserRepository) conflict(user *interfaces.User, pending []*interfaces.User) error {
+	others := make([]interfaces.User, 0, len(r.users)+len(pending))
+	for id, existing := range r.users {
+		if id != user.ID {
+			others = append(others, existing)
+		}
+	}
+	for _, other := range pending {
+		others = append(others, *other)
+	}
+	for _, other := range others {
+		if other.Username == user.Username {
+			return &interfaces.ConflictError{Field: "username"}
+		}
+		if other.Email == user.Email {
+			return &interfaces.ConflictError{Field: "email"}
+		}
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) CreateUser(ctx context.Context, user *interfaces.User) error {
+	return r.CreateUsers(ctx, []*interfaces.User{user})
+}
+
+func (r *memoryUserRepository) CreateUsers(ctx context.Context, users []*interfaces.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// every user is checked before any is stored so either all are created or none are
+	for i, user := range users {
+		if err := r.conflict(user, users[:i]); err != nil {
+			return err
+		}
+	}
+	for _, user := range users {
+		user.ID = r.nextID
+		user.Version = 1
+		r.nextID++
+		r.users[user.ID] = detach(*user)
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) find(match func(user *interfaces.User) bool) (*interfaces.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, user := range r.users {
+		if match(&user) {
+			found := detach(user)
+			return &found, nil
+		}
+	}
+	return nil, interfaces.ErrNotFound
+}
+
+func (r *memoryUserRepository) GetUserByID(ctx context.Context, id uint) (*interfaces.User, error) {
+	return r.find(func(user *interfaces.User) bool { return user.ID == id })
+}
+
+func (r *memoryUserRepository) GetUserByUsername(ctx context.Context, username string) (*interfaces.User, error) {
+	return r.find(func(user *interfaces.User) bool { return user.Username == username })
+}
+
+func (r *memoryUserRepository) GetUserByEmail(ctx context.Context, email string) (*interfaces.User, error) {
+	return r.find(func(user *interfaces.User) bool { return user.Email == email })
+}
+
+// sorted returns a copy of the users ordered by ID, so callbacks can run without holding the lock
+func (r *memoryUserRepository) sorted() []interfaces.User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	users := make([]interfaces.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, detach(user))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+func (r *memoryUserRepository) ForEachUser(ctx context.Context, fn func(user *interfaces.User) error) error {
+	for _, user := range r.sorted() {
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) GetUsersDueForDeletion(ctx context.Context, before time.Time) ([]*interfaces.User, error) {
+	due := []*interfaces.User{}
+	for _, user := range r.sorted() {
+		if user.DeleteAfter != nil && !user.DeleteAfter.After(before) {
+			due = append(due, &user)
+		}
+	}
+	return due, nil
+}
+
+func (r *memoryUserRepository) UpdateUser(ctx context.Context, user *interfaces.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.users[user.ID]
+	if !ok {
+		return interfaces.ErrNotFound
+	}
+	if stored.Version != user.Version {
+		return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+	}
+	if err := r.conflict(user, nil); err != nil {
+		return err
+	}
+	user.Version++
+	r.users[user.ID] = detach(*user)
+	return nil
+}
+
+func (r *memoryUserRepository) DeleteUser(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.users, id)
+	return nil
+}
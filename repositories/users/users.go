@@ -1,16 +1,25 @@
 package users
 
 import (
+	"context"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/database"
 	"github.com/bryopsida/gofiber-pug-starter/interfaces"
 	"gorm.io/gorm"
 )
 
 type user struct {
-	ID           uint   `gorm:"primaryKey"`
-	Username     string `gorm:"uniqueIndex;not null"`
-	Email        string `gorm:"uniqueIndex;not null"`
-	Role         string `gorm:"not null"`
-	PasswordHash string `gorm:"not null"`
+	ID           uint       `gorm:"primaryKey"`
+	Username     string     `gorm:"uniqueIndex;not null"`
+	Email        string     `gorm:"uniqueIndex;not null"`
+	Role         string     `gorm:"not null"`
+	PasswordHash string     `gorm:"not null"`
+	FirstName    string     `gorm:"not null;default:''"`
+	LastName     string     `gorm:"not null;default:''"`
+	AvatarKey    string     `gorm:"not null;default:''"`
+	DeleteAfter  *time.Time `gorm:"index"`
+	Version      uint       `gorm:"not null;default:1"`
 }
 
 // Optionally, set a custom table name
@@ -34,6 +43,11 @@ func (userRepository) FromDTO(userDTO interfaces.User) user {
 		Email:        userDTO.Email,
 		Role:         userDTO.Role,
 		PasswordHash: userDTO.PasswordHash,
+		FirstName:    userDTO.FirstName,
+		LastName:     userDTO.LastName,
+		AvatarKey:    userDTO.AvatarKey,
+		DeleteAfter:  userDTO.DeleteAfter,
+		Version:      userDTO.Version,
 	}
 }
 
@@ -44,39 +58,122 @@ func (userRepository) ToDTO(user user) interfaces.User {
 		Email:        user.Email,
 		Role:         user.Role,
 		PasswordHash: user.PasswordHash,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		AvatarKey:    user.AvatarKey,
+		DeleteAfter:  user.DeleteAfter,
+		Version:      user.Version,
 	}
 }
 
-func (r *userRepository) CreateUser(user *interfaces.User) error {
+func (r *userRepository) CreateUser(ctx context.Context, user *interfaces.User) error {
 	userDb := r.FromDTO(*user)
-	return r.db.Create(userDb).Error
+	userDb.Version = 1
+	if err := database.Conn(ctx, r.db).Create(&userDb).Error; err != nil {
+		return database.MapError(err)
+	}
+	user.ID = userDb.ID
+	user.Version = userDb.Version
+	return nil
+}
+
+func (r *userRepository) CreateUsers(ctx context.Context, users []*interfaces.User) error {
+	err := database.Conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		for _, dto := range users {
+			userDb := r.FromDTO(*dto)
+			userDb.Version = 1
+			if err := tx.Create(&userDb).Error; err != nil {
+				return err
+			}
+			dto.ID = userDb.ID
+			dto.Version = userDb.Version
+		}
+		return nil
+	})
+	return database.MapError(err)
+}
+
+func (r *userRepository) GetUserByID(ctx context.Context, id uint) (*interfaces.User, error) {
+	var user user
+	err := database.Conn(ctx, r.db).First(&user, id).Error
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+	var retUser = r.ToDTO(user)
+	return &retUser, nil
 }
 
-func (r *userRepository) GetUserByID(id uint) (*interfaces.User, error) {
+func (r *userRepository) GetUserByUsername(ctx context.Context, username string) (*interfaces.User, error) {
 	var user user
-	err := r.db.First(&user, id).Error
+	err := database.Conn(ctx, r.db).Where("username = ?", username).First(&user).Error
 	if err != nil {
-		return nil, err
+		return nil, database.MapError(err)
 	}
 	var retUser = r.ToDTO(user)
 	return &retUser, nil
 }
 
-func (r *userRepository) GetUserByUsername(username string) (*interfaces.User, error) {
+func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*interfaces.User, error) {
 	var user user
-	err := r.db.Where("username = ?", username).First(&user).Error
+	err := database.Conn(ctx, r.db).Where("email = ?", email).First(&user).Error
 	if err != nil {
-		return nil, err
+		return nil, database.MapError(err)
 	}
 	var retUser = r.ToDTO(user)
 	return &retUser, nil
 }
 
-func (r *userRepository) UpdateUser(user *interfaces.User) error {
-	dbuser := r.FromDTO(*user)
-	return r.db.Save(dbuser).Error
+func (r *userRepository) ForEachUser(ctx context.Context, fn func(user *interfaces.User) error) error {
+	var batch []user
+	var fnErr error
+	err := database.Conn(ctx, r.db).Order("id").FindInBatches(&batch, 100, func(tx *gorm.DB, _ int) error {
+		for _, dbUser := range batch {
+			dto := r.ToDTO(dbUser)
+			if fnErr = fn(&dto); fnErr != nil {
+				return fnErr
+			}
+		}
+		return nil
+	}).Error
+	if fnErr != nil {
+		return fnErr
+	}
+	return database.MapError(err)
+}
+
+func (r *userRepository) GetUsersDueForDeletion(ctx context.Context, before time.Time) ([]*interfaces.User, error) {
+	var users []user
+	err := database.Conn(ctx, r.db).Where("delete_after IS NOT NULL AND delete_after <= ?", before).Find(&users).Error
+	if err != nil {
+		return nil, database.MapError(err)
+	}
+	retUsers := make([]*interfaces.User, len(users))
+	for i := range users {
+		dto := r.ToDTO(users[i])
+		retUsers[i] = &dto
+	}
+	return retUsers, nil
+}
+
+func (r *userRepository) UpdateUser(ctx context.Context, dto *interfaces.User) error {
+	dbuser := r.FromDTO(*dto)
+	dbuser.Version++
+	db := database.Conn(ctx, r.db)
+	// compare and swap on the version so a user that changed since it was loaded is not overwritten
+	result := db.Model(&dbuser).Where("version = ?", dto.Version).Select("*").Updates(&dbuser)
+	if result.Error != nil {
+		return database.MapError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		if err := db.Select("id").First(&user{}, dto.ID).Error; err != nil {
+			return database.MapError(err)
+		}
+		return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+	}
+	dto.Version = dbuser.Version
+	return nil
 }
 
-func (r *userRepository) DeleteUser(id uint) error {
-	return r.db.Delete(&user{}, id).Error
+func (r *userRepository) DeleteUser(ctx context.Context, id uint) error {
+	return database.MapError(database.Conn(ctx, r.db).Delete(&user{}, id).Error)
 }
@@ -0,0 +1,26 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/database/dbtest"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/bryopsida/gofiber-pug-starter/repositories/repotest"
+)
+
+func TestUserRepository(t *testing.T) {
+	for _, backend := range dbtest.Backends() {
+		t.Run(backend.Driver, func(t *testing.T) {
+			repotest.UserRepository(t, func(t *testing.T) interfaces.IUserRepository {
+				db, _ := dbtest.Open(t, backend)
+				return NewUserRepository(db)
+			})
+		})
+	}
+}
+
+func TestMemoryUserRepository(t *testing.T) {
+	repotest.UserRepository(t, func(t *testing.T) interfaces.IUserRepository {
+		return NewMemoryUserRepository()
+	})
+}
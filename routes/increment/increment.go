@@ -11,9 +11,9 @@ func RegisterRoutes(app *fiber.App, service interfaces.IIncrementService) {
 
 	app.Post("/increment", func(c *fiber.Ctx) error {
 		id := c.Query("id")
-		number, err := service.Increment(id)
+		number, err := service.Increment(c.UserContext(), id)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			return err
 		}
 		return c.JSON(fiber.Map{"number": number})
 	})
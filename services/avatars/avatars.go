@@ -0,0 +1,167 @@
+package avatars
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// avatarSize is the width and height avatars are resized to
+	avatarSize = 128
+	// maxUploadBytes is the largest upload accepted
+	maxUploadBytes = 5 << 20
+	// maxSourceDimension bounds the decoded size of an upload to avoid decompression bombs
+	maxSourceDimension = 4096
+	keyPrefix          = "avatars/"
+)
+
+type avatarService struct {
+	storage      interfaces.IBlobStorage
+	usersService interfaces.IUsersService
+	transactions interfaces.ITransactionManager
+}
+
+// NewAvatarService creates a new avatarService instance
+// - storage: where the resized avatars are stored
+// - usersService: used to record the avatar key against the user
+// - transactions: defers deleting erased avatars until the erasure commits
+func NewAvatarService(storage interfaces.IBlobStorage, usersService interfaces.IUsersService, transactions interfaces.ITransactionManager) interfaces.IAvatarService {
+	return &avatarService{storage: storage, usersService: usersService, transactions: transactions}
+}
+
+// resize crops the center square of the image and scales it to avatarSize
+func resize(src image.Image) image.Image {
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x, y, x+side, y+side)
+
+	dst := image.NewRGBA(image.Rect(0, 0, avatarSize, avatarSize))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+	return dst
+}
+
+func (s *avatarService) SetAvatar(ctx context.Context, user *interfaces.User, r io.Reader) error {
+	data, err := io.ReadAll(io.LimitReader(r, maxUploadBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxUploadBytes {
+		return interfaces.ErrInvalidImage
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width > maxSourceDimension || config.Height > maxSourceDimension {
+		return interfaces.ErrInvalidImage
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return interfaces.ErrInvalidImage
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, resize(img)); err != nil {
+		return err
+	}
+	// the key is derived from the content so it can be cached forever
+	sum := sha256.Sum256(encoded.Bytes())
+	key := fmt.Sprintf("%s%d-%s.png", keyPrefix, user.ID, hex.EncodeToString(sum[:8]))
+	if err := s.storage.Put(key, &encoded); err != nil {
+		return err
+	}
+
+	previousKey := user.AvatarKey
+	user.AvatarKey = key
+	if err := s.usersService.UpdateUser(ctx, user); err != nil {
+		user.AvatarKey = previousKey
+		if deleteErr := s.storage.Delete(key); deleteErr != nil {
+			slog.Warn("Failed to clean up avatar", "key", key, "error", deleteErr)
+		}
+		return err
+	}
+	if previousKey != "" && previousKey != key {
+		if err := s.storage.Delete(previousKey); err != nil {
+			slog.Warn("Failed to delete previous avatar", "key", previousKey, "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *avatarService) RemoveAvatar(ctx context.Context, user *interfaces.User) error {
+	if user.AvatarKey == "" {
+		return nil
+	}
+	previousKey := user.AvatarKey
+	user.AvatarKey = ""
+	if err := s.usersService.UpdateUser(ctx, user); err != nil {
+		user.AvatarKey = previousKey
+		return err
+	}
+	return s.storage.Delete(previousKey)
+}
+
+func (s *avatarService) OpenAvatar(key string) (io.ReadCloser, *interfaces.BlobInfo, error) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return nil, nil, interfaces.ErrNotFound
+	}
+	return s.storage.Open(key)
+}
+
+func (s *avatarService) PersonalDataName() string {
+	return "avatar"
+}
+
+func (s *avatarService) ExportPersonalData(ctx context.Context, userID uint) ([]interfaces.PersonalDataFile, error) {
+	user, err := s.usersService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.AvatarKey == "" {
+		return nil, nil
+	}
+	reader, _, err := s.storage.Open(user.AvatarKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return []interfaces.PersonalDataFile{{Name: "avatar.png", Content: content}}, nil
+}
+
+func (s *avatarService) ErasePersonalData(ctx context.Context, userID uint) error {
+	user, err := s.usersService.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.AvatarKey == "" {
+		return nil
+	}
+	// the blob cannot be restored if the erasure rolls back, so it is only deleted once the erasure commits,
+	// a failed delete leaves an orphaned blob the user record no longer points to
+	key := user.AvatarKey
+	s.transactions.AfterCommit(ctx, func() {
+		if err := s.storage.Delete(key); err != nil {
+			slog.Error("Failed to delete erased avatar", "key", key, "error", err)
+		}
+	})
+	return nil
+}
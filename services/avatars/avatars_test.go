@@ -0,0 +1,92 @@
+package avatars
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStorage keeps blobs in memory
+type fakeStorage struct {
+	blobs map[string][]byte
+}
+
+func (s *fakeStorage) Put(key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	s.blobs[key] = data
+	return err
+}
+
+func (s *fakeStorage) Open(key string) (io.ReadCloser, *interfaces.BlobInfo, error) {
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, nil, interfaces.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), &interfaces.BlobInfo{Size: int64(len(data))}, nil
+}
+
+func (s *fakeStorage) Delete(key string) error {
+	delete(s.blobs, key)
+	return nil
+}
+
+// fakeUsersService embeds the interface so only the methods used by the avatar service need implementing
+type fakeUsersService struct {
+	interfaces.IUsersService
+	user interfaces.User
+}
+
+func (s *fakeUsersService) GetUserByID(ctx context.Context, id uint) (*interfaces.User, error) {
+	copied := s.user
+	return &copied, nil
+}
+
+// fakeTransactions runs the hooks registered with AfterCommit once the work succeeds, like a commit
+type fakeTransactions struct {
+	hooks []func()
+}
+
+func (f *fakeTransactions) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.hooks = nil
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	for _, hook := range f.hooks {
+		hook()
+	}
+	return nil
+}
+
+func (f *fakeTransactions) AfterCommit(ctx context.Context, fn func()) {
+	f.hooks = append(f.hooks, fn)
+}
+
+func TestErasePersonalDataDeletesTheAvatarOnCommit(t *testing.T) {
+	ctx := context.Background()
+	key := keyPrefix + "1-abc.png"
+	storage := &fakeStorage{blobs: map[string][]byte{key: []byte("png")}}
+	transactions := &fakeTransactions{}
+	service := NewAvatarService(storage, &fakeUsersService{user: interfaces.User{ID: 1, AvatarKey: key}}, transactions)
+
+	failed := errors.New("a later provider failed")
+	err := transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := service.ErasePersonalData(ctx, 1); err != nil {
+			return err
+		}
+		assert.Contains(t, storage.blobs, key, "the avatar is kept until the erasure commits")
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	assert.Contains(t, storage.blobs, key, "a rolled back erasure keeps the avatar")
+
+	err = transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+		return service.ErasePersonalData(ctx, 1)
+	})
+	assert.NoError(t, err)
+	assert.NotContains(t, storage.blobs, key)
+}
@@ -0,0 +1,49 @@
+package flags
+
+import (
+	"github.com/bryopsida/gofiber-pug-starter/auth"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/gofiber/fiber/v2"
+)
+
+// flagsLocal is the request local Middleware stores the flags service in
+const flagsLocal = "featureFlags"
+
+// Middleware makes the flags service available to Enabled and RequireFlag for every request
+// - flags: the flags service to evaluate with
+func Middleware(flags interfaces.IFeatureFlagService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(flagsLocal, flags)
+		return c.Next()
+	}
+}
+
+// subjectOf returns the subject flags are evaluated for, nil for anonymous visitors
+func subjectOf(user *interfaces.User) *interfaces.FlagSubject {
+	if user == nil {
+		return nil
+	}
+	return &interfaces.FlagSubject{UserID: user.ID, Role: user.Role}
+}
+
+// Enabled evaluates a flag for the current user of the request, flags are off when Middleware was not added
+// - key: the flag key
+func Enabled(c *fiber.Ctx, key string) bool {
+	flags, ok := c.Locals(flagsLocal).(interfaces.IFeatureFlagService)
+	if !ok {
+		return false
+	}
+	return flags.IsEnabled(key, subjectOf(auth.CurrentUser(c)))
+}
+
+// RequireFlag returns a handler that redirects to the not found page while a flag is off for the current user,
+// so routes of dark features do not reveal they exist
+// - key: the flag key
+func RequireFlag(key string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !Enabled(c, key) {
+			return c.Redirect("/404")
+		}
+		return c.Next()
+	}
+}
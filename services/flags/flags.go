@@ -0,0 +1,261 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+var flagKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+var roles = map[string]bool{
+	interfaces.RoleAdmin:  true,
+	interfaces.RoleUser:   true,
+	interfaces.RoleViewer: true,
+}
+
+// evaluations counts the results of a single flag
+type evaluations struct {
+	on  atomic.Uint64
+	off atomic.Uint64
+}
+
+type flagsService struct {
+	repo     interfaces.IFeatureFlagRepository
+	settings interfaces.ISettingsService
+
+	mu     sync.RWMutex
+	flags  map[string]interfaces.FeatureFlag
+	groups map[string]map[uint]bool
+	counts map[string]*evaluations
+}
+
+// NewFeatureFlagService creates a new flagsService instance and loads the flags,
+// flags evaluate as off until they can be loaded
+// - repo: the repository flags are stored in
+// - settings: provides the groups flags can target
+func NewFeatureFlagService(repo interfaces.IFeatureFlagRepository, settings interfaces.ISettingsService) interfaces.IFeatureFlagService {
+	service := &flagsService{
+		repo:     repo,
+		settings: settings,
+		flags:    map[string]interfaces.FeatureFlag{},
+		counts:   map[string]*evaluations{},
+	}
+	ctx := context.Background()
+	if err := service.Refresh(ctx); err != nil {
+		slog.Error("Failed to load feature flags", "error", err)
+	}
+	service.loadGroups(ctx)
+	// subscribers are notified after the new value is cached so it is not read from the database
+	settings.Subscribe(interfaces.SettingFeatureFlagGroups, func(key string) {
+		service.loadGroups(context.Background())
+	})
+	return service
+}
+
+func (s *flagsService) loadGroups(ctx context.Context) {
+	var members map[string][]uint
+	if err := s.settings.GetJSON(ctx, interfaces.SettingFeatureFlagGroups, &members); err != nil {
+		slog.Error("Failed to load feature flag groups", "error", err)
+		return
+	}
+	groups := map[string]map[uint]bool{}
+	for name, ids := range members {
+		groups[name] = map[uint]bool{}
+		for _, id := range ids {
+			groups[name][id] = true
+		}
+	}
+	s.mu.Lock()
+	s.groups = groups
+	s.mu.Unlock()
+}
+
+// bucket places a user in one of 100 buckets, the same user always lands in the same bucket for a flag
+// so raising the percentage only ever adds users
+func bucket(key string, userID uint) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key + ":" + strconv.FormatUint(uint64(userID), 10)))
+	return int(hash.Sum32() % 100)
+}
+
+// evaluate must be called with the read lock held
+func (s *flagsService) evaluate(flag *interfaces.FeatureFlag, subject *interfaces.FlagSubject) bool {
+	if !flag.Enabled {
+		return false
+	}
+	if subject != nil {
+		if slices.Contains(flag.UserIDs, subject.UserID) || slices.Contains(flag.Roles, subject.Role) {
+			return true
+		}
+		for _, group := range flag.Groups {
+			if s.groups[group][subject.UserID] {
+				return true
+			}
+		}
+	}
+	if flag.Percentage >= 100 {
+		return true
+	}
+	// anonymous visitors cannot be bucketed consistently so they only see fully rolled out flags
+	if subject == nil {
+		return false
+	}
+	return bucket(flag.Key, subject.UserID) < flag.Percentage
+}
+
+func (s *flagsService) IsEnabled(key string, subject *interfaces.FlagSubject) bool {
+	s.mu.RLock()
+	flag, ok := s.flags[key]
+	if !ok {
+		s.mu.RUnlock()
+		return false
+	}
+	enabled := s.evaluate(&flag, subject)
+	counts := s.counts[key]
+	s.mu.RUnlock()
+
+	if enabled {
+		counts.on.Add(1)
+	} else {
+		counts.off.Add(1)
+	}
+	return enabled
+}
+
+func (s *flagsService) Flags() []interfaces.FeatureFlag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	flags := make([]interfaces.FeatureFlag, 0, len(s.flags))
+	for _, flag := range s.flags {
+		flags = append(flags, flag)
+	}
+	slices.SortFunc(flags, func(a, b interfaces.FeatureFlag) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return flags
+}
+
+func (s *flagsService) Flag(key string) (*interfaces.FeatureFlag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	flag, ok := s.flags[key]
+	if !ok {
+		return nil, interfaces.ErrNotFound
+	}
+	return &flag, nil
+}
+
+func validate(flag *interfaces.FeatureFlag) error {
+	if !flagKeyPattern.MatchString(flag.Key) {
+		return fmt.Errorf("%w: key must be lower case letters, digits, dots, dashes or underscores", interfaces.ErrInvalidFeatureFlag)
+	}
+	if flag.Percentage < 0 || flag.Percentage > 100 {
+		return fmt.Errorf("%w: percentage must be between 0 and 100", interfaces.ErrInvalidFeatureFlag)
+	}
+	for _, role := range flag.Roles {
+		if !roles[role] {
+			return fmt.Errorf("%w: unknown role %q", interfaces.ErrInvalidFeatureFlag, role)
+		}
+	}
+	return nil
+}
+
+// store caches a saved flag, keeping the counts of a flag that already existed
+func (s *flagsService) store(flag interfaces.FeatureFlag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flags[flag.Key] = flag
+	if _, ok := s.counts[flag.Key]; !ok {
+		s.counts[flag.Key] = &evaluations{}
+	}
+}
+
+// save stores a flag, picking up the stored flag when it changed since it was loaded
+// so the cache does not keep serving the version that was overwritten
+func (s *flagsService) save(ctx context.Context, flag *interfaces.FeatureFlag) error {
+	err := s.repo.SaveFlag(ctx, flag)
+	var conflict *interfaces.ConflictError
+	if errors.As(err, &conflict) {
+		if stored, getErr := s.repo.GetFlag(ctx, flag.Key); getErr == nil {
+			s.store(*stored)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.store(*flag)
+	return nil
+}
+
+func (s *flagsService) SaveFlag(ctx context.Context, flag *interfaces.FeatureFlag) error {
+	if err := validate(flag); err != nil {
+		return err
+	}
+	return s.save(ctx, flag)
+}
+
+func (s *flagsService) SetEnabled(ctx context.Context, key string, enabled bool) error {
+	flag, err := s.Flag(key)
+	if err != nil {
+		return err
+	}
+	flag.Enabled = enabled
+	return s.save(ctx, flag)
+}
+
+func (s *flagsService) DeleteFlag(ctx context.Context, key string) error {
+	if err := s.repo.DeleteFlag(ctx, key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.flags, key)
+	delete(s.counts, key)
+	return nil
+}
+
+func (s *flagsService) Evaluations(key string) interfaces.FlagEvaluations {
+	s.mu.RLock()
+	counts, ok := s.counts[key]
+	s.mu.RUnlock()
+	if !ok {
+		return interfaces.FlagEvaluations{}
+	}
+	return interfaces.FlagEvaluations{On: counts.on.Load(), Off: counts.off.Load()}
+}
+
+func (s *flagsService) Refresh(ctx context.Context) error {
+	stored, err := s.repo.GetFlags(ctx)
+	if err != nil {
+		return err
+	}
+	flags := make(map[string]interfaces.FeatureFlag, len(stored))
+	for _, flag := range stored {
+		flags[flag.Key] = flag
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flags = flags
+	for key := range flags {
+		if _, ok := s.counts[key]; !ok {
+			s.counts[key] = &evaluations{}
+		}
+	}
+	for key := range s.counts {
+		if _, ok := flags[key]; !ok {
+			delete(s.counts, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFlagRepository keeps flags in a map
+type fakeFlagRepository struct {
+	flags map[string]interfaces.FeatureFlag
+}
+
+func (r *fakeFlagRepository) GetFlags(ctx context.Context) ([]interfaces.FeatureFlag, error) {
+	flags := []interfaces.FeatureFlag{}
+	for _, flag := range r.flags {
+		flags = append(flags, flag)
+	}
+	return flags, nil
+}
+
+func (r *fakeFlagRepository) GetFlag(ctx context.Context, key string) (*interfaces.FeatureFlag, error) {
+	flag, ok := r.flags[key]
+	if !ok {
+		return nil, interfaces.ErrNotFound
+	}
+	return &flag, nil
+}
+
+func (r *fakeFlagRepository) SaveFlag(ctx context.Context, flag *interfaces.FeatureFlag) error {
+	if r.flags[flag.Key].Version != flag.Version {
+		return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+	}
+	flag.Version++
+	r.flags[flag.Key] = *flag
+	return nil
+}
+
+func (r *fakeFlagRepository) DeleteFlag(ctx context.Context, key string) error {
+	delete(r.flags, key)
+	return nil
+}
+
+// fakeSettingsService embeds the interface so only the methods used by the flags service need implementing
+type fakeSettingsService struct {
+	interfaces.ISettingsService
+	groups      string
+	subscribers []func(key string)
+}
+
+func (s *fakeSettingsService) GetJSON(ctx context.Context, key string, target interface{}) error {
+	return json.Unmarshal([]byte(s.groups), target)
+}
+
+func (s *fakeSettingsService) Subscribe(key string, fn func(key string)) func() {
+	s.subscribers = append(s.subscribers, fn)
+	return func() {}
+}
+
+func newService(flags ...interfaces.FeatureFlag) (interfaces.IFeatureFlagService, *fakeFlagRepository, *fakeSettingsService) {
+	repo := &fakeFlagRepository{flags: map[string]interfaces.FeatureFlag{}}
+	for _, flag := range flags {
+		repo.flags[flag.Key] = flag
+	}
+	settings := &fakeSettingsService{groups: `{"beta": [7]}`}
+	return NewFeatureFlagService(repo, settings), repo, settings
+}
+
+func TestBooleanFlags(t *testing.T) {
+	service, _, _ := newService(
+		interfaces.FeatureFlag{Key: "on", Enabled: true, Percentage: 100},
+		interfaces.FeatureFlag{Key: "off", Enabled: false, Percentage: 100},
+	)
+
+	assert.True(t, service.IsEnabled("on", nil))
+	assert.True(t, service.IsEnabled("on", &interfaces.FlagSubject{UserID: 1}))
+	assert.False(t, service.IsEnabled("off", &interfaces.FlagSubject{UserID: 1}))
+	assert.False(t, service.IsEnabled("missing", nil))
+	assert.Equal(t, interfaces.FlagEvaluations{On: 2}, service.Evaluations("on"))
+	assert.Equal(t, interfaces.FlagEvaluations{Off: 1}, service.Evaluations("off"))
+}
+
+func TestPercentageRollout(t *testing.T) {
+	service, _, _ := newService(interfaces.FeatureFlag{Key: "rollout", Enabled: true, Percentage: 30})
+
+	on := 0
+	for id := uint(1); id <= 1000; id++ {
+		subject := &interfaces.FlagSubject{UserID: id}
+		enabled := service.IsEnabled("rollout", subject)
+		assert.Equal(t, enabled, service.IsEnabled("rollout", subject), "a user always gets the same result")
+		if enabled {
+			on++
+		}
+	}
+	assert.InDelta(t, 300, on, 60)
+	assert.False(t, service.IsEnabled("rollout", nil), "anonymous visitors only see fully rolled out flags")
+}
+
+func TestTargeting(t *testing.T) {
+	service, _, settings := newService(interfaces.FeatureFlag{
+		Key: "targeted", Enabled: true, Percentage: 0,
+		UserIDs: []uint{3}, Roles: []string{interfaces.RoleAdmin}, Groups: []string{"beta"},
+	})
+
+	assert.True(t, service.IsEnabled("targeted", &interfaces.FlagSubject{UserID: 3, Role: interfaces.RoleUser}))
+	assert.True(t, service.IsEnabled("targeted", &interfaces.FlagSubject{UserID: 4, Role: interfaces.RoleAdmin}))
+	assert.True(t, service.IsEnabled("targeted", &interfaces.FlagSubject{UserID: 7, Role: interfaces.RoleUser}))
+	assert.False(t, service.IsEnabled("targeted", &interfaces.FlagSubject{UserID: 8, Role: interfaces.RoleUser}))
+
+	settings.groups = `{"beta": [8]}`
+	settings.subscribers[0](interfaces.SettingFeatureFlagGroups)
+	assert.True(t, service.IsEnabled("targeted", &interfaces.FlagSubject{UserID: 8, Role: interfaces.RoleUser}))
+	assert.False(t, service.IsEnabled("targeted", &interfaces.FlagSubject{UserID: 7, Role: interfaces.RoleUser}))
+}
+
+func TestSaveFlag(t *testing.T) {
+	ctx := context.Background()
+	service, repo, _ := newService()
+
+	assert.ErrorIs(t, service.SaveFlag(ctx, &interfaces.FeatureFlag{Key: "Bad Key", Percentage: 100}), interfaces.ErrInvalidFeatureFlag)
+	assert.ErrorIs(t, service.SaveFlag(ctx, &interfaces.FeatureFlag{Key: "new-ui", Percentage: 101}), interfaces.ErrInvalidFeatureFlag)
+	assert.ErrorIs(t, service.SaveFlag(ctx, &interfaces.FeatureFlag{Key: "new-ui", Percentage: 100, Roles: []string{"root"}}), interfaces.ErrInvalidFeatureFlag)
+
+	assert.NoError(t, service.SaveFlag(ctx, &interfaces.FeatureFlag{Key: "new-ui", Percentage: 100}))
+	assert.False(t, service.IsEnabled("new-ui", nil))
+	assert.NoError(t, service.SetEnabled(ctx, "new-ui", true))
+	assert.True(t, service.IsEnabled("new-ui", nil))
+	assert.True(t, repo.flags["new-ui"].Enabled)
+	assert.ErrorIs(t, service.SetEnabled(ctx, "missing", true), interfaces.ErrNotFound)
+
+	// another instance changes the flag, saving the copy loaded before fails and picks up the change
+	stale, _ := service.Flag("new-ui")
+	changed := repo.flags["new-ui"]
+	changed.Percentage = 50
+	changed.Version++
+	repo.flags["new-ui"] = changed
+	var conflict *interfaces.ConflictError
+	assert.ErrorAs(t, service.SaveFlag(ctx, stale), &conflict)
+	current, _ := service.Flag("new-ui")
+	assert.Equal(t, 50, current.Percentage)
+	assert.NoError(t, service.SetEnabled(ctx, "new-ui", false))
+
+	assert.NoError(t, service.DeleteFlag(ctx, "new-ui"))
+	assert.False(t, service.IsEnabled("new-ui", nil))
+	assert.Empty(t, service.Flags())
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	service, repo, _ := newService()
+
+	// another instance saves a flag straight to the shared database
+	repo.flags["remote"] = interfaces.FeatureFlag{Key: "remote", Enabled: true, Percentage: 100}
+	assert.False(t, service.IsEnabled("remote", nil))
+
+	assert.NoError(t, service.Refresh(ctx))
+	assert.True(t, service.IsEnabled("remote", nil))
+}
@@ -0,0 +1,37 @@
+package flags
+
+import (
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/gofiber/fiber/v2"
+)
+
+// userLocal is the request local auth.AddCurrentUser stores the logged in user in, it is passed to views
+const userLocal = "User"
+
+// flagEnabled evaluates a flag for the user of a render, the flags service and the user are read from the
+// request locals passed to the view, flags are off when Middleware was not added
+func flagEnabled(binding interface{}, key string) bool {
+	var bind map[string]interface{}
+	switch b := binding.(type) {
+	case fiber.Map:
+		bind = b
+	case map[string]interface{}:
+		bind = b
+	default:
+		return false
+	}
+	flags, ok := bind[flagsLocal].(interfaces.IFeatureFlagService)
+	if !ok {
+		return false
+	}
+	user, _ := bind[userLocal].(*interfaces.User)
+	return flags.IsEnabled(key, subjectOf(user))
+}
+
+// TemplateFuncs returns the view helpers for flags, templates use {{ if flag $ "key" }} to evaluate a flag
+// for the logged in user, views must be rendered with PassLocalsToViews
+func TemplateFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"flag": flagEnabled,
+	}
+}
@@ -0,0 +1,51 @@
+package flags
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/template/html/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateFuncsEvaluateFlagsPerRender(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "layouts"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "layouts", "main.html"), []byte(`[{{ embed }}]`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte(`{{ if flag $ "targeted" }}on{{ else }}off{{ end }}`), 0o644))
+	engine := html.New(dir, ".html")
+	engine.AddFuncMap(TemplateFuncs())
+	service, _, _ := newService(interfaces.FeatureFlag{Key: "targeted", Enabled: true, UserIDs: []uint{3}})
+
+	// renders for different users run at the same time and each sees its own flags
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		for _, user := range []struct {
+			id       uint
+			expected string
+		}{{3, "[on]"}, {4, "[off]"}} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var out bytes.Buffer
+				err := engine.Render(&out, "index", fiber.Map{flagsLocal: service, userLocal: &interfaces.User{ID: user.id}}, "layouts/main")
+				assert.NoError(t, err)
+				assert.Equal(t, user.expected, out.String())
+			}()
+		}
+	}
+	wg.Wait()
+
+	var out bytes.Buffer
+	assert.NoError(t, engine.Render(&out, "index", fiber.Map{flagsLocal: service}))
+	assert.Equal(t, "off", out.String(), "anonymous visitors")
+	out.Reset()
+	assert.NoError(t, engine.Render(&out, "index", fiber.Map{userLocal: &interfaces.User{ID: 3}}))
+	assert.Equal(t, "off", out.String(), "flags are off without the middleware")
+}
@@ -1,6 +1,8 @@
 package increment
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 
 	"github.com/bryopsida/gofiber-pug-starter/interfaces"
@@ -25,16 +27,19 @@ func NewIncrementService(repo interfaces.INumberRepository, bucket string) inter
 // Increment increments a number
 // - id: the ID of the number to increment
 // Returns the incremented number if successful, otherwise returns an error
-func (s *ServiceImpl) Increment(id string) (uint64, error) {
-	number, err := s.repo.FindByID(s.bucket)
-	if err != nil {
+func (s *ServiceImpl) Increment(ctx context.Context, id string) (uint64, error) {
+	number, err := s.repo.FindByID(ctx, s.bucket)
+	if errors.Is(err, interfaces.ErrNotFound) {
 		slog.Info("Bucket not found, creating new bucket", "bucket", s.bucket)
 		number = &interfaces.Number{ID: s.bucket, Number: 0}
+	} else if err != nil {
+		slog.Error("Error finding number", "error", err)
+		return 0, err
 	}
 	slog.Info("Incrementing number", "number", number.Number)
 	number.Number++
 	slog.Info("Saving number", "number", number.Number)
-	saveErr := s.repo.Save(*number)
+	saveErr := s.repo.Save(ctx, *number)
 	if saveErr != nil {
 		slog.Error("Error saving number", "error", saveErr)
 		return 0, saveErr
@@ -1,9 +1,11 @@
 package increment
 
 import (
+	"context"
 	"testing"
 
 	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	number_repository "github.com/bryopsida/gofiber-pug-starter/repositories/number"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -14,17 +16,17 @@ type MockNumberRepository struct {
 }
 
 // DeleteByID implements interfaces.INumberRepository.
-func (m *MockNumberRepository) DeleteByID(id string) error {
+func (m *MockNumberRepository) DeleteByID(ctx context.Context, id string) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
-func (m *MockNumberRepository) FindByID(id string) (*interfaces.Number, error) {
+func (m *MockNumberRepository) FindByID(ctx context.Context, id string) (*interfaces.Number, error) {
 	args := m.Called(id)
 	return args.Get(0).(*interfaces.Number), args.Error(1)
 }
 
-func (m *MockNumberRepository) Save(number interfaces.Number) error {
+func (m *MockNumberRepository) Save(ctx context.Context, number interfaces.Number) error {
 	args := m.Called(number)
 	return args.Error(0)
 }
@@ -38,6 +40,7 @@ func TestNewIncrementService(t *testing.T) {
 }
 
 func TestIncrement(t *testing.T) {
+	ctx := context.Background()
 
 	t.Run("successful increment", func(t *testing.T) {
 		mockRepo := new(MockNumberRepository)
@@ -48,7 +51,7 @@ func TestIncrement(t *testing.T) {
 		mockRepo.On("FindByID", bucket).Return(mockNumber, nil)
 		mockRepo.On("Save", *expectedNumber).Return(nil)
 
-		resp, err := service.Increment(bucket)
+		resp, err := service.Increment(ctx, bucket)
 
 		assert.NoError(t, err)
 		assert.Equal(t, expectedNumber.Number, resp)
@@ -62,13 +65,25 @@ func TestIncrement(t *testing.T) {
 		mockRepo.On("FindByID", bucket).Return(&interfaces.Number{}, interfaces.ErrNotFound)
 		mockRepo.On("Save", mock.AnythingOfType("interfaces.Number")).Return(nil)
 
-		resp, err := service.Increment(bucket)
+		resp, err := service.Increment(ctx, bucket)
 
 		assert.NoError(t, err)
 		assert.Equal(t, uint64(1), resp)
 		mockRepo.AssertExpectations(t)
 	})
 
+	t.Run("find error does not reset the number", func(t *testing.T) {
+		mockRepo := new(MockNumberRepository)
+		bucket := "test-bucket-4"
+		service := NewIncrementService(mockRepo, bucket)
+		mockRepo.On("FindByID", bucket).Return((*interfaces.Number)(nil), interfaces.ErrUnavailable)
+
+		_, err := service.Increment(ctx, bucket)
+
+		assert.ErrorIs(t, err, interfaces.ErrUnavailable)
+		mockRepo.AssertNotCalled(t, "Save", mock.Anything)
+	})
+
 	t.Run("save error", func(t *testing.T) {
 		mockRepo := new(MockNumberRepository)
 		bucket := "test-bucket-3"
@@ -77,10 +92,25 @@ func TestIncrement(t *testing.T) {
 		mockRepo.On("FindByID", bucket).Return(mockNumber, nil)
 		mockRepo.On("Save", mock.Anything).Return(interfaces.ErrSaveFailed)
 
-		resp, err := service.Increment(bucket)
+		resp, err := service.Increment(ctx, bucket)
 
 		assert.Error(t, err)
 		assert.Equal(t, uint64(0), resp)
 		mockRepo.AssertExpectations(t)
 	})
 }
+
+func TestIncrementWithMemoryRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := number_repository.NewMemoryNumberRepository()
+	service := NewIncrementService(repo, "counter")
+
+	for want := uint64(1); want <= 3; want++ {
+		got, err := service.Increment(ctx, "counter")
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	stored, err := repo.FindByID(ctx, "counter")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), stored.Number)
+}
@@ -1,20 +1,33 @@
 package jwt
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/bryopsida/gofiber-pug-starter/interfaces"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// userLocal is the request local the JWT middleware stores the parsed token in by default
+const userLocal = "user"
+
 type jwtService struct {
+	mu        sync.RWMutex
 	secretKey string
 	issuer    string
+	lifetime  time.Duration
 }
 
-func NewJWTService(settings interfaces.ISettingsService) interfaces.IJWTService {
-	key, err := settings.GetString("jwt_signing_key")
+// NewJWTService creates a JWT service signing with the key in the settings
+// - config: provides how long tokens are valid
+func NewJWTService(settings interfaces.ISettingsService, config interfaces.IConfig) interfaces.IJWTService {
+	key, err := settings.GetString(context.Background(), interfaces.SettingJWTSigningKey)
 	if err != nil {
 		panic(err)
 	}
@@ -22,60 +35,80 @@ func NewJWTService(settings interfaces.ISettingsService) interfaces.IJWTService
 	if err != nil {
 		panic(err)
 	}
-	return &jwtService{
+	service := &jwtService{
 		secretKey: key,
 		issuer:    hostname,
+		lifetime:  config.GetJWTLifetime(),
 	}
+	// a rotated key takes effect immediately, tokens signed with the old key stop validating
+	settings.Subscribe(interfaces.SettingJWTSigningKey, func(key string) {
+		newKey, err := settings.GetString(context.Background(), key)
+		if err != nil {
+			slog.Error("Failed to reload JWT signing key", "error", err)
+			return
+		}
+		service.mu.Lock()
+		service.secretKey = newKey
+		service.mu.Unlock()
+		slog.Info("Reloaded JWT signing key")
+	})
+	return service
+}
+
+// signingKey returns the current signing key
+func (s *jwtService) signingKey() []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return []byte(s.secretKey)
 }
 
 func (s *jwtService) UserFromClaims(ctx interfaces.IRequestContext) (*interfaces.User, error) {
-	userLocal := ctx.Locals("user")
-	if userLocal == nil {
-		return nil, nil
-	}
-	userToken := ctx.Locals("user").(*jwt.Token)
-	if userToken == nil {
-		return nil, nil
-	}
-	claims := userToken.Claims.(jwt.MapClaims)
-	if claims == nil {
+	userToken, ok := ctx.Locals(userLocal).(*jwt.Token)
+	if !ok || userToken == nil {
 		return nil, nil
 	}
-	retUser := &interfaces.User{}
-	if username, ok := claims["username"].(string); ok {
-		retUser.Username = username
-	}
-	if email, ok := claims["email"].(string); ok {
-		retUser.Email = email
-	}
-	if role, ok := claims["role"].(string); ok {
-		retUser.Role = role
+	claims, ok := userToken.Claims.(*interfaces.UserClaims)
+	if !ok {
+		return nil, errors.New("unexpected claims type")
 	}
-	if id, ok := claims["sub"].(uint); ok {
-		retUser.ID = id
+	id, err := strconv.ParseUint(claims.Subject, 10, 0)
+	if err != nil {
+		return nil, err
 	}
-	return retUser, nil
+	return &interfaces.User{
+		ID:       uint(id),
+		Username: claims.Username,
+		Email:    claims.Email,
+		Role:     claims.Role,
+	}, nil
 }
 
 func (s *jwtService) Generate(user *interfaces.User) (string, error) {
-	claims := jwt.MapClaims{
-		"iss":      s.issuer,
-		"sub":      user.ID,
-		"username": user.Username,
-		"email":    user.Email,
-		"role":     user.Role,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
+	claims := interfaces.UserClaims{
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.lifetime)),
+		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.secretKey))
+	return token.SignedString(s.signingKey())
 }
 
-func (s *jwtService) keyFunc(token *jwt.Token) (interface{}, error) {
-	return []byte(s.secretKey), nil
+func (s *jwtService) KeyFunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return s.signingKey(), nil
 }
 func (s *jwtService) Validate(tokenString string) (*jwt.Token, error) {
-	token, err := jwt.Parse(tokenString, s.keyFunc, jwt.WithExpirationRequired())
+	token, err := jwt.ParseWithClaims(tokenString, &interfaces.UserClaims{}, s.KeyFunc,
+		jwt.WithExpirationRequired(), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
 		return nil, err
 	}
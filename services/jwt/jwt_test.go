@@ -0,0 +1,84 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRequestContext is a minimal IRequestContext backed by a map
+type fakeRequestContext map[interface{}]interface{}
+
+func (f fakeRequestContext) Locals(key interface{}, value ...interface{}) interface{} {
+	if len(value) > 0 {
+		f[key] = value[0]
+	}
+	return f[key]
+}
+
+func newTestService() *jwtService {
+	return &jwtService{secretKey: "test-key", issuer: "test", lifetime: time.Hour}
+}
+
+func TestGenerateValidateRoundTrip(t *testing.T) {
+	service := newTestService()
+	user := &interfaces.User{ID: 42, Username: "alice", Email: "alice@example.com", Role: interfaces.RoleAdmin}
+
+	signed, err := service.Generate(user)
+	assert.NoError(t, err)
+	token, err := service.Validate(signed)
+	assert.NoError(t, err)
+
+	claims, ok := token.Claims.(*interfaces.UserClaims)
+	assert.True(t, ok)
+	assert.Equal(t, "42", claims.Subject)
+
+	ctx := fakeRequestContext{}
+	ctx.Locals(userLocal, token)
+	claimsUser, err := service.UserFromClaims(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), claimsUser.ID)
+	assert.Equal(t, "alice", claimsUser.Username)
+	assert.Equal(t, interfaces.RoleAdmin, claimsUser.Role)
+}
+
+func TestValidateRejectsOtherKeys(t *testing.T) {
+	other := &jwtService{secretKey: "other-key", issuer: "test"}
+	signed, err := other.Generate(&interfaces.User{ID: 1})
+	assert.NoError(t, err)
+
+	_, err = newTestService().Validate(signed)
+
+	assert.Error(t, err)
+}
+
+func TestUserFromClaimsWithoutToken(t *testing.T) {
+	user, err := newTestService().UserFromClaims(fakeRequestContext{})
+
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+}
+
+func TestUserFromClaimsRejectsMapClaims(t *testing.T) {
+	ctx := fakeRequestContext{}
+	ctx.Locals(userLocal, &jwt.Token{Claims: jwt.MapClaims{"sub": float64(1)}})
+
+	_, err := newTestService().UserFromClaims(ctx)
+
+	assert.Error(t, err)
+}
+
+func TestValidateRejectsOtherAlgorithms(t *testing.T) {
+	service := newTestService()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, interfaces.UserClaims{})
+	signed, err := token.SignedString([]byte("test-key"))
+	assert.NoError(t, err)
+
+	_, err = service.KeyFunc(token)
+	assert.Error(t, err)
+	_, err = service.Validate(signed)
+	assert.Error(t, err)
+}
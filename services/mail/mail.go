@@ -0,0 +1,161 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// sendTimeout bounds the whole conversation with the mail server
+const sendTimeout = 30 * time.Second
+
+// logMailer writes emails to the log instead of sending them, links included, it is meant for development only
+type logMailer struct{}
+
+// NewLogMailer creates a new logMailer instance, anyone reading the log can use the links it writes
+func NewLogMailer() interfaces.IMailer {
+	return &logMailer{}
+}
+
+func (m *logMailer) Send(to string, subject string, body string) error {
+	slog.Info("Email written to the log instead of being sent", "to", to, "subject", subject, "body", body)
+	return nil
+}
+
+// disabledMailer refuses every email when no mail transport is configured
+type disabledMailer struct{}
+
+// NewDisabledMailer creates a mailer that fails every email with ErrMailUnavailable
+func NewDisabledMailer() interfaces.IMailer {
+	return &disabledMailer{}
+}
+
+func (m *disabledMailer) Send(to string, subject string, body string) error {
+	return interfaces.ErrMailUnavailable
+}
+
+type smtpMailer struct {
+	config interfaces.SMTPConfig
+}
+
+// NewSMTPMailer creates a mailer sending through a mail server
+// - config: the mail server and the sender address
+func NewSMTPMailer(config interfaces.SMTPConfig) interfaces.IMailer {
+	return &smtpMailer{config: config}
+}
+
+// message builds a plain text email, the body is quoted-printable encoded so any line length and character is sent intact
+func (m *smtpMailer) message(to string, subject string, body string) ([]byte, error) {
+	var message bytes.Buffer
+	header := func(name string, value string) {
+		fmt.Fprintf(&message, "%s: %s\r\n", name, value)
+	}
+	header("From", m.config.From)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	message.WriteString("\r\n")
+	encoder := quotedprintable.NewWriter(&message)
+	if _, err := encoder.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
+
+// dial connects to the mail server and secures the connection as configured
+func (m *smtpMailer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(int(m.config.Port)))
+	tlsConfig := &tls.Config{ServerName: m.config.Host, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: sendTimeout}
+	var conn net.Conn
+	var err error
+	if m.config.TLS == interfaces.SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if m.config.TLS == interfaces.SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("mail server %s does not offer STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+func (m *smtpMailer) Send(to string, subject string, body string) error {
+	// addresses and the subject end up in headers, line breaks would let them add headers of their own
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("line breaks are not allowed in the recipient or subject")
+	}
+	sender, err := mail.ParseAddress(m.config.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender: %w", err)
+	}
+	message, err := m.message(to, subject, body)
+	if err != nil {
+		return err
+	}
+	client, err := m.dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the mail server: %w", err)
+	}
+	defer client.Close()
+	if m.config.Username != "" {
+		// PLAIN auth refuses to send the password over a connection without TLS unless the server is local
+		if err := client.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate with the mail server: %w", err)
+		}
+	}
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
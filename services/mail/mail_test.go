@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receivedMail is what fakeSMTPServer was sent
+type receivedMail struct {
+	from string
+	to   string
+	data string
+}
+
+// fakeSMTPServer accepts a single conversation and records the email, it never offers STARTTLS
+func fakeSMTPServer(t *testing.T) (interfaces.SMTPConfig, <-chan receivedMail) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	received := make(chan receivedMail, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		var mail receivedMail
+		text.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch command {
+			case "EHLO", "HELO":
+				text.PrintfLine("250 localhost")
+			case "MAIL":
+				mail.from = strings.TrimPrefix(line, "MAIL FROM:")
+				text.PrintfLine("250 OK")
+			case "RCPT":
+				mail.to = strings.TrimPrefix(line, "RCPT TO:")
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				data, err := io.ReadAll(text.DotReader())
+				if err != nil {
+					return
+				}
+				mail.data = string(data)
+				text.PrintfLine("250 OK")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				received <- mail
+				return
+			default:
+				text.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return interfaces.SMTPConfig{Host: "127.0.0.1", Port: uint16(portNumber), TLS: interfaces.SMTPTLSNone, From: "App <app@example.com>"}, received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	config, received := fakeSMTPServer(t)
+	body := "Hi jane,\n\nConfirm it by opening https://example.com/verify-email?token=" + strings.Repeat("a", 100) + "\n"
+
+	require.NoError(t, NewSMTPMailer(config).Send("jane@example.com", "Confirm your email address", body))
+
+	mail := <-received
+	assert.Equal(t, "<app@example.com>", mail.from)
+	assert.Equal(t, "<jane@example.com>", mail.to)
+	header, content, _ := strings.Cut(mail.data, "\n\n")
+	assert.Contains(t, header, "Subject: Confirm your email address")
+	assert.Contains(t, header, "To: jane@example.com")
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(content)))
+	require.NoError(t, err)
+	assert.Equal(t, body, strings.ReplaceAll(string(decoded), "\r\n", "\n"), "the link arrives intact")
+}
+
+func TestSMTPMailerRejectsInvalidHeaders(t *testing.T) {
+	mailer := NewSMTPMailer(interfaces.SMTPConfig{Host: "127.0.0.1", Port: 1, TLS: interfaces.SMTPTLSNone, From: "app@example.com"})
+
+	assert.Error(t, mailer.Send("jane@example.com\r\nBcc: all@example.com", "subject", "body"))
+	assert.Error(t, mailer.Send("jane@example.com", "subject\r\nBcc: all@example.com", "body"))
+}
+
+func TestSMTPMailerRequiresStartTLS(t *testing.T) {
+	config, _ := fakeSMTPServer(t)
+	config.TLS = interfaces.SMTPTLSStartTLS
+
+	err := NewSMTPMailer(config).Send("jane@example.com", "subject", "body")
+
+	assert.ErrorContains(t, err, "STARTTLS", "the email is not sent in plaintext")
+}
+
+func TestDisabledMailer(t *testing.T) {
+	assert.ErrorIs(t, NewDisabledMailer().Send("jane@example.com", "subject", "body"), interfaces.ErrMailUnavailable)
+}
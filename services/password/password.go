@@ -12,59 +12,93 @@ import (
 	"golang.org/x/crypto/argon2"
 )
 
+// DefaultParams are the parameters used where no configuration is available, such as migrations,
+// hashes in the legacy salt:hash format were made with them
+var DefaultParams = interfaces.Argon2Params{
+	Time:       1,
+	Memory:     64 * 1024,
+	Threads:    4,
+	KeyLength:  32,
+	SaltLength: 16,
+}
+
 type passwordService struct {
-	SaltLength uint32
-	Time       uint32
-	Memory     uint32
-	Threads    uint8
-	KeyLength  uint32
+	params interfaces.Argon2Params
 }
 
 // NewPasswordService creates a new password service
-func NewPasswordService() interfaces.IPasswordService {
-	return &passwordService{
-		SaltLength: 16,
-		Time:       1,
-		Memory:     64 * 1024,
-		Threads:    4,
-		KeyLength:  32,
-	}
+// - config: provides the argon2id parameters new hashes are made with
+func NewPasswordService(config interfaces.IConfig) interfaces.IPasswordService {
+	return NewPasswordServiceWithParams(config.GetArgon2Params())
+}
+
+// NewPasswordServiceWithParams creates a new password service that hashes with the given parameters
+func NewPasswordServiceWithParams(params interfaces.Argon2Params) interfaces.IPasswordService {
+	return &passwordService{params: params}
 }
 
+// Hash hashes a password in the PHC string format, $argon2id$v=19$m=65536,t=1,p=4$salt$hash,
+// so it can be verified after the configured parameters change
 func (ps *passwordService) Hash(plaintext string) (string, error) {
-	salt := make([]byte, ps.SaltLength)
+	salt := make([]byte, ps.params.SaltLength)
 	_, err := rand.Read(salt)
 	if err != nil {
 		return "", err
 	}
 
-	hash := argon2.IDKey([]byte(plaintext), salt, ps.Time, ps.Memory, ps.Threads, ps.KeyLength)
+	hash := argon2.IDKey([]byte(plaintext), salt, ps.params.Time, ps.params.Memory, ps.params.Threads, ps.params.KeyLength)
 	encodedSalt := base64.RawStdEncoding.EncodeToString(salt)
 	encodedHash := base64.RawStdEncoding.EncodeToString(hash)
 
-	return fmt.Sprintf("%s:%s", encodedSalt, encodedHash), nil
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, ps.params.Memory, ps.params.Time, ps.params.Threads, encodedSalt, encodedHash), nil
 }
 
+// Verify checks a password against a hash in the PHC string format or the legacy salt:hash format
 func (ps *passwordService) Verify(plaintext, encodedHash string) (bool, error) {
-	parts := strings.Split(encodedHash, ":")
-	if len(parts) != 2 {
-		return false, errors.New("invalid hash format")
+	params, salt, storedHash, err := decodeHash(encodedHash)
+	if err != nil {
+		return false, err
 	}
 
-	encodedSalt := parts[0]
-	encodedStoredHash := parts[1]
+	hash := argon2.IDKey([]byte(plaintext), salt, params.Time, params.Memory, params.Threads, uint32(len(storedHash)))
+
+	return subtle.ConstantTimeCompare(hash, storedHash) == 1, nil
+}
+
+// decodeHash returns the parameters, salt and hash of an encoded hash
+func decodeHash(encodedHash string) (interfaces.Argon2Params, []byte, []byte, error) {
+	params := DefaultParams
+	var encodedSalt, encodedStoredHash string
+	if strings.HasPrefix(encodedHash, "$") {
+		parts := strings.Split(encodedHash, "$")
+		if len(parts) != 6 || parts[1] != "argon2id" {
+			return params, nil, nil, errors.New("invalid hash format")
+		}
+		var version int
+		if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+			return params, nil, nil, errors.New("unsupported argon2 version")
+		}
+		if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+			return params, nil, nil, errors.New("invalid hash parameters")
+		}
+		encodedSalt, encodedStoredHash = parts[4], parts[5]
+	} else {
+		parts := strings.Split(encodedHash, ":")
+		if len(parts) != 2 {
+			return params, nil, nil, errors.New("invalid hash format")
+		}
+		encodedSalt, encodedStoredHash = parts[0], parts[1]
+	}
 
 	salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
 	if err != nil {
-		return false, err
+		return params, nil, nil, err
 	}
 
 	storedHash, err := base64.RawStdEncoding.DecodeString(encodedStoredHash)
 	if err != nil {
-		return false, err
+		return params, nil, nil, err
 	}
-
-	hash := argon2.IDKey([]byte(plaintext), salt, ps.Time, ps.Memory, ps.Threads, ps.KeyLength)
-
-	return subtle.ConstantTimeCompare(hash, storedHash) == 1, nil
+	return params, salt, storedHash, nil
 }
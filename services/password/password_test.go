@@ -0,0 +1,60 @@
+package password
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
+)
+
+var fastParams = interfaces.Argon2Params{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLength: 16, SaltLength: 8}
+
+func TestHashVerifyRoundTrip(t *testing.T) {
+	service := NewPasswordServiceWithParams(fastParams)
+
+	hash, err := service.Hash("secret")
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$"))
+	ok, err := service.Verify("secret", hash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = service.Verify("wrong", hash)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestVerifyAfterParamsChange(t *testing.T) {
+	hash, err := NewPasswordServiceWithParams(fastParams).Hash("secret")
+	assert.NoError(t, err)
+
+	ok, err := NewPasswordServiceWithParams(interfaces.Argon2Params{Time: 2, Memory: 16 * 1024, Threads: 2, KeyLength: 32, SaltLength: 16}).Verify("secret", hash)
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestVerifyLegacyHash(t *testing.T) {
+	salt := make([]byte, DefaultParams.SaltLength)
+	_, err := rand.Read(salt)
+	assert.NoError(t, err)
+	key := argon2.IDKey([]byte("secret"), salt, DefaultParams.Time, DefaultParams.Memory, DefaultParams.Threads, DefaultParams.KeyLength)
+	legacy := base64.RawStdEncoding.EncodeToString(salt) + ":" + base64.RawStdEncoding.EncodeToString(key)
+
+	ok, err := NewPasswordServiceWithParams(fastParams).Verify("secret", legacy)
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestVerifyRejectsMalformedHashes(t *testing.T) {
+	service := NewPasswordServiceWithParams(fastParams)
+	for _, hash := range []string{"", "nocolon", "$argon2i$v=19$m=8192,t=1,p=1$c2FsdA$aGFzaA", "$argon2id$v=16$m=8192,t=1,p=1$c2FsdA$aGFzaA", "$argon2id$v=19$m=x$c2FsdA$aGFzaA"} {
+		_, err := service.Verify("secret", hash)
+		assert.Error(t, err, hash)
+	}
+}
@@ -0,0 +1,169 @@
+package preferences
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"golang.org/x/text/language"
+)
+
+var dateFormats = []string{
+	"2006-01-02 15:04",
+	"02/01/2006 15:04",
+	"01/02/2006 3:04 PM",
+	"2 Jan 2006 15:04",
+	"Jan 2, 2006 3:04 PM",
+}
+
+var pageSizes = []int{10, 25, 50, 100}
+
+var themes = map[string]bool{
+	interfaces.ThemeLight: true,
+	interfaces.ThemeDark:  true,
+	interfaces.ThemeAuto:  true,
+}
+
+// DefaultPreferences returns the preferences used until a user saves their own
+// - userID: the user the preferences are for
+func DefaultPreferences(userID uint) *interfaces.Preferences {
+	return &interfaces.Preferences{
+		UserID:     userID,
+		Theme:      interfaces.ThemeDark,
+		Timezone:   "UTC",
+		Locale:     "en-US",
+		DateFormat: dateFormats[0],
+		PageSize:   25,
+	}
+}
+
+type preferencesService struct {
+	repo interfaces.IPreferencesRepository
+}
+
+// NewPreferencesService creates a new preferencesService instance
+func NewPreferencesService(repo interfaces.IPreferencesRepository) interfaces.IPreferencesService {
+	return &preferencesService{repo: repo}
+}
+
+func (s *preferencesService) GetPreferences(ctx context.Context, userID uint) (*interfaces.Preferences, error) {
+	prefs, err := s.repo.GetPreferences(ctx, userID)
+	if errors.Is(err, interfaces.ErrNotFound) {
+		return DefaultPreferences(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+func (s *preferencesService) ValidatePreferences(prefs *interfaces.Preferences) map[string]string {
+	errors := map[string]string{}
+	if !themes[prefs.Theme] {
+		errors["Theme"] = "Theme must be light, dark or auto"
+	}
+	if _, err := time.LoadLocation(prefs.Timezone); err != nil || prefs.Timezone == "" {
+		errors["Timezone"] = "Timezone must be an IANA timezone such as Europe/Berlin"
+	}
+	if tag, err := language.Parse(prefs.Locale); err != nil {
+		errors["Locale"] = "Locale must be a language tag such as en-US"
+	} else {
+		prefs.Locale = tag.String()
+	}
+	validFormat := false
+	for _, format := range dateFormats {
+		validFormat = validFormat || format == prefs.DateFormat
+	}
+	if !validFormat {
+		errors["DateFormat"] = "Date format must be one of the listed formats"
+	}
+	validPageSize := false
+	for _, size := range pageSizes {
+		validPageSize = validPageSize || size == prefs.PageSize
+	}
+	if !validPageSize {
+		errors["PageSize"] = "Page size must be one of the listed sizes"
+	}
+	return errors
+}
+
+func (s *preferencesService) SavePreferences(ctx context.Context, prefs *interfaces.Preferences) error {
+	if len(s.ValidatePreferences(prefs)) > 0 {
+		return interfaces.ErrInvalidPreferences
+	}
+	return s.repo.SavePreferences(ctx, prefs)
+}
+
+func (s *preferencesService) DateFormats() []string {
+	return dateFormats
+}
+
+func (s *preferencesService) PageSizes() []int {
+	return pageSizes
+}
+
+// FormatTime renders a time in the timezone and date format of the preferences
+// - t: the time to render
+// - prefs: the preferences to render with, the defaults are used when nil
+func FormatTime(t time.Time, prefs *interfaces.Preferences) string {
+	if prefs == nil {
+		prefs = DefaultPreferences(0)
+	}
+	location, err := time.LoadLocation(prefs.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	return t.In(location).Format(prefs.DateFormat)
+}
+
+// TemplateFuncs returns the view helpers that render using preferences, they all accept nil preferences
+// for pages rendered without a logged in user
+func TemplateFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"formatTime": FormatTime,
+		"theme": func(prefs *interfaces.Preferences) string {
+			if prefs == nil {
+				return DefaultPreferences(0).Theme
+			}
+			return prefs.Theme
+		},
+		"locale": func(prefs *interfaces.Preferences) string {
+			if prefs == nil {
+				return DefaultPreferences(0).Locale
+			}
+			return prefs.Locale
+		},
+	}
+}
+
+func (s *preferencesService) PersonalDataName() string {
+	return "preferences"
+}
+
+func (s *preferencesService) ExportPersonalData(ctx context.Context, userID uint) ([]interfaces.PersonalDataFile, error) {
+	prefs, err := s.repo.GetPreferences(ctx, userID)
+	if errors.Is(err, interfaces.ErrNotFound) {
+		// nothing stored, the user is using the defaults
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.MarshalIndent(map[string]interface{}{
+		"theme":       prefs.Theme,
+		"timezone":    prefs.Timezone,
+		"locale":      prefs.Locale,
+		"date_format": prefs.DateFormat,
+		"page_size":   prefs.PageSize,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []interfaces.PersonalDataFile{{Name: "preferences.json", Content: content}}, nil
+}
+
+func (s *preferencesService) ErasePersonalData(ctx context.Context, userID uint) error {
+	return s.repo.DeletePreferences(ctx, userID)
+}
@@ -0,0 +1,42 @@
+package preferences
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePreferences(t *testing.T) {
+	service := NewPreferencesService(nil)
+
+	t.Run("defaults are valid", func(t *testing.T) {
+		assert.Empty(t, service.ValidatePreferences(DefaultPreferences(1)))
+	})
+
+	t.Run("normalizes the locale", func(t *testing.T) {
+		prefs := DefaultPreferences(1)
+		prefs.Locale = "de-de"
+
+		assert.Empty(t, service.ValidatePreferences(prefs))
+		assert.Equal(t, "de-DE", prefs.Locale)
+	})
+
+	t.Run("reports every invalid field", func(t *testing.T) {
+		prefs := &interfaces.Preferences{Theme: "blue", Timezone: "Mars/Base", Locale: "!!", DateFormat: "x", PageSize: 7}
+
+		errors := service.ValidatePreferences(prefs)
+
+		assert.Len(t, errors, 5)
+	})
+}
+
+func TestFormatTime(t *testing.T) {
+	moment := time.Date(2024, 8, 1, 12, 30, 0, 0, time.UTC)
+	prefs := DefaultPreferences(1)
+	prefs.Timezone = "Asia/Tokyo"
+
+	assert.Equal(t, "2024-08-01 21:30", FormatTime(moment, prefs))
+	assert.Equal(t, "2024-08-01 12:30", FormatTime(moment, nil))
+}
@@ -0,0 +1,147 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// manifest describes the contents of a personal data export
+type manifest struct {
+	UserID      uint      `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Sections    []string  `json:"sections"`
+}
+
+type privacyService struct {
+	usersService interfaces.IUsersService
+	transactions interfaces.ITransactionManager
+	providers    []interfaces.IPersonalDataProvider
+	gracePeriod  time.Duration
+}
+
+// NewPrivacyService creates a new privacyService instance
+// - usersService: used to record and find pending deletions
+// - transactions: each account is erased in its own transaction so it is erased completely or not at all
+// - gracePeriod: how long a deletion can be cancelled for
+// - providers: the components that store personal data, they are erased in order so the user record itself should be last
+func NewPrivacyService(usersService interfaces.IUsersService, transactions interfaces.ITransactionManager, gracePeriod time.Duration, providers ...interfaces.IPersonalDataProvider) interfaces.IPrivacyService {
+	return &privacyService{
+		usersService: usersService,
+		transactions: transactions,
+		providers:    providers,
+		gracePeriod:  gracePeriod,
+	}
+}
+
+func (s *privacyService) ExportPersonalData(ctx context.Context, userID uint, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	export := manifest{UserID: userID, GeneratedAt: time.Now().UTC(), Sections: []string{}}
+	for _, provider := range s.providers {
+		files, err := provider.ExportPersonalData(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			continue
+		}
+		export.Sections = append(export.Sections, provider.PersonalDataName())
+		for _, file := range files {
+			entry, err := archive.Create(provider.PersonalDataName() + "/" + file.Name)
+			if err != nil {
+				return err
+			}
+			if _, err := entry.Write(file.Content); err != nil {
+				return err
+			}
+		}
+	}
+	content, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	entry, err := archive.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if _, err := entry.Write(content); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func (s *privacyService) RequestDeletion(ctx context.Context, user *interfaces.User) error {
+	deleteAfter := time.Now().Add(s.gracePeriod)
+	user.DeleteAfter = &deleteAfter
+	return s.usersService.UpdateUser(ctx, user)
+}
+
+func (s *privacyService) CancelDeletion(ctx context.Context, user *interfaces.User) error {
+	user.DeleteAfter = nil
+	return s.usersService.UpdateUser(ctx, user)
+}
+
+func (s *privacyService) PurgeDueDeletions(ctx context.Context, now time.Time) (int, error) {
+	users, err := s.usersService.GetUsersDueForDeletion(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	var errs []error
+	for _, user := range users {
+		erased, err := s.erase(ctx, user.ID, now)
+		if err != nil {
+			slog.Error("Failed to purge account", "id", user.ID, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		if !erased {
+			slog.Info("Account deletion was cancelled before the purge", "id", user.ID)
+			continue
+		}
+		slog.Info("Purged account", "id", user.ID)
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+// erase erases a user in one transaction if their deletion is still due at now
+// Returns false when the user cancelled the deletion or is already gone
+func (s *privacyService) erase(ctx context.Context, userID uint, now time.Time) (bool, error) {
+	erased := false
+	err := s.transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+		// the list of due users was read before the loop, the user may have cancelled since
+		user, err := s.usersService.GetUserByID(ctx, userID)
+		if errors.Is(err, interfaces.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if user.DeleteAfter == nil || user.DeleteAfter.After(now) {
+			return nil
+		}
+		// writing the user claims it, a cancellation that races the purge now conflicts instead of being lost
+		err = s.usersService.UpdateUser(ctx, user)
+		if errors.Is(err, interfaces.ErrConflict) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, provider := range s.providers {
+			if err := provider.ErasePersonalData(ctx, userID); err != nil {
+				return err
+			}
+		}
+		erased = true
+		return nil
+	})
+	return erased && err == nil, err
+}
@@ -0,0 +1,193 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProvider records erasures and exports a single fixed file
+type fakeProvider struct {
+	name   string
+	erased []uint
+	err    error
+}
+
+func (p *fakeProvider) PersonalDataName() string {
+	return p.name
+}
+
+func (p *fakeProvider) ExportPersonalData(ctx context.Context, userID uint) ([]interfaces.PersonalDataFile, error) {
+	return []interfaces.PersonalDataFile{{Name: "data.json", Content: []byte("{}")}}, nil
+}
+
+func (p *fakeProvider) ErasePersonalData(ctx context.Context, userID uint) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.erased = append(p.erased, userID)
+	return nil
+}
+
+// fakeUsersService embeds the interface so only the methods under test need implementing
+type fakeUsersService struct {
+	interfaces.IUsersService
+	due     []*interfaces.User
+	updated *interfaces.User
+	// stored are the users as they are when reloaded, the due users when nil
+	stored map[uint]*interfaces.User
+}
+
+func (s *fakeUsersService) GetUsersDueForDeletion(ctx context.Context, before time.Time) ([]*interfaces.User, error) {
+	return s.due, nil
+}
+
+func (s *fakeUsersService) GetUserByID(ctx context.Context, id uint) (*interfaces.User, error) {
+	if s.stored != nil {
+		if user, ok := s.stored[id]; ok {
+			copied := *user
+			return &copied, nil
+		}
+		return nil, interfaces.ErrNotFound
+	}
+	for _, user := range s.due {
+		if user.ID == id {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, interfaces.ErrNotFound
+}
+
+func (s *fakeUsersService) UpdateUser(ctx context.Context, user *interfaces.User) error {
+	s.updated = user
+	return nil
+}
+
+// fakeTransactions runs the work without a database and records the outcome of each transaction
+type fakeTransactions struct {
+	outcomes []error
+}
+
+func (f *fakeTransactions) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	f.outcomes = append(f.outcomes, err)
+	return err
+}
+
+func (f *fakeTransactions) AfterCommit(ctx context.Context, fn func()) {
+	fn()
+}
+
+// conflictingUsersService fails every update as if the user changed since it was loaded
+type conflictingUsersService struct {
+	fakeUsersService
+}
+
+func (s *conflictingUsersService) UpdateUser(ctx context.Context, user *interfaces.User) error {
+	return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+}
+
+func TestExportPersonalData(t *testing.T) {
+	ctx := context.Background()
+	service := NewPrivacyService(&fakeUsersService{}, &fakeTransactions{}, time.Hour, &fakeProvider{name: "profile"}, &fakeProvider{name: "tokens"})
+
+	var out bytes.Buffer
+	err := service.ExportPersonalData(ctx, 1, &out)
+
+	assert.NoError(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	assert.NoError(t, err)
+	names := []string{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	assert.Equal(t, []string{"profile/data.json", "tokens/data.json", "manifest.json"}, names)
+}
+
+func TestRequestDeletion(t *testing.T) {
+	ctx := context.Background()
+	users := &fakeUsersService{}
+	service := NewPrivacyService(users, &fakeTransactions{}, time.Hour, &fakeProvider{name: "profile"})
+	user := &interfaces.User{ID: 1}
+
+	assert.NoError(t, service.RequestDeletion(ctx, user))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *users.updated.DeleteAfter, time.Minute)
+
+	assert.NoError(t, service.CancelDeletion(ctx, user))
+	assert.Nil(t, users.updated.DeleteAfter)
+}
+
+func TestPurgeDueDeletions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	due := now.Add(-time.Minute)
+	users := &fakeUsersService{due: []*interfaces.User{{ID: 1, DeleteAfter: &due}, {ID: 2, DeleteAfter: &due}}}
+	tokens := &fakeProvider{name: "tokens"}
+	profile := &fakeProvider{name: "profile"}
+	transactions := &fakeTransactions{}
+	service := NewPrivacyService(users, transactions, time.Hour, tokens, profile)
+
+	purged, err := service.PurgeDueDeletions(ctx, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	assert.Equal(t, []uint{1, 2}, tokens.erased)
+	assert.Equal(t, []uint{1, 2}, profile.erased)
+	assert.Equal(t, []error{nil, nil}, transactions.outcomes, "each account is erased in its own transaction")
+
+	t.Run("stops erasing a user when a provider fails", func(t *testing.T) {
+		failing := &fakeProvider{name: "tokens", err: errors.New("boom")}
+		profile := &fakeProvider{name: "profile"}
+		transactions := &fakeTransactions{}
+		service := NewPrivacyService(users, transactions, time.Hour, failing, profile)
+
+		purged, err := service.PurgeDueDeletions(ctx, now)
+
+		assert.Error(t, err)
+		assert.Equal(t, 0, purged)
+		assert.Empty(t, profile.erased)
+		assert.Len(t, transactions.outcomes, 2)
+		for _, outcome := range transactions.outcomes {
+			assert.Error(t, outcome, "the transaction is rolled back")
+		}
+	})
+
+	t.Run("skips users that cancelled after the due list was read", func(t *testing.T) {
+		later := now.Add(time.Hour)
+		users := &fakeUsersService{
+			due: []*interfaces.User{{ID: 1, DeleteAfter: &due}, {ID: 2, DeleteAfter: &due}, {ID: 3, DeleteAfter: &due}},
+			stored: map[uint]*interfaces.User{
+				1: {ID: 1},
+				2: {ID: 2, DeleteAfter: &later},
+				3: {ID: 3, DeleteAfter: &due},
+			},
+		}
+		profile := &fakeProvider{name: "profile"}
+		service := NewPrivacyService(users, &fakeTransactions{}, time.Hour, profile)
+
+		purged, err := service.PurgeDueDeletions(ctx, now)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, purged)
+		assert.Equal(t, []uint{3}, profile.erased)
+	})
+
+	t.Run("skips users whose cancellation races the purge", func(t *testing.T) {
+		users := &conflictingUsersService{fakeUsersService: fakeUsersService{due: []*interfaces.User{{ID: 1, DeleteAfter: &due}}}}
+		profile := &fakeProvider{name: "profile"}
+		service := NewPrivacyService(users, &fakeTransactions{}, time.Hour, profile)
+
+		purged, err := service.PurgeDueDeletions(ctx, now)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, purged)
+		assert.Empty(t, profile.erased)
+	})
+}
@@ -0,0 +1,75 @@
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+type sessionService struct {
+	repo     interfaces.IUserSessionRepository
+	lifetime time.Duration
+}
+
+// NewSessionService creates a new sessionService instance
+// - lifetime: how long the session token issued at sign in is valid
+func NewSessionService(repo interfaces.IUserSessionRepository, lifetime time.Duration) interfaces.ISessionService {
+	return &sessionService{repo: repo, lifetime: lifetime}
+}
+
+func (s *sessionService) Record(ctx context.Context, userID uint, method string, ipAddress string, userAgent string) error {
+	now := time.Now()
+	// expired sessions are of no use to anyone, they are dropped rather than kept forever
+	if err := s.repo.DeleteExpiredSessions(ctx, now); err != nil {
+		slog.Warn("Failed to delete expired sessions", "error", err)
+	}
+	return s.repo.CreateSession(ctx, &interfaces.UserSession{
+		UserID:    userID,
+		Method:    method,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		ExpiresAt: now.Add(s.lifetime),
+	})
+}
+
+// exportedSession is a session included in a personal data export
+type exportedSession struct {
+	Method    string    `json:"method"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *sessionService) PersonalDataName() string {
+	return "sessions"
+}
+
+func (s *sessionService) ExportPersonalData(ctx context.Context, userID uint) ([]interfaces.PersonalDataFile, error) {
+	sessions, err := s.repo.GetSessionsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	exported := make([]exportedSession, len(sessions))
+	for i, session := range sessions {
+		exported[i] = exportedSession{
+			Method:    session.Method,
+			IPAddress: session.IPAddress,
+			UserAgent: session.UserAgent,
+			CreatedAt: session.CreatedAt,
+			ExpiresAt: session.ExpiresAt,
+		}
+	}
+	content, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []interfaces.PersonalDataFile{{Name: "sessions.json", Content: content}}, nil
+}
+
+func (s *sessionService) ErasePersonalData(ctx context.Context, userID uint) error {
+	return s.repo.DeleteSessionsForUser(ctx, userID)
+}
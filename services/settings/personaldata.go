@@ -0,0 +1,66 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// exportedChange is a setting change made by the user, secret changes never carry values
+type exportedChange struct {
+	Key       string    `json:"key"`
+	OldValue  string    `json:"old_value,omitempty"`
+	NewValue  string    `json:"new_value,omitempty"`
+	Secret    bool      `json:"secret"`
+	RequestID string    `json:"request_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// historyPersonalData exports and anonymises the setting changes a user made, they are matched on the user ID
+// as the recorded username may also be a pseudo actor such as SettingActorSystem
+type historyPersonalData struct {
+	repo interfaces.ISettingsRepository
+}
+
+// NewHistoryPersonalDataProvider creates the personal data provider of the settings history
+// - repo: the repository the history is stored in
+func NewHistoryPersonalDataProvider(repo interfaces.ISettingsRepository) interfaces.IPersonalDataProvider {
+	return &historyPersonalData{repo: repo}
+}
+
+func (p *historyPersonalData) PersonalDataName() string {
+	return "audit"
+}
+
+func (p *historyPersonalData) ExportPersonalData(ctx context.Context, userID uint) ([]interfaces.PersonalDataFile, error) {
+	changes, err := p.repo.GetChangesByActor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	exported := make([]exportedChange, len(changes))
+	for i, change := range changes {
+		exported[i] = exportedChange{
+			Key:       change.Key,
+			OldValue:  change.OldValue,
+			NewValue:  change.NewValue,
+			Secret:    change.Secret,
+			RequestID: change.RequestID,
+			CreatedAt: change.CreatedAt,
+		}
+	}
+	content, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []interfaces.PersonalDataFile{{Name: "setting_changes.json", Content: content}}, nil
+}
+
+func (p *historyPersonalData) ErasePersonalData(ctx context.Context, userID uint) error {
+	// the changes stay in the history so it remains complete, only who made them is forgotten
+	return p.repo.ReplaceActor(ctx, userID, interfaces.SettingActorDeleted)
+}
@@ -0,0 +1,69 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	settings_repository "github.com/bryopsida/gofiber-pug-starter/repositories/settings"
+	users_repository "github.com/bryopsida/gofiber-pug-starter/repositories/users"
+	users_service "github.com/bryopsida/gofiber-pug-starter/services/users"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryPersonalData(t *testing.T) {
+	ctx := context.Background()
+	repo := settings_repository.NewMemorySettingsRepository()
+	usersService := users_service.NewUsersService(users_repository.NewMemoryUserRepository())
+	user := &interfaces.User{Username: "jane", Email: "jane@example.com"}
+	require.NoError(t, usersService.CreateUser(ctx, user))
+	require.NoError(t, repo.Set(ctx, "site_name", "Jane's site", interfaces.SettingActor{Username: "jane", UserID: user.ID}))
+	require.NoError(t, repo.Set(ctx, "site_name", "Other", interfaces.SettingActor{Username: "admin", UserID: user.ID + 1}))
+	provider := NewHistoryPersonalDataProvider(repo)
+
+	files, err := provider.ExportPersonalData(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	var exported []map[string]interface{}
+	require.NoError(t, json.Unmarshal(files[0].Content, &exported))
+	if assert.Len(t, exported, 1) {
+		assert.Equal(t, "Jane's site", exported[0]["new_value"])
+	}
+
+	require.NoError(t, provider.ErasePersonalData(ctx, user.ID))
+	history, err := repo.GetHistory(ctx, "site_name")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", history[0].Actor)
+	assert.Equal(t, interfaces.SettingActorDeleted, history[1].Actor, "the username is anonymised")
+	files, err = provider.ExportPersonalData(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestHistoryPersonalDataOfPseudoActorNamesake(t *testing.T) {
+	ctx := context.Background()
+	repo := settings_repository.NewMemorySettingsRepository()
+	usersService := users_service.NewUsersService(users_repository.NewMemoryUserRepository())
+	user := &interfaces.User{Username: interfaces.SettingActorSystem, Email: "system@example.com"}
+	require.NoError(t, usersService.CreateUser(ctx, user))
+	require.NoError(t, repo.Set(ctx, "site_name", "Default", interfaces.SettingActor{Username: interfaces.SettingActorSystem}))
+	require.NoError(t, repo.Set(ctx, "site_name", "Mine", interfaces.SettingActor{Username: user.Username, UserID: user.ID}))
+	provider := NewHistoryPersonalDataProvider(repo)
+
+	files, err := provider.ExportPersonalData(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	var exported []map[string]interface{}
+	require.NoError(t, json.Unmarshal(files[0].Content, &exported))
+	if assert.Len(t, exported, 1, "changes of the system are not exported to a user named after it") {
+		assert.Equal(t, "Mine", exported[0]["new_value"])
+	}
+
+	require.NoError(t, provider.ErasePersonalData(ctx, user.ID))
+	history, err := repo.GetHistory(ctx, "site_name")
+	require.NoError(t, err)
+	assert.Equal(t, interfaces.SettingActorDeleted, history[0].Actor)
+	assert.Equal(t, interfaces.SettingActorSystem, history[1].Actor, "changes of the system are not anonymised")
+}
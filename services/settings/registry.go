@@ -0,0 +1,65 @@
+package settings
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// minJWTSigningKeyLength is the shortest signing key accepted, HS256 keys should be at least 256 bits
+const minJWTSigningKeyLength = 32
+
+func validateCookieEncryptionKey(value interface{}) error {
+	key, err := base64.StdEncoding.DecodeString(value.(string))
+	if err != nil {
+		return errors.New("must be base64 encoded")
+	}
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return errors.New("must decode to 16, 24 or 32 bytes")
+	}
+	return nil
+}
+
+func validateJWTSigningKey(value interface{}) error {
+	if len(value.(string)) < minJWTSigningKeyLength {
+		return errors.New("must be at least 32 characters")
+	}
+	return nil
+}
+
+func validateFeatureFlagGroups(value interface{}) error {
+	var groups map[string][]uint
+	if err := json.Unmarshal(value.(json.RawMessage), &groups); err != nil {
+		return errors.New("must map group names to lists of user IDs")
+	}
+	return nil
+}
+
+// Registry returns the definitions of every setting the application stores in the database
+func Registry() []interfaces.SettingDefinition {
+	return []interfaces.SettingDefinition{
+		{
+			Key:         interfaces.SettingCookieEncryptionKey,
+			Type:        interfaces.SettingTypeString,
+			Description: "Base64 encoded AES key cookies are encrypted with, changing it signs everyone out",
+			Secret:      true,
+			Validate:    validateCookieEncryptionKey,
+		},
+		{
+			Key:         interfaces.SettingJWTSigningKey,
+			Type:        interfaces.SettingTypeString,
+			Description: "Key session tokens are signed with, changing it signs everyone out",
+			Secret:      true,
+			Validate:    validateJWTSigningKey,
+		},
+		{
+			Key:         interfaces.SettingFeatureFlagGroups,
+			Type:        interfaces.SettingTypeJSON,
+			Default:     "{}",
+			Description: `Groups feature flags can target, mapping each group name to the IDs of its members like {"beta": [1, 2]}`,
+			Validate:    validateFeatureFlagGroups,
+		},
+	}
+}
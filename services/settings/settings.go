@@ -1,36 +1,520 @@
 package settings
 
-import "github.com/bryopsida/gofiber-pug-starter/interfaces"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// cachedText is the stored text form of a setting, found is false when the default applies
+type cachedText struct {
+	text  string
+	found bool
+}
 
 type settingsService struct {
-	repo interfaces.ISettingsRepository
+	repo         interfaces.ISettingsRepository
+	transactions interfaces.ITransactionManager
+	definitions  []interfaces.SettingDefinition
+	byKey        map[string]*interfaces.SettingDefinition
+
+	mu               sync.RWMutex
+	cache            map[string]cachedText
+	subscribers      map[string]map[int]func(key string)
+	nextSubscriberID int
 }
 
 // NewSettingsService creates a new settingsService instance
-func NewSettingsService(repo interfaces.ISettingsRepository) interfaces.ISettingsService {
-	return &settingsService{repo: repo}
+// - repo: the repository settings are stored in
+// - transactions: changes made within a transaction are only cached and notified once it commits
+// - definitions: the registered settings, any other key is rejected
+func NewSettingsService(repo interfaces.ISettingsRepository, transactions interfaces.ITransactionManager, definitions []interfaces.SettingDefinition) interfaces.ISettingsService {
+	service := &settingsService{
+		repo:         repo,
+		transactions: transactions,
+		definitions:  definitions,
+		byKey:        make(map[string]*interfaces.SettingDefinition, len(definitions)),
+		cache:        map[string]cachedText{},
+		subscribers:  map[string]map[int]func(key string){},
+	}
+	for i := range service.definitions {
+		service.byKey[service.definitions[i].Key] = &service.definitions[i]
+	}
+	return service
+}
+
+// parseText converts the text form of a setting into the Go type of its definition
+func parseText(definition *interfaces.SettingDefinition, text string) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch definition.Type {
+	case interfaces.SettingTypeString:
+		value = text
+	case interfaces.SettingTypeInt:
+		value, err = strconv.Atoi(strings.TrimSpace(text))
+	case interfaces.SettingTypeBool:
+		value, err = strconv.ParseBool(strings.TrimSpace(text))
+	case interfaces.SettingTypeDuration:
+		value, err = time.ParseDuration(strings.TrimSpace(text))
+	case interfaces.SettingTypeFloat:
+		value, err = strconv.ParseFloat(strings.TrimSpace(text), 64)
+	case interfaces.SettingTypeStringList:
+		items := []string{}
+		for _, line := range strings.Split(text, "\n") {
+			if item := strings.TrimSpace(line); item != "" {
+				items = append(items, item)
+			}
+		}
+		value = items
+	case interfaces.SettingTypeJSON:
+		if !json.Valid([]byte(text)) {
+			err = errors.New("not valid JSON")
+		}
+		value = json.RawMessage(text)
+	default:
+		err = fmt.Errorf("unsupported type %q", definition.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", interfaces.ErrInvalidSetting, definition.Key, err)
+	}
+	return value, nil
+}
+
+// formatValue converts a Go value into the text form of a setting
+func formatValue(definition *interfaces.SettingDefinition, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		if definition.Type == interfaces.SettingTypeString {
+			return v, nil
+		}
+	case int:
+		if definition.Type == interfaces.SettingTypeInt {
+			return strconv.Itoa(v), nil
+		}
+	case bool:
+		if definition.Type == interfaces.SettingTypeBool {
+			return strconv.FormatBool(v), nil
+		}
+	case time.Duration:
+		if definition.Type == interfaces.SettingTypeDuration {
+			return v.String(), nil
+		}
+	case float64:
+		if definition.Type == interfaces.SettingTypeFloat {
+			return strconv.FormatFloat(v, 'g', -1, 64), nil
+		}
+	case []string:
+		if definition.Type == interfaces.SettingTypeStringList {
+			for _, item := range v {
+				if strings.Contains(item, "\n") {
+					return "", fmt.Errorf("%w: %s: list items cannot contain new lines", interfaces.ErrInvalidSetting, definition.Key)
+				}
+			}
+			return strings.Join(v, "\n"), nil
+		}
+	}
+	if definition.Type == interfaces.SettingTypeJSON {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s: %v", interfaces.ErrInvalidSetting, definition.Key, err)
+		}
+		return string(encoded), nil
+	}
+	return "", fmt.Errorf("%w: %s is a %s setting", interfaces.ErrInvalidSetting, definition.Key, definition.Type)
+}
+
+// definition looks up a registered setting and checks it has the expected type
+func (s *settingsService) definition(key string, settingType string) (*interfaces.SettingDefinition, error) {
+	definition, ok := s.byKey[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", interfaces.ErrUnknownSetting, key)
+	}
+	if settingType != "" && definition.Type != settingType {
+		return nil, fmt.Errorf("%w: %s is a %s setting", interfaces.ErrInvalidSetting, key, definition.Type)
+	}
+	return definition, nil
+}
+
+// get reads the text form of a setting, falling back to its default, and parses it
+func (s *settingsService) get(ctx context.Context, key string, settingType string) (interface{}, error) {
+	definition, err := s.definition(key, settingType)
+	if err != nil {
+		return nil, err
+	}
+	text, err := s.load(ctx, definition)
+	if err != nil {
+		return nil, err
+	}
+	return parseText(definition, text)
+}
+
+// load reads the text form of a setting through the cache, falling back to its default
+func (s *settingsService) load(ctx context.Context, definition *interfaces.SettingDefinition) (string, error) {
+	s.mu.RLock()
+	cached, ok := s.cache[definition.Key]
+	s.mu.RUnlock()
+	if !ok {
+		text, err := s.repo.GetString(ctx, definition.Key)
+		if err != nil && !errors.Is(err, interfaces.ErrNotFound) {
+			return "", err
+		}
+		cached = cachedText{text: text, found: err == nil}
+		s.mu.Lock()
+		// a concurrent refresh or save may have cached a newer value while the lock was released
+		if existing, ok := s.cache[definition.Key]; ok {
+			cached = existing
+		} else {
+			s.cache[definition.Key] = cached
+		}
+		s.mu.Unlock()
+	}
+	if !cached.found {
+		return definition.Default, nil
+	}
+	return cached.text, nil
+}
+
+// store caches the text form of a setting
+// Returns whether the setting was cached before and whether its value changed
+func (s *settingsService) store(key string, value cachedText) (bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, ok := s.cache[key]
+	s.cache[key] = value
+	return ok, previous != value
+}
+
+// storeAfterCommit caches saved settings and notifies their subscribers once the transaction of ctx commits,
+// so a rollback does not leave uncommitted values cached
+func (s *settingsService) storeAfterCommit(ctx context.Context, texts map[string]string) {
+	s.transactions.AfterCommit(ctx, func() {
+		for _, definition := range s.definitions {
+			text, ok := texts[definition.Key]
+			if !ok {
+				continue
+			}
+			if _, changed := s.store(definition.Key, cachedText{text: text, found: true}); changed {
+				s.notify(definition.Key)
+			}
+		}
+	})
+}
+
+// notify calls the subscribers of a setting outside of the lock so they can read settings
+func (s *settingsService) notify(key string) {
+	s.mu.RLock()
+	callbacks := make([]func(key string), 0, len(s.subscribers[key]))
+	for _, fn := range s.subscribers[key] {
+		callbacks = append(callbacks, fn)
+	}
+	s.mu.RUnlock()
+	for _, fn := range callbacks {
+		fn(key)
+	}
+}
+
+// validate parses the text form of a setting and runs its validation
+func validate(definition *interfaces.SettingDefinition, text string) error {
+	value, err := parseText(definition, text)
+	if err != nil {
+		return err
+	}
+	if definition.Validate != nil {
+		if err := definition.Validate(value); err != nil {
+			return fmt.Errorf("%w: %s: %v", interfaces.ErrInvalidSetting, definition.Key, err)
+		}
+	}
+	return nil
+}
+
+// editable looks up a setting that may be changed from the admin page
+func (s *settingsService) editable(key string) (*interfaces.SettingDefinition, error) {
+	definition, err := s.definition(key, "")
+	if err != nil {
+		return nil, err
+	}
+	if definition.ReadOnly {
+		return nil, fmt.Errorf("%w: %s", interfaces.ErrSettingReadOnly, key)
+	}
+	return definition, nil
+}
+
+// save validates the text form of a setting and stores it
+// - version: the version the setting must be at, nil to overwrite whatever is stored
+func (s *settingsService) save(ctx context.Context, definition *interfaces.SettingDefinition, text string, version *uint, actor interfaces.SettingActor) error {
+	err := validate(definition, text)
+	if err != nil {
+		return err
+	}
+	if version != nil {
+		err = s.repo.SetIfVersion(ctx, definition.Key, text, definition.Secret, *version, actor)
+	} else if definition.Secret {
+		err = s.repo.SetSecret(ctx, definition.Key, text, actor)
+	} else {
+		err = s.repo.Set(ctx, definition.Key, text, actor)
+	}
+	if err != nil {
+		return err
+	}
+	s.storeAfterCommit(ctx, map[string]string{definition.Key: text})
+	return nil
+}
+
+// set formats and stores a Go value
+func (s *settingsService) set(ctx context.Context, key string, value interface{}) error {
+	definition, err := s.definition(key, "")
+	if err != nil {
+		return err
+	}
+	text, err := formatValue(definition, value)
+	if err != nil {
+		return err
+	}
+	return s.save(ctx, definition, text, nil, interfaces.SettingActor{Username: interfaces.SettingActorSystem})
+}
+
+func (s *settingsService) GetString(ctx context.Context, key string) (string, error) {
+	value, err := s.get(ctx, key, interfaces.SettingTypeString)
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+func (s *settingsService) GetInt(ctx context.Context, key string) (int, error) {
+	value, err := s.get(ctx, key, interfaces.SettingTypeInt)
+	if err != nil {
+		return 0, err
+	}
+	return value.(int), nil
+}
+
+func (s *settingsService) GetBool(ctx context.Context, key string) (bool, error) {
+	value, err := s.get(ctx, key, interfaces.SettingTypeBool)
+	if err != nil {
+		return false, err
+	}
+	return value.(bool), nil
+}
+
+func (s *settingsService) GetDuration(ctx context.Context, key string) (time.Duration, error) {
+	value, err := s.get(ctx, key, interfaces.SettingTypeDuration)
+	if err != nil {
+		return 0, err
+	}
+	return value.(time.Duration), nil
+}
+
+func (s *settingsService) GetFloat(ctx context.Context, key string) (float64, error) {
+	value, err := s.get(ctx, key, interfaces.SettingTypeFloat)
+	if err != nil {
+		return 0, err
+	}
+	return value.(float64), nil
+}
+
+func (s *settingsService) GetStringList(ctx context.Context, key string) ([]string, error) {
+	value, err := s.get(ctx, key, interfaces.SettingTypeStringList)
+	if err != nil {
+		return nil, err
+	}
+	return value.([]string), nil
+}
+
+func (s *settingsService) GetJSON(ctx context.Context, key string, target interface{}) error {
+	value, err := s.get(ctx, key, interfaces.SettingTypeJSON)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(value.(json.RawMessage), target)
+}
+
+func (s *settingsService) SetString(ctx context.Context, key string, value string) error {
+	return s.set(ctx, key, value)
+}
+
+func (s *settingsService) SetInt(ctx context.Context, key string, value int) error {
+	return s.set(ctx, key, value)
+}
+
+func (s *settingsService) SetBool(ctx context.Context, key string, value bool) error {
+	return s.set(ctx, key, value)
+}
+
+func (s *settingsService) SetDuration(ctx context.Context, key string, value time.Duration) error {
+	return s.set(ctx, key, value)
+}
+
+func (s *settingsService) SetFloat(ctx context.Context, key string, value float64) error {
+	return s.set(ctx, key, value)
+}
+
+func (s *settingsService) SetStringList(ctx context.Context, key string, value []string) error {
+	return s.set(ctx, key, value)
+}
+
+func (s *settingsService) SetJSON(ctx context.Context, key string, value interface{}) error {
+	return s.set(ctx, key, value)
+}
+
+func (s *settingsService) Definitions() []interfaces.SettingDefinition {
+	return append([]interfaces.SettingDefinition{}, s.definitions...)
+}
+
+func (s *settingsService) GetText(ctx context.Context, key string) (string, error) {
+	definition, err := s.definition(key, "")
+	if err != nil {
+		return "", err
+	}
+	if definition.Secret {
+		return "", nil
+	}
+	return s.load(ctx, definition)
+}
+
+func (s *settingsService) SetText(ctx context.Context, key string, text string, actor interfaces.SettingActor) error {
+	definition, err := s.editable(key)
+	if err != nil {
+		return err
+	}
+	return s.save(ctx, definition, strings.ReplaceAll(text, "\r\n", "\n"), nil, actor)
+}
+
+func (s *settingsService) GetTextVersion(ctx context.Context, key string) (string, uint, error) {
+	definition, err := s.definition(key, "")
+	if err != nil {
+		return "", 0, err
+	}
+	// read past the cache, which another instance may have made stale, so the text matches the version
+	text, version, err := s.repo.GetStringVersion(ctx, key)
+	if errors.Is(err, interfaces.ErrNotFound) {
+		text, version, err = definition.Default, 0, nil
+	}
+	if err != nil || definition.Secret {
+		return "", version, err
+	}
+	return text, version, nil
+}
+
+func (s *settingsService) SetTextIfVersion(ctx context.Context, key string, text string, version uint, actor interfaces.SettingActor) error {
+	definition, err := s.editable(key)
+	if err != nil {
+		return err
+	}
+	return s.save(ctx, definition, strings.ReplaceAll(text, "\r\n", "\n"), &version, actor)
+}
+
+func (s *settingsService) GetValue(ctx context.Context, key string) (interface{}, error) {
+	return s.get(ctx, key, "")
+}
+
+func (s *settingsService) ValidateText(key string, text string) error {
+	definition, err := s.editable(key)
+	if err != nil {
+		return err
+	}
+	return validate(definition, strings.ReplaceAll(text, "\r\n", "\n"))
+}
+
+func (s *settingsService) SetTexts(ctx context.Context, texts map[string]string, actor interfaces.SettingActor) error {
+	normalized, err := s.validateTexts(texts)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetMany(ctx, normalized, actor); err != nil {
+		return err
+	}
+	s.storeAfterCommit(ctx, normalized)
+	return nil
 }
 
-func (s *settingsService) GetString(key string) (string, error) {
-	return s.repo.GetString(key)
+func (s *settingsService) SetTextsIfVersion(ctx context.Context, texts map[string]string, versions map[string]uint, actor interfaces.SettingActor) error {
+	normalized, err := s.validateTexts(texts)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetManyIfVersion(ctx, normalized, versions, actor); err != nil {
+		return err
+	}
+	s.storeAfterCommit(ctx, normalized)
+	return nil
 }
 
-func (s *settingsService) GetInt(key string) (int, error) {
-	return s.repo.GetInt(key)
+// validateTexts checks every text would be accepted for a bulk write
+// Returns the texts with normalized line endings, or the first validation error
+func (s *settingsService) validateTexts(texts map[string]string) (map[string]string, error) {
+	normalized := make(map[string]string, len(texts))
+	for key, text := range texts {
+		definition, err := s.editable(key)
+		if err != nil {
+			return nil, err
+		}
+		if definition.Secret {
+			return nil, fmt.Errorf("%w: %s: secret settings must be set individually", interfaces.ErrInvalidSetting, key)
+		}
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		if err := validate(definition, text); err != nil {
+			return nil, err
+		}
+		normalized[key] = text
+	}
+	return normalized, nil
 }
 
-func (s *settingsService) GetBool(key string) (bool, error) {
-	return s.repo.GetBool(key)
+func (s *settingsService) History(ctx context.Context, key string) ([]interfaces.SettingChange, error) {
+	if _, err := s.definition(key, ""); err != nil {
+		return nil, err
+	}
+	return s.repo.GetHistory(ctx, key)
 }
 
-func (s *settingsService) SetString(key string, value string) error {
-	return s.repo.Set(key, value)
+func (s *settingsService) Rollback(ctx context.Context, changeID uint, version uint, actor interfaces.SettingActor) (*interfaces.SettingChange, error) {
+	change, err := s.repo.GetChange(ctx, changeID)
+	if err != nil {
+		return nil, err
+	}
+	if change.Secret {
+		return change, fmt.Errorf("%w: %s: secret values are not kept in the history", interfaces.ErrInvalidSetting, change.Key)
+	}
+	return change, s.SetTextIfVersion(ctx, change.Key, change.NewValue, version, actor)
 }
 
-func (s *settingsService) SetInt(key string, value int) error {
-	return s.repo.Set(key, value)
+func (s *settingsService) Subscribe(key string, fn func(key string)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextSubscriberID
+	s.nextSubscriberID++
+	if s.subscribers[key] == nil {
+		s.subscribers[key] = map[int]func(key string){}
+	}
+	s.subscribers[key][id] = fn
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subscribers[key], id)
+	}
 }
 
-func (s *settingsService) SetBool(key string, value bool) error {
-	return s.repo.Set(key, value)
+func (s *settingsService) Refresh(ctx context.Context) error {
+	values, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, definition := range s.definitions {
+		text, found := values[definition.Key]
+		// settings nobody has read yet have no one to notify
+		if cached, changed := s.store(definition.Key, cachedText{text: text, found: found}); cached && changed {
+			slog.Info("Setting changed by another instance", "key", definition.Key)
+			s.notify(definition.Key)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,398 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSettingsRepository keeps settings in a map and records which keys were saved as secrets
+type fakeSettingsRepository struct {
+	values   map[string]string
+	secrets  map[string]bool
+	versions map[string]uint
+	changes  []interfaces.SettingChange
+}
+
+func newFakeSettingsRepository() *fakeSettingsRepository {
+	return &fakeSettingsRepository{values: map[string]string{}, secrets: map[string]bool{}, versions: map[string]uint{}}
+}
+
+func (r *fakeSettingsRepository) GetString(ctx context.Context, key string) (string, error) {
+	value, ok := r.values[key]
+	if !ok {
+		return "", interfaces.ErrNotFound
+	}
+	return value, nil
+}
+
+func (r *fakeSettingsRepository) GetInt(ctx context.Context, key string) (int, error) {
+	return 0, errors.New("not used")
+}
+
+func (r *fakeSettingsRepository) GetBool(ctx context.Context, key string) (bool, error) {
+	return false, errors.New("not used")
+}
+
+func (r *fakeSettingsRepository) Set(ctx context.Context, key string, value interface{}, actor interfaces.SettingActor) error {
+	r.record(key, value.(string), actor)
+	r.values[key] = value.(string)
+	return nil
+}
+
+func (r *fakeSettingsRepository) SetMany(ctx context.Context, values map[string]string, actor interfaces.SettingActor) error {
+	for key, value := range values {
+		r.Set(ctx, key, value, actor)
+	}
+	return nil
+}
+
+func (r *fakeSettingsRepository) SetManyIfVersion(ctx context.Context, values map[string]string, versions map[string]uint, actor interfaces.SettingActor) error {
+	for key := range values {
+		if version, ok := versions[key]; !ok || r.versions[key] != version {
+			return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+		}
+	}
+	return r.SetMany(ctx, values, actor)
+}
+
+func (r *fakeSettingsRepository) SetSecret(ctx context.Context, key string, value string, actor interfaces.SettingActor) error {
+	r.values[key] = value
+	r.secrets[key] = true
+	r.record(key, "", actor)
+	return nil
+}
+
+func (r *fakeSettingsRepository) GetStringVersion(ctx context.Context, key string) (string, uint, error) {
+	value, err := r.GetString(ctx, key)
+	return value, r.versions[key], err
+}
+
+func (r *fakeSettingsRepository) SetIfVersion(ctx context.Context, key string, value string, secret bool, version uint, actor interfaces.SettingActor) error {
+	if r.versions[key] != version {
+		return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+	}
+	if secret {
+		return r.SetSecret(ctx, key, value, actor)
+	}
+	return r.Set(ctx, key, value, actor)
+}
+
+func (r *fakeSettingsRepository) record(key string, value string, actor interfaces.SettingActor) {
+	r.versions[key]++
+	r.changes = append(r.changes, interfaces.SettingChange{
+		ID:       uint(len(r.changes) + 1),
+		Key:      key,
+		OldValue: r.values[key],
+		NewValue: value,
+		Secret:   r.secrets[key],
+		Actor:    actor.Username,
+	})
+}
+
+func (r *fakeSettingsRepository) GetHistory(ctx context.Context, key string) ([]interfaces.SettingChange, error) {
+	changes := []interfaces.SettingChange{}
+	for i := len(r.changes) - 1; i >= 0; i-- {
+		if r.changes[i].Key == key {
+			changes = append(changes, r.changes[i])
+		}
+	}
+	return changes, nil
+}
+
+func (r *fakeSettingsRepository) GetChange(ctx context.Context, id uint) (*interfaces.SettingChange, error) {
+	for _, change := range r.changes {
+		if change.ID == id {
+			return &change, nil
+		}
+	}
+	return nil, interfaces.ErrNotFound
+}
+
+func (r *fakeSettingsRepository) GetChangesByActor(ctx context.Context, userID uint) ([]interfaces.SettingChange, error) {
+	return nil, errors.New("not used")
+}
+
+func (r *fakeSettingsRepository) ReplaceActor(ctx context.Context, userID uint, replacement string) error {
+	return errors.New("not used")
+}
+
+func (r *fakeSettingsRepository) MarkSecret(ctx context.Context, key string) error {
+	r.secrets[key] = true
+	return nil
+}
+
+func (r *fakeSettingsRepository) RewrapSecrets(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (r *fakeSettingsRepository) GetAll(ctx context.Context) (map[string]string, error) {
+	values := map[string]string{}
+	for key, value := range r.values {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// fakeTransactions runs the work without a database, the after commit hooks only run when the work succeeds
+type fakeTransactions struct{}
+
+type fakeTransactionKey struct{}
+
+func (f *fakeTransactions) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	hooks := &[]func(){}
+	if err := fn(context.WithValue(ctx, fakeTransactionKey{}, hooks)); err != nil {
+		return err
+	}
+	for _, hook := range *hooks {
+		hook()
+	}
+	return nil
+}
+
+func (f *fakeTransactions) AfterCommit(ctx context.Context, fn func()) {
+	if hooks, ok := ctx.Value(fakeTransactionKey{}).(*[]func()); ok {
+		*hooks = append(*hooks, fn)
+		return
+	}
+	fn()
+}
+
+var testDefinitions = []interfaces.SettingDefinition{
+	{Key: "name", Type: interfaces.SettingTypeString, Default: "starter"},
+	{Key: "retries", Type: interfaces.SettingTypeInt, Default: "3", Validate: func(value interface{}) error {
+		if value.(int) < 0 {
+			return errors.New("must not be negative")
+		}
+		return nil
+	}},
+	{Key: "timeout", Type: interfaces.SettingTypeDuration, Default: "30s"},
+	{Key: "ratio", Type: interfaces.SettingTypeFloat, Default: "0.5"},
+	{Key: "origins", Type: interfaces.SettingTypeStringList, Default: "a\nb"},
+	{Key: "limits", Type: interfaces.SettingTypeJSON, Default: `{"max":1}`},
+	{Key: "token", Type: interfaces.SettingTypeString, Secret: true},
+	{Key: "instance", Type: interfaces.SettingTypeString, ReadOnly: true},
+}
+
+var admin = interfaces.SettingActor{Username: "admin", RequestID: "request"}
+
+func TestDefaults(t *testing.T) {
+	ctx := context.Background()
+	service := NewSettingsService(newFakeSettingsRepository(), &fakeTransactions{}, testDefinitions)
+
+	name, err := service.GetString(ctx, "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "starter", name)
+	retries, _ := service.GetInt(ctx, "retries")
+	assert.Equal(t, 3, retries)
+	timeout, _ := service.GetDuration(ctx, "timeout")
+	assert.Equal(t, 30*time.Second, timeout)
+	ratio, _ := service.GetFloat(ctx, "ratio")
+	assert.Equal(t, 0.5, ratio)
+	origins, _ := service.GetStringList(ctx, "origins")
+	assert.Equal(t, []string{"a", "b"}, origins)
+	var limits map[string]int
+	assert.NoError(t, service.GetJSON(ctx, "limits", &limits))
+	assert.Equal(t, 1, limits["max"])
+}
+
+func TestSetAndGet(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeSettingsRepository()
+	service := NewSettingsService(repo, &fakeTransactions{}, testDefinitions)
+
+	assert.NoError(t, service.SetDuration(ctx, "timeout", time.Minute))
+	assert.NoError(t, service.SetStringList(ctx, "origins", []string{"x", "y"}))
+	assert.NoError(t, service.SetJSON(ctx, "limits", map[string]int{"max": 5}))
+	assert.NoError(t, service.SetString(ctx, "token", "hunter2"))
+
+	assert.Equal(t, "1m0s", repo.values["timeout"])
+	origins, _ := service.GetStringList(ctx, "origins")
+	assert.Equal(t, []string{"x", "y"}, origins)
+	assert.JSONEq(t, `{"max":5}`, repo.values["limits"])
+	assert.True(t, repo.secrets["token"])
+}
+
+func TestRejectsInvalidSettings(t *testing.T) {
+	ctx := context.Background()
+	service := NewSettingsService(newFakeSettingsRepository(), &fakeTransactions{}, testDefinitions)
+
+	_, err := service.GetString(ctx, "missing")
+	assert.ErrorIs(t, err, interfaces.ErrUnknownSetting)
+	assert.ErrorIs(t, service.SetString(ctx, "missing", "value"), interfaces.ErrUnknownSetting)
+	_, err = service.GetString(ctx, "retries")
+	assert.ErrorIs(t, err, interfaces.ErrInvalidSetting)
+	assert.ErrorIs(t, service.SetInt(ctx, "name", 1), interfaces.ErrInvalidSetting)
+	assert.ErrorIs(t, service.SetInt(ctx, "retries", -1), interfaces.ErrInvalidSetting)
+	assert.ErrorIs(t, service.SetText(ctx, "timeout", "soon", admin), interfaces.ErrInvalidSetting)
+	assert.ErrorIs(t, service.SetText(ctx, "limits", "{", admin), interfaces.ErrInvalidSetting)
+	assert.ErrorIs(t, service.SetText(ctx, "instance", "other", admin), interfaces.ErrSettingReadOnly)
+}
+
+func TestText(t *testing.T) {
+	ctx := context.Background()
+	service := NewSettingsService(newFakeSettingsRepository(), &fakeTransactions{}, testDefinitions)
+
+	assert.NoError(t, service.SetText(ctx, "origins", "one\r\n\r\ntwo\r\n", admin))
+	origins, _ := service.GetStringList(ctx, "origins")
+	assert.Equal(t, []string{"one", "two"}, origins)
+
+	assert.NoError(t, service.SetText(ctx, "token", "hunter2", admin))
+	text, err := service.GetText(ctx, "token")
+	assert.NoError(t, err)
+	assert.Empty(t, text)
+	token, _ := service.GetString(ctx, "token")
+	assert.Equal(t, "hunter2", token)
+}
+
+func TestSetTextIfVersion(t *testing.T) {
+	ctx := context.Background()
+	service := NewSettingsService(newFakeSettingsRepository(), &fakeTransactions{}, testDefinitions)
+
+	text, version, err := service.GetTextVersion(ctx, "retries")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", text, "the default applies until the setting is set")
+	assert.Zero(t, version)
+	assert.NoError(t, service.SetTextIfVersion(ctx, "retries", "5", version, admin))
+
+	var conflict *interfaces.ConflictError
+	assert.ErrorAs(t, service.SetTextIfVersion(ctx, "retries", "6", version, admin), &conflict)
+	retries, _ := service.GetInt(ctx, "retries")
+	assert.Equal(t, 5, retries, "a stale version changes nothing")
+	assert.ErrorIs(t, service.SetTextIfVersion(ctx, "retries", "-1", 1, admin), interfaces.ErrInvalidSetting)
+
+	assert.NoError(t, service.SetTextIfVersion(ctx, "token", "hunter2", 0, admin))
+	text, version, err = service.GetTextVersion(ctx, "token")
+	assert.NoError(t, err)
+	assert.Empty(t, text, "secrets are never shown")
+	assert.Equal(t, uint(1), version)
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeSettingsRepository()
+	service := NewSettingsService(repo, &fakeTransactions{}, testDefinitions)
+	changes := []string{}
+	unsubscribe := service.Subscribe("name", func(key string) {
+		value, _ := service.GetString(ctx, key)
+		changes = append(changes, value)
+	})
+
+	assert.NoError(t, service.SetString(ctx, "name", "first"))
+	assert.NoError(t, service.SetString(ctx, "name", "first"))
+	assert.NoError(t, service.SetInt(ctx, "retries", 5))
+	unsubscribe()
+	assert.NoError(t, service.SetString(ctx, "name", "second"))
+
+	assert.Equal(t, []string{"first"}, changes)
+}
+
+func TestSetWithinTransaction(t *testing.T) {
+	ctx := context.Background()
+	transactions := &fakeTransactions{}
+	service := NewSettingsService(newFakeSettingsRepository(), transactions, testDefinitions)
+	name, _ := service.GetString(ctx, "name")
+	assert.Equal(t, "starter", name)
+	changes := []string{}
+	service.Subscribe("name", func(key string) {
+		changes = append(changes, key)
+	})
+
+	err := transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+		assert.NoError(t, service.SetString(ctx, "name", "rolledback"))
+		return assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	name, _ = service.GetString(ctx, "name")
+	assert.Equal(t, "starter", name, "a rolled back value is not cached")
+	assert.Empty(t, changes, "subscribers are not told about a rolled back value")
+
+	assert.NoError(t, transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+		assert.NoError(t, service.SetTexts(ctx, map[string]string{"name": "committed"}, admin))
+		assert.Empty(t, changes, "subscribers are told once the transaction commits")
+		return nil
+	}))
+	name, _ = service.GetString(ctx, "name")
+	assert.Equal(t, "committed", name)
+	assert.Equal(t, []string{"name"}, changes)
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeSettingsRepository()
+	service := NewSettingsService(repo, &fakeTransactions{}, testDefinitions)
+	name, _ := service.GetString(ctx, "name")
+	assert.Equal(t, "starter", name)
+	changes := []string{}
+	service.Subscribe("name", func(key string) {
+		changes = append(changes, key)
+	})
+
+	// another instance writes straight to the shared database
+	repo.values["name"] = "renamed"
+	name, _ = service.GetString(ctx, "name")
+	assert.Equal(t, "starter", name, "reads are served from the cache until a refresh")
+
+	assert.NoError(t, service.Refresh(ctx))
+	name, _ = service.GetString(ctx, "name")
+	assert.Equal(t, "renamed", name)
+	assert.Equal(t, []string{"name"}, changes)
+
+	assert.NoError(t, service.Refresh(ctx))
+	assert.Len(t, changes, 1)
+}
+
+func TestHistoryAndRollback(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeSettingsRepository()
+	service := NewSettingsService(repo, &fakeTransactions{}, testDefinitions)
+	assert.NoError(t, service.SetText(ctx, "name", "first", admin))
+	assert.NoError(t, service.SetText(ctx, "name", "second", admin))
+
+	history, err := service.History(ctx, "name")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "second", history[0].NewValue)
+	assert.Equal(t, "first", history[0].OldValue)
+	assert.Equal(t, "admin", history[0].Actor)
+
+	_, version, err := service.GetTextVersion(ctx, "name")
+	assert.NoError(t, err)
+	_, err = service.Rollback(ctx, history[1].ID, version-1, admin)
+	assert.ErrorIs(t, err, interfaces.ErrConflict, "a change made since the history was loaded is not overwritten")
+	name, _ := service.GetString(ctx, "name")
+	assert.Equal(t, "second", name)
+
+	change, err := service.Rollback(ctx, history[1].ID, version, admin)
+	assert.NoError(t, err)
+	assert.Equal(t, "name", change.Key)
+	name, _ = service.GetString(ctx, "name")
+	assert.Equal(t, "first", name)
+	history, _ = service.History(ctx, "name")
+	assert.Len(t, history, 3)
+
+	_, err = service.History(ctx, "missing")
+	assert.ErrorIs(t, err, interfaces.ErrUnknownSetting)
+	_, err = service.Rollback(ctx, 99, version, admin)
+	assert.ErrorIs(t, err, interfaces.ErrNotFound)
+}
+
+func TestRollbackRejectsSecrets(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeSettingsRepository()
+	service := NewSettingsService(repo, &fakeTransactions{}, testDefinitions)
+	assert.NoError(t, service.SetText(ctx, "token", "first", admin))
+	assert.NoError(t, service.SetText(ctx, "token", "second", admin))
+
+	history, _ := service.History(ctx, "token")
+	_, version, _ := service.GetTextVersion(ctx, "token")
+	_, err := service.Rollback(ctx, history[1].ID, version, admin)
+
+	assert.ErrorIs(t, err, interfaces.ErrInvalidSetting)
+	token, _ := service.GetString(ctx, "token")
+	assert.Equal(t, "second", token)
+}
@@ -0,0 +1,244 @@
+package settingsbulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"gopkg.in/yaml.v3"
+)
+
+type settingsBulkService struct {
+	settingsService interfaces.ISettingsService
+}
+
+// NewSettingsBulkService creates a new settingsBulkService instance
+func NewSettingsBulkService(settingsService interfaces.ISettingsService) interfaces.ISettingsBulkService {
+	return &settingsBulkService{settingsService: settingsService}
+}
+
+// exportValue converts a setting value into a value that encodes naturally in YAML and JSON
+func exportValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.String(), nil
+	case json.RawMessage:
+		var decoded interface{}
+		if err := json.Unmarshal(v, &decoded); err != nil {
+			return nil, err
+		}
+		return decoded, nil
+	default:
+		return v, nil
+	}
+}
+
+func (s *settingsBulkService) ExportSettings(ctx context.Context, format string, w io.Writer) error {
+	if format != interfaces.ImportFormatYAML && format != interfaces.ImportFormatJSON {
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+	document := map[string]interface{}{}
+	for _, definition := range s.settingsService.Definitions() {
+		if definition.Secret {
+			continue
+		}
+		value, err := s.settingsService.GetValue(ctx, definition.Key)
+		if err != nil {
+			return err
+		}
+		if document[definition.Key], err = exportValue(value); err != nil {
+			return err
+		}
+	}
+	if format == interfaces.ImportFormatYAML {
+		encoder := yaml.NewEncoder(w)
+		if err := encoder.Encode(document); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document)
+}
+
+func parse(format string, data []byte) (map[string]interface{}, error) {
+	document := map[string]interface{}{}
+	switch format {
+	case interfaces.ImportFormatYAML:
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("failed to parse yaml: %w", err)
+		}
+	case interfaces.ImportFormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&document); err != nil {
+			return nil, fmt.Errorf("failed to parse json: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+	if len(document) == 0 {
+		return nil, errors.New("import contains no settings")
+	}
+	return document, nil
+}
+
+// importText converts a decoded YAML or JSON value into the text form of a setting
+func importText(definition *interfaces.SettingDefinition, value interface{}) (string, error) {
+	switch definition.Type {
+	case interfaces.SettingTypeString, interfaces.SettingTypeDuration:
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+		return "", errors.New("must be a string")
+	case interfaces.SettingTypeBool:
+		if flag, ok := value.(bool); ok {
+			return strconv.FormatBool(flag), nil
+		}
+		return "", errors.New("must be true or false")
+	case interfaces.SettingTypeInt:
+		switch v := value.(type) {
+		case int:
+			return strconv.Itoa(v), nil
+		case json.Number:
+			return v.String(), nil
+		case float64:
+			if v == math.Trunc(v) {
+				return strconv.FormatInt(int64(v), 10), nil
+			}
+		}
+		return "", errors.New("must be a whole number")
+	case interfaces.SettingTypeFloat:
+		switch v := value.(type) {
+		case int:
+			return strconv.Itoa(v), nil
+		case json.Number:
+			return v.String(), nil
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64), nil
+		}
+		return "", errors.New("must be a number")
+	case interfaces.SettingTypeStringList:
+		items, ok := value.([]interface{})
+		if !ok {
+			return "", errors.New("must be a list of strings")
+		}
+		lines := make([]string, len(items))
+		for i, item := range items {
+			line, ok := item.(string)
+			if !ok || strings.Contains(line, "\n") {
+				return "", errors.New("must be a list of single line strings")
+			}
+			lines[i] = line
+		}
+		return strings.Join(lines, "\n"), nil
+	case interfaces.SettingTypeJSON:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	default:
+		return "", fmt.Errorf("unsupported type %q", definition.Type)
+	}
+}
+
+// diff compares every imported setting with its current value
+// Returns the rows sorted by key and true if every row is valid
+func (s *settingsBulkService) diff(ctx context.Context, document map[string]interface{}) ([]interfaces.SettingImportRow, bool, error) {
+	definitions := map[string]*interfaces.SettingDefinition{}
+	registered := s.settingsService.Definitions()
+	for i := range registered {
+		definitions[registered[i].Key] = &registered[i]
+	}
+	keys := make([]string, 0, len(document))
+	for key := range document {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rows := make([]interfaces.SettingImportRow, 0, len(keys))
+	valid := true
+	for _, key := range keys {
+		row := interfaces.SettingImportRow{Key: key}
+		definition, ok := definitions[key]
+		switch {
+		case !ok:
+			row.Error = "unknown setting"
+		case definition.Secret:
+			row.Error = "secret settings cannot be imported"
+		default:
+			current, version, err := s.settingsService.GetTextVersion(ctx, key)
+			if err != nil {
+				return nil, false, err
+			}
+			row.Current = current
+			row.Version = version
+			row.New, err = importText(definition, document[key])
+			if err != nil {
+				row.Error = err.Error()
+			} else if err := s.settingsService.ValidateText(key, row.New); err != nil {
+				row.Error = err.Error()
+			}
+			row.Changed = row.Current != row.New
+		}
+		if row.Error != "" {
+			valid = false
+		}
+		rows = append(rows, row)
+	}
+	return rows, valid, nil
+}
+
+func (s *settingsBulkService) PreviewImport(ctx context.Context, format string, data []byte) ([]interfaces.SettingImportRow, error) {
+	document, err := parse(format, data)
+	if err != nil {
+		return nil, err
+	}
+	rows, _, err := s.diff(ctx, document)
+	return rows, err
+}
+
+func (s *settingsBulkService) ApplyImport(ctx context.Context, format string, data []byte, versions map[string]uint, actor interfaces.SettingActor) ([]interfaces.SettingImportRow, error) {
+	document, err := parse(format, data)
+	if err != nil {
+		return nil, err
+	}
+	rows, valid, err := s.diff(ctx, document)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return rows, interfaces.ErrImportInvalid
+	}
+	changes := map[string]string{}
+	for _, row := range rows {
+		// a setting the preview showed unchanged may have changed since, it must match the preview as well
+		if versions != nil {
+			if version, ok := versions[row.Key]; !ok || version != row.Version {
+				return rows, &interfaces.ConflictError{Field: interfaces.FieldVersion}
+			}
+		}
+		if row.Changed {
+			changes[row.Key] = row.New
+		}
+	}
+	if len(changes) == 0 {
+		return rows, nil
+	}
+	if versions == nil {
+		return rows, s.settingsService.SetTexts(ctx, changes, actor)
+	}
+	// checked again when writing so a change made after the diff is not overwritten either
+	return rows, s.settingsService.SetTextsIfVersion(ctx, changes, versions, actor)
+}
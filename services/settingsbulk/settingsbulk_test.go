@@ -0,0 +1,171 @@
+package settingsbulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// fakeSettingsService embeds the interface so only the methods used by the bulk service need implementing
+type fakeSettingsService struct {
+	interfaces.ISettingsService
+	texts    map[string]string
+	versions map[string]uint
+	applied  map[string]string
+}
+
+func newFakeSettingsService() *fakeSettingsService {
+	return &fakeSettingsService{texts: map[string]string{
+		"retries": "3",
+		"timeout": "30s",
+		"origins": "a\nb",
+		"limits":  `{"max":1}`,
+	}, versions: map[string]uint{"retries": 2}}
+}
+
+func (s *fakeSettingsService) Definitions() []interfaces.SettingDefinition {
+	return []interfaces.SettingDefinition{
+		{Key: "retries", Type: interfaces.SettingTypeInt},
+		{Key: "timeout", Type: interfaces.SettingTypeDuration},
+		{Key: "origins", Type: interfaces.SettingTypeStringList},
+		{Key: "limits", Type: interfaces.SettingTypeJSON},
+		{Key: "token", Type: interfaces.SettingTypeString, Secret: true},
+	}
+}
+
+func (s *fakeSettingsService) GetValue(ctx context.Context, key string) (interface{}, error) {
+	switch key {
+	case "retries":
+		return strconv.Atoi(s.texts[key])
+	case "timeout":
+		return time.ParseDuration(s.texts[key])
+	case "origins":
+		return []string{"a", "b"}, nil
+	case "limits":
+		return json.RawMessage(s.texts[key]), nil
+	}
+	return nil, errors.New("unexpected key " + key)
+}
+
+func (s *fakeSettingsService) GetTextVersion(ctx context.Context, key string) (string, uint, error) {
+	return s.texts[key], s.versions[key], nil
+}
+
+func (s *fakeSettingsService) ValidateText(key string, text string) error {
+	if key == "timeout" {
+		if _, err := time.ParseDuration(text); err != nil {
+			return interfaces.ErrInvalidSetting
+		}
+	}
+	return nil
+}
+
+func (s *fakeSettingsService) SetTexts(ctx context.Context, texts map[string]string, actor interfaces.SettingActor) error {
+	s.applied = texts
+	return nil
+}
+
+func (s *fakeSettingsService) SetTextsIfVersion(ctx context.Context, texts map[string]string, versions map[string]uint, actor interfaces.SettingActor) error {
+	for key := range texts {
+		if versions[key] != s.versions[key] {
+			return &interfaces.ConflictError{Field: interfaces.FieldVersion}
+		}
+	}
+	return s.SetTexts(ctx, texts, actor)
+}
+
+func TestExportSettings(t *testing.T) {
+	ctx := context.Background()
+	service := NewSettingsBulkService(newFakeSettingsService())
+
+	var out bytes.Buffer
+	assert.NoError(t, service.ExportSettings(ctx, interfaces.ImportFormatYAML, &out))
+
+	exported := map[string]interface{}{}
+	assert.NoError(t, yaml.Unmarshal(out.Bytes(), &exported))
+	assert.Equal(t, 3, exported["retries"])
+	assert.Equal(t, "30s", exported["timeout"])
+	assert.Equal(t, []interface{}{"a", "b"}, exported["origins"])
+	assert.Equal(t, map[string]interface{}{"max": 1}, exported["limits"])
+	assert.NotContains(t, exported, "token")
+}
+
+func TestPreviewImport(t *testing.T) {
+	ctx := context.Background()
+	service := NewSettingsBulkService(newFakeSettingsService())
+
+	rows, err := service.PreviewImport(ctx, interfaces.ImportFormatYAML, []byte("retries: 5\ntimeout: 30s\ntoken: x\nbogus: 1\norigins: [a, 2]\n"))
+
+	assert.NoError(t, err)
+	assert.Len(t, rows, 5)
+	assert.Equal(t, "bogus", rows[0].Key)
+	assert.Equal(t, "unknown setting", rows[0].Error)
+	assert.Equal(t, "origins", rows[1].Key)
+	assert.NotEmpty(t, rows[1].Error)
+	assert.Equal(t, interfaces.SettingImportRow{Key: "retries", Current: "3", Version: 2, New: "5", Changed: true}, rows[2])
+	assert.Equal(t, interfaces.SettingImportRow{Key: "timeout", Current: "30s", New: "30s"}, rows[3])
+	assert.Equal(t, "secret settings cannot be imported", rows[4].Error)
+}
+
+func TestApplyImport(t *testing.T) {
+	ctx := context.Background()
+	t.Run("applies only changed settings", func(t *testing.T) {
+		settings := newFakeSettingsService()
+		service := NewSettingsBulkService(settings)
+
+		_, err := service.ApplyImport(ctx, interfaces.ImportFormatJSON, []byte(`{"retries": 5, "timeout": "30s", "limits": {"max": 2}}`), nil, interfaces.SettingActor{Username: "admin"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"retries": "5", "limits": `{"max":2}`}, settings.applied)
+	})
+
+	t.Run("applies nothing when a setting is invalid", func(t *testing.T) {
+		settings := newFakeSettingsService()
+		service := NewSettingsBulkService(settings)
+
+		rows, err := service.ApplyImport(ctx, interfaces.ImportFormatJSON, []byte(`{"retries": 5, "timeout": "soon"}`), nil, interfaces.SettingActor{Username: "admin"})
+
+		assert.ErrorIs(t, err, interfaces.ErrImportInvalid)
+		assert.NotEmpty(t, rows[1].Error)
+		assert.Nil(t, settings.applied)
+	})
+
+	t.Run("applies the previewed versions", func(t *testing.T) {
+		settings := newFakeSettingsService()
+		service := NewSettingsBulkService(settings)
+		data := []byte(`{"retries": 5, "timeout": "30s"}`)
+
+		_, err := service.ApplyImport(ctx, interfaces.ImportFormatJSON, data, map[string]uint{"retries": 2, "timeout": 0}, interfaces.SettingActor{Username: "admin"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"retries": "5"}, settings.applied)
+	})
+
+	t.Run("applies nothing when a setting changed since the preview", func(t *testing.T) {
+		data := []byte(`{"retries": 5, "timeout": "30s"}`)
+		for name, versions := range map[string]map[string]uint{
+			"changed setting":           {"retries": 1, "timeout": 0},
+			"unchanged setting changed": {"retries": 2, "timeout": 1},
+			"setting not previewed":     {"retries": 2},
+		} {
+			settings := newFakeSettingsService()
+			service := NewSettingsBulkService(settings)
+
+			_, err := service.ApplyImport(ctx, interfaces.ImportFormatJSON, data, versions, interfaces.SettingActor{Username: "admin"})
+
+			var conflict *interfaces.ConflictError
+			if assert.ErrorAs(t, err, &conflict, name) {
+				assert.Equal(t, interfaces.FieldVersion, conflict.Field, name)
+			}
+			assert.Nil(t, settings.applied, name)
+		}
+	})
+}
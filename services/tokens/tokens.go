@@ -0,0 +1,114 @@
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+const tokenLength = 32
+
+type tokenService struct {
+	repo interfaces.IUserTokenRepository
+}
+
+// NewTokenService creates a new tokenService instance
+func NewTokenService(repo interfaces.IUserTokenRepository) interfaces.ITokenService {
+	return &tokenService{repo: repo}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *tokenService) Issue(ctx context.Context, userID uint, purpose string, data string, ttl time.Duration) (string, error) {
+	randomBytes := make([]byte, tokenLength)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(randomBytes)
+	err := s.repo.CreateToken(ctx, &interfaces.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		Data:      data,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *tokenService) Verify(ctx context.Context, purpose string, token string) (*interfaces.UserToken, error) {
+	if token == "" {
+		return nil, interfaces.ErrTokenInvalid
+	}
+	userToken, err := s.repo.GetTokenByHash(ctx, purpose, hashToken(token))
+	if errors.Is(err, interfaces.ErrNotFound) {
+		return nil, interfaces.ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(userToken.ExpiresAt) {
+		return nil, interfaces.ErrTokenInvalid
+	}
+	return userToken, nil
+}
+
+func (s *tokenService) Consume(ctx context.Context, purpose string, token string) (*interfaces.UserToken, error) {
+	userToken, err := s.Verify(ctx, purpose, token)
+	if err != nil {
+		return nil, err
+	}
+	// the delete is the redemption, only the caller that removes the token may use it
+	deleted, err := s.repo.DeleteToken(ctx, userToken.ID, userToken.TokenHash, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, interfaces.ErrTokenInvalid
+	}
+	return userToken, nil
+}
+
+// exportedToken is a token included in a personal data export, it intentionally omits the token hash
+type exportedToken struct {
+	Purpose   string    `json:"purpose"`
+	Data      string    `json:"data,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *tokenService) PersonalDataName() string {
+	return "tokens"
+}
+
+func (s *tokenService) ExportPersonalData(ctx context.Context, userID uint) ([]interfaces.PersonalDataFile, error) {
+	tokens, err := s.repo.GetTokensForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	exported := make([]exportedToken, len(tokens))
+	for i, token := range tokens {
+		exported[i] = exportedToken{Purpose: token.Purpose, Data: token.Data, CreatedAt: token.CreatedAt, ExpiresAt: token.ExpiresAt}
+	}
+	content, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []interfaces.PersonalDataFile{{Name: "tokens.json", Content: content}}, nil
+}
+
+func (s *tokenService) ErasePersonalData(ctx context.Context, userID uint) error {
+	return s.repo.DeleteAllTokensForUser(ctx, userID)
+}
@@ -0,0 +1,77 @@
+package tokens
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/database/dbtest"
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	tokens_repository "github.com/bryopsida/gofiber-pug-starter/repositories/tokens"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// barrierRepository holds every token lookup until all callers have looked the token up,
+// so concurrent redemptions all pass verification before any of them deletes the token
+type barrierRepository struct {
+	interfaces.IUserTokenRepository
+	lookups *sync.WaitGroup
+}
+
+func (r *barrierRepository) GetTokenByHash(ctx context.Context, purpose string, tokenHash string) (*interfaces.UserToken, error) {
+	token, err := r.IUserTokenRepository.GetTokenByHash(ctx, purpose, tokenHash)
+	r.lookups.Done()
+	r.lookups.Wait()
+	return token, err
+}
+
+func TestConsume(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *gorm.DB, _ interfaces.ISecretCipher) {
+		ctx := context.Background()
+		service := NewTokenService(tokens_repository.NewUserTokenRepository(db))
+
+		t.Run("a token is used once", func(t *testing.T) {
+			token, err := service.Issue(ctx, 1, interfaces.TokenPurposeInvitation, "", time.Hour)
+			assert.NoError(t, err)
+
+			_, err = service.Consume(ctx, interfaces.TokenPurposeInvitation, token)
+			assert.NoError(t, err)
+			_, err = service.Consume(ctx, interfaces.TokenPurposeInvitation, token)
+			assert.ErrorIs(t, err, interfaces.ErrTokenInvalid)
+		})
+
+		t.Run("concurrent redemptions", func(t *testing.T) {
+			token, err := service.Issue(ctx, 1, interfaces.TokenPurposeInvitation, "", time.Hour)
+			assert.NoError(t, err)
+			errs := make([]error, 2)
+			var lookups sync.WaitGroup
+			lookups.Add(len(errs))
+			racing := NewTokenService(&barrierRepository{
+				IUserTokenRepository: tokens_repository.NewUserTokenRepository(db),
+				lookups:              &lookups,
+			})
+
+			var wg sync.WaitGroup
+			for i := range errs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, errs[i] = racing.Consume(ctx, interfaces.TokenPurposeInvitation, token)
+				}(i)
+			}
+			wg.Wait()
+
+			succeeded := 0
+			for _, err := range errs {
+				if err == nil {
+					succeeded++
+				} else {
+					assert.ErrorIs(t, err, interfaces.ErrTokenInvalid)
+				}
+			}
+			assert.Equal(t, 1, succeeded, "only one redemption may succeed")
+		})
+	})
+}
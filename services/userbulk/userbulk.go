@@ -0,0 +1,307 @@
+package userbulk
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+const (
+	// invitationTTL is how long an imported user has to accept their invitation
+	invitationTTL = 7 * 24 * time.Hour
+	// temporaryPasswordBytes is the amount of randomness in a generated password
+	temporaryPasswordBytes = 12
+	maxUsernameLength      = 64
+)
+
+var validRoles = map[string]bool{
+	interfaces.RoleAdmin:  true,
+	interfaces.RoleUser:   true,
+	interfaces.RoleViewer: true,
+}
+
+// exportedUser is the shape of a user in an export, it intentionally omits the password hash
+type exportedUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+type userBulkService struct {
+	usersService    interfaces.IUsersService
+	passwordService interfaces.IPasswordService
+	tokenService    interfaces.ITokenService
+	transactions    interfaces.ITransactionManager
+}
+
+// NewUserBulkService creates a new userBulkService instance
+// - transactions: runs the creation of the users and their invitations as a single transaction
+func NewUserBulkService(usersService interfaces.IUsersService, passwordService interfaces.IPasswordService, tokenService interfaces.ITokenService, transactions interfaces.ITransactionManager) interfaces.IUserBulkService {
+	return &userBulkService{
+		usersService:    usersService,
+		passwordService: passwordService,
+		tokenService:    tokenService,
+		transactions:    transactions,
+	}
+}
+
+func randomString(length int) (string, error) {
+	randomBytes := make([]byte, length)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+func parseCSV(data []byte) ([]interfaces.UserImportRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"username", "email"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("csv header is missing the %s column", required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	rows := []interfaces.UserImportRow{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, interfaces.UserImportRow{
+			Line:     line,
+			Username: field(record, "username"),
+			Email:    field(record, "email"),
+			Role:     field(record, "role"),
+		})
+	}
+	return rows, nil
+}
+
+func parseJSON(data []byte) ([]interfaces.UserImportRow, error) {
+	rows := []interfaces.UserImportRow{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse json: %w", err)
+	}
+	for i := range rows {
+		rows[i].Line = i + 1
+	}
+	return rows, nil
+}
+
+func parse(format string, data []byte) ([]interfaces.UserImportRow, error) {
+	switch format {
+	case interfaces.ImportFormatCSV:
+		return parseCSV(data)
+	case interfaces.ImportFormatJSON:
+		return parseJSON(data)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+// validate normalizes the rows and records any validation errors against them
+// Returns true if every row is valid
+func (s *userBulkService) validate(ctx context.Context, rows []interfaces.UserImportRow) bool {
+	seenUsernames := map[string]int{}
+	seenEmails := map[string]int{}
+	valid := true
+	for i := range rows {
+		row := &rows[i]
+		row.Username = strings.TrimSpace(row.Username)
+		row.Email = strings.TrimSpace(row.Email)
+		row.Role = strings.ToLower(strings.TrimSpace(row.Role))
+		if row.Role == "" {
+			row.Role = interfaces.RoleUser
+		}
+
+		if row.Username == "" {
+			row.Errors = append(row.Errors, "username is required")
+		} else if len(row.Username) > maxUsernameLength {
+			row.Errors = append(row.Errors, "username must be at most "+strconv.Itoa(maxUsernameLength)+" characters")
+		} else if line, ok := seenUsernames[row.Username]; ok {
+			row.Errors = append(row.Errors, fmt.Sprintf("username duplicates line %d", line))
+		} else if _, err := s.usersService.GetUserByUsername(ctx, row.Username); err == nil {
+			row.Errors = append(row.Errors, "username already exists")
+		}
+
+		if row.Email == "" {
+			row.Errors = append(row.Errors, "email is required")
+		} else if addr, err := mail.ParseAddress(row.Email); err != nil || addr.Address != row.Email {
+			row.Errors = append(row.Errors, "email is not a valid address")
+		} else if line, ok := seenEmails[row.Email]; ok {
+			row.Errors = append(row.Errors, fmt.Sprintf("email duplicates line %d", line))
+		} else if _, err := s.usersService.GetUserByEmail(ctx, row.Email); err == nil {
+			row.Errors = append(row.Errors, "email already exists")
+		}
+
+		if !validRoles[row.Role] {
+			row.Errors = append(row.Errors, fmt.Sprintf("role %q is not one of admin, user or viewer", row.Role))
+		}
+
+		if _, ok := seenUsernames[row.Username]; !ok && row.Username != "" {
+			seenUsernames[row.Username] = row.Line
+		}
+		if _, ok := seenEmails[row.Email]; !ok && row.Email != "" {
+			seenEmails[row.Email] = row.Line
+		}
+		if len(row.Errors) > 0 {
+			valid = false
+		}
+	}
+	return valid
+}
+
+func (s *userBulkService) PreviewImport(ctx context.Context, format string, data []byte) ([]interfaces.UserImportRow, error) {
+	rows, err := parse(format, data)
+	if err != nil {
+		return nil, err
+	}
+	s.validate(ctx, rows)
+	return rows, nil
+}
+
+func (s *userBulkService) ApplyImport(ctx context.Context, format string, data []byte, mode string) ([]interfaces.UserImportRow, error) {
+	if mode != interfaces.ImportModeTemporaryPassword && mode != interfaces.ImportModeInvitation {
+		return nil, fmt.Errorf("unsupported import mode %q", mode)
+	}
+	rows, err := parse(format, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("import contains no rows")
+	}
+	if !s.validate(ctx, rows) {
+		return rows, interfaces.ErrImportInvalid
+	}
+
+	users := make([]*interfaces.User, len(rows))
+	for i := range rows {
+		// invited users get a password nobody knows until they accept the invitation
+		password, err := randomString(temporaryPasswordBytes)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash, err := s.passwordService.Hash(password)
+		if err != nil {
+			return nil, err
+		}
+		if mode == interfaces.ImportModeTemporaryPassword {
+			rows[i].TemporaryPassword = password
+		}
+		users[i] = &interfaces.User{
+			Username:     rows[i].Username,
+			Email:        rows[i].Email,
+			Role:         rows[i].Role,
+			PasswordHash: passwordHash,
+		}
+	}
+	// users without their invitation could never sign in, so either everything is created or nothing is
+	err = s.transactions.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.usersService.CreateUsers(ctx, users); err != nil {
+			return err
+		}
+		if mode != interfaces.ImportModeInvitation {
+			return nil
+		}
+		for i, user := range users {
+			token, err := s.tokenService.Issue(ctx, user.ID, interfaces.TokenPurposeInvitation, "", invitationTTL)
+			if err != nil {
+				return err
+			}
+			rows[i].InvitationToken = token
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// csvCell keeps a spreadsheet from evaluating a value as a formula by prefixing values that start with a formula
+// character with a quote, spreadsheets show the value as text without the quote
+func csvCell(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@\t\r") {
+		return "'" + value
+	}
+	return value
+}
+
+func (s *userBulkService) ExportUsers(ctx context.Context, format string, w io.Writer) error {
+	switch format {
+	case interfaces.ImportFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"id", "username", "email", "role"}); err != nil {
+			return err
+		}
+		err := s.usersService.ForEachUser(ctx, func(user *interfaces.User) error {
+			writer.Write([]string{strconv.FormatUint(uint64(user.ID), 10), csvCell(user.Username), csvCell(user.Email), csvCell(user.Role)})
+			writer.Flush()
+			return writer.Error()
+		})
+		if err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	case interfaces.ImportFormatJSON:
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+		first := true
+		err := s.usersService.ForEachUser(ctx, func(user *interfaces.User) error {
+			if !first {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+			encoded, err := json.Marshal(exportedUser{ID: user.ID, Username: user.Username, Email: user.Email, Role: user.Role})
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(encoded)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "]")
+		return err
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+}
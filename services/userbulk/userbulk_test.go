@@ -0,0 +1,285 @@
+package userbulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockUsersService is a mock implementation of the IUsersService interface
+type MockUsersService struct {
+	mock.Mock
+}
+
+func (m *MockUsersService) CreateUser(ctx context.Context, user *interfaces.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *MockUsersService) CreateUsers(ctx context.Context, users []*interfaces.User) error {
+	args := m.Called(users)
+	return args.Error(0)
+}
+
+func (m *MockUsersService) GetUserByID(ctx context.Context, id uint) (*interfaces.User, error) {
+	args := m.Called(id)
+	return args.Get(0).(*interfaces.User), args.Error(1)
+}
+
+func (m *MockUsersService) GetUserByUsername(ctx context.Context, username string) (*interfaces.User, error) {
+	args := m.Called(username)
+	return args.Get(0).(*interfaces.User), args.Error(1)
+}
+
+func (m *MockUsersService) GetUserByEmail(ctx context.Context, email string) (*interfaces.User, error) {
+	args := m.Called(email)
+	return args.Get(0).(*interfaces.User), args.Error(1)
+}
+
+func (m *MockUsersService) ForEachUser(ctx context.Context, fn func(user *interfaces.User) error) error {
+	args := m.Called(fn)
+	for _, user := range args.Get(0).([]interfaces.User) {
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockUsersService) GetUsersDueForDeletion(ctx context.Context, before time.Time) ([]*interfaces.User, error) {
+	args := m.Called(before)
+	return args.Get(0).([]*interfaces.User), args.Error(1)
+}
+
+func (m *MockUsersService) UpdateUser(ctx context.Context, user *interfaces.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *MockUsersService) DeleteUser(ctx context.Context, id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockUsersService) PersonalDataName() string {
+	return "profile"
+}
+
+func (m *MockUsersService) ExportPersonalData(ctx context.Context, userID uint) ([]interfaces.PersonalDataFile, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]interfaces.PersonalDataFile), args.Error(1)
+}
+
+func (m *MockUsersService) ErasePersonalData(ctx context.Context, userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+// MockPasswordService is a mock implementation of the IPasswordService interface
+type MockPasswordService struct {
+	mock.Mock
+}
+
+func (m *MockPasswordService) Hash(plaintext string) (string, error) {
+	args := m.Called(plaintext)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockPasswordService) Verify(plaintext, encodedHash string) (bool, error) {
+	args := m.Called(plaintext, encodedHash)
+	return args.Bool(0), args.Error(1)
+}
+
+// MockTokenService is a mock implementation of the ITokenService interface
+type MockTokenService struct {
+	mock.Mock
+}
+
+func (m *MockTokenService) Issue(ctx context.Context, userID uint, purpose string, data string, ttl time.Duration) (string, error) {
+	args := m.Called(userID, purpose)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockTokenService) Verify(ctx context.Context, purpose string, token string) (*interfaces.UserToken, error) {
+	args := m.Called(purpose, token)
+	return args.Get(0).(*interfaces.UserToken), args.Error(1)
+}
+
+func (m *MockTokenService) Consume(ctx context.Context, purpose string, token string) (*interfaces.UserToken, error) {
+	args := m.Called(purpose, token)
+	return args.Get(0).(*interfaces.UserToken), args.Error(1)
+}
+
+func (m *MockTokenService) PersonalDataName() string {
+	return "tokens"
+}
+
+func (m *MockTokenService) ExportPersonalData(ctx context.Context, userID uint) ([]interfaces.PersonalDataFile, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]interfaces.PersonalDataFile), args.Error(1)
+}
+
+func (m *MockTokenService) ErasePersonalData(ctx context.Context, userID uint) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+// fakeTransactions runs the work without a database and records the outcome of each transaction
+type fakeTransactions struct {
+	outcomes []error
+}
+
+func (f *fakeTransactions) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	f.outcomes = append(f.outcomes, err)
+	return err
+}
+
+func (f *fakeTransactions) AfterCommit(ctx context.Context, fn func()) {
+	fn()
+}
+
+func TestPreviewImport(t *testing.T) {
+	ctx := context.Background()
+	t.Run("reports per row errors", func(t *testing.T) {
+		usersService := new(MockUsersService)
+		service := NewUserBulkService(usersService, nil, nil, nil)
+		usersService.On("GetUserByUsername", "alice").Return(&interfaces.User{}, interfaces.ErrNotFound)
+		usersService.On("GetUserByUsername", "admin").Return(&interfaces.User{ID: 1}, nil)
+		usersService.On("GetUserByEmail", "alice@example.com").Return(&interfaces.User{}, interfaces.ErrNotFound)
+		usersService.On("GetUserByEmail", "root@example.com").Return(&interfaces.User{}, interfaces.ErrNotFound)
+
+		data := "username,email,role\n" +
+			"alice,alice@example.com,Admin\n" +
+			"admin,root@example.com,\n" +
+			"alice,not-an-email,wizard\n"
+		rows, err := service.PreviewImport(ctx, interfaces.ImportFormatCSV, []byte(data))
+
+		assert.NoError(t, err)
+		assert.Len(t, rows, 3)
+		assert.Empty(t, rows[0].Errors)
+		assert.Equal(t, interfaces.RoleAdmin, rows[0].Role)
+		assert.Equal(t, 2, rows[0].Line)
+		assert.Equal(t, []string{"username already exists"}, rows[1].Errors)
+		assert.Equal(t, interfaces.RoleUser, rows[1].Role)
+		assert.Len(t, rows[2].Errors, 3)
+	})
+
+	t.Run("rejects csv without required columns", func(t *testing.T) {
+		service := NewUserBulkService(new(MockUsersService), nil, nil, nil)
+
+		_, err := service.PreviewImport(ctx, interfaces.ImportFormatCSV, []byte("username,role\nalice,user\n"))
+
+		assert.Error(t, err)
+	})
+}
+
+func TestApplyImport(t *testing.T) {
+	ctx := context.Background()
+	t.Run("creates users with temporary passwords", func(t *testing.T) {
+		usersService := new(MockUsersService)
+		passwordService := new(MockPasswordService)
+		service := NewUserBulkService(usersService, passwordService, nil, &fakeTransactions{})
+		usersService.On("GetUserByUsername", "alice").Return(&interfaces.User{}, interfaces.ErrNotFound)
+		usersService.On("GetUserByEmail", "alice@example.com").Return(&interfaces.User{}, interfaces.ErrNotFound)
+		passwordService.On("Hash", mock.Anything).Return("hash", nil)
+		usersService.On("CreateUsers", mock.MatchedBy(func(users []*interfaces.User) bool {
+			return len(users) == 1 && users[0].Username == "alice" && users[0].PasswordHash == "hash"
+		})).Return(nil)
+
+		rows, err := service.ApplyImport(ctx, interfaces.ImportFormatJSON, []byte(`[{"username":"alice","email":"alice@example.com"}]`), interfaces.ImportModeTemporaryPassword)
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, rows[0].TemporaryPassword)
+		usersService.AssertExpectations(t)
+	})
+
+	t.Run("creates nothing when a row is invalid", func(t *testing.T) {
+		usersService := new(MockUsersService)
+		service := NewUserBulkService(usersService, nil, nil, nil)
+		usersService.On("GetUserByEmail", "alice@example.com").Return(&interfaces.User{}, interfaces.ErrNotFound)
+
+		rows, err := service.ApplyImport(ctx, interfaces.ImportFormatJSON, []byte(`[{"username":"","email":"alice@example.com"}]`), interfaces.ImportModeTemporaryPassword)
+
+		assert.ErrorIs(t, err, interfaces.ErrImportInvalid)
+		assert.NotEmpty(t, rows[0].Errors)
+		usersService.AssertNotCalled(t, "CreateUsers", mock.Anything)
+	})
+
+	t.Run("rolls the users back when an invitation cannot be issued", func(t *testing.T) {
+		usersService := new(MockUsersService)
+		passwordService := new(MockPasswordService)
+		tokenService := new(MockTokenService)
+		transactions := &fakeTransactions{}
+		service := NewUserBulkService(usersService, passwordService, tokenService, transactions)
+		usersService.On("GetUserByUsername", mock.Anything).Return(&interfaces.User{}, interfaces.ErrNotFound)
+		usersService.On("GetUserByEmail", mock.Anything).Return(&interfaces.User{}, interfaces.ErrNotFound)
+		passwordService.On("Hash", mock.Anything).Return("hash", nil)
+		usersService.On("CreateUsers", mock.Anything).Run(func(args mock.Arguments) {
+			for i, user := range args.Get(0).([]*interfaces.User) {
+				user.ID = uint(i + 1)
+			}
+		}).Return(nil)
+		tokenService.On("Issue", uint(1), interfaces.TokenPurposeInvitation).Return("token", nil)
+		tokenService.On("Issue", uint(2), interfaces.TokenPurposeInvitation).Return("", assert.AnError)
+
+		rows, err := service.ApplyImport(ctx, interfaces.ImportFormatJSON, []byte(`[
+			{"username":"alice","email":"alice@example.com"},
+			{"username":"bob","email":"bob@example.com"}
+		]`), interfaces.ImportModeInvitation)
+
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Nil(t, rows)
+		assert.Equal(t, []error{assert.AnError}, transactions.outcomes, "the users and invitations are created in one transaction that is rolled back")
+	})
+}
+
+func TestExportUsers(t *testing.T) {
+	ctx := context.Background()
+	usersService := new(MockUsersService)
+	service := NewUserBulkService(usersService, nil, nil, nil)
+	usersService.On("ForEachUser", mock.Anything).Return([]interfaces.User{
+		{ID: 1, Username: "admin", Email: "admin@localhost", Role: "admin", PasswordHash: "secret"},
+		{ID: 2, Username: "alice", Email: "alice@example.com", Role: "user", PasswordHash: "secret"},
+	}, nil)
+
+	var out bytes.Buffer
+	err := service.ExportUsers(ctx, interfaces.ImportFormatJSON, &out)
+
+	assert.NoError(t, err)
+	assert.NotContains(t, out.String(), "secret")
+	var exported []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &exported))
+	assert.Len(t, exported, 2)
+}
+
+func TestExportUsersEscapesFormulas(t *testing.T) {
+	ctx := context.Background()
+	usersService := new(MockUsersService)
+	service := NewUserBulkService(usersService, nil, nil, nil)
+	usersService.On("ForEachUser", mock.Anything).Return([]interfaces.User{
+		{ID: 1, Username: "=HYPERLINK(\"http://evil\")", Email: "+1@example.com", Role: "user"},
+		{ID: 2, Username: "-2", Email: "@sum", Role: "user"},
+		{ID: 3, Username: "alice", Email: "alice=1@example.com", Role: "user"},
+	}, nil)
+
+	var out bytes.Buffer
+	err := service.ExportUsers(ctx, interfaces.ImportFormatCSV, &out)
+
+	assert.NoError(t, err)
+	records, err := csv.NewReader(&out).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"id", "username", "email", "role"},
+		{"1", "'=HYPERLINK(\"http://evil\")", "'+1@example.com", "user"},
+		{"2", "'-2", "'@sum", "user"},
+		{"3", "alice", "alice=1@example.com", "user"},
+	}, records)
+}
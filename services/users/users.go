@@ -1,6 +1,12 @@
 package users
 
-import "github.com/bryopsida/gofiber-pug-starter/interfaces"
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
 
 type usersService struct {
 	repo interfaces.IUserRepository
@@ -10,22 +16,77 @@ func NewUsersService(repo interfaces.IUserRepository) *usersService {
 	return &usersService{repo: repo}
 }
 
-func (s *usersService) CreateUser(user *interfaces.User) error {
-	return s.repo.CreateUser(user)
+func (s *usersService) CreateUser(ctx context.Context, user *interfaces.User) error {
+	return s.repo.CreateUser(ctx, user)
+}
+
+func (s *usersService) CreateUsers(ctx context.Context, users []*interfaces.User) error {
+	return s.repo.CreateUsers(ctx, users)
+}
+
+func (s *usersService) GetUserByID(ctx context.Context, id uint) (*interfaces.User, error) {
+	return s.repo.GetUserByID(ctx, id)
+}
+
+func (s *usersService) GetUserByUsername(ctx context.Context, username string) (*interfaces.User, error) {
+	return s.repo.GetUserByUsername(ctx, username)
+}
+
+func (s *usersService) GetUserByEmail(ctx context.Context, email string) (*interfaces.User, error) {
+	return s.repo.GetUserByEmail(ctx, email)
+}
+
+func (s *usersService) ForEachUser(ctx context.Context, fn func(user *interfaces.User) error) error {
+	return s.repo.ForEachUser(ctx, fn)
+}
+
+func (s *usersService) UpdateUser(ctx context.Context, user *interfaces.User) error {
+	return s.repo.UpdateUser(ctx, user)
+}
+
+func (s *usersService) DeleteUser(ctx context.Context, id uint) error {
+	return s.repo.DeleteUser(ctx, id)
+}
+
+func (s *usersService) GetUsersDueForDeletion(ctx context.Context, before time.Time) ([]*interfaces.User, error) {
+	return s.repo.GetUsersDueForDeletion(ctx, before)
 }
 
-func (s *usersService) GetUserByID(id uint) (*interfaces.User, error) {
-	return s.repo.GetUserByID(id)
+// exportedProfile is the profile included in a personal data export, it intentionally omits the password hash
+type exportedProfile struct {
+	ID          uint       `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	FirstName   string     `json:"first_name"`
+	LastName    string     `json:"last_name"`
+	DeleteAfter *time.Time `json:"delete_after,omitempty"`
 }
 
-func (s *usersService) GetUserByUsername(username string) (*interfaces.User, error) {
-	return s.repo.GetUserByUsername(username)
+func (s *usersService) PersonalDataName() string {
+	return "profile"
 }
 
-func (s *usersService) UpdateUser(user *interfaces.User) error {
-	return s.repo.UpdateUser(user)
+func (s *usersService) ExportPersonalData(ctx context.Context, userID uint) ([]interfaces.PersonalDataFile, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.MarshalIndent(exportedProfile{
+		ID:          user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		Role:        user.Role,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		DeleteAfter: user.DeleteAfter,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []interfaces.PersonalDataFile{{Name: "profile.json", Content: content}}, nil
 }
 
-func (s *usersService) DeleteUser(id uint) error {
-	return s.repo.DeleteUser(id)
+func (s *usersService) ErasePersonalData(ctx context.Context, userID uint) error {
+	return s.repo.DeleteUser(ctx, userID)
 }
@@ -0,0 +1,93 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+)
+
+// filesystemStorage stores blobs as files below a root directory
+type filesystemStorage struct {
+	root string
+}
+
+// NewFilesystemStorage creates a new filesystemStorage instance
+// - root: the directory blobs are stored in, created when missing
+func NewFilesystemStorage(root string) interfaces.IBlobStorage {
+	return &filesystemStorage{root: root}
+}
+
+// resolve maps a key to a path, rejecting keys that would escape the root
+func (s *filesystemStorage) resolve(key string) (string, error) {
+	if key == "" || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *filesystemStorage) Put(key string, r io.Reader) error {
+	path, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	// write to a temporary file and rename so readers never see a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *filesystemStorage) Open(key string) (io.ReadCloser, *interfaces.BlobInfo, error) {
+	path, err := s.resolve(key)
+	if err != nil {
+		return nil, nil, interfaces.ErrNotFound
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, interfaces.ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, &interfaces.BlobInfo{Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (s *filesystemStorage) Delete(key string) error {
+	path, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package filesystem
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bryopsida/gofiber-pug-starter/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutOpenDelete(t *testing.T) {
+	storage := NewFilesystemStorage(t.TempDir())
+
+	err := storage.Put("avatars/1.png", strings.NewReader("content"))
+	assert.NoError(t, err)
+
+	reader, info, err := storage.Open("avatars/1.png")
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, "content", string(content))
+	assert.Equal(t, int64(7), info.Size)
+
+	assert.NoError(t, storage.Delete("avatars/1.png"))
+	assert.NoError(t, storage.Delete("avatars/1.png"))
+	_, _, err = storage.Open("avatars/1.png")
+	assert.ErrorIs(t, err, interfaces.ErrNotFound)
+}
+
+func TestRejectsKeysOutsideRoot(t *testing.T) {
+	storage := NewFilesystemStorage(t.TempDir())
+
+	for _, key := range []string{"", "../escape", "avatars/../../escape", "/absolute", "avatars//double"} {
+		assert.Error(t, storage.Put(key, strings.NewReader("content")), key)
+	}
+}